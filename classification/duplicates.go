@@ -0,0 +1,194 @@
+package classification
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"bitbucket.org/kleinnic74/photos/domain"
+	"bitbucket.org/kleinnic74/photos/library"
+	"bitbucket.org/kleinnic74/photos/library/boltstore"
+	"bitbucket.org/kleinnic74/photos/logging"
+	"bitbucket.org/kleinnic74/photos/tasks"
+	"go.uber.org/zap"
+)
+
+// DefaultDuplicateThreshold is the maximum Hamming distance between the perceptual hashes
+// of two photos considered duplicates
+const DefaultDuplicateThreshold = 6
+
+// PerceptualHasher computes the perceptual hashes of photos and finds near-duplicates
+type PerceptualHasher struct {
+	index *boltstore.PHashIndex
+}
+
+func NewPerceptualHasher(index *boltstore.PHashIndex) *PerceptualHasher {
+	return &PerceptualHasher{index: index}
+}
+
+// RegisterTasks registers the task computing the perceptual hash of a photo
+func (h *PerceptualHasher) RegisterTasks(repo *tasks.TaskRepository) {
+	repo.Register("perceptualHash", func() tasks.Task {
+		return &hashPhotoTask{index: h.index}
+	})
+}
+
+// HashPhotoOnAdd returns the task computing the perceptual hash of a new picture, videos are not hashed
+func (h *PerceptualHasher) HashPhotoOnAdd(ctx context.Context, p *library.Photo) (tasks.Task, bool) {
+	if p.Format.Type() != domain.Picture {
+		return nil, false
+	}
+	return &hashPhotoTask{index: h.index, PhotoID: p.ID}, true
+}
+
+// FindDuplicates returns the groups of photos whose perceptual hashes differ by at most threshold bits
+func (h *PerceptualHasher) FindDuplicates(ctx context.Context, threshold int) ([][]library.PhotoID, error) {
+	hashes, err := h.index.All(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return ClusterByHash(hashes, threshold), nil
+}
+
+type hashPhotoTask struct {
+	index   *boltstore.PHashIndex
+	PhotoID library.PhotoID `json:"photoID"`
+}
+
+func (t *hashPhotoTask) Describe() string {
+	return fmt.Sprintf("Computing perceptual hash of photo %s", t.PhotoID)
+}
+
+func (t *hashPhotoTask) Execute(ctx context.Context, executor tasks.TaskExecutor, lib library.PhotoLibrary) error {
+	log, ctx := logging.FromWithNameAndFields(ctx, "phash", zap.String("photo", string(t.PhotoID)))
+	content, photo, err := lib.OpenContent(ctx, t.PhotoID)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+	img, err := photo.Format.Decode(content)
+	if err != nil {
+		return err
+	}
+	hash := domain.DHash(img, photo.Orientation)
+	log.Debug("Perceptual hash computed", zap.Stringer("phash", hash))
+	return t.index.Set(ctx, t.PhotoID, hash)
+}
+
+// ClusterByHash groups photos whose hashes are within the given Hamming distance. Grouping is
+// transitive, each photo of a cluster is close to at least one other photo of the cluster.
+// Clusters are sorted by their first photo ID, photos within a cluster by ID
+func ClusterByHash(hashes map[library.PhotoID]domain.PerceptualHash, threshold int) [][]library.PhotoID {
+	ids := make([]library.PhotoID, 0, len(hashes))
+	for id := range hashes {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	tree := &bkTree{}
+	for i, id := range ids {
+		tree.add(hashes[id], i)
+	}
+	clusters := newUnionFind(len(ids))
+	for i, id := range ids {
+		tree.find(hashes[id], threshold, func(j int) {
+			clusters.union(i, j)
+		})
+	}
+	groups := make(map[int][]library.PhotoID)
+	for i, id := range ids {
+		root := clusters.find(i)
+		groups[root] = append(groups[root], id)
+	}
+	result := make([][]library.PhotoID, 0)
+	for _, g := range groups {
+		if len(g) > 1 {
+			result = append(result, g)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i][0] < result[j][0] })
+	return result
+}
+
+// bkTree is a Burkhard-Keller tree indexing perceptual hashes by their Hamming distance
+type bkTree struct {
+	root *bkNode
+}
+
+type bkNode struct {
+	hash     domain.PerceptualHash
+	items    []int
+	children map[int]*bkNode
+}
+
+func (t *bkTree) add(hash domain.PerceptualHash, item int) {
+	if t.root == nil {
+		t.root = &bkNode{hash: hash, items: []int{item}}
+		return
+	}
+	n := t.root
+	for {
+		d := n.hash.Distance(hash)
+		if d == 0 {
+			n.items = append(n.items, item)
+			return
+		}
+		child, found := n.children[d]
+		if !found {
+			if n.children == nil {
+				n.children = make(map[int]*bkNode)
+			}
+			n.children[d] = &bkNode{hash: hash, items: []int{item}}
+			return
+		}
+		n = child
+	}
+}
+
+// find calls f for all items whose hash is within maxDistance of the given hash
+func (t *bkTree) find(hash domain.PerceptualHash, maxDistance int, f func(int)) {
+	if t.root == nil {
+		return
+	}
+	stack := []*bkNode{t.root}
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		d := n.hash.Distance(hash)
+		if d <= maxDistance {
+			for _, item := range n.items {
+				f(item)
+			}
+		}
+		for childDistance, child := range n.children {
+			if childDistance >= d-maxDistance && childDistance <= d+maxDistance {
+				stack = append(stack, child)
+			}
+		}
+	}
+}
+
+type unionFind []int
+
+func newUnionFind(n int) unionFind {
+	u := make(unionFind, n)
+	for i := range u {
+		u[i] = i
+	}
+	return u
+}
+
+func (u unionFind) find(i int) int {
+	for u[i] != i {
+		u[i] = u[u[i]]
+		i = u[i]
+	}
+	return i
+}
+
+func (u unionFind) union(i, j int) {
+	ri, rj := u.find(i), u.find(j)
+	if ri != rj {
+		u[rj] = ri
+	}
+}
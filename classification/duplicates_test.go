@@ -0,0 +1,32 @@
+package classification_test
+
+import (
+	"testing"
+
+	"bitbucket.org/kleinnic74/photos/classification"
+	"bitbucket.org/kleinnic74/photos/domain"
+	"bitbucket.org/kleinnic74/photos/library"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClusterByHash(t *testing.T) {
+	hashes := map[library.PhotoID]domain.PerceptualHash{
+		"a": 0xF0F0F0F0F0F0F0F0,
+		"b": 0xF0F0F0F0F0F0F0F1, // 1 bit from a
+		"c": 0xF0F0F0F0F0F0F0F7, // 2 bits from b, 3 bits from a
+		"d": 0x0F0F0F0F0F0F0F0F,
+		"e": 0x0F0F0F0F0F0F0F0F, // identical to d
+		"f": 0xFFFF0000FFFF0000,
+	}
+	data := []struct {
+		threshold int
+		expected  [][]library.PhotoID
+	}{
+		{0, [][]library.PhotoID{{"d", "e"}}},
+		{1, [][]library.PhotoID{{"a", "b"}, {"d", "e"}}},
+		{2, [][]library.PhotoID{{"a", "b", "c"}, {"d", "e"}}},
+	}
+	for _, d := range data {
+		assert.Equal(t, d.expected, classification.ClusterByHash(hashes, d.threshold), "threshold %d", d.threshold)
+	}
+}
@@ -0,0 +1,212 @@
+package classification
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"bitbucket.org/kleinnic74/photos/consts"
+	"bitbucket.org/kleinnic74/photos/domain"
+	"bitbucket.org/kleinnic74/photos/library"
+	"bitbucket.org/kleinnic74/photos/library/boltstore"
+	"bitbucket.org/kleinnic74/photos/logging"
+	"bitbucket.org/kleinnic74/photos/tasks"
+	"go.uber.org/zap"
+)
+
+// DefaultBurstGap is the maximum time between two photos of a burst
+const DefaultBurstGap = time.Second
+
+// editedSuffix matches the suffixes added to the name of an original by editing tools,
+// e.g. IMG_1234-edited.jpg, IMG_1234 (Edited).jpg or IMG_1234_edit-2.jpg
+var editedSuffix = regexp.MustCompile(`(?i)(?:[ _-]+\(?|\()(?:edited|edit|bearbeitet)(?:[ _-]*\d+)?\)?(?:[ _-]*\d+)?$`)
+
+// StackDetector groups RAW+JPEG pairs, bursts and edited versions into stacks
+type StackDetector struct {
+	index *boltstore.StackIndex
+}
+
+func NewStackDetector(index *boltstore.StackIndex) *StackDetector {
+	return &StackDetector{index: index}
+}
+
+// RegisterTasks registers the task detecting stacks over the whole library
+func (d *StackDetector) RegisterTasks(repo *tasks.TaskRepository) {
+	repo.RegisterWithProperties("detectStacks", func() tasks.Task {
+		return &detectStacksTask{index: d.index}
+	}, tasks.TaskProperties{
+		UserRunnable: true,
+	})
+}
+
+type detectStacksTask struct {
+	index *boltstore.StackIndex
+}
+
+func (t *detectStacksTask) Describe() string {
+	return "Detecting stacks of photos"
+}
+
+// Execute creates stacks for photos which are not stacked yet, existing stacks are not
+// changed so that stacks edited by the user are kept
+func (t *detectStacksTask) Execute(ctx context.Context, executor tasks.TaskExecutor, lib library.PhotoLibrary) error {
+	log, ctx := logging.SubFrom(ctx, "stacks")
+	photos, err := lib.FindAll(ctx, consts.Ascending)
+	if err != nil {
+		return err
+	}
+	stacked, err := t.index.Memberships(ctx)
+	if err != nil {
+		return err
+	}
+	unstacked := make([]*library.Photo, 0, len(photos))
+	for _, p := range photos {
+		if _, found := stacked[p.ID]; !found {
+			unstacked = append(unstacked, p)
+		}
+	}
+	stacks := FindStacks(unstacked, DefaultBurstGap)
+	for _, s := range stacks {
+		if _, err := t.index.Create(ctx, s.Kind, s.Photos, s.Representative); err != nil {
+			return err
+		}
+	}
+	log.Info("Stacks detected", zap.Int("photos", len(unstacked)), zap.Int("stacks", len(stacks)))
+	return nil
+}
+
+// FindStacks groups the given photos, which must be sorted by date, into stacks:
+// RAW files and JPEGs with the same name and date, originals and their edited versions
+// and bursts of photos taken by the same camera less than burstGap apart.
+// A photo is part of at most one stack, the IDs of stacks are not set
+func FindStacks(photos []*library.Photo, burstGap time.Duration) []boltstore.Stack {
+	var stacks []boltstore.Stack
+	used := make(map[library.PhotoID]bool)
+	add := func(kind boltstore.StackKind, group []*library.Photo, representative *library.Photo) {
+		s := boltstore.Stack{Kind: kind, Representative: representative.ID}
+		for _, p := range group {
+			s.Photos = append(s.Photos, p.ID)
+			used[p.ID] = true
+		}
+		stacks = append(stacks, s)
+	}
+	for _, group := range groupBy(photos, used, func(p *library.Photo) string { return baseName(p.Name()) }) {
+		if jpeg, ok := rawJPEGRepresentative(group); ok {
+			add(boltstore.RawJPEGStack, group, jpeg)
+		}
+	}
+	for _, group := range groupBy(photos, used, func(p *library.Photo) string { return originalName(p.Name()) }) {
+		if edit, ok := editedRepresentative(group); ok {
+			add(boltstore.EditedStack, group, edit)
+		}
+	}
+	for _, group := range findBursts(photos, used, burstGap) {
+		add(boltstore.BurstStack, group, burstRepresentative(group))
+	}
+	return stacks
+}
+
+// groupBy groups unused pictures with the same date taken, to the second, and key.
+// Groups are returned in the order of their first photo
+func groupBy(photos []*library.Photo, used map[library.PhotoID]bool, key func(*library.Photo) string) [][]*library.Photo {
+	var keys []string
+	groups := make(map[string][]*library.Photo)
+	for _, p := range photos {
+		if used[p.ID] || p.Format.Type() != domain.Picture || p.Name() == "" {
+			continue
+		}
+		k := fmt.Sprintf("%d/%s", p.DateTaken.Unix(), key(p))
+		if _, found := groups[k]; !found {
+			keys = append(keys, k)
+		}
+		groups[k] = append(groups[k], p)
+	}
+	result := make([][]*library.Photo, 0)
+	for _, k := range keys {
+		if len(groups[k]) > 1 {
+			result = append(result, groups[k])
+		}
+	}
+	return result
+}
+
+// rawJPEGRepresentative returns the JPEG of a group made of RAW files and a JPEG
+func rawJPEGRepresentative(group []*library.Photo) (jpeg *library.Photo, ok bool) {
+	raws := 0
+	for _, p := range group {
+		if p.Format.HasPreview() {
+			raws++
+		} else {
+			jpeg = p
+		}
+	}
+	return jpeg, raws > 0 && raws == len(group)-1
+}
+
+// editedRepresentative returns the first edit of a group made of an original and its
+// edited versions
+func editedRepresentative(group []*library.Photo) (edit *library.Photo, ok bool) {
+	originals := 0
+	for _, p := range group {
+		if baseName(p.Name()) == originalName(p.Name()) {
+			originals++
+		} else if edit == nil {
+			edit = p
+		}
+	}
+	return edit, originals == 1
+}
+
+// findBursts returns the sequences of unused pictures taken by the same camera with less
+// than burstGap between two consecutive pictures
+func findBursts(photos []*library.Photo, used map[library.PhotoID]bool, burstGap time.Duration) [][]*library.Photo {
+	var cameras []string
+	sequences := make(map[string][]*library.Photo)
+	var bursts [][]*library.Photo
+	flush := func(camera string) {
+		if seq := sequences[camera]; len(seq) > 1 {
+			bursts = append(bursts, seq)
+		}
+		sequences[camera] = nil
+	}
+	for _, p := range photos {
+		if used[p.ID] || p.Format.Type() != domain.Picture || p.Camera == nil || p.Camera.Name() == "" {
+			continue
+		}
+		camera := p.Camera.Name()
+		seq, found := sequences[camera]
+		if !found {
+			cameras = append(cameras, camera)
+		}
+		if len(seq) > 0 && p.DateTaken.Sub(seq[len(seq)-1].DateTaken) >= burstGap {
+			flush(camera)
+		}
+		sequences[camera] = append(sequences[camera], p)
+	}
+	for _, camera := range cameras {
+		flush(camera)
+	}
+	return bursts
+}
+
+// burstRepresentative returns the best rated photo of a burst, the first one if none is rated
+func burstRepresentative(burst []*library.Photo) *library.Photo {
+	best := burst[0]
+	for _, p := range burst[1:] {
+		if p.Rating > best.Rating {
+			best = p
+		}
+	}
+	return best
+}
+
+func baseName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, filepath.Ext(name)))
+}
+
+func originalName(name string) string {
+	return editedSuffix.ReplaceAllString(baseName(name), "")
+}
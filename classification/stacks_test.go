@@ -0,0 +1,53 @@
+package classification_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"bitbucket.org/kleinnic74/photos/classification"
+	"bitbucket.org/kleinnic74/photos/domain"
+	"bitbucket.org/kleinnic74/photos/library"
+	"bitbucket.org/kleinnic74/photos/library/boltstore"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindStacks(t *testing.T) {
+	start := time.Date(2020, 7, 14, 10, 0, 0, 0, time.UTC)
+	canon := &domain.CameraMetaData{Make: "Canon", Model: "Canon EOS 40D"}
+	nikon := &domain.CameraMetaData{Make: "NIKON CORPORATION", Model: "D750"}
+	photo := func(id, name string, offset time.Duration, camera *domain.CameraMetaData) *library.Photo {
+		ext := strings.ToLower(filepath.Ext(name)[1:])
+		return &library.Photo{
+			ExtendedPhotoID: library.ExtendedPhotoID{ID: library.PhotoID(id)},
+			PhotoMeta: library.PhotoMeta{
+				Name:      name,
+				Format:    domain.MustFormatForExt(ext),
+				DateTaken: start.Add(offset),
+				Camera:    camera,
+			},
+		}
+	}
+	photos := []*library.Photo{
+		photo("raw", "IMG_0001.CR2", 0, canon),
+		photo("jpeg", "IMG_0001.JPG", 0, canon),
+		photo("original", "DSC_0002.jpg", time.Minute, nil),
+		photo("edit1", "DSC_0002-edited.jpg", time.Minute, nil),
+		photo("edit2", "DSC_0002 (Edited 2).jpg", time.Minute, nil),
+		photo("burst1", "IMG_0003.JPG", 2*time.Minute, canon),
+		photo("other", "DSC_0004.JPG", 2*time.Minute+100*time.Millisecond, nikon),
+		photo("burst2", "IMG_0004.JPG", 2*time.Minute+200*time.Millisecond, canon),
+		photo("burst3", "IMG_0005.JPG", 2*time.Minute+900*time.Millisecond, canon),
+		photo("single", "IMG_0006.JPG", 3*time.Minute, canon),
+		photo("credit", "IMG_credit.JPG", 4*time.Minute, nil),
+		photo("cr", "IMG_cr.JPG", 4*time.Minute, nil),
+	}
+	photos[8].Rating = 3
+	stacks := classification.FindStacks(photos, classification.DefaultBurstGap)
+	assert.Equal(t, []boltstore.Stack{
+		{Kind: boltstore.RawJPEGStack, Representative: "jpeg", Photos: []library.PhotoID{"raw", "jpeg"}},
+		{Kind: boltstore.EditedStack, Representative: "edit1", Photos: []library.PhotoID{"original", "edit1", "edit2"}},
+		{Kind: boltstore.BurstStack, Representative: "burst3", Photos: []library.PhotoID{"burst1", "burst2", "burst3"}},
+	}, stacks)
+}
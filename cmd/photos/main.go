@@ -2,6 +2,7 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"flag"
 	"fmt"
@@ -21,6 +22,7 @@ import (
 	"bitbucket.org/kleinnic74/photos/consts"
 	"bitbucket.org/kleinnic74/photos/domain"
 	"bitbucket.org/kleinnic74/photos/events"
+	"bitbucket.org/kleinnic74/photos/export"
 	"bitbucket.org/kleinnic74/photos/geocoding"
 	"bitbucket.org/kleinnic74/photos/geocoding/openstreetmap"
 	"bitbucket.org/kleinnic74/photos/importer"
@@ -28,8 +30,10 @@ import (
 	"bitbucket.org/kleinnic74/photos/library"
 	"bitbucket.org/kleinnic74/photos/library/boltstore"
 	"bitbucket.org/kleinnic74/photos/logging"
+	"bitbucket.org/kleinnic74/photos/maintenance"
 	"bitbucket.org/kleinnic74/photos/rest"
 	"bitbucket.org/kleinnic74/photos/rest/wdav"
+	"bitbucket.org/kleinnic74/photos/search"
 	"bitbucket.org/kleinnic74/photos/swarm"
 	"bitbucket.org/kleinnic74/photos/tasks"
 	"github.com/kleinnic74/fflags"
@@ -38,9 +42,15 @@ import (
 var (
 	dbName = "photos.db"
 
-	libDir string
-	uiDir  string
-	port   uint
+	libDir       string
+	storeBackend string
+	uiDir        string
+	port         uint
+
+	trashRetention time.Duration
+	viewCacheSize  int64
+	thumbSizes     string
+	thumbQuality   int
 
 	logger *zap.Logger
 	ctx    context.Context
@@ -57,6 +67,11 @@ func init() {
 	flag.StringVar(&libDir, "l", "gophotos", "Path to photo library")
 	flag.StringVar(&uiDir, "ui", "", "Path to the frontend static assets")
 	flag.UintVar(&port, "p", 8080, "HTTP server port")
+	flag.StringVar(&storeBackend, "store", boltBackend, "Database of the photos, dates, places and indexing states: bolt or sqlite")
+	flag.DurationVar(&trashRetention, "trash-retention", maintenance.DefaultTrashRetention, "Time trashed photos are kept before being purged")
+	flag.Int64Var(&viewCacheSize, "view-cache", library.DefaultViewCacheSize, "Maximum size in bytes of the cached resized photos")
+	flag.StringVar(&thumbSizes, "thumb-sizes", "", "Additional thumb sizes as name:width[:square],...")
+	flag.IntVar(&thumbQuality, "thumb-quality", domain.DefaultThumbQuality, "JPEG quality of thumbs")
 	logger, ctx = logging.SubFrom(context.Background(), "main")
 
 	flag.Parse()
@@ -104,21 +119,28 @@ func main() {
 	taskRepo := tasks.NewTaskRepository()
 	tasks.RegisterTasks(taskRepo)
 	importer.RegisterTasks(taskRepo)
+	maintenance.RegisterTasks(taskRepo, trashRetention)
 
 	migrator, err := index.NewMigrationCoordinator(db)
 	if err != nil {
 		logger.Fatal("Failed to initialize migration coordinator", zap.Error(err))
 	}
 
-	indexTracker, err := boltstore.NewIndexTracker(db)
+	stores, err := openStores(storeBackend, db, taskRepo)
 	if err != nil {
-		logger.Fatal("Failed to initialize library", zap.Error(err))
+		logger.Fatal("Failed to initialize library", zap.String("store", storeBackend), zap.Error(err))
 	}
+	defer func() {
+		stores.close()
+		logger.Info("Closed store", zap.String("store", storeBackend))
+	}()
+	indexTracker, store := stores.indexTracker, stores.store
 
-	store, err := boltstore.NewBoltStore(db)
+	sizes, err := domain.ParseThumbSizes(thumbSizes)
 	if err != nil {
-		logger.Fatal("Failed to initialize library", zap.Error(err))
+		logger.Fatal("Invalid thumb sizes", zap.Error(err))
 	}
+	domain.AddThumbSizes(sizes...)
 
 	thumbers := &domain.Thumbers{}
 	nbParallelThumbers := domain.CalculateOptimumParallelism()
@@ -129,35 +151,113 @@ func main() {
 	if err != nil {
 		logger.Fatal("Failed to initialize library", zap.Error(err))
 	}
+	lib.SetThumbQuality(thumbQuality)
 	logger.Info("Opened photo library", zap.String("path", libDir))
 	migrator.AddInstances(lib)
 
-	geoindex, err := boltstore.NewBoltGeoIndex(db)
-	if err != nil {
-		logger.Fatal("Failed to initialize geoindex", zap.Error(err))
-	}
+	checker := maintenance.NewIntegrityChecker(lib)
+	checker.RegisterTasks(taskRepo)
+	integrity := rest.NewIntegrityHandler(checker)
+	integrity.InitRoutes(router)
+
+	sidecars := maintenance.NewSidecarWriter(lib)
+	sidecars.RegisterTasks(taskRepo)
+
+	thumbGenerator := maintenance.NewThumbGenerator(lib)
+	thumbGenerator.RegisterTasks(taskRepo)
+
+	geoindex := stores.geoindex
 	migrator.AddStructure("geo", geoindex)
 
 	geocoder := geocoding.NewGeocoder(geoindex, openstreetmap.NewResolver("de,en"))
 	geocoder.RegisterTasks(taskRepo)
 
-	dateindex, err := boltstore.NewDateIndex(db)
-	if err != nil {
-		logger.Fatal("Failed to initialize dataindex", zap.Error(err))
-	}
+	dateindex := stores.dateindex
 	migrator.AddStructure("date", dateindex)
 
+	exporter := export.NewExporter(lib, dateindex, geoindex)
+	exporter.RegisterTasks(taskRepo)
+	exports := rest.NewExportHandler(exporter)
+	exports.InitRoutes(router)
+
 	fflags.IfEnabled(eventFeature, func() error {
 		eventindex, err := boltstore.NewEventIndex(db)
 		if err != nil {
 			return fmt.Errorf("Failed to initialize event database: %w", err)
 		}
 		classification.RegisterTasks(taskRepo, eventindex)
+		exporter.UseEvents(eventindex)
+		lib.AddDeleteCallback(eventindex.RemovePhoto)
+		lib.AddUpdateCallback(func(ctx context.Context, old, updated *library.Photo) error {
+			if old.DateTaken.Equal(updated.DateTaken) {
+				return nil
+			}
+			return eventindex.RemovePhoto(ctx, old)
+		})
 		events := rest.NewEventsHandler(eventindex, lib)
 		events.InitRoutes(router)
 		return nil
 	})
 
+	albumindex, err := boltstore.NewAlbumIndex(db)
+	if err != nil {
+		logger.Fatal("Failed to initialize album index", zap.Error(err))
+	}
+	lib.AddPurgeCallback(albumindex.RemovePhoto)
+	lib.AddTrashCallback(albumindex.TrashPhoto)
+	lib.AddRestoreCallback(albumindex.RestorePhoto)
+	albums := rest.NewAlbumsHandler(albumindex, lib)
+	albums.InitRoutes(router)
+
+	tagindex, err := boltstore.NewTagIndex(db)
+	if err != nil {
+		logger.Fatal("Failed to initialize tag index", zap.Error(err))
+	}
+	lib.AddPurgeCallback(tagindex.RemovePhoto)
+	lib.AddTrashCallback(tagindex.TrashPhoto)
+	lib.AddRestoreCallback(tagindex.RestorePhoto)
+	lib.AddUpdateCallback(tagindex.UpdatePhoto)
+	sidecars.UseTags(tagindex)
+	exporter.UseTags(tagindex)
+	tags := rest.NewTagsHandler(tagindex, lib)
+	tags.InitRoutes(router)
+
+	cameraindex, err := boltstore.NewCameraIndex(db)
+	if err != nil {
+		logger.Fatal("Failed to initialize camera index", zap.Error(err))
+	}
+	// Trashed photos are indexed again when restored
+	lib.AddDeleteCallback(cameraindex.RemovePhoto)
+	lib.AddUpdateCallback(cameraindex.UpdatePhoto)
+	cameras := rest.NewCamerasHandler(cameraindex)
+	cameras.InitRoutes(router)
+
+	phashindex, err := boltstore.NewPHashIndex(db)
+	if err != nil {
+		logger.Fatal("Failed to initialize perceptual hash index", zap.Error(err))
+	}
+	hasher := classification.NewPerceptualHasher(phashindex)
+	hasher.RegisterTasks(taskRepo)
+	duplicates := rest.NewDuplicatesHandler(hasher, lib)
+	duplicates.InitRoutes(router)
+
+	stackindex, err := boltstore.NewStackIndex(db)
+	if err != nil {
+		logger.Fatal("Failed to initialize stack index", zap.Error(err))
+	}
+	lib.AddPurgeCallback(stackindex.RemovePhoto)
+	lib.AddTrashCallback(stackindex.TrashPhoto)
+	lib.AddRestoreCallback(stackindex.RestorePhoto)
+	classification.NewStackDetector(stackindex).RegisterTasks(taskRepo)
+	stacks := rest.NewStacksHandler(stackindex, lib)
+	stacks.InitRoutes(router)
+
+	viewCache, err := library.NewViewCache(filepath.Join(libDir, "tmp", "views"), viewCacheSize)
+	if err != nil {
+		logger.Fatal("Failed to initialize view cache", zap.Error(err))
+	}
+	lib.AddPurgeCallback(viewCache.RemovePhoto)
+
 	bus := events.NewStream()
 	go bus.Dispatch(ctx)
 
@@ -167,9 +267,13 @@ func main() {
 	})
 
 	indexer := index.NewIndexer(indexTracker, executor)
-	indexer.RegisterDirect("date", boltstore.DateIndexVersion, dateindex.Add)
+	indexer.RegisterDirect("date", stores.dateIndexVersion, dateindex.Add)
+	indexer.RegisterDirect("tags", boltstore.TagIndexVersion, tagindex.Add)
+	indexer.RegisterDirect("camera", boltstore.CameraIndexVersion, cameraindex.Add)
+	indexer.RegisterDefered("phash", boltstore.PHashIndexVersion, hasher.HashPhotoOnAdd)
+	indexer.RegisterDefered("thumbs", maintenance.ThumbIndexVersion, thumbGenerator.CreateThumbsOnAdd)
 	fflags.IfEnabled(geoFeature, func() error {
-		indexer.RegisterDefered("geo", boltstore.GeoIndexVersion, geocoder.LookupPhotoOnAdd)
+		indexer.RegisterDefered("geo", stores.geoIndexVersion, geocoder.LookupPhotoOnAdd)
 		return nil
 	})
 
@@ -178,8 +282,55 @@ func main() {
 	RegisterMigrationTask(taskRepo, migrator, indexer)
 
 	lib.AddCallback(indexer.Add)
+	lib.AddDeleteCallback(dateindex.Remove)
+	lib.AddDeleteCallback(func(ctx context.Context, p *library.Photo) error {
+		return geoindex.Remove(ctx, p.ExtendedPhotoID)
+	})
+	lib.AddDeleteCallback(indexer.Remove)
+	lib.AddDeleteCallback(phashindex.RemovePhoto)
+	lib.AddUpdateCallback(func(ctx context.Context, old, updated *library.Photo) error {
+		if old.Orientation == updated.Orientation {
+			return nil
+		}
+		task, needed := hasher.HashPhotoOnAdd(ctx, updated)
+		if !needed {
+			return nil
+		}
+		_, err := executor.Submit(ctx, task)
+		return err
+	})
+	lib.AddUpdateCallback(func(ctx context.Context, old, updated *library.Photo) error {
+		if old.Orientation == updated.Orientation {
+			return nil
+		}
+		// Thumbs were dropped by the library
+		task, _ := thumbGenerator.CreateThumbsOnAdd(ctx, updated)
+		_, err := executor.Submit(ctx, task)
+		return err
+	})
+	lib.AddUpdateCallback(func(ctx context.Context, old, updated *library.Photo) error {
+		if bytes.Equal(old.SortID, updated.SortID) && old.LiveStill == updated.LiveStill {
+			return nil
+		}
+		if err := dateindex.Remove(ctx, old); err != nil {
+			return err
+		}
+		return dateindex.Add(ctx, updated)
+	})
+	fflags.IfEnabled(geoFeature, func() error {
+		lib.AddUpdateCallback(func(ctx context.Context, old, updated *library.Photo) error {
+			task, ok, err := geocoder.LookupPhotoOnUpdate(ctx, old, updated)
+			if err != nil || !ok {
+				return err
+			}
+			_, err = executor.Submit(ctx, task)
+			return err
+		})
+		return nil
+	})
 
 	go launchStartupTasks(ctx, taskRepo, executor)
+	go launchPeriodicTasks(ctx, taskRepo, executor)
 
 	instance, err := NewInstance(ctx, lib.ID, DefaultInstanceProperties()...)
 	if err != nil {
@@ -209,14 +360,21 @@ func main() {
 	sse.InitRoutes(router)
 
 	photoApp := rest.NewApp(lib)
+	photoApp.UseCameraIndex(cameraindex)
+	photoApp.UseStacks(stackindex)
+	photoApp.UseViewCache(viewCache)
 	photoApp.InitRoutes(router)
 
 	timeline := rest.NewTimelineHandler(dateindex, lib)
+	timeline.UseStacks(stackindex)
 	timeline.InitRoutes(router)
 
 	geo := rest.NewGeoHandler(geoindex, lib)
 	geo.InitRoutes(router)
 
+	searchApp := rest.NewSearchHandler(search.NewSearcher(lib, dateindex, geoindex, tagindex))
+	searchApp.InitRoutes(router)
+
 	geocache := rest.NewGeoCacheHandler(geocoder.Cache)
 	geocache.InitRoutes(router)
 
@@ -306,6 +464,34 @@ func launchStartupTasks(ctx context.Context, tasksRepo *tasks.TaskRepository, ex
 	}
 }
 
+func launchPeriodicTasks(ctx context.Context, tasksRepo *tasks.TaskRepository, executor tasks.TaskExecutor) {
+	for _, t := range tasksRepo.DefinedTasks() {
+		if t.RunEvery <= 0 {
+			continue
+		}
+		go func(t tasks.TaskDefinition) {
+			ticker := time.NewTicker(t.RunEvery)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					logging.From(ctx).Debug("Launching periodic task", zap.String("task", t.Name))
+					task, err := tasksRepo.CreateTask(t.Name)
+					if err != nil {
+						logging.From(ctx).Warn("PeriodicTasks", zap.String("task", t.Name), zap.Error(err))
+						continue
+					}
+					if _, err := executor.Submit(ctx, task); err != nil {
+						logging.From(ctx).Warn("PeriodicTasks", zap.String("task", t.Name), zap.Error(err))
+					}
+				}
+			}
+		}(t)
+	}
+}
+
 func backgroundImport(executor tasks.TaskExecutor) wdav.UploadedFunc {
 	return func(ctx context.Context, path string) {
 		task := importer.NewImportFileTaskWithParams(false, path, true)
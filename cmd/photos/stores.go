@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	bolt "go.etcd.io/bbolt"
+
+	"bitbucket.org/kleinnic74/photos/index"
+	"bitbucket.org/kleinnic74/photos/library"
+	"bitbucket.org/kleinnic74/photos/library/boltstore"
+	"bitbucket.org/kleinnic74/photos/library/sqlstore"
+	"bitbucket.org/kleinnic74/photos/tasks"
+)
+
+const (
+	boltBackend   = "bolt"
+	sqliteBackend = "sqlite"
+
+	sqlName = "photos.sqlite"
+)
+
+type dateIndex interface {
+	library.DateIndex
+	index.MigratableStructure
+}
+
+// stores are the meta-data store and the indexes which can be kept in another database than
+// the bolt one holding all other indexes
+type stores struct {
+	store        library.ClosableStore
+	indexTracker index.Tracker
+	dateindex    dateIndex
+	geoindex     library.GeoIndex
+
+	dateIndexVersion library.Version
+	geoIndexVersion  library.Version
+
+	close func() error
+}
+
+// openStores opens the stores of the given backend. The SQLite backend also defines the
+// task copying the stores of the bolt database into SQLite
+func openStores(backend string, db *bolt.DB, repo *tasks.TaskRepository) (s stores, err error) {
+	switch backend {
+	case boltBackend:
+		return openBoltStores(db)
+	case sqliteBackend:
+	default:
+		return s, fmt.Errorf("Unknown store backend %q, expected %s or %s", backend, boltBackend, sqliteBackend)
+	}
+	sqlDB, err := sqlstore.Open(filepath.Join(libDir, sqlName))
+	if err != nil {
+		return
+	}
+	s.close = sqlDB.Close
+	s.dateIndexVersion, s.geoIndexVersion = sqlstore.DateIndexVersion, sqlstore.GeoIndexVersion
+	if s.indexTracker, err = sqlstore.NewIndexTracker(sqlDB); err != nil {
+		return
+	}
+	if s.store, err = sqlstore.NewSQLStore(sqlDB); err != nil {
+		return
+	}
+	if s.geoindex, err = sqlstore.NewSQLGeoIndex(sqlDB); err != nil {
+		return
+	}
+	if s.dateindex, err = sqlstore.NewDateIndex(sqlDB); err != nil {
+		return
+	}
+	from, err := openBoltStores(db)
+	if err != nil {
+		return
+	}
+	copier := sqlstore.NewCopier(sqlstore.Source{Store: from.store, Geo: from.geoindex, Tracker: from.indexTracker}, sqlDB)
+	copier.RegisterTasks(repo)
+	return
+}
+
+func openBoltStores(db *bolt.DB) (s stores, err error) {
+	s.close = func() error { return nil }
+	s.dateIndexVersion, s.geoIndexVersion = boltstore.DateIndexVersion, boltstore.GeoIndexVersion
+	if s.indexTracker, err = boltstore.NewIndexTracker(db); err != nil {
+		return
+	}
+	if s.store, err = boltstore.NewBoltStore(db); err != nil {
+		return
+	}
+	if s.geoindex, err = boltstore.NewBoltGeoIndex(db); err != nil {
+		return
+	}
+	s.dateindex, err = boltstore.NewDateIndex(db)
+	return
+}
@@ -5,6 +5,7 @@ import (
 	"image/draw"
 	"io"
 	"os"
+	"strings"
 	"time"
 
 	"path/filepath"
@@ -68,6 +69,15 @@ func (o Orientation) Apply(src image.Image) image.Image {
 	return image.Image(dst)
 }
 
+// Dimensions returns the dimensions of an image of the given stored dimensions once this
+// orientation is applied
+func (o Orientation) Dimensions(width, height int) (int, int) {
+	if filter, needsTransform := o.Filter(); needsTransform && filter.swapBounds {
+		return height, width
+	}
+	return width, height
+}
+
 func (o Orientation) Filter() (orientationFilter, bool) {
 	i := int(o) - 2
 	switch {
@@ -92,6 +102,60 @@ type MediaMetaData struct {
 	DateTaken   time.Time
 	Location    *gps.Coordinates
 	Orientation Orientation
+	Keywords    []string
+	// Rating is the star rating from 0 to 5
+	Rating int
+	// Video is the technical meta-data of videos, nil for pictures
+	Video *VideoMetaData
+	// Camera is the camera and settings used to take a picture, nil if unknown
+	Camera *CameraMetaData
+	// TimeZoneOffset is the UTC offset in seconds of DateTaken, nil if the time zone is unknown
+	TimeZoneOffset *int
+	// ContentIdentifier is shared by the still image and the video of a Live Photo
+	ContentIdentifier string
+	// Width and Height are the pixel dimensions as displayed, with the orientation or the
+	// rotation of videos applied, 0 if unknown
+	Width, Height int
+}
+
+// CameraMetaData contains the camera, its settings and the size of a picture as found in
+// its EXIF data
+type CameraMetaData struct {
+	Make  string `json:"make,omitempty"`
+	Model string `json:"model,omitempty"`
+	Lens  string `json:"lens,omitempty"`
+	// FocalLength is in millimeters
+	FocalLength float64 `json:"focalLength,omitempty"`
+	// Aperture is the f-number
+	Aperture float64 `json:"aperture,omitempty"`
+	// ExposureTime is in seconds
+	ExposureTime float64 `json:"exposureTime,omitempty"`
+	ISO          int     `json:"iso,omitempty"`
+	Flash        bool    `json:"flash,omitempty"`
+	Width        int     `json:"width,omitempty"`
+	Height       int     `json:"height,omitempty"`
+}
+
+// Name returns the name of the camera made of its make and model, most models
+// already start with the make
+func (c *CameraMetaData) Name() string {
+	switch {
+	case c.Model == "":
+		return c.Make
+	case c.Make == "" || strings.HasPrefix(strings.ToLower(c.Model), strings.ToLower(c.Make)):
+		return c.Model
+	}
+	return c.Make + " " + c.Model
+}
+
+// VideoMetaData contains the technical meta-information of a video
+type VideoMetaData struct {
+	Duration time.Duration `json:"duration"`
+	Width    int           `json:"width,omitempty"`
+	Height   int           `json:"height,omitempty"`
+	Codec    string        `json:"codec,omitempty"`
+	// Rotation is the clockwise rotation in degrees to apply when displaying the video
+	Rotation int `json:"rotation,omitempty"`
 }
 
 // Photo represents one image in a media library
@@ -104,8 +168,17 @@ type Photo interface {
 	Image() (image.Image, error)
 
 	DateTaken() time.Time
+	TimeZoneOffset() *int
 	Location() *gps.Coordinates
 	Orientation() Orientation
+	Keywords() []string
+	Rating() int
+	Video() *VideoMetaData
+	Camera() *CameraMetaData
+	ContentIdentifier() string
+	// Width and Height are the pixel dimensions as displayed, 0 if unknown
+	Width() int
+	Height() int
 }
 
 type photoFile struct {
@@ -113,9 +186,17 @@ type photoFile struct {
 	path        string
 	size        int64
 	dateTaken   time.Time
+	tzOffset    *int
 	format      FormatSpec
 	location    *gps.Coordinates
 	orientation Orientation
+	keywords    []string
+	rating      int
+	video       *VideoMetaData
+	camera      *CameraMetaData
+	contentID   string
+	width       int
+	height      int
 }
 
 // NewPhoto creates a new Photo instance from the image file at the given path
@@ -143,8 +224,16 @@ func NewPhoto(path string) (Photo, error) {
 		path:        path,
 		size:        fileinfo.Size(),
 		dateTaken:   meta.DateTaken,
+		tzOffset:    meta.TimeZoneOffset,
 		location:    meta.Location,
 		orientation: meta.Orientation,
+		keywords:    meta.Keywords,
+		rating:      meta.Rating,
+		video:       meta.Video,
+		camera:      meta.Camera,
+		contentID:   meta.ContentIdentifier,
+		width:       meta.Width,
+		height:      meta.Height,
 		format:      format,
 	}, nil
 }
@@ -187,6 +276,10 @@ func (p *photoFile) DateTaken() time.Time {
 	return p.dateTaken
 }
 
+func (p *photoFile) TimeZoneOffset() *int {
+	return p.tzOffset
+}
+
 func (p *photoFile) Format() FormatSpec {
 	return p.format
 }
@@ -199,6 +292,34 @@ func (p *photoFile) Orientation() Orientation {
 	return p.orientation
 }
 
+func (p *photoFile) Keywords() []string {
+	return p.keywords
+}
+
+func (p *photoFile) Rating() int {
+	return p.rating
+}
+
+func (p *photoFile) Video() *VideoMetaData {
+	return p.video
+}
+
+func (p *photoFile) Camera() *CameraMetaData {
+	return p.camera
+}
+
+func (p *photoFile) ContentIdentifier() string {
+	return p.contentID
+}
+
+func (p *photoFile) Width() int {
+	return p.width
+}
+
+func (p *photoFile) Height() int {
+	return p.height
+}
+
 func (p *photoFile) Image() (image.Image, error) {
 	in, err := p.Content()
 	if err != nil {
@@ -1,17 +1,23 @@
 package domain
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"image"
+	"image/gif"
 	"image/jpeg"
+	"image/png"
 	"io"
+	"io/ioutil"
 	"log"
 	"strings"
+	"time"
 
 	"github.com/h2non/filetype"
 	"github.com/rwcarlsen/goexif/exif"
+	"golang.org/x/image/webp"
 
 	"bitbucket.org/kleinnic74/photos/domain/formats"
 	"bitbucket.org/kleinnic74/photos/domain/gps"
@@ -29,7 +35,8 @@ const (
 type metaDataReader func(io.Reader, *MediaMetaData) error
 type photoDecoder func(io.Reader) (image.Image, error)
 type photoEncoder func(image.Image, io.Writer) error
-type thumbFunc func(io.Reader) (image.Image, error)
+type thumbFunc func(io.Reader, ThumbSize) (image.Image, error)
+type previewFunc func(io.Reader) ([]byte, error)
 
 type Format interface {
 	Type() MediaType
@@ -38,7 +45,8 @@ type Format interface {
 	DecodeMetaData(in io.Reader, meta *MediaMetaData) error
 	Decode(in io.Reader) (image.Image, error)
 	Encode(img image.Image, out io.Writer) error
-	Thumbbase(in io.Reader) (image.Image, error)
+	// Thumbbase returns the image thumbs of the given size are created from
+	Thumbbase(in io.Reader, size ThumbSize) (image.Image, error)
 }
 
 type formatImpl struct {
@@ -59,6 +67,27 @@ func (e ErrThumbsNotSupported) Error() string {
 
 var (
 	formatsById map[string]Format = map[string]Format{}
+	// previewers extract the embedded JPEG preview of formats which cannot be displayed directly
+	previewers = map[string]previewFunc{}
+	// formatAliases maps alternative extensions to the ID of a format
+	formatAliases = map[string]string{
+		"jpeg": "jpg",
+		"heif": "heic",
+	}
+	// videoBrands maps the brands of the 'ftyp' atom of ISO base media files to video formats
+	videoBrands = map[string]string{
+		"qt  ": "mov",
+		"M4V ": "m4v", "M4VH": "m4v", "M4VP": "m4v",
+		"isom": "mp4", "iso2": "mp4", "iso3": "mp4", "iso4": "mp4", "iso5": "mp4", "iso6": "mp4",
+		"mp41": "mp4", "mp42": "mp4", "mp71": "mp4", "avc1": "mp4", "mmp4": "mp4", "dash": "mp4",
+		"3gp4": "mp4", "3gp5": "mp4", "3gp6": "mp4", "3g2a": "mp4",
+		"MSNV": "mp4", "XAVC": "mp4", "CAEP": "mp4", "F4V ": "mp4",
+	}
+	// audioBrands are the major brands of ISO base media files without video, their compatible
+	// brands are the ones of videos
+	audioBrands = map[string]bool{
+		"M4A ": true, "M4B ": true, "M4P ": true,
+	}
 
 	ErrNoDecoderAvailable = errors.New("No decoder available for this format")
 	ErrNoEncoderAvailable = errors.New("No encoder available for this format")
@@ -90,8 +119,23 @@ func (stub FormatSpec) Encode(img image.Image, out io.Writer) error {
 	return formatsById[string(stub)].Encode(img, out)
 }
 
-func (stub FormatSpec) Thumbbase(in io.Reader) (image.Image, error) {
-	return formatsById[string(stub)].Thumbbase(in)
+func (stub FormatSpec) Thumbbase(in io.Reader, size ThumbSize) (image.Image, error) {
+	return formatsById[string(stub)].Thumbbase(in, size)
+}
+
+// HasPreview returns true if files of this format are displayed using an embedded JPEG preview
+func (stub FormatSpec) HasPreview() bool {
+	_, found := previewers[string(stub)]
+	return found
+}
+
+// Preview returns the embedded JPEG preview of the file in the given reader
+func (stub FormatSpec) Preview(in io.Reader) ([]byte, error) {
+	previewer, found := previewers[string(stub)]
+	if !found {
+		return nil, ErrNoDecoderAvailable
+	}
+	return previewer(in)
 }
 
 func (stub *FormatSpec) UnmarshalJSON(data []byte) error {
@@ -111,7 +155,17 @@ func (stub *FormatSpec) UnmarshalJSON(data []byte) error {
 
 var (
 	JPEG          Format
+	PNG           Format
+	GIF           Format
+	WEBP          Format
+	HEIC          Format
+	DNG           Format
+	CR2           Format
+	NEF           Format
+	ARW           Format
 	MOV           Format
+	MP4           Format
+	M4V           Format
 	UnknownFormat Format = formatImpl{
 		typeID:     Picture,
 		metaReader: func(io.Reader, *MediaMetaData) error { return nil },
@@ -120,8 +174,23 @@ var (
 
 func init() {
 	formatsById[""] = UnknownFormat
-	JPEG = RegisterFormat(Picture, "jpg", "image/jpeg", exifReader, jpeg.Decode, jpegEncode, jpeg.Decode)
+	// Thumbs of JPEG images are created from the EXIF thumbnail when it is large enough
+	JPEG = RegisterFormat(Picture, "jpg", "image/jpeg", exifReader, jpeg.Decode, jpegEncode, jpegThumbbase)
+	PNG = RegisterFormat(Picture, "png", "image/png", pngReader, png.Decode, pngEncode, decodeThumbbase("png", png.Decode))
+	GIF = RegisterFormat(Picture, "gif", "image/gif", nil, gif.Decode, gifEncode, decodeThumbbase("gif", gif.Decode))
+	// There is no WebP encoder in the standard library or x/image, WebP images are encoded lossy by formats
+	WEBP = RegisterFormat(Picture, "webp", "image/webp", webpReader, webp.Decode, webpEncode, decodeThumbbase("webp", webp.Decode))
+	// Only HEIF files with a JPEG image or thumbnail can be decoded, there is no HEVC decoder
+	HEIC = RegisterFormat(Picture, "heic", "image/heic", heifReader, heifDecode, nil, heifThumbbase)
+	// RAW files are TIFF based, their EXIF data is read like for JPEG files and they are
+	// displayed using their largest embedded JPEG preview
+	DNG = registerRawFormat("dng", "image/x-adobe-dng")
+	CR2 = registerRawFormat("cr2", "image/x-canon-cr2")
+	NEF = registerRawFormat("nef", "image/x-nikon-nef")
+	ARW = registerRawFormat("arw", "image/x-sony-arw")
 	MOV = RegisterFormat(Video, "mov", "video/quicktime", quicktimeReader, nil, nil, nil)
+	MP4 = RegisterFormat(Video, "mp4", "video/mp4", quicktimeReader, nil, nil, nil)
+	M4V = RegisterFormat(Video, "m4v", "video/x-m4v", quicktimeReader, nil, nil, nil)
 }
 
 func RegisterFormat(typeID MediaType, extension string, mime string,
@@ -149,6 +218,9 @@ func FormatForExt(ext string) (Format, bool) {
 	if ext[0] == '.' {
 		ext = ext[1:]
 	}
+	if id, found := formatAliases[ext]; found {
+		ext = id
+	}
 	f, found := formatsById[ext]
 	return f, found
 }
@@ -177,17 +249,59 @@ func MustFormatForExt(ext string) FormatSpec {
 func FormatOf(r io.Reader) (FormatSpec, error) {
 	header := make([]byte, 500)
 	r.Read(header)
+	if isAudioOnly(header) {
+		return "", fmt.Errorf("Unsupported audio file")
+	}
+	if id, found := videoFormatOf(header); found {
+		return FormatSpec(id), nil
+	}
+	if formats.IsTIFF(header) {
+		// The first directory of RAW files is needed to tell them apart
+		rest := make([]byte, maxTIFFHeaderSize-len(header))
+		n, _ := io.ReadFull(r, rest)
+		if id := formats.RawKindOf(append(header, rest[:n]...)); id != "" {
+			return FormatSpec(id), nil
+		}
+	}
 	kind, err := filetype.Match(header)
 	if err != nil {
 		return "", err
 	}
-	if _, found := formatsById[kind.Extension]; found {
-		return FormatSpec(kind.Extension), nil
+	ext := kind.Extension
+	if id, found := formatAliases[ext]; found {
+		ext = id
+	}
+	if _, found := formatsById[ext]; found {
+		return FormatSpec(ext), nil
 	} else {
 		return "", fmt.Errorf("Unsupported file format")
 	}
 }
 
+// maxTIFFHeaderSize is the size of the header of TIFF files searched for the RAW format
+const maxTIFFHeaderSize = 64 * 1024
+
+// isAudioOnly returns true if the major brand of the ISO base media file is one of an audio file
+func isAudioOnly(header []byte) bool {
+	major, _, ok := formats.Brands(header)
+	return ok && audioBrands[major]
+}
+
+// videoFormatOf returns the video format of an ISO base media file from its brands, the major
+// brand takes precedence over the compatible brands
+func videoFormatOf(header []byte) (string, bool) {
+	major, compatible, ok := formats.Brands(header)
+	if !ok {
+		return "", false
+	}
+	for _, brand := range append([]string{major}, compatible...) {
+		if id, found := videoBrands[brand]; found {
+			return id, true
+		}
+	}
+	return "", false
+}
+
 func (f formatImpl) Type() MediaType {
 	return f.typeID
 }
@@ -200,20 +314,23 @@ func (f formatImpl) Mime() string {
 	return f.mime
 }
 
-func (f formatImpl) Thumbbase(in io.Reader) (image.Image, error) {
+func (f formatImpl) Thumbbase(in io.Reader, size ThumbSize) (image.Image, error) {
 	if f.thumber == nil {
 		return nil, ErrThumbsNotSupported(f.id)
 	}
-	return f.thumber(in)
+	return f.thumber(in, size)
 }
 
 // DecodeMetaData will decode meta-data as per this format from the given
 // reader and store it in the given metadata instance
 func (f formatImpl) DecodeMetaData(in io.Reader, meta *MediaMetaData) error {
-	if f.metaReader != nil {
-		return f.metaReader(in, meta)
+	if f.metaReader == nil {
+		return nil
 	}
-	return nil
+	err := f.metaReader(in, meta)
+	// Readers store the dimensions as found in the file
+	meta.Width, meta.Height = meta.Orientation.Dimensions(meta.Width, meta.Height)
+	return err
 }
 
 // Decode decodes the binary data from the given reader as an image in this format
@@ -232,27 +349,321 @@ func (f formatImpl) Encode(img image.Image, out io.Writer) error {
 	return f.encoder(img, out)
 }
 
+// maxMetaDataSize is the size of the header of a JPEG file searched for IPTC data
+const maxMetaDataSize = 256 * 1024
+
 func exifReader(in io.Reader, meta *MediaMetaData) error {
-	ex, err := exif.Decode(in)
+	head, err := ioutil.ReadAll(io.LimitReader(in, maxMetaDataSize))
 	if err != nil {
 		return err
 	}
-	if dateTaken, err := ex.DateTime(); err == nil {
-		meta.DateTaken = dateTaken
+	// The frame header may follow large APP segments, the data read after the head is kept for
+	// the EXIF decoder
+	var rest bytes.Buffer
+	if config, err := jpeg.DecodeConfig(io.MultiReader(bytes.NewReader(head), io.TeeReader(in, &rest))); err == nil {
+		// The frame header is more reliable than EXIF data which is not always updated by editors
+		meta.Width, meta.Height = config.Width, config.Height
+	}
+	// IPTC data is optional, keywords found before an error are still used
+	keywords, _ := formats.ReadIPTCKeywords(bytes.NewReader(head))
+	meta.Keywords = appendKeywords(meta.Keywords, keywords...)
+	ex, err := exif.Decode(io.MultiReader(bytes.NewReader(head), &rest, in))
+	if err != nil {
+		return err
+	}
+	applyExif(ex, meta)
+	return nil
+}
+
+// applyExif copies the meta-data found in the given EXIF data
+func applyExif(ex *exif.Exif, meta *MediaMetaData) {
+	if rating, found := formats.RatingOf(ex); found {
+		meta.Rating = rating
+	}
+	if tag, err := ex.Get(exif.XPKeywords); err == nil {
+		meta.Keywords = appendKeywords(meta.Keywords, strings.Split(formats.DecodeUTF16LE(tag.Val), ";")...)
 	}
 	if lat, long, err := ex.LatLong(); err == nil {
 		if coords, err := gps.NewCoordinates(lat, long); err == nil {
 			meta.Location = coords
 		}
 	}
+	if dateTaken, err := ex.DateTime(); err == nil {
+		dateTaken = dateTaken.Add(exifSubSeconds(ex))
+		meta.DateTaken, meta.TimeZoneOffset = dateTaken, nil
+		if zone, found := exifTimeZone(ex, dateTaken); found {
+			meta.setTimeZone(withZone(dateTaken, zone))
+		} else {
+			meta.inferTimeZone()
+		}
+	}
 	if tag, err := ex.Get(exif.Orientation); err == nil && tag.Count > 0 {
 		if orientation, err := tag.Int(0); err == nil {
 			meta.Orientation = Orientation(orientation)
 		}
 	}
+	if camera := cameraOf(ex); camera != nil {
+		meta.Camera = camera
+		if meta.Width == 0 || meta.Height == 0 {
+			meta.Width, meta.Height = camera.Width, camera.Height
+		}
+	}
+	if tag, err := ex.Get(exif.MakerNote); err == nil {
+		if id, found := formats.AppleContentIdentifier(tag.Val); found {
+			meta.ContentIdentifier = id
+		}
+	}
+}
+
+// exifSubSeconds returns the fraction of the second of the capture time, which tells apart
+// the pictures of a burst taken within the same second
+func exifSubSeconds(ex *exif.Exif) time.Duration {
+	var fraction time.Duration
+	scale := time.Second
+	for _, digit := range exifString(ex, exif.SubSecTimeOriginal) {
+		if digit < '0' || digit > '9' || scale == 1 {
+			break
+		}
+		scale /= 10
+		fraction += time.Duration(digit-'0') * scale
+	}
+	return fraction
+}
+
+// cameraOf returns the camera meta-data found in the given EXIF data, nil if there is none
+func cameraOf(ex *exif.Exif) *CameraMetaData {
+	camera := CameraMetaData{
+		Make:         exifString(ex, exif.Make),
+		Model:        exifString(ex, exif.Model),
+		Lens:         exifString(ex, exif.LensModel),
+		FocalLength:  exifFloat(ex, exif.FocalLength),
+		Aperture:     exifFloat(ex, exif.FNumber),
+		ExposureTime: exifFloat(ex, exif.ExposureTime),
+		ISO:          exifInt(ex, exif.ISOSpeedRatings),
+		// Bit 0 of the flash tag tells whether the flash fired
+		Flash:  exifInt(ex, exif.Flash)&1 == 1,
+		Width:  exifInt(ex, exif.PixelXDimension),
+		Height: exifInt(ex, exif.PixelYDimension),
+	}
+	if camera.Width == 0 || camera.Height == 0 {
+		camera.Width, camera.Height = exifInt(ex, exif.ImageWidth), exifInt(ex, exif.ImageLength)
+	}
+	if camera == (CameraMetaData{}) {
+		return nil
+	}
+	return &camera
+}
+
+func exifString(ex *exif.Exif, name exif.FieldName) string {
+	tag, err := ex.Get(name)
+	if err != nil {
+		return ""
+	}
+	value, err := tag.StringVal()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimRight(value, "\x00"))
+}
+
+func exifFloat(ex *exif.Exif, name exif.FieldName) float64 {
+	tag, err := ex.Get(name)
+	if err != nil || tag.Count == 0 {
+		return 0
+	}
+	num, den, err := tag.Rat2(0)
+	if err != nil || den == 0 {
+		return 0
+	}
+	return float64(num) / float64(den)
+}
+
+func exifInt(ex *exif.Exif, name exif.FieldName) int {
+	tag, err := ex.Get(name)
+	if err != nil || tag.Count == 0 {
+		return 0
+	}
+	value, err := tag.Int(0)
+	if err != nil {
+		return 0
+	}
+	return value
+}
+
+// pngCreationTimeLayouts are the layouts seen in the 'Creation Time' text chunk, the PNG
+// specification recommends RFC 1123 but most tools use ISO 8601 or the EXIF layout
+var pngCreationTimeLayouts = []string{
+	time.RFC1123,
+	time.RFC1123Z,
+	time.RFC3339,
+	"2006:01:02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+}
+
+func pngReader(in io.Reader, meta *MediaMetaData) error {
+	chunks, err := formats.ReadPNGMetaData(in)
+	if err != nil {
+		return err
+	}
+	meta.Width, meta.Height = chunks.Width, chunks.Height
+	if created, found := chunks.Text["Creation Time"]; found {
+		for _, layout := range pngCreationTimeLayouts {
+			if t, err := time.Parse(layout, created); err == nil {
+				meta.DateTaken = t
+				break
+			}
+		}
+	}
+	if len(chunks.Exif) > 0 {
+		// EXIF data is optional, broken EXIF data is ignored
+		if ex, err := exif.Decode(bytes.NewReader(chunks.Exif)); err == nil {
+			applyExif(ex, meta)
+		}
+	}
+	return nil
+}
+
+func webpReader(in io.Reader, meta *MediaMetaData) error {
+	webpMeta, err := formats.ReadWebPMetaData(in)
+	if err != nil {
+		return err
+	}
+	meta.Width, meta.Height = webpMeta.Width, webpMeta.Height
+	if len(webpMeta.Exif) == 0 {
+		return nil
+	}
+	if ex, err := exif.Decode(bytes.NewReader(webpMeta.Exif)); err == nil {
+		applyExif(ex, meta)
+	}
+	return nil
+}
+
+// appendKeywords adds the given keywords, skipping empty and duplicate keywords
+func appendKeywords(keywords []string, add ...string) []string {
+	for _, k := range add {
+		k = strings.TrimSpace(k)
+		if k == "" {
+			continue
+		}
+		found := false
+		for _, existing := range keywords {
+			found = found || existing == k
+		}
+		if !found {
+			keywords = append(keywords, k)
+		}
+	}
+	return keywords
+}
+
+func heifReader(in io.Reader, meta *MediaMetaData) error {
+	heif, err := formats.ReadHEIF(in)
+	if err != nil {
+		return err
+	}
+	data, err := heif.Exif()
+	if err != nil || len(data) == 0 {
+		return err
+	}
+	ex, err := exif.Decode(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	applyExif(ex, meta)
 	return nil
 }
 
+// heifDecode decodes the JPEG preview embedded in a HEIF file
+func heifDecode(in io.Reader) (image.Image, error) {
+	heif, err := formats.ReadHEIF(in)
+	if err != nil {
+		return nil, err
+	}
+	preview, found := heif.JPEGPreview()
+	if !found {
+		return nil, ErrNoDecoderAvailable
+	}
+	return jpeg.Decode(bytes.NewReader(preview))
+}
+
+// heifThumbbase uses the smallest JPEG thumbnail large enough for the given size if the primary
+// image is a JPEG, the primary image is decoded otherwise. The largest JPEG thumbnail is used
+// for HEVC coded images, HEIF files without JPEG thumbnails have no thumbs
+func heifThumbbase(in io.Reader, size ThumbSize) (image.Image, error) {
+	start := time.Now()
+	heif, err := formats.ReadHEIF(in)
+	if err != nil {
+		return nil, err
+	}
+	thumbs := heif.JPEGThumbnails()
+	if primary, found := heif.PrimaryJPEG(); found {
+		if config, err := jpeg.DecodeConfig(bytes.NewReader(primary)); err == nil {
+			if preview, found := previewFor(size, config.Width, config.Height, thumbs...); found {
+				if img, err := jpeg.Decode(bytes.NewReader(preview)); err == nil {
+					observeThumbbase("heic", thumbFromPreview, start)
+					return img, nil
+				}
+			}
+		}
+		defer observeThumbbase("heic", thumbFromDecode, start)
+		return jpeg.Decode(bytes.NewReader(primary))
+	}
+	if len(thumbs) == 0 {
+		return nil, ErrThumbsNotSupported("heic")
+	}
+	largest := thumbs[0]
+	for _, thumb := range thumbs[1:] {
+		if len(thumb) > len(largest) {
+			largest = thumb
+		}
+	}
+	defer observeThumbbase("heic", thumbFromPreview, start)
+	return jpeg.Decode(bytes.NewReader(largest))
+}
+
+func registerRawFormat(id, mime string) Format {
+	thumbbase := func(in io.Reader, size ThumbSize) (image.Image, error) {
+		img, err := rawThumbbase(id, in, size)
+		if err == formats.ErrNoPreview {
+			return nil, ErrThumbsNotSupported(id)
+		}
+		return img, err
+	}
+	format := RegisterFormat(Picture, id, mime, rawReader, rawDecode, nil, thumbbase)
+	previewers[id] = formats.ReadRawPreview
+	return format
+}
+
+// rawReader reads the EXIF data of a RAW file. The EXIF data of RAW files often lacks the pixel
+// dimensions, the dimensions of the largest embedded preview are used instead
+func rawReader(in io.Reader, meta *MediaMetaData) error {
+	var data bytes.Buffer
+	previews, previewErr := formats.ReadRawPreviews(io.TeeReader(in, &data))
+	ex, err := exif.Decode(bytes.NewReader(data.Bytes()))
+	meta.Width, meta.Height = 0, 0
+	if err == nil {
+		applyExif(ex, meta)
+		// The size of the first directory is the one of the thumbnail in RAW files
+		meta.Width, meta.Height = exifInt(ex, exif.PixelXDimension), exifInt(ex, exif.PixelYDimension)
+	}
+	if (meta.Width == 0 || meta.Height == 0) && previewErr == nil {
+		if config, err := jpeg.DecodeConfig(bytes.NewReader(previews[len(previews)-1])); err == nil {
+			meta.Width, meta.Height = config.Width, config.Height
+		}
+	}
+	return err
+}
+
+// rawDecode decodes the largest JPEG preview embedded in a RAW file
+func rawDecode(in io.Reader) (image.Image, error) {
+	preview, err := formats.ReadRawPreview(in)
+	if err != nil {
+		return nil, err
+	}
+	return jpeg.Decode(bytes.NewReader(preview))
+}
+
 func quicktimeReader(in io.Reader, meta *MediaMetaData) error {
 	qt, err := formats.ReadAsQuicktime(in)
 	if err != nil {
@@ -260,9 +671,40 @@ func quicktimeReader(in io.Reader, meta *MediaMetaData) error {
 	}
 	meta.DateTaken = qt.DateTaken()
 	meta.Location = qt.Location()
+	meta.ContentIdentifier = qt.ContentIdentifier()
+	if qt.HasTimeZone() {
+		meta.setTimeZone(meta.DateTaken)
+	} else if meta.Location != nil {
+		// QuickTime creation times are in UTC, only the zone is missing
+		if zone, err := meta.Location.TimeZone(); err == nil {
+			meta.setTimeZone(meta.DateTaken.In(zone))
+		}
+	}
+	meta.Video = &VideoMetaData{Duration: qt.Duration()}
+	if track := qt.Video(); track != nil {
+		meta.Video.Width, meta.Video.Height = track.Width, track.Height
+		meta.Video.Codec = track.Codec
+		meta.Video.Rotation = track.Rotation
+		meta.Width, meta.Height = track.Width, track.Height
+		if track.Rotation == 90 || track.Rotation == 270 {
+			meta.Width, meta.Height = track.Height, track.Width
+		}
+	}
 	return nil
 }
 
 func jpegEncode(img image.Image, out io.Writer) error {
 	return jpeg.Encode(out, img, nil)
 }
+
+func pngEncode(img image.Image, out io.Writer) error {
+	return png.Encode(out, img)
+}
+
+func gifEncode(img image.Image, out io.Writer) error {
+	return gif.Encode(out, img, nil)
+}
+
+func webpEncode(img image.Image, out io.Writer) error {
+	return formats.EncodeWebP(out, img, DefaultQuality)
+}
@@ -2,10 +2,15 @@
 package domain_test
 
 import (
+	"bytes"
 	"encoding/json"
+	"image"
+	"image/png"
 	"io"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"bitbucket.org/kleinnic74/photos/domain"
 	"github.com/stretchr/testify/assert"
@@ -19,6 +24,17 @@ func TestFormatById(t *testing.T) {
 	}{
 		{"jpg", "jpg", "image/jpeg"},
 		{"mov", "mov", "video/quicktime"},
+		{"png", "png", "image/png"},
+		{"gif", "gif", "image/gif"},
+		{"webp", "webp", "image/webp"},
+		{"heic", "heic", "image/heic"},
+		{"heif", "heic", "image/heic"},
+		{"mp4", "mp4", "video/mp4"},
+		{"m4v", "m4v", "video/x-m4v"},
+		{"dng", "dng", "image/x-adobe-dng"},
+		{"cr2", "cr2", "image/x-canon-cr2"},
+		{"nef", "nef", "image/x-nikon-nef"},
+		{"arw", "arw", "image/x-sony-arw"},
 	}
 	for _, i := range test {
 		actual, found := domain.FormatForExt(i.t)
@@ -28,6 +44,7 @@ func TestFormatById(t *testing.T) {
 		if actual.ID() != i.expExt {
 			t.Errorf("Bad extension for %s: Expectetd %s, got %s", i.t, i.expExt, actual.ID())
 		}
+		assert.Equal(t, i.expMime, actual.Mime())
 	}
 }
 
@@ -43,6 +60,221 @@ func TestJpegFormat(t *testing.T) {
 	}
 }
 
+func TestCameraMetaData(t *testing.T) {
+	photo, err := domain.NewPhoto("testdata/Canon_40D.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := domain.CameraMetaData{
+		Make:         "Canon",
+		Model:        "Canon EOS 40D",
+		FocalLength:  135,
+		Aperture:     7.1,
+		ExposureTime: 0.00625,
+		ISO:          100,
+		Flash:        true,
+		Width:        100,
+		Height:       68,
+	}
+	if assert.NotNil(t, photo.Camera()) {
+		assert.Equal(t, expected, *photo.Camera())
+		assert.Equal(t, "Canon EOS 40D", photo.Camera().Name())
+	}
+	nikon := domain.CameraMetaData{Make: "NIKON CORPORATION", Model: "D750"}
+	assert.Equal(t, "NIKON CORPORATION D750", nikon.Name())
+}
+
+func TestVideoBrands(t *testing.T) {
+	test := []struct {
+		ftyp     string
+		expected string
+	}{
+		{"qt  \x00\x00\x02\x00qt  ", "mov"},
+		{"isom\x00\x00\x02\x00isomiso2avc1mp41", "mp4"},
+		{"mp42\x00\x00\x00\x00mp42isom", "mp4"},
+		{"M4V \x00\x00\x00\x01M4V M4A mp42isom", "m4v"},
+		{"3gp4\x00\x00\x00\x00", "mp4"},
+		{"XXXX\x00\x00\x00\x00XXXXmp42", "mp4"},
+	}
+	for _, i := range test {
+		f, err := domain.FormatOf(bytes.NewReader(ftypHeader(i.ftyp)))
+		if err != nil {
+			t.Errorf("No format for brands %q: %s", i.ftyp, err)
+			continue
+		}
+		assert.Equal(t, i.expected, f.ID())
+	}
+	for _, ftyp := range []string{"M4A \x00\x00\x00\x00M4A mp42isom", "M4B \x00\x00\x00\x00M4B mp42isom"} {
+		_, err := domain.FormatOf(bytes.NewReader(ftypHeader(ftyp)))
+		assert.Error(t, err, "Audio file %q should not be imported", ftyp)
+	}
+}
+
+// ftypHeader returns the start of an ISO base media file with the given 'ftyp' atom content
+func ftypHeader(ftyp string) []byte {
+	header := make([]byte, 4, 512)
+	header[3] = byte(8 + len(ftyp))
+	header = append(header, "ftyp"+ftyp...)
+	return append(header, make([]byte, 512-len(header))...)
+}
+
+func TestWebPFormat(t *testing.T) {
+	photo, err := domain.NewPhoto("testdata/blue-purple-pink.webp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "webp", photo.Format().ID())
+	in, err := photo.Content()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	thumb, err := domain.LocalThumber{}.CreateThumb(in, photo.Format(), domain.NormalOrientation, domain.Small)
+	if err != nil {
+		t.Fatalf("Failed to create thumb: %s", err)
+	}
+	img, err := photo.Image()
+	if err != nil {
+		t.Fatalf("Failed to decode WebP: %s", err)
+	}
+	assert.Equal(t, domain.Small.BoundsOf(img.Bounds()).Size(), thumb.Bounds().Size())
+	assert.Equal(t, img.Bounds().Size(), image.Pt(photo.Width(), photo.Height()))
+}
+
+func TestHEICFormat(t *testing.T) {
+	reference, err := domain.NewPhoto("testdata/Canon_40D.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	photo, err := domain.NewPhoto("testdata/Canon_40D.heic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "heic", photo.Format().ID())
+	assert.Equal(t, reference.DateTaken(), photo.DateTaken())
+	assert.Equal(t, reference.Orientation(), photo.Orientation())
+	img, err := photo.Image()
+	if err != nil {
+		t.Fatalf("Failed to decode HEIC preview: %s", err)
+	}
+	expected, _ := reference.Image()
+	assert.Equal(t, expected.Bounds(), img.Bounds())
+
+	content, _ := photo.Content()
+	defer content.Close()
+	thumb, err := photo.Format().Thumbbase(content, domain.Small)
+	if err != nil {
+		t.Fatalf("Failed to create HEIC thumbbase: %s", err)
+	}
+	assert.Equal(t, expected.Bounds(), thumb.Bounds())
+}
+
+func TestRawFormat(t *testing.T) {
+	photo, err := domain.NewPhoto("testdata/nikon.nef")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "nef", photo.Format().ID())
+	assert.Equal(t, time.Date(2019, 7, 14, 10, 30, 0, 0, time.Local), photo.DateTaken())
+	assert.Equal(t, domain.Orientation(6), photo.Orientation())
+	assert.True(t, photo.Format().HasPreview())
+	img, err := photo.Image()
+	if err != nil {
+		t.Fatalf("Failed to decode RAW preview: %s", err)
+	}
+	assert.Equal(t, image.Rect(0, 0, 160, 120), img.Bounds())
+
+	content, _ := photo.Content()
+	defer content.Close()
+	preview, err := photo.Format().Preview(content)
+	if err != nil {
+		t.Fatalf("Failed to read RAW preview: %s", err)
+	}
+	assert.Equal(t, []byte{0xFF, 0xD8}, preview[:2])
+	assert.False(t, domain.FormatSpec("jpg").HasPreview())
+}
+
+func TestPNGFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scan.png")
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 300, 200))); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	photo, err := domain.NewPhoto(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "png", photo.Format().ID())
+	img, err := photo.Image()
+	if err != nil {
+		t.Fatalf("Failed to decode PNG: %s", err)
+	}
+	assert.Equal(t, image.Rect(0, 0, 300, 200), img.Bounds())
+	assert.Equal(t, 300, photo.Width())
+	assert.Equal(t, 200, photo.Height())
+}
+
+func TestDimensions(t *testing.T) {
+	data := []struct {
+		path          string
+		width, height int
+	}{
+		{"testdata/Canon_40D.jpg", 100, 68},
+		{"testdata/orientation/portrait_3.jpg", 450, 600},
+		// Stored as landscape, rotated by its orientation
+		{"testdata/orientation/portrait_6.jpg", 1200, 1800},
+		// Size of the largest preview, rotated by its orientation
+		{"testdata/nikon.nef", 120, 160},
+	}
+	for _, d := range data {
+		t.Run(d.path, func(t *testing.T) {
+			photo, err := domain.NewPhoto(d.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, d.width, photo.Width())
+			assert.Equal(t, d.height, photo.Height())
+		})
+	}
+	t.Run("frame header after large APP segments", func(t *testing.T) {
+		// No pixel dimensions in its EXIF data
+		content, err := os.ReadFile("testdata/orientation/portrait_1.jpg")
+		if err != nil {
+			t.Fatal(err)
+		}
+		reference, err := domain.NewPhoto("testdata/orientation/portrait_1.jpg")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		buf.Write(content[:2])
+		// 5 APP15 segments of 64KB push the frame header beyond the first 256KB
+		for i := 0; i < 5; i++ {
+			buf.Write([]byte{0xFF, 0xEF, 0xFF, 0xFF})
+			buf.Write(make([]byte, 0xFFFF-2))
+		}
+		buf.Write(content[2:])
+		path := filepath.Join(t.TempDir(), "padded.jpg")
+		if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		photo, err := domain.NewPhoto(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.NotZero(t, photo.Width())
+		assert.Equal(t, reference.Width(), photo.Width())
+		assert.Equal(t, reference.Height(), photo.Height())
+	})
+	width, height := domain.Orientation(8).Dimensions(4000, 3000)
+	assert.Equal(t, []int{3000, 4000}, []int{width, height})
+	width, height = domain.NormalOrientation.Dimensions(4000, 3000)
+	assert.Equal(t, []int{4000, 3000}, []int{width, height})
+}
+
 func TestUnmarshalJSON(t *testing.T) {
 	data := []struct {
 		ext            string
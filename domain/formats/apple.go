@@ -0,0 +1,34 @@
+package formats
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// appleMakerNoteHeader starts the EXIF maker note of iPhones, it is followed by a version
+// and the byte order of the IFD at offset 14. Offsets are relative to the start of the note
+var appleMakerNoteHeader = []byte("Apple iOS\x00")
+
+const (
+	appleIFDOffset = 14
+	// tagContentIdentifier links the still image of a Live Photo with its video
+	tagContentIdentifier = 0x0011
+)
+
+// AppleContentIdentifier returns the Live Photo content identifier found in the given
+// EXIF maker note, false is returned if this is not an Apple maker note
+func AppleContentIdentifier(makerNote []byte) (string, bool) {
+	if len(makerNote) < appleIFDOffset || !bytes.HasPrefix(makerNote, appleMakerNoteHeader) {
+		return "", false
+	}
+	t := &tiffFile{data: makerNote, order: binary.BigEndian}
+	if string(makerNote[12:14]) == "II" {
+		t.order = binary.LittleEndian
+	}
+	dir, err := t.ifd(appleIFDOffset)
+	if err != nil {
+		return "", false
+	}
+	id := t.ascii(dir, tagContentIdentifier)
+	return string(id), len(id) > 0
+}
@@ -0,0 +1,22 @@
+package formats
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAppleContentIdentifier(t *testing.T) {
+	// Header, version, byte order and an IFD with a single content identifier stored at offset 32
+	note := []byte("Apple iOS\x00\x00\x01MM" +
+		"\x00\x01" + "\x00\x11\x00\x02\x00\x00\x00\x05\x00\x00\x00\x20" + "\x00\x00\x00\x00" +
+		"ABCD\x00")
+	id, found := AppleContentIdentifier(note)
+	assert.True(t, found)
+	assert.Equal(t, "ABCD", id)
+
+	_, found = AppleContentIdentifier([]byte("Nikon\x00\x02\x10\x00\x00MM\x00*"))
+	assert.False(t, found)
+	_, found = AppleContentIdentifier([]byte("Apple iOS\x00"))
+	assert.False(t, found)
+}
@@ -2,11 +2,22 @@ package formats
 
 import (
 	"os"
+	"strconv"
 
 	"github.com/rwcarlsen/goexif/exif"
 	"github.com/rwcarlsen/goexif/tiff"
 )
 
+// tagRating is the EXIF tag of the star rating as written by Windows and most photo managers
+const tagRating = 0x4746
+
+const (
+	// tagOffsetTimeOriginal is the UTC offset of DateTimeOriginal in the EXIF IFD, added in EXIF 2.31
+	tagOffsetTimeOriginal = 0x9011
+	// tagOffsetTime is the UTC offset of DateTime in the EXIF IFD
+	tagOffsetTime = 0x9010
+)
+
 type TagHandler func(name, value string)
 
 type exifWalker struct {
@@ -30,3 +41,74 @@ func PrintExif(path string, walker func(name, value string)) error {
 	}
 	return meta.Walk(&exifWalker{w: walker})
 }
+
+// RatingOf returns the star rating from 0 to 5 stored in the main IFD. The rating tag is
+// not known to goexif, it is therefore read from the raw TIFF directory
+func RatingOf(x *exif.Exif) (int, bool) {
+	if x.Tiff == nil || len(x.Tiff.Dirs) == 0 {
+		return 0, false
+	}
+	for _, tag := range x.Tiff.Dirs[0].Tags {
+		if tag.Id != tagRating || tag.Count == 0 {
+			continue
+		}
+		rating, err := tag.Int(0)
+		if err != nil {
+			return 0, false
+		}
+		if rating < 0 {
+			rating = 0
+		} else if rating > 5 {
+			rating = 5
+		}
+		return rating, true
+	}
+	return 0, false
+}
+
+// OffsetTimeOf returns the UTC offset in seconds of the capture time. The offset tags are not
+// known to goexif, they are read from the raw EXIF IFD
+func OffsetTimeOf(x *exif.Exif) (int, bool) {
+	ptr, err := x.Get(exif.ExifIFDPointer)
+	if err != nil {
+		return 0, false
+	}
+	offset, err := ptr.Int64(0)
+	if err != nil || offset < 0 || offset > int64(len(x.Raw)) {
+		return 0, false
+	}
+	t, err := newTIFFFile(x.Raw)
+	if err != nil {
+		return 0, false
+	}
+	dir, err := t.ifd(uint32(offset))
+	if err != nil {
+		return 0, false
+	}
+	for _, tag := range []uint16{tagOffsetTimeOriginal, tagOffsetTime} {
+		if seconds, ok := parseUTCOffset(string(t.ascii(dir, tag))); ok {
+			return seconds, true
+		}
+	}
+	return 0, false
+}
+
+// parseUTCOffset parses an offset of the form "+HH:MM"
+func parseUTCOffset(value string) (int, bool) {
+	if len(value) != 6 || (value[0] != '+' && value[0] != '-') || value[3] != ':' {
+		return 0, false
+	}
+	hours, err := strconv.Atoi(value[1:3])
+	if err != nil || hours > 14 {
+		return 0, false
+	}
+	minutes, err := strconv.Atoi(value[4:6])
+	if err != nil || minutes >= 60 {
+		return 0, false
+	}
+	seconds := hours*3600 + minutes*60
+	if value[0] == '-' {
+		seconds = -seconds
+	}
+	return seconds, true
+}
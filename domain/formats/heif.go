@@ -0,0 +1,455 @@
+package formats
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// maxHEIFSize is the maximum size of HEIF files read into memory, items are located by
+// absolute offsets in the file which requires random access
+const maxHEIFSize = 256 * 1024 * 1024
+
+var (
+	NotAHEIFFile = errors.New("Not a HEIF file")
+	ErrNoItem    = errors.New("No such item in HEIF file")
+)
+
+// HEIFItem is an item of a HEIF file like an image, a thumbnail or the EXIF block
+type HEIFItem struct {
+	ID          uint32
+	Type        string
+	ContentType string
+
+	constructionMethod uint16
+	extents            []heifExtent
+}
+
+type heifExtent struct {
+	offset uint64
+	length uint64
+}
+
+// HEIF is the structure of a HEIF file as described by its top-level meta box
+type HEIF struct {
+	PrimaryItem uint32
+	Items       map[uint32]*HEIFItem
+	// Thumbnails maps the ID of an item to the IDs of its thumbnails
+	Thumbnails map[uint32][]uint32
+	// Descriptions maps the ID of an item to the IDs of the items describing it like EXIF
+	Descriptions map[uint32][]uint32
+
+	data []byte
+	idat []byte
+}
+
+// ReadHEIF reads the item structure of a HEIF file, HEIF is an ISO base media file
+// format like QuickTime with its items described in the boxes below the 'meta' box
+func ReadHEIF(in io.Reader) (*HEIF, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(in, maxHEIFSize))
+	if err != nil {
+		return nil, err
+	}
+	h := &HEIF{
+		Items:        make(map[uint32]*HEIFItem),
+		Thumbnails:   make(map[uint32][]uint32),
+		Descriptions: make(map[uint32][]uint32),
+		data:         data,
+	}
+	r := bytes.NewReader(data)
+	foundMeta := false
+	for a, err := nextAtom(r); err != io.EOF; a, err = nextAtom(r) {
+		if err != nil {
+			return nil, err
+		}
+		switch a.typ {
+		case fType:
+			content, err := readAtomData(r, a)
+			if err != nil {
+				return nil, err
+			}
+			if !isHEIFBrand(content) {
+				return nil, NotAHEIFFile
+			}
+		case meta:
+			content, err := readAtomData(r, a)
+			if err != nil {
+				return nil, err
+			}
+			// The meta box of ISO BMFF is a full box with version and flags
+			if len(content) < 4 {
+				return nil, NotAHEIFFile
+			}
+			if err := h.parseMeta(content[4:]); err != nil {
+				return nil, err
+			}
+			foundMeta = true
+		default:
+			// Media data is only read through the extents of the items
+			if err := skipAtomData(r, a); err != nil {
+				return nil, err
+			}
+		}
+		if a.size == 0 {
+			// Box extends to the end of the file
+			break
+		}
+	}
+	if !foundMeta {
+		return nil, NotAHEIFFile
+	}
+	return h, nil
+}
+
+func isHEIFBrand(ftyp []byte) bool {
+	for i := 0; i+4 <= len(ftyp); i += 4 {
+		if i == 4 {
+			// Skip minor version
+			continue
+		}
+		switch string(ftyp[i : i+4]) {
+		case "heic", "heix", "heim", "heis", "mif1", "msf1":
+			return true
+		}
+	}
+	return false
+}
+
+// ItemData returns the content of the item with the given ID
+func (h *HEIF) ItemData(id uint32) ([]byte, error) {
+	item, found := h.Items[id]
+	if !found {
+		return nil, ErrNoItem
+	}
+	source := h.data
+	if item.constructionMethod == 1 {
+		source = h.idat
+	} else if item.constructionMethod != 0 {
+		return nil, fmt.Errorf("Unsupported construction method %d for item %d", item.constructionMethod, id)
+	}
+	var buf bytes.Buffer
+	for _, e := range item.extents {
+		end := e.offset + e.length
+		if e.length == 0 {
+			// Extent extends to the end of the data
+			end = uint64(len(source))
+		}
+		if e.offset > end || end > uint64(len(source)) {
+			return nil, fmt.Errorf("Extent of item %d out of bounds", id)
+		}
+		buf.Write(source[e.offset:end])
+	}
+	return buf.Bytes(), nil
+}
+
+// Exif returns the raw TIFF data of the EXIF item of the primary image, nil is returned if
+// there is no such EXIF item
+func (h *HEIF) Exif() ([]byte, error) {
+	id, found := h.exifItem()
+	if !found {
+		return nil, nil
+	}
+	data, err := h.ItemData(id)
+	if err != nil {
+		return nil, err
+	}
+	// The EXIF item starts with the offset of the TIFF header
+	if len(data) < 4 {
+		return nil, fmt.Errorf("EXIF item %d too short", id)
+	}
+	offset := 4 + uint64(binary.BigEndian.Uint32(data))
+	if offset > uint64(len(data)) {
+		return nil, fmt.Errorf("Bad TIFF header offset in EXIF item %d", id)
+	}
+	return data[offset:], nil
+}
+
+// exifItem returns the ID of the EXIF item describing the primary image. Files which do not
+// link their EXIF items to images fall back to the unlinked EXIF item with the lowest ID
+func (h *HEIF) exifItem() (uint32, bool) {
+	for _, id := range h.Descriptions[h.PrimaryItem] {
+		if item, found := h.Items[id]; found && item.Type == "Exif" {
+			return id, true
+		}
+	}
+	linked := make(map[uint32]bool)
+	for _, ids := range h.Descriptions {
+		for _, id := range ids {
+			linked[id] = true
+		}
+	}
+	var exif uint32
+	found := false
+	for id, item := range h.Items {
+		if item.Type == "Exif" && !linked[id] && (!found || id < exif) {
+			exif, found = id, true
+		}
+	}
+	return exif, found
+}
+
+// JPEGPreview returns the JPEG data of the primary image if it is a JPEG, or else of a JPEG
+// thumbnail of the primary image. HEVC coded images are not supported
+func (h *HEIF) JPEGPreview() ([]byte, bool) {
+	candidates := append([]uint32{h.PrimaryItem}, h.Thumbnails[h.PrimaryItem]...)
+	for _, id := range candidates {
+		item, found := h.Items[id]
+		if !found || !item.isJPEG() {
+			continue
+		}
+		if data, err := h.ItemData(id); err == nil {
+			return data, true
+		}
+	}
+	return nil, false
+}
+
+// JPEGThumbnails returns the JPEG data of the thumbnails of the primary image
+func (h *HEIF) JPEGThumbnails() [][]byte {
+	var thumbs [][]byte
+	for _, id := range h.Thumbnails[h.PrimaryItem] {
+		if item, found := h.Items[id]; found && item.isJPEG() {
+			if data, err := h.ItemData(id); err == nil {
+				thumbs = append(thumbs, data)
+			}
+		}
+	}
+	return thumbs
+}
+
+// PrimaryJPEG returns the JPEG data of the primary image, false if it is not a JPEG
+func (h *HEIF) PrimaryJPEG() ([]byte, bool) {
+	item, found := h.Items[h.PrimaryItem]
+	if !found || !item.isJPEG() {
+		return nil, false
+	}
+	data, err := h.ItemData(item.ID)
+	return data, err == nil
+}
+
+func (item *HEIFItem) isJPEG() bool {
+	return item.Type == "jpeg" || (item.Type == "mime" && item.ContentType == "image/jpeg")
+}
+
+func (h *HEIF) parseMeta(data []byte) error {
+	r := bytes.NewReader(data)
+	for a, err := nextAtom(r); err != io.EOF; a, err = nextAtom(r) {
+		if err != nil {
+			return err
+		}
+		content, err := readAtomData(r, a)
+		if err != nil {
+			return err
+		}
+		box := &fullBox{data: content}
+		switch a.typ {
+		case "pitm":
+			h.PrimaryItem = box.id(box.version() == 0)
+		case "iinf":
+			err = h.parseItemInfos(box)
+		case "iloc":
+			err = h.parseItemLocations(box)
+		case "iref":
+			err = h.parseItemReferences(box)
+		case "idat":
+			h.idat = content
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *HEIF) parseItemInfos(box *fullBox) error {
+	version := box.version()
+	count := box.id(version == 0)
+	// Each entry has at least a box header, a crafted count must not keep the loop going
+	if box.err == nil && uint64(count) > uint64(len(box.data)-box.pos)/8 {
+		return NotAHEIFFile
+	}
+	for i := uint32(0); i < count && box.err == nil; i++ {
+		r := bytes.NewReader(box.data[box.pos:])
+		a, err := nextAtom(r)
+		if err != nil {
+			return err
+		}
+		// Entries cannot extend to the end of the box, a size of 0 would never advance
+		if a.size < a.hsize || a.size > uint64(len(box.data)-box.pos) {
+			return NotAHEIFFile
+		}
+		content, err := readAtomData(r, a)
+		if err != nil {
+			return err
+		}
+		box.pos += int(a.size)
+		if a.typ != "infe" {
+			continue
+		}
+		infe := &fullBox{data: content}
+		v := infe.version()
+		if v < 2 {
+			// Legacy item info entries do not have an item type
+			continue
+		}
+		item := h.item(infe.id(v == 2))
+		infe.uint(2) // protection index
+		item.Type = string(infe.bytes(4))
+		infe.string() // item name
+		if item.Type == "mime" {
+			item.ContentType = infe.string()
+		}
+		if infe.err != nil {
+			return infe.err
+		}
+	}
+	return box.err
+}
+
+func (h *HEIF) parseItemLocations(box *fullBox) error {
+	version := box.version()
+	sizes := box.uint(2)
+	offsetSize, lengthSize := int(sizes>>12&0xF), int(sizes>>8&0xF)
+	baseOffsetSize, indexSize := int(sizes>>4&0xF), 0
+	if version == 1 || version == 2 {
+		indexSize = int(sizes & 0xF)
+	}
+	count := box.id(version < 2)
+	for i := uint32(0); i < count && box.err == nil; i++ {
+		item := h.item(box.id(version < 2))
+		if version == 1 || version == 2 {
+			item.constructionMethod = uint16(box.uint(2) & 0xF)
+		}
+		box.uint(2) // data reference index
+		base := box.uint(baseOffsetSize)
+		extents := int(box.uint(2))
+		item.extents = nil
+		for j := 0; j < extents && box.err == nil; j++ {
+			if indexSize > 0 {
+				box.uint(indexSize)
+			}
+			offset := box.uint(offsetSize)
+			length := box.uint(lengthSize)
+			item.extents = append(item.extents, heifExtent{offset: base + offset, length: length})
+		}
+	}
+	return box.err
+}
+
+func (h *HEIF) parseItemReferences(box *fullBox) error {
+	shortIDs := box.version() == 0
+	for box.pos < len(box.data) && box.err == nil {
+		size := int(box.uint(4))
+		typ := string(box.bytes(4))
+		end := box.pos + size - 8
+		from := box.id(shortIDs)
+		count := int(box.uint(2))
+		for i := 0; i < count && box.err == nil; i++ {
+			to := box.id(shortIDs)
+			switch typ {
+			case "thmb":
+				h.Thumbnails[to] = append(h.Thumbnails[to], from)
+			case "cdsc":
+				h.Descriptions[to] = append(h.Descriptions[to], from)
+			}
+		}
+		if end < box.pos || end > len(box.data) {
+			return NotAHEIFFile
+		}
+		box.pos = end
+	}
+	return box.err
+}
+
+func (h *HEIF) item(id uint32) *HEIFItem {
+	item, found := h.Items[id]
+	if !found {
+		item = &HEIFItem{ID: id}
+		h.Items[id] = item
+	}
+	return item
+}
+
+func readAtomData(r *bytes.Reader, a *Atom) ([]byte, error) {
+	size := a.SizeOfData()
+	if a.size == 0 {
+		size = int64(r.Len())
+	}
+	if size < 0 || size > int64(r.Len()) {
+		return nil, NotAHEIFFile
+	}
+	data := make([]byte, size)
+	_, err := io.ReadFull(r, data)
+	return data, err
+}
+
+// skipAtomData moves the reader past the data of the atom
+func skipAtomData(r *bytes.Reader, a *Atom) error {
+	size := a.SizeOfData()
+	if a.size == 0 {
+		size = int64(r.Len())
+	}
+	if size < 0 || size > int64(r.Len()) {
+		return NotAHEIFFile
+	}
+	_, err := r.Seek(size, io.SeekCurrent)
+	return err
+}
+
+// fullBox reads the fields of an ISO BMFF full box, the first error is kept and
+// all subsequent reads return zero values
+type fullBox struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (b *fullBox) version() uint8 {
+	// Version is followed by 3 bytes of flags
+	return uint8(b.uint(4) >> 24)
+}
+
+func (b *fullBox) bytes(n int) []byte {
+	if b.err != nil || b.pos+n > len(b.data) {
+		b.err = NotAHEIFFile
+		return make([]byte, n)
+	}
+	v := b.data[b.pos : b.pos+n]
+	b.pos += n
+	return v
+}
+
+// uint reads a big-endian unsigned integer of the given size in bytes
+func (b *fullBox) uint(n int) uint64 {
+	var v uint64
+	for _, c := range b.bytes(n) {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+// id reads a 16-bit or a 32-bit item ID
+func (b *fullBox) id(short bool) uint32 {
+	if short {
+		return uint32(b.uint(2))
+	}
+	return uint32(b.uint(4))
+}
+
+// string reads a null-terminated string
+func (b *fullBox) string() string {
+	if b.err != nil {
+		return ""
+	}
+	end := bytes.IndexByte(b.data[b.pos:], 0)
+	if end < 0 {
+		b.err = NotAHEIFFile
+		return ""
+	}
+	s := string(b.data[b.pos : b.pos+end])
+	b.pos += end + 1
+	return s
+}
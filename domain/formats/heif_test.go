@@ -0,0 +1,122 @@
+package formats
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadHEIF(t *testing.T) {
+	f, err := os.Open("../testdata/Canon_40D.heic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	heif, err := ReadHEIF(f)
+	if err != nil {
+		t.Fatalf("Failed to read HEIF: %s", err)
+	}
+	assert.Equal(t, uint32(1), heif.PrimaryItem)
+	assert.Equal(t, "hvc1", heif.Items[1].Type)
+	assert.Equal(t, "jpeg", heif.Items[2].Type)
+	assert.Equal(t, "Exif", heif.Items[3].Type)
+	assert.Equal(t, []uint32{2}, heif.Thumbnails[1])
+
+	exif, err := heif.Exif()
+	if err != nil {
+		t.Fatalf("Failed to read EXIF item: %s", err)
+	}
+	assert.True(t, bytes.HasPrefix(exif, []byte("II*\x00")), "EXIF item should start with TIFF header")
+	assert.Empty(t, heif.Descriptions[1], "The unlinked EXIF item is used")
+
+	preview, found := heif.JPEGPreview()
+	assert.True(t, found)
+	assert.True(t, bytes.HasPrefix(preview, []byte{0xFF, 0xD8}), "Preview should be a JPEG")
+
+	_, err = ReadHEIF(bytes.NewReader([]byte("\x00\x00\x00\x10ftypqt  \x00\x00\x00\x00")))
+	assert.Equal(t, NotAHEIFFile, err)
+}
+
+func TestReadHEIFWithEmptyItemInfo(t *testing.T) {
+	// Item info box announcing 2^32-1 entries, the first one with a size of 0
+	crafted := []byte("\x00\x00\x00\x10ftypheic\x00\x00\x00\x00" +
+		"\x00\x00\x00\x24meta\x00\x00\x00\x00" +
+		"\x00\x00\x00\x18iinf\x01\x00\x00\x00\xFF\xFF\xFF\xFF" +
+		"\x00\x00\x00\x00infe")
+	done := make(chan error)
+	go func() {
+		_, err := ReadHEIF(bytes.NewReader(crafted))
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		assert.Equal(t, NotAHEIFFile, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Reading the item infos does not terminate")
+	}
+}
+
+func TestReadHEIFExifOfPrimaryImage(t *testing.T) {
+	exifOther := "\x00\x00\x00\x00MM\x00*other"
+	exifPrimary := "\x00\x00\x00\x00II*\x00primary"
+	infos := []byte{0, 4}
+	for _, item := range []struct {
+		id  uint16
+		typ string
+	}{{1, "hvc1"}, {2, "Exif"}, {3, "Exif"}, {5, "hvc1"}} {
+		infos = append(infos, heifBox("infe", []byte{2, 0, 0, 0}, u16(item.id), u16(0), []byte(item.typ+"\x00"))...)
+	}
+	// The EXIF items are stored in the idat box
+	locations := heifBox("iloc", []byte{1, 0, 0, 0, 0x44, 0x00}, u16(2),
+		u16(2), u16(1), u16(0), u16(1), u32(0), u32(uint32(len(exifOther))),
+		u16(3), u16(1), u16(0), u16(1), u32(uint32(len(exifOther))), u32(uint32(len(exifPrimary))))
+	references := heifBox("iref", []byte{0, 0, 0, 0},
+		heifBox("cdsc", u16(2), u16(1), u16(5)),
+		heifBox("cdsc", u16(3), u16(1), u16(1)))
+	file := bytes.Join([][]byte{
+		heifBox("ftyp", []byte("heic\x00\x00\x00\x00mif1")),
+		heifBox("meta", []byte{0, 0, 0, 0},
+			heifBox("pitm", []byte{0, 0, 0, 0}, u16(1)),
+			heifBox("iinf", []byte{0, 0, 0, 0}, infos),
+			locations,
+			references,
+			heifBox("idat", []byte(exifOther+exifPrimary))),
+		heifBox("mdat", make([]byte, 1024)),
+	}, nil)
+	for i := 0; i < 10; i++ {
+		heif, err := ReadHEIF(bytes.NewReader(file))
+		if err != nil {
+			t.Fatalf("Failed to read HEIF: %s", err)
+		}
+		exif, err := heif.Exif()
+		if err != nil {
+			t.Fatalf("Failed to read EXIF item: %s", err)
+		}
+		assert.Equal(t, "II*\x00primary", string(exif))
+	}
+
+	// Boxes must not extend beyond the end of the file
+	_, err := ReadHEIF(bytes.NewReader(file[:len(file)-1]))
+	assert.Equal(t, NotAHEIFFile, err)
+}
+
+func heifBox(typ string, content ...[]byte) []byte {
+	data := bytes.Join(content, nil)
+	return append(append(u32(uint32(8+len(data))), typ...), data...)
+}
+
+func u16(v uint16) []byte {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, v)
+	return b
+}
+
+func u32(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	return b
+}
@@ -0,0 +1,157 @@
+package formats
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+const (
+	markerSOI   = 0xD8
+	markerSOS   = 0xDA
+	markerAPP13 = 0xED
+
+	resourceIPTC = 0x0404
+
+	iptcApplicationRecord = 2
+	iptcKeywords          = 25
+)
+
+var (
+	ErrNotAJPEG = errors.New("Not a JPEG file")
+
+	photoshopHeader = []byte("Photoshop 3.0\x00")
+	resourceMarker  = []byte("8BIM")
+)
+
+// ReadIPTCKeywords returns the keywords found in the IPTC block of a JPEG file. The IPTC
+// block is stored as a Photoshop image resource in the APP13 segment
+func ReadIPTCKeywords(in io.Reader) ([]string, error) {
+	r := bufio.NewReader(in)
+	var marker [2]byte
+	if _, err := io.ReadFull(r, marker[:]); err != nil {
+		return nil, err
+	}
+	if marker[0] != 0xFF || marker[1] != markerSOI {
+		return nil, ErrNotAJPEG
+	}
+	var keywords []string
+	for {
+		if _, err := io.ReadFull(r, marker[:]); err != nil {
+			return keywords, err
+		}
+		if marker[0] != 0xFF {
+			return keywords, ErrNotAJPEG
+		}
+		switch {
+		case marker[1] == 0xFF:
+			// Fill byte, the actual marker follows
+			r.UnreadByte()
+			continue
+		case marker[1] == markerSOS:
+			// Image data follows, no more meta-data
+			return keywords, nil
+		case marker[1] >= 0xD0 && marker[1] <= 0xD7, marker[1] == 0x01:
+			// Markers without payload
+			continue
+		}
+		var length uint16
+		if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+			return keywords, err
+		}
+		if length < 2 {
+			return keywords, ErrNotAJPEG
+		}
+		if marker[1] != markerAPP13 {
+			if _, err := r.Discard(int(length) - 2); err != nil {
+				return keywords, err
+			}
+			continue
+		}
+		segment := make([]byte, length-2)
+		if _, err := io.ReadFull(r, segment); err != nil {
+			return keywords, err
+		}
+		keywords = append(keywords, keywordsFromPhotoshopResources(segment)...)
+	}
+}
+
+func keywordsFromPhotoshopResources(segment []byte) (keywords []string) {
+	if !bytes.HasPrefix(segment, photoshopHeader) {
+		return
+	}
+	data := segment[len(photoshopHeader):]
+	for len(data) >= 12 && bytes.HasPrefix(data, resourceMarker) {
+		id := binary.BigEndian.Uint16(data[4:6])
+		// Pascal string padded to an even length
+		nameLen := int(data[6]) + 1
+		nameLen += nameLen % 2
+		if len(data) < 6+nameLen+4 {
+			return
+		}
+		data = data[6+nameLen:]
+		size := int(binary.BigEndian.Uint32(data[0:4]))
+		data = data[4:]
+		if size > len(data) {
+			return
+		}
+		if id == resourceIPTC {
+			keywords = append(keywords, keywordsFromIPTC(data[:size])...)
+		}
+		size += size % 2
+		if size > len(data) {
+			return
+		}
+		data = data[size:]
+	}
+	return
+}
+
+func keywordsFromIPTC(data []byte) (keywords []string) {
+	for len(data) >= 5 && data[0] == 0x1C {
+		record, dataset := data[1], data[2]
+		size := int(binary.BigEndian.Uint16(data[3:5]))
+		if size&0x8000 != 0 {
+			// Extended datasets are not used for keywords
+			return
+		}
+		data = data[5:]
+		if size > len(data) {
+			return
+		}
+		if record == iptcApplicationRecord && dataset == iptcKeywords {
+			keywords = append(keywords, decodeIPTCString(data[:size]))
+		}
+		data = data[size:]
+	}
+	return
+}
+
+// decodeIPTCString decodes UTF-8 strings and falls back to Latin-1 for legacy files
+func decodeIPTCString(data []byte) string {
+	if utf8.Valid(data) {
+		return string(data)
+	}
+	runes := make([]rune, len(data))
+	for i, b := range data {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+
+// DecodeUTF16LE decodes a zero terminated little-endian UTF-16 string as used by the Windows XP tags of EXIF
+func DecodeUTF16LE(data []byte) string {
+	codes := make([]uint16, 0, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		c := binary.LittleEndian.Uint16(data[i:])
+		if c == 0 {
+			break
+		}
+		codes = append(codes, c)
+	}
+	return string(utf16.Decode(codes))
+}
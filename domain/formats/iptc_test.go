@@ -0,0 +1,48 @@
+package formats
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func TestReadIPTCKeywords(t *testing.T) {
+	var iptc bytes.Buffer
+	for _, k := range []string{"beach", "Zürich"} {
+		iptc.Write([]byte{0x1C, iptcApplicationRecord, iptcKeywords})
+		binary.Write(&iptc, binary.BigEndian, uint16(len(k)))
+		iptc.WriteString(k)
+	}
+	var resources bytes.Buffer
+	resources.Write(photoshopHeader)
+	resources.Write(resourceMarker)
+	binary.Write(&resources, binary.BigEndian, uint16(resourceIPTC))
+	resources.Write([]byte{0, 0})
+	binary.Write(&resources, binary.BigEndian, uint32(iptc.Len()))
+	resources.Write(iptc.Bytes())
+
+	var jpeg bytes.Buffer
+	jpeg.Write([]byte{0xFF, markerSOI})
+	jpeg.Write([]byte{0xFF, 0xE0, 0x00, 0x04, 0x00, 0x00})
+	jpeg.Write([]byte{0xFF, markerAPP13})
+	binary.Write(&jpeg, binary.BigEndian, uint16(resources.Len()+2))
+	jpeg.Write(resources.Bytes())
+	jpeg.Write([]byte{0xFF, markerSOS})
+
+	keywords, err := ReadIPTCKeywords(&jpeg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"beach", "Zürich"}
+	if !reflect.DeepEqual(expected, keywords) {
+		t.Errorf("Bad keywords, expected %v, got %v", expected, keywords)
+	}
+}
+
+func TestDecodeUTF16LE(t *testing.T) {
+	raw := []byte{'a', 0, ';', 0, 'b', 0, 0, 0}
+	if s := DecodeUTF16LE(raw); s != "a;b" {
+		t.Errorf("Bad value, expected %s, got %s", "a;b", s)
+	}
+}
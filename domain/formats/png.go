@@ -0,0 +1,85 @@
+package formats
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+)
+
+// maxChunkSize is the maximum size of meta-data chunks read into memory
+const maxChunkSize = 1024 * 1024
+
+var (
+	ErrNotAPNG = errors.New("Not a PNG file")
+
+	pngSignature = []byte("\x89PNG\r\n\x1a\n")
+)
+
+// PNGMetaData is the meta-data found in the ancillary chunks of a PNG file
+type PNGMetaData struct {
+	// Exif is the raw TIFF data of the eXIf chunk
+	Exif []byte
+	// Text contains the keyword/text pairs of the tEXt chunks
+	Text map[string]string
+	// Width and Height are the dimensions found in the IHDR chunk
+	Width, Height int
+}
+
+// ReadPNGMetaData reads the IHDR, eXIf and tEXt chunks preceding the image data of a PNG file
+func ReadPNGMetaData(in io.Reader) (meta PNGMetaData, err error) {
+	var signature [8]byte
+	if _, err = io.ReadFull(in, signature[:]); err != nil {
+		return
+	}
+	if !bytes.Equal(signature[:], pngSignature) {
+		return meta, ErrNotAPNG
+	}
+	meta.Text = make(map[string]string)
+	var header [8]byte
+	for {
+		if _, err = io.ReadFull(in, header[:]); err != nil {
+			return
+		}
+		length := binary.BigEndian.Uint32(header[0:4])
+		chunkType := string(header[4:8])
+		switch chunkType {
+		case "IDAT", "IEND":
+			// Meta-data after the image data is not supported
+			return meta, nil
+		case "IHDR":
+			if length < 8 || length > maxChunkSize {
+				return meta, ErrNotAPNG
+			}
+			data := make([]byte, length+4)
+			if _, err = io.ReadFull(in, data); err != nil {
+				return
+			}
+			meta.Width = int(binary.BigEndian.Uint32(data[0:4]))
+			meta.Height = int(binary.BigEndian.Uint32(data[4:8]))
+		case "eXIf", "tEXt":
+			if length > maxChunkSize {
+				return meta, ErrNotAPNG
+			}
+			data := make([]byte, length+4)
+			if _, err = io.ReadFull(in, data); err != nil {
+				return
+			}
+			data, crc := data[:length], binary.BigEndian.Uint32(data[length:])
+			if crc32.Update(crc32.ChecksumIEEE(header[4:8]), crc32.IEEETable, data) != crc {
+				// Corrupted chunks are ignored
+				continue
+			}
+			if chunkType == "eXIf" {
+				meta.Exif = data
+			} else if sep := bytes.IndexByte(data, 0); sep > 0 {
+				meta.Text[string(data[:sep])] = decodeIPTCString(data[sep+1:])
+			}
+		default:
+			if _, err = io.CopyN(io.Discard, in, int64(length)+4); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package formats
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadPNGMetaData(t *testing.T) {
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, image.NewGray(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+	// Insert the meta-data chunks after the IHDR chunk
+	ihdrEnd := len(pngSignature) + 8 + 13 + 4
+	var in bytes.Buffer
+	in.Write(encoded.Bytes()[:ihdrEnd])
+	writePNGChunk(&in, "tEXt", []byte("Creation Time\x002019-06-14T12:30:00Z"))
+	writePNGChunk(&in, "eXIf", []byte("MM\x00\x2a"))
+	in.Write(encoded.Bytes()[ihdrEnd:])
+
+	meta, err := ReadPNGMetaData(&in)
+	if err != nil {
+		t.Fatalf("Failed to read PNG meta-data: %s", err)
+	}
+	assert.Equal(t, "2019-06-14T12:30:00Z", meta.Text["Creation Time"])
+	assert.Equal(t, []byte("MM\x00\x2a"), meta.Exif)
+
+	_, err = ReadPNGMetaData(bytes.NewReader([]byte("GIF89a..")))
+	assert.Equal(t, ErrNotAPNG, err)
+}
+
+func writePNGChunk(out *bytes.Buffer, chunkType string, data []byte) {
+	binary.Write(out, binary.BigEndian, uint32(len(data)))
+	out.WriteString(chunkType)
+	out.Write(data)
+	crc := crc32.Update(crc32.ChecksumIEEE([]byte(chunkType)), crc32.IEEETable, data)
+	binary.Write(out, binary.BigEndian, crc)
+}
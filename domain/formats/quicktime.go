@@ -1,9 +1,12 @@
 package formats
 
 import (
+	"bytes"
 	"encoding/binary"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"math"
 	"regexp"
 	"strconv"
 	"time"
@@ -14,15 +17,20 @@ import (
 const (
 	fType     = "ftyp"
 	movieData = "moov"
+	movieHdr  = "mvhd"
+	userData  = "udta"
 	meta      = "meta"
+	location  = "\xa9xyz"
+	track     = "trak"
 )
 
 var (
 	NotAQuickTimeFile error = fmt.Errorf("Not a quicktime file")
 	atoms             map[string]AtomParser
 	metaDataParsers   = map[string]MetaDataParser{
-		"com.apple.quicktime.creationdate":     setCreationDate,
-		"com.apple.quicktime.location.ISO6709": setLocation,
+		"com.apple.quicktime.creationdate":       setCreationDate,
+		"com.apple.quicktime.location.ISO6709":   setLocation,
+		"com.apple.quicktime.content.identifier": setContentIdentifier,
 	}
 )
 
@@ -61,6 +69,52 @@ type Quicktime struct {
 	Atoms        []*Atom
 	creationDate time.Time
 	coords       *gps.Coordinates
+	// contentID links the video of a Live Photo with its still image
+	contentID string
+
+	// Fallbacks used when the Apple meta-data keys are absent, as in most MP4 files
+	movieCreated time.Time
+	userCoords   *gps.Coordinates
+
+	duration   time.Duration
+	videoTrack *VideoTrack
+	// currentTrack collects the properties of the track being parsed
+	currentTrack *trackInfo
+}
+
+// VideoTrack describes the first video track of a movie
+type VideoTrack struct {
+	Width  int
+	Height int
+	// Codec is the fourcc of the sample description, like avc1 or hvc1
+	Codec string
+	// Rotation is the clockwise rotation in degrees of the track matrix
+	Rotation int
+}
+
+type trackInfo struct {
+	VideoTrack
+	handler string
+}
+
+// quicktimeEpoch is the reference of the timestamps of the movie header
+var quicktimeEpoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Brands returns the major and the compatible brands of the 'ftyp' atom at the start
+// of the given header of an ISO base media file
+func Brands(header []byte) (major string, compatible []string, ok bool) {
+	if len(header) < 16 || string(header[4:8]) != fType {
+		return "", nil, false
+	}
+	size := int(binary.BigEndian.Uint32(header[0:4]))
+	if size > len(header) {
+		size = len(header)
+	}
+	major = string(header[8:12])
+	for i := 16; i+4 <= size; i += 4 {
+		compatible = append(compatible, string(header[i:i+4]))
+	}
+	return major, compatible, true
 }
 
 func (parent *Atom) Walk(f AtomWalker, level int) {
@@ -97,14 +151,43 @@ func (qt *Quicktime) Walk(f AtomWalker) {
 	}
 }
 
+// DateTaken returns the creation date of the Apple meta-data or else the creation time of the movie
 func (qt *Quicktime) DateTaken() time.Time {
+	if qt.creationDate.IsZero() {
+		return qt.movieCreated
+	}
 	return qt.creationDate
 }
 
+// HasTimeZone returns true if the creation date has been found in the Apple meta-data, which
+// includes the UTC offset of the local time
+func (qt *Quicktime) HasTimeZone() bool {
+	return !qt.creationDate.IsZero()
+}
+
+// Duration returns the duration of the movie from the movie header
+func (qt *Quicktime) Duration() time.Duration {
+	return qt.duration
+}
+
+// Video returns the properties of the first video track, nil is returned if there is no video track
+func (qt *Quicktime) Video() *VideoTrack {
+	return qt.videoTrack
+}
+
+// Location returns the location of the Apple meta-data or else the location of the user data
 func (qt *Quicktime) Location() *gps.Coordinates {
+	if qt.coords == nil {
+		return qt.userCoords
+	}
 	return qt.coords
 }
 
+// ContentIdentifier returns the identifier shared by the still image and the video of a Live Photo
+func (qt *Quicktime) ContentIdentifier() string {
+	return qt.contentID
+}
+
 func (qt *Quicktime) defineKey(i uint32, name string) {
 	qt.keys[i] = name
 }
@@ -157,6 +240,185 @@ func skip(in io.Reader, nb int64) error {
 	}
 }
 
+// parseMeta parses the children of a 'meta' atom, which is a full box with version and
+// flags in MP4 files but a plain container in QuickTime files
+func parseMeta(qt *Quicktime, in io.Reader, parent AtomContainer) error {
+	var versionFlags [4]byte
+	if _, err := io.ReadFull(in, versionFlags[:]); err != nil {
+		return err
+	}
+	if versionFlags != [4]byte{} {
+		// First bytes are the size of the first child atom
+		in = io.MultiReader(bytes.NewReader(versionFlags[:]), in)
+	}
+	return parseAtoms(qt, in, parent)
+}
+
+// parseUserData parses the children of the 'udta' atom, QuickTime allows the list of
+// user data atoms to be terminated by 4 zero bytes
+func parseUserData(qt *Quicktime, in io.Reader, parent AtomContainer) error {
+	if err := parseAtoms(qt, in, parent); err != nil && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	_, err := io.Copy(ioutil.Discard, in)
+	return err
+}
+
+// parseMovieHeader reads the creation time and the duration of the movie, a zero creation time is ignored
+func parseMovieHeader(qt *Quicktime, in io.Reader, parent AtomContainer) error {
+	var versionFlags uint32
+	if err := binary.Read(in, binary.BigEndian, &versionFlags); err != nil {
+		return err
+	}
+	var header struct {
+		Created   uint64
+		Modified  uint64
+		TimeScale uint32
+		Duration  uint64
+	}
+	if versionFlags>>24 == 1 {
+		if err := binary.Read(in, binary.BigEndian, &header); err != nil {
+			return err
+		}
+	} else {
+		var header32 struct {
+			Created   uint32
+			Modified  uint32
+			TimeScale uint32
+			Duration  uint32
+		}
+		if err := binary.Read(in, binary.BigEndian, &header32); err != nil {
+			return err
+		}
+		header.Created, header.TimeScale, header.Duration = uint64(header32.Created), header32.TimeScale, uint64(header32.Duration)
+		if header32.Duration == math.MaxUint32 {
+			header.Duration = math.MaxUint64
+		}
+	}
+	if header.Created != 0 {
+		qt.movieCreated = quicktimeEpoch.Add(time.Duration(header.Created) * time.Second)
+	}
+	// A duration with all bits set is unknown
+	if header.TimeScale != 0 && header.Duration != math.MaxUint64 {
+		scale := uint64(header.TimeScale)
+		seconds, rest := header.Duration/scale, header.Duration%scale
+		if seconds < uint64(math.MaxInt64/int64(time.Second)) {
+			qt.duration = time.Duration(seconds)*time.Second + time.Duration(rest)*time.Second/time.Duration(scale)
+		}
+	}
+	_, err := io.Copy(ioutil.Discard, in)
+	return err
+}
+
+// parseTrack parses the atoms of a track and keeps the first video track
+func parseTrack(qt *Quicktime, in io.Reader, parent AtomContainer) error {
+	qt.currentTrack = &trackInfo{}
+	defer func() { qt.currentTrack = nil }()
+	if err := parseAtoms(qt, in, parent); err != nil {
+		return err
+	}
+	if qt.currentTrack.handler == "vide" && qt.videoTrack == nil {
+		video := qt.currentTrack.VideoTrack
+		qt.videoTrack = &video
+	}
+	return nil
+}
+
+// parseTrackHeader reads the matrix and the dimensions of a track
+func parseTrackHeader(qt *Quicktime, in io.Reader, parent AtomContainer) error {
+	var versionFlags uint32
+	if err := binary.Read(in, binary.BigEndian, &versionFlags); err != nil {
+		return err
+	}
+	// Skip times, track ID and duration
+	timesSize := int64(20)
+	if versionFlags>>24 == 1 {
+		timesSize = 32
+	}
+	// Skip reserved, layer, alternate group, volume and reserved
+	if _, err := io.CopyN(ioutil.Discard, in, timesSize+16); err != nil {
+		return err
+	}
+	var header struct {
+		Matrix [9]int32
+		Width  uint32
+		Height uint32
+	}
+	if err := binary.Read(in, binary.BigEndian, &header); err != nil {
+		return err
+	}
+	if qt.currentTrack != nil {
+		// Dimensions are 16.16 fixed point numbers
+		qt.currentTrack.Width = int(header.Width >> 16)
+		qt.currentTrack.Height = int(header.Height >> 16)
+		qt.currentTrack.Rotation = rotationOf(header.Matrix)
+	}
+	_, err := io.Copy(ioutil.Discard, in)
+	return err
+}
+
+// rotationOf returns the clockwise rotation in degrees of the given transformation matrix
+func rotationOf(matrix [9]int32) int {
+	a, b := float64(matrix[0]), float64(matrix[1])
+	degrees := int(math.Round(math.Atan2(b, a) * 180 / math.Pi))
+	return (degrees + 360) % 360
+}
+
+// parseHandler reads the type of the media of a track
+func parseHandler(qt *Quicktime, in io.Reader, parent AtomContainer) error {
+	var header struct {
+		VersionFlags uint32
+		PreDefined   uint32
+		HandlerType  [4]byte
+	}
+	if err := binary.Read(in, binary.BigEndian, &header); err != nil {
+		return err
+	}
+	if qt.currentTrack != nil {
+		qt.currentTrack.handler = string(header.HandlerType[:])
+	}
+	_, err := io.Copy(ioutil.Discard, in)
+	return err
+}
+
+// parseSampleDescription reads the codec of the first sample description of a track
+func parseSampleDescription(qt *Quicktime, in io.Reader, parent AtomContainer) error {
+	var header struct {
+		VersionFlags uint32
+		Entries      uint32
+		Size         uint32
+		Format       [4]byte
+	}
+	if err := binary.Read(in, binary.BigEndian, &header); err != nil {
+		return err
+	}
+	if qt.currentTrack != nil && header.Entries > 0 {
+		qt.currentTrack.Codec = string(header.Format[:])
+	}
+	_, err := io.Copy(ioutil.Discard, in)
+	return err
+}
+
+// parseUserLocation reads the ISO 6709 location of the user data
+func parseUserLocation(qt *Quicktime, in io.Reader, parent AtomContainer) error {
+	var header struct {
+		Size     uint16
+		Language uint16
+	}
+	if err := binary.Read(in, binary.BigEndian, &header); err != nil {
+		return err
+	}
+	value := make([]byte, header.Size)
+	if _, err := io.ReadFull(in, value); err != nil {
+		return err
+	}
+	var parsed Quicktime
+	setLocation(&parsed, "", string(value))
+	qt.userCoords = parsed.coords
+	_, err := io.Copy(ioutil.Discard, in)
+	return err
+}
+
 func parseKeys(qt *Quicktime, in io.Reader, parent AtomContainer) error {
 	var header struct {
 		VersionFlags uint32
@@ -267,6 +529,11 @@ func setCreationDate(qt *Quicktime, key, value string) error {
 	return nil
 }
 
+func setContentIdentifier(qt *Quicktime, key, value string) error {
+	qt.contentID = value
+	return nil
+}
+
 func setLocation(qt *Quicktime, key, value string) error {
 	re := regexp.MustCompile("([-+]\\d+\\.?\\d*)")
 	matches := re.FindAllString(value, 3)
@@ -289,7 +556,17 @@ func setLocation(qt *Quicktime, key, value string) error {
 func init() {
 	atoms = map[string]AtomParser{
 		movieData: parseAtoms,
-		meta:      parseAtoms,
+		movieHdr:  parseMovieHeader,
+		track:     parseTrack,
+		"mdia":    parseAtoms,
+		"minf":    parseAtoms,
+		"stbl":    parseAtoms,
+		"tkhd":    parseTrackHeader,
+		"hdlr":    parseHandler,
+		"stsd":    parseSampleDescription,
+		userData:  parseUserData,
+		meta:      parseMeta,
+		location:  parseUserLocation,
 		"keys":    parseKeys,
 		"ilst":    parseItemList,
 	}
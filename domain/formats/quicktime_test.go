@@ -1,6 +1,10 @@
 package formats
 
 import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"strings"
 	"testing"
 	"time"
 )
@@ -31,3 +35,122 @@ func TestCreationDateDecoding(t *testing.T) {
 	}
 
 }
+
+func atom(typ string, content ...[]byte) []byte {
+	var buf bytes.Buffer
+	size := 8
+	for _, c := range content {
+		size += len(c)
+	}
+	binary.Write(&buf, binary.BigEndian, uint32(size))
+	buf.WriteString(typ)
+	for _, c := range content {
+		buf.Write(c)
+	}
+	return buf.Bytes()
+}
+
+func TestMP4Fallbacks(t *testing.T) {
+	created := time.Date(2019, 7, 14, 10, 30, 0, 0, time.UTC)
+	mvhd := make([]byte, 100)
+	binary.BigEndian.PutUint32(mvhd[4:], uint32(created.Sub(quicktimeEpoch)/time.Second))
+	xyz := []byte("\x00\x12\x15\xc7+46.5197+006.6323/")
+	mp4 := bytes.Join([][]byte{
+		atom(fType, []byte("isom\x00\x00\x02\x00isomiso2mp41")),
+		atom(movieData,
+			atom(movieHdr, mvhd),
+			atom(userData,
+				atom(location, xyz),
+				atom(meta, []byte{0, 0, 0, 0}, atom("hdlr", make([]byte, 24))),
+				[]byte{0, 0, 0, 0},
+			),
+		),
+		atom("mdat", make([]byte, 16)),
+	}, nil)
+
+	qt, err := ReadAsQuicktime(bytes.NewReader(mp4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !qt.DateTaken().Equal(created) {
+		t.Errorf("Bad date taken, expected %s, got %s", created, qt.DateTaken())
+	}
+	if qt.Location() == nil {
+		t.Fatal("Expected location from user data")
+	}
+	if iso6709 := qt.Location().ISO6709(); iso6709 != "+46.519700+006.632300/" {
+		t.Errorf("Bad location, got %s", iso6709)
+	}
+
+	major, compatible, ok := Brands(mp4)
+	if !ok {
+		t.Fatal("Expected brands of ftyp atom")
+	}
+	if major != "isom" || strings.Join(compatible, ",") != "isom,iso2,mp41" {
+		t.Errorf("Bad brands, got %s %v", major, compatible)
+	}
+	if _, _, ok := Brands([]byte("not an iso base media file")); ok {
+		t.Error("Expected no brands for non-ISO file")
+	}
+}
+
+func TestVideoTrack(t *testing.T) {
+	mvhd := make([]byte, 100)
+	binary.BigEndian.PutUint32(mvhd[12:], 600)
+	binary.BigEndian.PutUint32(mvhd[16:], 7500)
+	trak := func(handler, codec string, width, height uint32, matrix [9]int32) []byte {
+		tkhd := new(bytes.Buffer)
+		tkhd.Write(make([]byte, 40))
+		binary.Write(tkhd, binary.BigEndian, matrix)
+		binary.Write(tkhd, binary.BigEndian, []uint32{width << 16, height << 16})
+		hdlr := append(make([]byte, 8), handler...)
+		hdlr = append(hdlr, make([]byte, 13)...)
+		stsd := []byte{0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 16}
+		stsd = append(append(stsd, codec...), make([]byte, 8)...)
+		return atom(track,
+			atom("tkhd", tkhd.Bytes()),
+			atom("mdia",
+				atom("mdhd", make([]byte, 24)),
+				atom("hdlr", hdlr),
+				atom("minf", atom("stbl", atom("stsd", stsd))),
+			),
+		)
+	}
+	identity := [9]int32{0x10000, 0, 0, 0, 0x10000, 0, 0, 0, 0x40000000}
+	rotated := [9]int32{0, 0x10000, 0, -0x10000, 0, 0, 0, 0, 0x40000000}
+	mov := atom(movieData,
+		atom(movieHdr, mvhd),
+		trak("soun", "mp4a", 0, 0, identity),
+		trak("vide", "hvc1", 1920, 1080, rotated),
+		trak("vide", "jpeg", 320, 240, identity),
+	)
+
+	qt, err := ReadAsQuicktime(bytes.NewReader(mov))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if qt.Duration() != 12500*time.Millisecond {
+		t.Errorf("Bad duration, expected 12.5s, got %s", qt.Duration())
+	}
+
+	// Ten days at a time scale of 90kHz overflow when multiplied by a second
+	mvhd64 := make([]byte, 112)
+	mvhd64[0] = 1
+	binary.BigEndian.PutUint32(mvhd64[20:], 90000)
+	binary.BigEndian.PutUint64(mvhd64[24:], 240*3600*90000)
+	if qt, err := ReadAsQuicktime(bytes.NewReader(atom(movieData, atom(movieHdr, mvhd64)))); err != nil {
+		t.Fatal(err)
+	} else if qt.Duration() != 240*time.Hour {
+		t.Errorf("Bad duration, expected 240h, got %s", qt.Duration())
+	}
+	binary.BigEndian.PutUint32(mvhd[16:], math.MaxUint32)
+	if qt, err := ReadAsQuicktime(bytes.NewReader(atom(movieData, atom(movieHdr, mvhd)))); err != nil {
+		t.Fatal(err)
+	} else if qt.Duration() != 0 {
+		t.Errorf("Unknown duration should be 0, got %s", qt.Duration())
+	}
+	expected := VideoTrack{Width: 1920, Height: 1080, Codec: "hvc1", Rotation: 90}
+	if qt.Video() == nil || *qt.Video() != expected {
+		t.Errorf("Bad video track, expected %v, got %v", expected, qt.Video())
+	}
+}
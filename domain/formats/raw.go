@@ -0,0 +1,271 @@
+package formats
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"sort"
+)
+
+// maxRawSize is the maximum size of RAW files read into memory, previews are located by
+// absolute offsets in the file which requires random access
+const maxRawSize = 512 * 1024 * 1024
+
+// maxIFDs limits the number of image file directories visited in broken or looping files
+const maxIFDs = 64
+
+var (
+	NotATIFFFile = errors.New("Not a TIFF based file")
+	ErrNoPreview = errors.New("No JPEG preview found")
+)
+
+const (
+	tagCompression     = 0x0103
+	tagMake            = 0x010F
+	tagStripOffsets    = 0x0111
+	tagStripByteCounts = 0x0117
+	tagSubIFDs         = 0x014A
+	tagJPEGOffset      = 0x0201
+	tagJPEGLength      = 0x0202
+	tagExifIFD         = 0x8769
+	tagDNGVersion      = 0xC612
+)
+
+// tiffFile gives access to the image file directories of a TIFF file
+type tiffFile struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+type ifdEntry struct {
+	typ    uint16
+	count  uint32
+	offset int
+}
+
+type ifd struct {
+	entries map[uint16]ifdEntry
+	next    uint32
+}
+
+func newTIFFFile(data []byte) (*tiffFile, error) {
+	if len(data) < 8 {
+		return nil, NotATIFFFile
+	}
+	t := &tiffFile{data: data}
+	switch string(data[0:4]) {
+	case "II*\x00":
+		t.order = binary.LittleEndian
+	case "MM\x00*":
+		t.order = binary.BigEndian
+	default:
+		return nil, NotATIFFFile
+	}
+	return t, nil
+}
+
+// IsTIFF returns true if the given header is the start of a TIFF file
+func IsTIFF(header []byte) bool {
+	_, err := newTIFFFile(header)
+	return err == nil
+}
+
+// RawKindOf returns the RAW format of the TIFF based file starting with the given header,
+// one of dng, cr2, nef or arw. An empty string is returned for other files
+func RawKindOf(header []byte) string {
+	t, err := newTIFFFile(header)
+	if err != nil {
+		return ""
+	}
+	if len(header) > 10 && string(header[8:10]) == "CR" && header[10] == 2 {
+		return "cr2"
+	}
+	ifd0, err := t.ifd(t.order.Uint32(header[4:8]))
+	if err != nil {
+		return ""
+	}
+	if _, found := ifd0.entries[tagDNGVersion]; found {
+		return "dng"
+	}
+	maker := t.ascii(ifd0, tagMake)
+	switch {
+	case bytes.HasPrefix(maker, []byte("NIKON")):
+		return "nef"
+	case bytes.HasPrefix(maker, []byte("SONY")):
+		return "arw"
+	}
+	return ""
+}
+
+// ReadRawPreview returns the largest baseline JPEG image embedded in a TIFF based RAW file
+func ReadRawPreview(in io.Reader) ([]byte, error) {
+	previews, err := ReadRawPreviews(in)
+	if err != nil {
+		return nil, err
+	}
+	return previews[len(previews)-1], nil
+}
+
+// ReadRawPreviews returns all baseline JPEG images embedded in a TIFF based RAW file, ordered
+// by ascending size in bytes
+func ReadRawPreviews(in io.Reader) ([][]byte, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(in, maxRawSize))
+	if err != nil {
+		return nil, err
+	}
+	t, err := newTIFFFile(data)
+	if err != nil {
+		return nil, err
+	}
+	var previews [][]byte
+	visited := make(map[uint32]bool)
+	pending := []uint32{t.order.Uint32(data[4:8])}
+	for len(pending) > 0 && len(visited) < maxIFDs {
+		offset := pending[0]
+		pending = pending[1:]
+		if offset == 0 || visited[offset] {
+			continue
+		}
+		visited[offset] = true
+		dir, err := t.ifd(offset)
+		if err != nil {
+			continue
+		}
+		pending = append(pending, dir.next)
+		pending = append(pending, t.values(dir, tagSubIFDs)...)
+		pending = append(pending, t.values(dir, tagExifIFD)...)
+		if jpeg := t.jpegOf(dir); jpeg != nil {
+			previews = append(previews, jpeg)
+		}
+	}
+	if len(previews) == 0 {
+		return nil, ErrNoPreview
+	}
+	sort.SliceStable(previews, func(i, j int) bool { return len(previews[i]) < len(previews[j]) })
+	return previews, nil
+}
+
+// jpegOf returns the baseline JPEG image described by the given directory, if any
+func (t *tiffFile) jpegOf(dir ifd) []byte {
+	offsets, lengths := t.values(dir, tagJPEGOffset), t.values(dir, tagJPEGLength)
+	if len(offsets) != 1 || len(lengths) != 1 {
+		compression := t.values(dir, tagCompression)
+		if len(compression) != 1 || (compression[0] != 6 && compression[0] != 7) {
+			return nil
+		}
+		offsets, lengths = t.values(dir, tagStripOffsets), t.values(dir, tagStripByteCounts)
+		if len(offsets) != 1 || len(lengths) != 1 {
+			return nil
+		}
+	}
+	start, end := uint64(offsets[0]), uint64(offsets[0])+uint64(lengths[0])
+	if end > uint64(len(t.data)) {
+		return nil
+	}
+	jpeg := t.data[start:end]
+	if !isBaselineJPEG(jpeg) {
+		return nil
+	}
+	return jpeg
+}
+
+// isBaselineJPEG checks that the given data is a JPEG image which can be decoded, RAW files
+// also embed the sensor data as lossless JPEG
+func isBaselineJPEG(data []byte) bool {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return false
+	}
+	for pos := 2; pos+4 <= len(data); {
+		if data[pos] != 0xFF {
+			return false
+		}
+		marker := data[pos+1]
+		switch {
+		case marker == 0xFF:
+			// Fill byte
+			pos++
+			continue
+		case marker == 0xC0 || marker == 0xC1 || marker == 0xC2:
+			return true
+		case marker >= 0xC3 && marker <= 0xCF && marker != 0xC4 && marker != 0xC8 && marker != 0xCC:
+			return false
+		case marker == 0xDA:
+			return false
+		}
+		pos += 2 + int(binary.BigEndian.Uint16(data[pos+2:]))
+	}
+	return false
+}
+
+func (t *tiffFile) ifd(offset uint32) (dir ifd, err error) {
+	start := int(offset)
+	if start < 8 || start+2 > len(t.data) {
+		return dir, NotATIFFFile
+	}
+	count := int(t.order.Uint16(t.data[start:]))
+	end := start + 2 + count*12
+	if end+4 > len(t.data) {
+		return dir, NotATIFFFile
+	}
+	dir.entries = make(map[uint16]ifdEntry, count)
+	for pos := start + 2; pos < end; pos += 12 {
+		e := ifdEntry{
+			typ:    t.order.Uint16(t.data[pos+2:]),
+			count:  t.order.Uint32(t.data[pos+4:]),
+			offset: pos + 8,
+		}
+		if size := uint64(typeSize(e.typ)) * uint64(e.count); size > 4 {
+			// Values which do not fit in the entry are stored at the given offset
+			e.offset = int(t.order.Uint32(t.data[pos+8:]))
+			if uint64(e.offset)+size > uint64(len(t.data)) {
+				continue
+			}
+		}
+		dir.entries[t.order.Uint16(t.data[pos:])] = e
+	}
+	dir.next = t.order.Uint32(t.data[end:])
+	return dir, nil
+}
+
+// values returns the integer values of the given tag, entries of other types are ignored
+func (t *tiffFile) values(dir ifd, tag uint16) []uint32 {
+	e, found := dir.entries[tag]
+	if !found || (e.typ != 3 && e.typ != 4 && e.typ != 13) {
+		return nil
+	}
+	values := make([]uint32, e.count)
+	for i := range values {
+		if e.typ == 3 {
+			values[i] = uint32(t.order.Uint16(t.data[e.offset+2*i:]))
+		} else {
+			values[i] = t.order.Uint32(t.data[e.offset+4*i:])
+		}
+	}
+	return values
+}
+
+// ascii returns the value of the given ASCII tag without the terminating null byte
+func (t *tiffFile) ascii(dir ifd, tag uint16) []byte {
+	e, found := dir.entries[tag]
+	if !found || e.typ != 2 {
+		return nil
+	}
+	return bytes.TrimRight(t.data[e.offset:e.offset+int(e.count)], "\x00")
+}
+
+// typeSize returns the size in bytes of the values of the given TIFF field type
+func typeSize(typ uint16) int {
+	switch typ {
+	case 1, 2, 6, 7:
+		return 1
+	case 3, 8:
+		return 2
+	case 4, 9, 11, 13:
+		return 4
+	case 5, 10, 12:
+		return 8
+	}
+	return 0
+}
@@ -0,0 +1,49 @@
+package formats
+
+import (
+	"bytes"
+	"image/jpeg"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadRawPreview(t *testing.T) {
+	data, err := ioutil.ReadFile("../testdata/nikon.nef")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, IsTIFF(data))
+	assert.Equal(t, "nef", RawKindOf(data))
+
+	preview, err := ReadRawPreview(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to read preview: %s", err)
+	}
+	// The lossless sensor data is larger but cannot be decoded, the thumbnail is smaller
+	img, err := jpeg.Decode(bytes.NewReader(preview))
+	if err != nil {
+		t.Fatalf("Failed to decode preview: %s", err)
+	}
+	assert.Equal(t, 160, img.Bounds().Dx())
+	previews, err := ReadRawPreviews(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to read previews: %s", err)
+	}
+	assert.Equal(t, preview, previews[len(previews)-1], "Previews are ordered by size")
+
+	_, err = ReadRawPreview(bytes.NewReader([]byte("MM\x00*\x00\x00\x00\x08\x00\x00\x00\x00\x00\x00")))
+	assert.Equal(t, ErrNoPreview, err)
+	_, err = ReadRawPreview(bytes.NewReader([]byte("\xFF\xD8\xFF\xE0")))
+	assert.Equal(t, NotATIFFFile, err)
+}
+
+func TestRawKindOf(t *testing.T) {
+	assert.Equal(t, "cr2", RawKindOf([]byte("II*\x00\x10\x00\x00\x00CR\x02\x00\x00\x00\x00\x00")))
+	// DNG files have a DNGVersion tag in the first directory
+	dng := []byte("MM\x00*\x00\x00\x00\x08\x00\x01\xC6\x12\x00\x01\x00\x00\x00\x04\x01\x04\x00\x00\x00\x00\x00\x00")
+	assert.Equal(t, "dng", RawKindOf(dng))
+	assert.Equal(t, "", RawKindOf([]byte("MM\x00*\x00\x00\x00\x08\x00\x00\x00\x00\x00\x00")))
+	assert.Equal(t, "", RawKindOf([]byte("not a tiff")))
+}
@@ -0,0 +1,759 @@
+package formats
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+)
+
+// vp8MaxSize is the largest width or height of a VP8 frame
+const vp8MaxSize = 1<<14 - 1
+
+var ErrInvalidWebPSize = errors.New("Image size not supported by WebP")
+
+// Intra prediction modes of whole macroblocks, section 12.2
+const (
+	vp8PredDC = iota
+	vp8PredV
+	vp8PredH
+	vp8PredTM
+	vp8PredModes
+)
+
+// EncodeWebP writes the image as a lossy WebP file with a quality from 1, the smallest
+// file, to 100, the best quality. Macroblocks are only predicted as a whole which makes
+// encoding simple and fast, other encoders produce smaller files
+func EncodeWebP(out io.Writer, img image.Image, quality int) error {
+	b := img.Bounds()
+	if b.Empty() || b.Dx() > vp8MaxSize || b.Dy() > vp8MaxSize {
+		return ErrInvalidWebPSize
+	}
+	frame := newVP8Encoder(img, quality).encode()
+	var header [20]byte
+	copy(header[0:4], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:8], uint32(12+len(frame)+len(frame)%2))
+	copy(header[8:16], "WEBPVP8 ")
+	binary.LittleEndian.PutUint32(header[16:20], uint32(len(frame)))
+	if _, err := out.Write(header[:]); err != nil {
+		return err
+	}
+	// Chunks are padded to an even size
+	if len(frame)%2 == 1 {
+		frame = append(frame, 0)
+	}
+	_, err := out.Write(frame)
+	return err
+}
+
+// vp8Plane is a luma or chroma plane padded to a multiple of the macroblock size
+type vp8Plane struct {
+	pix    []uint8
+	stride int
+}
+
+func newVP8Plane(width, height int) vp8Plane {
+	return vp8Plane{pix: make([]uint8, width*height), stride: width}
+}
+
+func (p *vp8Plane) at(x, y int) int32 {
+	return int32(p.pix[y*p.stride+x])
+}
+
+// pad replicates the last column and row of the image area of width x height
+func (p *vp8Plane) pad(width, height int) {
+	for y := 0; y < height; y++ {
+		row := p.pix[y*p.stride : (y+1)*p.stride]
+		for x := width; x < p.stride; x++ {
+			row[x] = row[width-1]
+		}
+	}
+	last := p.pix[(height-1)*p.stride : height*p.stride]
+	for y := height; y < len(p.pix)/p.stride; y++ {
+		copy(p.pix[y*p.stride:], last)
+	}
+}
+
+// predict computes the prediction of the size x size block at x, y from the reconstructed
+// pixels above and left of it. Pixels outside of the frame have the values the decoder
+// uses, section 12.2
+func (p *vp8Plane) predict(pred []int32, x, y, size, mode int) {
+	var above, left [16]int32
+	corner := int32(0x7f)
+	for i := 0; i < size; i++ {
+		above[i], left[i] = 0x7f, 0x81
+		if y > 0 {
+			above[i] = p.at(x+i, y-1)
+		}
+		if x > 0 {
+			left[i] = p.at(x-1, y+i)
+		}
+	}
+	if y > 0 {
+		corner = 0x81
+		if x > 0 {
+			corner = p.at(x-1, y-1)
+		}
+	}
+	shift := uint(3)
+	if size == 16 {
+		shift = 4
+	}
+	for j := 0; j < size; j++ {
+		for i := 0; i < size; i++ {
+			var v int32
+			switch mode {
+			case vp8PredV:
+				v = above[i]
+			case vp8PredH:
+				v = left[j]
+			case vp8PredTM:
+				v = clip255(left[j] + above[i] - corner)
+			}
+			pred[j*size+i] = v
+		}
+	}
+	if mode != vp8PredDC {
+		return
+	}
+	var sumAbove, sumLeft int32
+	for i := 0; i < size; i++ {
+		sumAbove += above[i]
+		sumLeft += left[i]
+	}
+	dc := int32(0x80)
+	switch {
+	case x > 0 && y > 0:
+		dc = (sumAbove + sumLeft + int32(size)) >> (shift + 1)
+	case y > 0:
+		dc = (sumAbove + int32(size/2)) >> shift
+	case x > 0:
+		dc = (sumLeft + int32(size/2)) >> shift
+	}
+	for i := range pred[:size*size] {
+		pred[i] = dc
+	}
+}
+
+// sad returns the sum of absolute differences between the block at x, y and the prediction
+func (p *vp8Plane) sad(pred []int32, x, y, size int) int32 {
+	var sum int32
+	for j := 0; j < size; j++ {
+		for i := 0; i < size; i++ {
+			d := p.at(x+i, y+j) - pred[j*size+i]
+			if d < 0 {
+				d = -d
+			}
+			sum += d
+		}
+	}
+	return sum
+}
+
+// vp8Encoder encodes an image as a single VP8 key frame
+type vp8Encoder struct {
+	width, height int
+	mbw, mbh      int
+	// src are the Y, U and V planes of the image, rec the planes reconstructed like
+	// the decoder does and used for prediction
+	src, rec    [3]vp8Plane
+	qi          int
+	y1, y2, uv  [2]int32
+	filterLevel int
+	first       vp8BoolEncoder
+	tokens      vp8BoolEncoder
+	// Whether the blocks above and left of the current macroblock had non-zero
+	// coefficients, these are the contexts of the first token of a block
+	upY2, upY, upU, upV []uint8
+	leftY2              uint8
+	leftY, leftU, leftV [4]uint8
+}
+
+func newVP8Encoder(img image.Image, quality int) *vp8Encoder {
+	b := img.Bounds()
+	e := &vp8Encoder{
+		width:  b.Dx(),
+		height: b.Dy(),
+		mbw:    (b.Dx() + 15) / 16,
+		mbh:    (b.Dy() + 15) / 16,
+	}
+	e.src[0] = newVP8Plane(16*e.mbw, 16*e.mbh)
+	e.rec[0] = newVP8Plane(16*e.mbw, 16*e.mbh)
+	for i := 1; i < 3; i++ {
+		e.src[i] = newVP8Plane(8*e.mbw, 8*e.mbh)
+		e.rec[i] = newVP8Plane(8*e.mbw, 8*e.mbh)
+	}
+	e.readSource(img)
+
+	if quality < 1 {
+		quality = 1
+	} else if quality > 100 {
+		quality = 100
+	}
+	qi := (100 - quality) * 127 / 99
+	e.qi = qi
+	e.y1 = [2]int32{int32(vp8DCQuant[qi]), int32(vp8ACQuant[qi])}
+	e.y2 = [2]int32{int32(vp8DCQuant[qi]) * 2, int32(vp8ACQuant[qi]) * 155 / 100}
+	if e.y2[1] < 8 {
+		e.y2[1] = 8
+	}
+	uvDC := qi
+	if uvDC > 117 {
+		uvDC = 117
+	}
+	e.uv = [2]int32{int32(vp8DCQuant[uvDC]), int32(vp8ACQuant[qi])}
+	// Stronger filtering hides the edges of coarsely quantized blocks
+	e.filterLevel = qi * 3 / 8
+
+	e.upY2 = make([]uint8, e.mbw)
+	e.upY = make([]uint8, 4*e.mbw)
+	e.upU = make([]uint8, 2*e.mbw)
+	e.upV = make([]uint8, 2*e.mbw)
+	e.first = newVP8BoolEncoder()
+	e.tokens = newVP8BoolEncoder()
+	return e
+}
+
+// readSource converts the image to YCbCr with chroma subsampled 2x2
+func (e *vp8Encoder) readSource(img image.Image) {
+	b := img.Bounds()
+	rgb := rgbReader(img)
+	cw, ch := (e.width+1)/2, (e.height+1)/2
+	var (
+		cb = make([]int32, cw*ch)
+		cr = make([]int32, cw*ch)
+		n  = make([]int32, cw*ch)
+	)
+	y := &e.src[0]
+	for j := 0; j < e.height; j++ {
+		for i := 0; i < e.width; i++ {
+			yy, u, v := color.RGBToYCbCr(rgb(b.Min.X+i, b.Min.Y+j))
+			y.pix[j*y.stride+i] = yy
+			k := (j/2)*cw + i/2
+			cb[k] += int32(u)
+			cr[k] += int32(v)
+			n[k]++
+		}
+	}
+	u, v := &e.src[1], &e.src[2]
+	for j := 0; j < ch; j++ {
+		for i := 0; i < cw; i++ {
+			k := j*cw + i
+			u.pix[j*u.stride+i] = uint8((cb[k] + n[k]/2) / n[k])
+			v.pix[j*v.stride+i] = uint8((cr[k] + n[k]/2) / n[k])
+		}
+	}
+	y.pad(e.width, e.height)
+	u.pad(cw, ch)
+	v.pad(cw, ch)
+}
+
+// rgbReader returns a function reading the 8 bit RGB values of pixels, with fast paths
+// for the image types returned by decoders and resizing
+func rgbReader(img image.Image) func(x, y int) (uint8, uint8, uint8) {
+	switch m := img.(type) {
+	case *image.RGBA:
+		return func(x, y int) (uint8, uint8, uint8) {
+			p := m.Pix[m.PixOffset(x, y):]
+			return p[0], p[1], p[2]
+		}
+	case *image.NRGBA:
+		return func(x, y int) (uint8, uint8, uint8) {
+			p := m.Pix[m.PixOffset(x, y):]
+			return p[0], p[1], p[2]
+		}
+	case *image.YCbCr:
+		return func(x, y int) (uint8, uint8, uint8) {
+			c := m.YCbCrAt(x, y)
+			return color.YCbCrToRGB(c.Y, c.Cb, c.Cr)
+		}
+	}
+	return func(x, y int) (uint8, uint8, uint8) {
+		r, g, b, _ := img.At(x, y).RGBA()
+		return uint8(r >> 8), uint8(g >> 8), uint8(b >> 8)
+	}
+}
+
+// encode returns the VP8 key frame, the first partition holds the headers and the
+// prediction modes, the second one the coefficients
+func (e *vp8Encoder) encode() []byte {
+	e.writeHeader()
+	for mby := 0; mby < e.mbh; mby++ {
+		e.leftY2 = 0
+		e.leftY, e.leftU, e.leftV = [4]uint8{}, [4]uint8{}, [4]uint8{}
+		for mbx := 0; mbx < e.mbw; mbx++ {
+			e.encodeMacroblock(mbx, mby)
+		}
+	}
+	first := e.first.flush()
+	tokens := e.tokens.flush()
+
+	frame := make([]byte, 10, 10+len(first)+len(tokens))
+	// Key frame of version 0 which is shown
+	tag := uint32(len(first))<<5 | 1<<4
+	frame[0], frame[1], frame[2] = byte(tag), byte(tag>>8), byte(tag>>16)
+	frame[3], frame[4], frame[5] = 0x9d, 0x01, 0x2a
+	binary.LittleEndian.PutUint16(frame[6:8], uint16(e.width))
+	binary.LittleEndian.PutUint16(frame[8:10], uint16(e.height))
+	frame = append(frame, first...)
+	return append(frame, tokens...)
+}
+
+// writeHeader writes the frame header of section 9 to the first partition
+func (e *vp8Encoder) writeHeader() {
+	f := &e.first
+	f.writeLiteral(0, 1) // Color space
+	f.writeLiteral(0, 1) // Clamping required
+	f.writeLiteral(0, 1) // No segmentation
+	f.writeLiteral(0, 1) // Normal loop filter
+	f.writeLiteral(e.filterLevel, 6)
+	f.writeLiteral(0, 3) // Sharpness
+	f.writeLiteral(0, 1) // No loop filter adjustments
+	f.writeLiteral(0, 2) // A single partition of coefficients
+	f.writeLiteral(e.qi, 7)
+	for i := 0; i < 5; i++ {
+		f.writeLiteral(0, 1) // No quantizer deltas
+	}
+	f.writeLiteral(0, 1) // Do not keep the updated probabilities
+	for i := range vp8TokenUpdateProbs {
+		for j := range vp8TokenUpdateProbs[i] {
+			for k := range vp8TokenUpdateProbs[i][j] {
+				for _, p := range vp8TokenUpdateProbs[i][j][k] {
+					f.writeBit(false, p)
+				}
+			}
+		}
+	}
+	f.writeLiteral(0, 1) // Macroblocks without coefficients are not skipped
+}
+
+func (e *vp8Encoder) encodeMacroblock(mbx, mby int) {
+	var pred [3][256]int32
+	yMode, uvMode := vp8PredDC, vp8PredDC
+	best := int32(-1)
+	for mode := vp8PredDC; mode < vp8PredModes; mode++ {
+		e.rec[0].predict(pred[0][:], 16*mbx, 16*mby, 16, mode)
+		if sad := e.src[0].sad(pred[0][:], 16*mbx, 16*mby, 16); best < 0 || sad < best {
+			yMode, best = mode, sad
+		}
+	}
+	best = -1
+	for mode := vp8PredDC; mode < vp8PredModes; mode++ {
+		var sad int32
+		for c := 1; c < 3; c++ {
+			e.rec[c].predict(pred[c][:], 8*mbx, 8*mby, 8, mode)
+			sad += e.src[c].sad(pred[c][:], 8*mbx, 8*mby, 8)
+		}
+		if best < 0 || sad < best {
+			uvMode, best = mode, sad
+		}
+	}
+	e.writeModes(yMode, uvMode)
+
+	e.rec[0].predict(pred[0][:], 16*mbx, 16*mby, 16, yMode)
+	e.encodeLuma(mbx, mby, pred[0][:])
+	e.rec[1].predict(pred[1][:], 8*mbx, 8*mby, 8, uvMode)
+	e.encodeChroma(1, mbx, mby, pred[1][:], e.upU[2*mbx:], &e.leftU)
+	e.rec[2].predict(pred[2][:], 8*mbx, 8*mby, 8, uvMode)
+	e.encodeChroma(2, mbx, mby, pred[2][:], e.upV[2*mbx:], &e.leftV)
+}
+
+// writeModes writes the prediction modes of a macroblock predicted as a whole, section 11.2
+func (e *vp8Encoder) writeModes(yMode, uvMode int) {
+	f := &e.first
+	f.writeBit(true, 145)
+	switch yMode {
+	case vp8PredDC:
+		f.writeBit(false, 156)
+		f.writeBit(false, 163)
+	case vp8PredV:
+		f.writeBit(false, 156)
+		f.writeBit(true, 163)
+	case vp8PredH:
+		f.writeBit(true, 156)
+		f.writeBit(false, 128)
+	case vp8PredTM:
+		f.writeBit(true, 156)
+		f.writeBit(true, 128)
+	}
+	f.writeBit(uvMode != vp8PredDC, 142)
+	if uvMode != vp8PredDC {
+		f.writeBit(uvMode != vp8PredV, 114)
+		if uvMode != vp8PredV {
+			f.writeBit(uvMode == vp8PredTM, 183)
+		}
+	}
+}
+
+// encodeLuma codes the 16 luma blocks of a macroblock, their DC coefficients are coded
+// together after a Walsh-Hadamard transform
+func (e *vp8Encoder) encodeLuma(mbx, mby int, pred []int32) {
+	x0, y0 := 16*mbx, 16*mby
+	var coeffs [16][16]int32
+	var dc [16]int32
+	for n := 0; n < 16; n++ {
+		var residual [16]int32
+		bx, by := 4*(n%4), 4*(n/4)
+		for j := 0; j < 4; j++ {
+			for i := 0; i < 4; i++ {
+				residual[4*j+i] = e.src[0].at(x0+bx+i, y0+by+j) - pred[(by+j)*16+bx+i]
+			}
+		}
+		forwardDCT4(&residual, &coeffs[n])
+		dc[n] = coeffs[n][0]
+	}
+	var wht [16]int32
+	forwardWHT4(&dc, &wht)
+	levels := quantize(&wht, e.y2, 0)
+	nz := e.writeCoefficients(vp8PlaneY2, e.upY2[mbx]+e.leftY2, 0, &levels)
+	e.upY2[mbx], e.leftY2 = nz, nz
+	dequantize(&levels, e.y2)
+	inverseWHT4(&levels, &dc)
+
+	for n := 0; n < 16; n++ {
+		levels := quantize(&coeffs[n], e.y1, 1)
+		i, j := n%4, n/4
+		nz := e.writeCoefficients(vp8PlaneY1WithY2, e.upY[4*mbx+i]+e.leftY[j], 1, &levels)
+		e.upY[4*mbx+i], e.leftY[j] = nz, nz
+		dequantize(&levels, e.y1)
+		levels[0] = dc[n]
+		e.reconstruct(0, x0+4*i, y0+4*j, pred[4*j*16+4*i:], 16, &levels)
+	}
+}
+
+// encodeChroma codes the 4 blocks of a chroma plane of a macroblock
+func (e *vp8Encoder) encodeChroma(plane, mbx, mby int, pred []int32, up []uint8, left *[4]uint8) {
+	x0, y0 := 8*mbx, 8*mby
+	for n := 0; n < 4; n++ {
+		var residual, coeffs [16]int32
+		i, j := n%2, n/2
+		for y := 0; y < 4; y++ {
+			for x := 0; x < 4; x++ {
+				residual[4*y+x] = e.src[plane].at(x0+4*i+x, y0+4*j+y) - pred[(4*j+y)*8+4*i+x]
+			}
+		}
+		forwardDCT4(&residual, &coeffs)
+		levels := quantize(&coeffs, e.uv, 0)
+		nz := e.writeCoefficients(vp8PlaneUV, up[i]+left[j], 0, &levels)
+		up[i], left[j] = nz, nz
+		dequantize(&levels, e.uv)
+		e.reconstruct(plane, x0+4*i, y0+4*j, pred[4*j*8+4*i:], 8, &levels)
+	}
+}
+
+// reconstruct adds the inverse transform of the dequantized coefficients to the prediction
+func (e *vp8Encoder) reconstruct(plane, x, y int, pred []int32, predStride int, coeffs *[16]int32) {
+	var residual [16]int32
+	inverseDCT4(coeffs, &residual)
+	rec := &e.rec[plane]
+	for j := 0; j < 4; j++ {
+		for i := 0; i < 4; i++ {
+			rec.pix[(y+j)*rec.stride+x+i] = uint8(clip255(pred[j*predStride+i] + residual[4*j+i]))
+		}
+	}
+}
+
+// writeCoefficients writes the tokens of the coefficients of a block starting at first,
+// section 13. It returns 1 if any coefficient was written, which is the context of the
+// neighbouring blocks
+func (e *vp8Encoder) writeCoefficients(plane int, ctx uint8, first int, levels *[16]int32) uint8 {
+	probs := &vp8DefaultTokenProbs[plane]
+	t := &e.tokens
+	last := -1
+	for n := first; n < 16; n++ {
+		if levels[vp8Zigzag[n]] != 0 {
+			last = n
+		}
+	}
+	p := &probs[vp8BandOf[first]][ctx]
+	if last < 0 {
+		t.writeBit(false, p[0])
+		return 0
+	}
+	t.writeBit(true, p[0])
+	for n := first; n <= last; n++ {
+		v := levels[vp8Zigzag[n]]
+		negative := v < 0
+		if negative {
+			v = -v
+		}
+		if v == 0 {
+			// No end of block can follow a zero
+			t.writeBit(false, p[1])
+			p = &probs[vp8BandOf[n+1]][0]
+			continue
+		}
+		t.writeBit(true, p[1])
+		if v == 1 {
+			t.writeBit(false, p[2])
+			p = &probs[vp8BandOf[n+1]][1]
+		} else {
+			t.writeBit(true, p[2])
+			writeTokenValue(t, p, v)
+			p = &probs[vp8BandOf[n+1]][2]
+		}
+		t.writeBit(negative, 128)
+		if n == 15 {
+			return 1
+		}
+		t.writeBit(n < last, p[0])
+	}
+	return 1
+}
+
+// writeTokenValue writes a coefficient value larger than 1, section 13.2
+func writeTokenValue(t *vp8BoolEncoder, p *[vp8Probs]uint8, v int32) {
+	switch {
+	case v <= 4:
+		t.writeBit(false, p[3])
+		t.writeBit(v > 2, p[4])
+		if v > 2 {
+			t.writeBit(v == 4, p[5])
+		}
+	case v <= 10:
+		t.writeBit(true, p[3])
+		t.writeBit(false, p[6])
+		t.writeBit(v > 6, p[7])
+		if v <= 6 {
+			t.writeBit(v == 6, 159)
+		} else {
+			t.writeBit((v-7)&2 != 0, 165)
+			t.writeBit((v-7)&1 != 0, 145)
+		}
+	default:
+		t.writeBit(true, p[3])
+		t.writeBit(true, p[6])
+		cat := 3
+		for cat > 0 && v < 3+int32(8<<uint(cat)) {
+			cat--
+		}
+		t.writeBit(cat >= 2, p[8])
+		t.writeBit(cat&1 == 1, p[9+cat/2])
+		extra := v - (3 + int32(8<<uint(cat)))
+		bits := vp8CatProbs[cat]
+		for i, prob := range bits {
+			t.writeBit(extra>>uint(len(bits)-1-i)&1 == 1, prob)
+		}
+	}
+}
+
+// quantize returns the quantized coefficients, starting at first. Small AC coefficients
+// are rounded towards zero as they are expensive to code
+func quantize(coeffs *[16]int32, q [2]int32, first int) (levels [16]int32) {
+	for k := first; k < 16; k++ {
+		c, step := coeffs[k], q[0]
+		bias := step / 2
+		if k > 0 {
+			step = q[1]
+			bias = step * 3 / 8
+		}
+		negative := c < 0
+		if negative {
+			c = -c
+		}
+		level := (c + bias) / step
+		if level > 2048 {
+			level = 2048
+		}
+		if negative {
+			level = -level
+		}
+		levels[k] = level
+	}
+	return
+}
+
+func dequantize(levels *[16]int32, q [2]int32) {
+	levels[0] *= q[0]
+	for k := 1; k < 16; k++ {
+		levels[k] *= q[1]
+	}
+}
+
+// forwardDCT4 is the forward transform matching the inverse transform of section 14.3
+func forwardDCT4(in, out *[16]int32) {
+	var tmp [16]int32
+	for i := 0; i < 4; i++ {
+		r := in[4*i : 4*i+4]
+		a := (r[0] + r[3]) * 8
+		b := (r[1] + r[2]) * 8
+		c := (r[1] - r[2]) * 8
+		d := (r[0] - r[3]) * 8
+		tmp[4*i+0] = a + b
+		tmp[4*i+2] = a - b
+		tmp[4*i+1] = (c*2217 + d*5352 + 14500) >> 12
+		tmp[4*i+3] = (d*2217 - c*5352 + 7500) >> 12
+	}
+	for i := 0; i < 4; i++ {
+		a := tmp[i] + tmp[12+i]
+		b := tmp[4+i] + tmp[8+i]
+		c := tmp[4+i] - tmp[8+i]
+		d := tmp[i] - tmp[12+i]
+		out[i] = (a + b + 7) >> 4
+		out[8+i] = (a - b + 7) >> 4
+		out[4+i] = (c*2217+d*5352+12000)>>16 + btoi(d != 0)
+		out[12+i] = (d*2217 - c*5352 + 51000) >> 16
+	}
+}
+
+// inverseDCT4 is the inverse transform of section 14.3
+func inverseDCT4(in, out *[16]int32) {
+	const (
+		c1 = 85627 // 65536 * cos(pi/8) * sqrt(2)
+		c2 = 35468 // 65536 * sin(pi/8) * sqrt(2)
+	)
+	var m [4][4]int32
+	for i := 0; i < 4; i++ {
+		a := in[i] + in[8+i]
+		b := in[i] - in[8+i]
+		c := (in[4+i]*c2)>>16 - (in[12+i]*c1)>>16
+		d := (in[4+i]*c1)>>16 + (in[12+i]*c2)>>16
+		m[i] = [4]int32{a + d, b + c, b - c, a - d}
+	}
+	for j := 0; j < 4; j++ {
+		dc := m[0][j] + 4
+		a := dc + m[2][j]
+		b := dc - m[2][j]
+		c := (m[1][j]*c2)>>16 - (m[3][j]*c1)>>16
+		d := (m[1][j]*c1)>>16 + (m[3][j]*c2)>>16
+		out[4*j+0] = (a + d) >> 3
+		out[4*j+1] = (b + c) >> 3
+		out[4*j+2] = (b - c) >> 3
+		out[4*j+3] = (a - d) >> 3
+	}
+}
+
+// forwardWHT4 is the forward transform matching the inverse Walsh-Hadamard transform of
+// section 14.3
+func forwardWHT4(in, out *[16]int32) {
+	var tmp [16]int32
+	for i := 0; i < 4; i++ {
+		r := in[4*i : 4*i+4]
+		a := (r[0] + r[2]) * 4
+		d := (r[1] + r[3]) * 4
+		c := (r[1] - r[3]) * 4
+		b := (r[0] - r[2]) * 4
+		tmp[4*i+0] = a + d + btoi(a != 0)
+		tmp[4*i+1] = b + c
+		tmp[4*i+2] = b - c
+		tmp[4*i+3] = a - d
+	}
+	for i := 0; i < 4; i++ {
+		a := tmp[i] + tmp[8+i]
+		d := tmp[4+i] + tmp[12+i]
+		c := tmp[4+i] - tmp[12+i]
+		b := tmp[i] - tmp[8+i]
+		for k, v := range [4]int32{a + d, b + c, b - c, a - d} {
+			if v < 0 {
+				v++
+			}
+			out[4*k+i] = (v + 3) >> 3
+		}
+	}
+}
+
+// inverseWHT4 is the inverse Walsh-Hadamard transform of section 14.3
+func inverseWHT4(in, out *[16]int32) {
+	var m [16]int32
+	for i := 0; i < 4; i++ {
+		a0 := in[i] + in[12+i]
+		a1 := in[4+i] + in[8+i]
+		a2 := in[4+i] - in[8+i]
+		a3 := in[i] - in[12+i]
+		m[i] = a0 + a1
+		m[8+i] = a0 - a1
+		m[4+i] = a3 + a2
+		m[12+i] = a3 - a2
+	}
+	for i := 0; i < 4; i++ {
+		dc := m[4*i] + 3
+		a0 := dc + m[4*i+3]
+		a1 := m[4*i+1] + m[4*i+2]
+		a2 := m[4*i+1] - m[4*i+2]
+		a3 := dc - m[4*i+3]
+		out[4*i+0] = (a0 + a1) >> 3
+		out[4*i+1] = (a3 + a2) >> 3
+		out[4*i+2] = (a0 - a1) >> 3
+		out[4*i+3] = (a3 - a2) >> 3
+	}
+}
+
+func clip255(v int32) int32 {
+	if v < 0 {
+		return 0
+	}
+	if v > 255 {
+		return 255
+	}
+	return v
+}
+
+func btoi(b bool) int32 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// vp8BoolEncoder is the boolean entropy encoder of section 7
+type vp8BoolEncoder struct {
+	buf      []byte
+	rng      uint32
+	bottom   uint32
+	bitCount int
+}
+
+func newVP8BoolEncoder() vp8BoolEncoder {
+	return vp8BoolEncoder{rng: 255, bitCount: 24}
+}
+
+// writeBit writes a bit which is false with the probability prob/256
+func (e *vp8BoolEncoder) writeBit(bit bool, prob uint8) {
+	split := 1 + ((e.rng-1)*uint32(prob))>>8
+	if bit {
+		e.bottom += split
+		e.rng -= split
+	} else {
+		e.rng = split
+	}
+	for e.rng < 128 {
+		e.rng <<= 1
+		if e.bottom&(1<<31) != 0 {
+			e.carry()
+		}
+		e.bottom <<= 1
+		e.bitCount--
+		if e.bitCount == 0 {
+			e.buf = append(e.buf, byte(e.bottom>>24))
+			e.bottom &= 1<<24 - 1
+			e.bitCount = 8
+		}
+	}
+}
+
+// writeLiteral writes the n lowest bits of v, most significant bit first
+func (e *vp8BoolEncoder) writeLiteral(v, n int) {
+	for i := n - 1; i >= 0; i-- {
+		e.writeBit(v>>uint(i)&1 == 1, 128)
+	}
+}
+
+// carry propagates a carry into the bytes already written
+func (e *vp8BoolEncoder) carry() {
+	i := len(e.buf) - 1
+	for ; i >= 0 && e.buf[i] == 0xff; i-- {
+		e.buf[i] = 0
+	}
+	if i >= 0 {
+		e.buf[i]++
+	}
+}
+
+// flush writes the remaining bits and returns the encoded data
+func (e *vp8BoolEncoder) flush() []byte {
+	for i := 0; i < 32; i++ {
+		e.writeBit(false, 128)
+	}
+	return e.buf
+}
@@ -0,0 +1,238 @@
+package formats
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math"
+	"os"
+	"testing"
+
+	"golang.org/x/image/vp8"
+	"golang.org/x/image/webp"
+)
+
+func TestEncodeWebP(t *testing.T) {
+	in, err := os.Open("../testdata/Canon_40D.jpg")
+	if err != nil {
+		t.Fatalf("Failed to open test image: %s", err)
+	}
+	defer in.Close()
+	photo, err := jpeg.Decode(in)
+	if err != nil {
+		t.Fatalf("Failed to decode test image: %s", err)
+	}
+	// Odd sizes are padded to whole macroblocks
+	gradient := image.NewRGBA(image.Rect(0, 0, 37, 21))
+	for y := 0; y < 21; y++ {
+		for x := 0; x < 37; x++ {
+			gradient.Set(x, y, color.RGBA{uint8(7 * x), uint8(12 * y), 128, 255})
+		}
+	}
+	data := map[string]struct {
+		img     image.Image
+		quality int
+		minPSNR float64
+	}{
+		"photo":        {photo, 80, 33},
+		"best quality": {photo, 100, 45},
+		"gradient":     {gradient, 80, 38},
+		"low quality":  {gradient, 1, 25},
+	}
+	for name, d := range data {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := EncodeWebP(&buf, d.img, d.quality); err != nil {
+				t.Fatalf("Failed to encode WebP: %s", err)
+			}
+			decoded, err := webp.Decode(&buf)
+			if err != nil {
+				t.Fatalf("Failed to decode WebP: %s", err)
+			}
+			if decoded.Bounds().Size() != d.img.Bounds().Size() {
+				t.Fatalf("Bad size: expected %v, got %v", d.img.Bounds().Size(), decoded.Bounds().Size())
+			}
+			if p := psnr(d.img, decoded); p < d.minPSNR {
+				t.Errorf("Bad quality: expected PSNR of at least %.1f, got %.1f", d.minPSNR, p)
+			}
+		})
+	}
+}
+
+// testPhotos returns the photos of the test data, decoded
+func testPhotos(t testing.TB) map[string]image.Image {
+	photos := make(map[string]image.Image)
+	for _, name := range []string{"Canon_40D.jpg", "orientation/portrait_3.jpg", "orientation/landscape_7.jpg", "blue-purple-pink.webp"} {
+		in, err := os.Open("../testdata/" + name)
+		if err != nil {
+			t.Fatalf("Failed to open test image: %s", err)
+		}
+		img, _, err := image.Decode(in)
+		in.Close()
+		if err != nil {
+			t.Fatalf("Failed to decode %s: %s", name, err)
+		}
+		photos[name] = img
+	}
+	return photos
+}
+
+// crop returns the part of the image of the given size starting at an odd position
+func crop(img image.Image, width, height int) image.Image {
+	b := img.Bounds()
+	r := image.Rect(1, 3, 1+width, 3+height).Add(b.Min).Intersect(b)
+	return img.(interface {
+		SubImage(image.Rectangle) image.Image
+	}).SubImage(r)
+}
+
+func TestEncodeWebPPhotos(t *testing.T) {
+	sizes := []image.Point{{1, 1}, {1, 31}, {31, 1}, {15, 17}, {17, 15}, {33, 49}, {99, 65}}
+	for name, photo := range testPhotos(t) {
+		images := map[string]image.Image{"full": photo}
+		for _, s := range sizes {
+			images[fmt.Sprintf("%dx%d", s.X, s.Y)] = crop(photo, s.X, s.Y)
+		}
+		for size, img := range images {
+			for _, quality := range []int{1, 50, 80, 100} {
+				t.Run(fmt.Sprintf("%s/%s/%d", name, size, quality), func(t *testing.T) {
+					assertReconstruction(t, img, quality)
+					var buf bytes.Buffer
+					if err := EncodeWebP(&buf, img, quality); err != nil {
+						t.Fatalf("Failed to encode WebP: %s", err)
+					}
+					decoded, err := webp.Decode(&buf)
+					if err != nil {
+						t.Fatalf("Failed to decode WebP: %s", err)
+					}
+					if decoded.Bounds().Size() != img.Bounds().Size() {
+						t.Fatalf("Bad size: expected %v, got %v", img.Bounds().Size(), decoded.Bounds().Size())
+					}
+					if p := psnr(img, decoded); p < minPSNR(quality) {
+						t.Errorf("Bad quality: expected PSNR of at least %.1f, got %.1f", minPSNR(quality), p)
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestEncodeWebPQualities(t *testing.T) {
+	photo := crop(testPhotos(t)["orientation/portrait_3.jpg"], 97, 83)
+	var previous float64
+	for quality := 1; quality <= 100; quality++ {
+		assertReconstruction(t, photo, quality)
+		var buf bytes.Buffer
+		if err := EncodeWebP(&buf, photo, quality); err != nil {
+			t.Fatalf("Quality %d: failed to encode WebP: %s", quality, err)
+		}
+		decoded, err := webp.Decode(&buf)
+		if err != nil {
+			t.Fatalf("Quality %d: failed to decode WebP: %s", quality, err)
+		}
+		p := psnr(photo, decoded)
+		if p < minPSNR(quality) {
+			t.Errorf("Quality %d: expected PSNR of at least %.1f, got %.1f", quality, minPSNR(quality), p)
+		}
+		// Higher qualities may differ slightly, but never get much worse
+		if p < previous-1 {
+			t.Errorf("Quality %d: PSNR dropped from %.1f to %.1f", quality, previous, p)
+		}
+		previous = p
+	}
+}
+
+func FuzzEncodeWebP(f *testing.F) {
+	f.Add([]byte{0}, uint8(1), uint8(1), uint8(80))
+	f.Add([]byte("gradient"), uint8(37), uint8(21), uint8(1))
+	f.Add([]byte{255, 0, 0, 255, 0, 255, 0, 128}, uint8(17), uint8(33), uint8(100))
+	f.Fuzz(func(t *testing.T, pixels []byte, width, height, quality uint8) {
+		if len(pixels) == 0 || width == 0 || height == 0 {
+			return
+		}
+		img := image.NewNRGBA(image.Rect(0, 0, int(width), int(height)))
+		for i := range img.Pix {
+			img.Pix[i] = pixels[i%len(pixels)]
+		}
+		assertReconstruction(t, img, int(quality))
+		var buf bytes.Buffer
+		if err := EncodeWebP(&buf, img, int(quality)); err != nil {
+			t.Fatalf("Failed to encode WebP: %s", err)
+		}
+		decoded, err := webp.Decode(&buf)
+		if err != nil {
+			t.Fatalf("Failed to decode WebP: %s", err)
+		}
+		if decoded.Bounds().Size() != img.Bounds().Size() {
+			t.Fatalf("Bad size: expected %v, got %v", img.Bounds().Size(), decoded.Bounds().Size())
+		}
+	})
+}
+
+// minPSNR is the lowest acceptable quality of photos encoded with the given quality, the
+// lowest qualities only have to keep photos recognizable
+func minPSNR(quality int) float64 {
+	if quality <= 50 {
+		return 20
+	}
+	return 20 + float64(quality-50)*2/5
+}
+
+// assertReconstruction checks that a decoder reconstructs exactly the frame the encoder
+// predicted from. The loop filter is disabled as the encoder predicts from unfiltered pixels
+func assertReconstruction(t testing.TB, img image.Image, quality int) {
+	t.Helper()
+	e := newVP8Encoder(img, quality)
+	e.filterLevel = 0
+	frame := e.encode()
+	d := vp8.NewDecoder()
+	d.Init(bytes.NewReader(frame), len(frame))
+	if _, err := d.DecodeFrameHeader(); err != nil {
+		t.Fatalf("Quality %d: bad frame header: %s", quality, err)
+	}
+	decoded, err := d.DecodeFrame()
+	if err != nil {
+		t.Fatalf("Quality %d: failed to decode frame: %s", quality, err)
+	}
+	cw, ch := (e.width+1)/2, (e.height+1)/2
+	planes := []struct {
+		name          string
+		pix           []uint8
+		stride        int
+		width, height int
+	}{
+		{"Y", decoded.Y, decoded.YStride, e.width, e.height},
+		{"Cb", decoded.Cb, decoded.CStride, cw, ch},
+		{"Cr", decoded.Cr, decoded.CStride, cw, ch},
+	}
+	for i, p := range planes {
+		for y := 0; y < p.height; y++ {
+			for x := 0; x < p.width; x++ {
+				if expected, actual := e.rec[i].at(x, y), int32(p.pix[y*p.stride+x]); expected != actual {
+					t.Fatalf("Quality %d: %s at %d,%d decoded as %d instead of %d", quality, p.name, x, y, actual, expected)
+				}
+			}
+		}
+	}
+}
+
+// psnr returns the peak signal to noise ratio of the luma of two images
+func psnr(a, b image.Image) float64 {
+	var sum float64
+	ab, bb := a.Bounds(), b.Bounds()
+	for y := 0; y < ab.Dy(); y++ {
+		for x := 0; x < ab.Dx(); x++ {
+			ya := color.GrayModel.Convert(a.At(ab.Min.X+x, ab.Min.Y+y)).(color.Gray).Y
+			yb := color.GrayModel.Convert(b.At(bb.Min.X+x, bb.Min.Y+y)).(color.Gray).Y
+			d := float64(ya) - float64(yb)
+			sum += d * d
+		}
+	}
+	mse := sum / float64(ab.Dx()*ab.Dy())
+	if mse == 0 {
+		return math.Inf(1)
+	}
+	return 10 * math.Log10(255*255/mse)
+}
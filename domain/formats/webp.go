@@ -0,0 +1,100 @@
+package formats
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+var (
+	ErrNotAWebP = errors.New("Not a WebP file")
+
+	exifHeader = []byte("Exif\x00\x00")
+)
+
+// WebPMetaData is the meta-data found in the chunks of a WebP file
+type WebPMetaData struct {
+	// Exif is the raw TIFF data of the EXIF chunk, nil if the file has no EXIF data
+	Exif []byte
+	// Width and Height are the dimensions of the canvas, 0 if unknown
+	Width, Height int
+}
+
+// ReadWebPExif returns the raw TIFF data of the EXIF chunk of a WebP file, nil is returned
+// if the file has no EXIF data
+func ReadWebPExif(in io.Reader) ([]byte, error) {
+	meta, err := ReadWebPMetaData(in)
+	return meta.Exif, err
+}
+
+// ReadWebPMetaData reads the dimensions and the EXIF data of a WebP file
+func ReadWebPMetaData(in io.Reader) (meta WebPMetaData, err error) {
+	var header [12]byte
+	if _, err = io.ReadFull(in, header[:]); err != nil {
+		return
+	}
+	if string(header[0:4]) != "RIFF" || string(header[8:12]) != "WEBP" {
+		return meta, ErrNotAWebP
+	}
+	var chunk [8]byte
+	for {
+		if _, err = io.ReadFull(in, chunk[:]); err != nil {
+			if err == io.EOF {
+				return meta, nil
+			}
+			return
+		}
+		size := int64(binary.LittleEndian.Uint32(chunk[4:8]))
+		// Chunks are padded to an even size
+		padded := size + size%2
+		chunkType := string(chunk[0:4])
+		switch {
+		case chunkType == "EXIF":
+			if size > maxChunkSize {
+				return meta, ErrNotAWebP
+			}
+			data := make([]byte, size)
+			if _, err = io.ReadFull(in, data); err != nil {
+				return
+			}
+			// Some encoders keep the JPEG APP1 header
+			meta.Exif = bytes.TrimPrefix(data, exifHeader)
+			return meta, nil
+		case meta.Width == 0 && (chunkType == "VP8X" || chunkType == "VP8 " || chunkType == "VP8L") && size >= 10:
+			var data [10]byte
+			if _, err = io.ReadFull(in, data[:]); err != nil {
+				return
+			}
+			meta.Width, meta.Height = webpDimensions(chunkType, data[:])
+			padded -= int64(len(data))
+		}
+		if _, err = io.CopyN(io.Discard, in, padded); err != nil {
+			return
+		}
+	}
+}
+
+// webpDimensions returns the dimensions found at the start of the first chunk of a WebP file
+func webpDimensions(chunkType string, data []byte) (width, height int) {
+	switch chunkType {
+	case "VP8X":
+		// Canvas dimensions minus one on 24 bits after the flags
+		width = 1 + (int(data[4]) | int(data[5])<<8 | int(data[6])<<16)
+		height = 1 + (int(data[7]) | int(data[8])<<8 | int(data[9])<<16)
+	case "VP8 ":
+		// Key frame header followed by 14 bit dimensions and 2 bit scales
+		if data[3] == 0x9d && data[4] == 0x01 && data[5] == 0x2a {
+			width = int(binary.LittleEndian.Uint16(data[6:8]) & 0x3fff)
+			height = int(binary.LittleEndian.Uint16(data[8:10]) & 0x3fff)
+		}
+	case "VP8L":
+		// Signature followed by the dimensions minus one on 14 bits each
+		if data[0] == 0x2f {
+			bits := binary.LittleEndian.Uint32(data[1:5])
+			width = 1 + int(bits&0x3fff)
+			height = 1 + int(bits>>14&0x3fff)
+		}
+	}
+	return
+}
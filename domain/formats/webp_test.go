@@ -0,0 +1,52 @@
+package formats
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadWebPExif(t *testing.T) {
+	var chunks bytes.Buffer
+	writeRIFFChunk(&chunks, "VP8X", make([]byte, 10))
+	writeRIFFChunk(&chunks, "ICCP", []byte("odd"))
+	writeRIFFChunk(&chunks, "EXIF", []byte("Exif\x00\x00II\x2a\x00"))
+	var in bytes.Buffer
+	in.WriteString("RIFF")
+	binary.Write(&in, binary.LittleEndian, uint32(chunks.Len()+4))
+	in.WriteString("WEBP")
+	in.Write(chunks.Bytes())
+
+	data, err := ReadWebPExif(&in)
+	if err != nil {
+		t.Fatalf("Failed to read WebP EXIF: %s", err)
+	}
+	assert.Equal(t, []byte("II\x2a\x00"), data)
+}
+
+func TestWebPDimensions(t *testing.T) {
+	vp8x := make([]byte, 10)
+	copy(vp8x[4:], []byte{0x7f, 0x07, 0x00, 0x37, 0x04, 0x00})
+	w, h := webpDimensions("VP8X", vp8x)
+	assert.Equal(t, []int{1920, 1080}, []int{w, h})
+
+	vp8 := []byte{0x50, 0x01, 0x00, 0x9d, 0x01, 0x2a, 0x80, 0x07, 0x38, 0x04}
+	w, h = webpDimensions("VP8 ", vp8)
+	assert.Equal(t, []int{1920, 1080}, []int{w, h})
+
+	// 14 bits width and height minus one, 1919 | 1079<<14
+	vp8l := []byte{0x2f, 0x7f, 0xc7, 0x0d, 0x01, 0x00, 0, 0, 0, 0}
+	w, h = webpDimensions("VP8L", vp8l)
+	assert.Equal(t, []int{1920, 1080}, []int{w, h})
+}
+
+func writeRIFFChunk(out *bytes.Buffer, chunkType string, data []byte) {
+	out.WriteString(chunkType)
+	binary.Write(out, binary.LittleEndian, uint32(len(data)))
+	out.Write(data)
+	if len(data)%2 == 1 {
+		out.WriteByte(0)
+	}
+}
@@ -0,0 +1,224 @@
+package formats
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"bitbucket.org/kleinnic74/photos/domain/gps"
+)
+
+// RatingRejected is the XMP rating of photos rejected in Lightroom or darktable
+const RatingRejected = -1
+
+const (
+	nsRDF       = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	nsXMP       = "http://ns.adobe.com/xap/1.0/"
+	nsDC        = "http://purl.org/dc/elements/1.1/"
+	nsEXIF      = "http://ns.adobe.com/exif/1.0/"
+	nsTIFF      = "http://ns.adobe.com/tiff/1.0/"
+	nsPhotoshop = "http://ns.adobe.com/photoshop/1.0/"
+)
+
+// xmpDateLayouts are the date formats allowed by the XMP specification, dates without time
+// zone are in local time
+var xmpDateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// XMP is the meta-data of an XMP sidecar file as written by Lightroom or darktable
+type XMP struct {
+	// Rating is the star rating from 0 to 5 or RatingRejected, 0 if not set
+	Rating      int
+	Keywords    []string
+	DateTaken   time.Time
+	Location    *gps.Coordinates
+	Orientation int
+
+	// dates found in the file by property name, the EXIF date is preferred
+	dates map[string]time.Time
+}
+
+// ReadXMP reads an XMP packet, properties are accepted both as attributes of the rdf:Description
+// element and as child elements. Unknown properties are ignored
+func ReadXMP(in io.Reader) (*XMP, error) {
+	x := &XMP{dates: make(map[string]time.Time)}
+	d := xml.NewDecoder(bufio.NewReader(in))
+	var stack []xml.Name
+	for {
+		token, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			stack = append(stack, t.Name)
+			for _, attr := range t.Attr {
+				x.set(attr.Name, attr.Value)
+			}
+		case xml.EndElement:
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		case xml.CharData:
+			value := strings.TrimSpace(string(t))
+			if value == "" {
+				continue
+			}
+			if property, found := propertyOf(stack); found {
+				x.set(property, value)
+			}
+		}
+	}
+	for _, name := range []string{"DateTimeOriginal", "DateCreated", "CreateDate"} {
+		if date, found := x.dates[name]; found {
+			x.DateTaken = date
+			break
+		}
+	}
+	return x, nil
+}
+
+// propertyOf returns the innermost element of the stack which is not an RDF container
+func propertyOf(stack []xml.Name) (xml.Name, bool) {
+	for i := len(stack) - 1; i >= 0; i-- {
+		if stack[i].Space != nsRDF {
+			return stack[i], true
+		}
+	}
+	return xml.Name{}, false
+}
+
+func (x *XMP) set(name xml.Name, value string) {
+	switch {
+	case name.Space == nsXMP && name.Local == "Rating":
+		if rating, err := strconv.ParseFloat(value, 64); err == nil {
+			x.Rating = int(math.Max(RatingRejected, math.Min(5, rating)))
+		}
+	case name.Space == nsDC && name.Local == "subject":
+		if keyword := strings.TrimSpace(value); keyword != "" {
+			x.Keywords = append(x.Keywords, keyword)
+		}
+	case name.Space == nsTIFF && name.Local == "Orientation":
+		if orientation, err := strconv.Atoi(value); err == nil && orientation >= 1 && orientation <= 8 {
+			x.Orientation = orientation
+		}
+	case name.Space == nsEXIF && name.Local == "GPSLatitude":
+		if lat, ok := parseXMPCoordinate(value, 'N', 'S'); ok {
+			x.location().Lat = lat
+		}
+	case name.Space == nsEXIF && name.Local == "GPSLongitude":
+		if long, ok := parseXMPCoordinate(value, 'E', 'W'); ok {
+			x.location().Long = long
+		}
+	case (name.Space == nsEXIF && name.Local == "DateTimeOriginal") ||
+		(name.Space == nsPhotoshop && name.Local == "DateCreated") ||
+		(name.Space == nsXMP && name.Local == "CreateDate"):
+		if date, ok := parseXMPDate(value); ok {
+			x.dates[name.Local] = date
+		}
+	}
+}
+
+func (x *XMP) location() *gps.Coordinates {
+	if x.Location == nil {
+		x.Location = &gps.Coordinates{}
+	}
+	return x.Location
+}
+
+func parseXMPDate(value string) (time.Time, bool) {
+	for _, layout := range xmpDateLayouts {
+		if date, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return date, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// parseXMPCoordinate parses a GPS coordinate in the XMP format "DDD,MM,SSk" or "DDD,MM.mmk"
+// where k is the given positive or negative direction
+func parseXMPCoordinate(value string, positive, negative byte) (float64, bool) {
+	if len(value) < 2 {
+		return 0, false
+	}
+	sign := 1.
+	switch value[len(value)-1] {
+	case positive:
+	case negative:
+		sign = -1
+	default:
+		return 0, false
+	}
+	parts := strings.Split(value[:len(value)-1], ",")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, false
+	}
+	var coordinate float64
+	for i, divisor := range []float64{1, 60, 3600}[:len(parts)] {
+		v, err := strconv.ParseFloat(strings.TrimSpace(parts[i]), 64)
+		if err != nil {
+			return 0, false
+		}
+		coordinate += v / divisor
+	}
+	return sign * coordinate, true
+}
+
+// formatXMPCoordinate formats a GPS coordinate as "DDD,MM.mmmmmmk"
+func formatXMPCoordinate(value float64, positive, negative byte) string {
+	direction := positive
+	if value < 0 {
+		direction, value = negative, -value
+	}
+	degrees := math.Floor(value)
+	return fmt.Sprintf("%d,%.6f%c", int(degrees), (value-degrees)*60, direction)
+}
+
+// Write writes this meta-data as an XMP packet which can be used as sidecar file
+func (x *XMP) Write(out io.Writer) error {
+	w := bufio.NewWriter(out)
+	fmt.Fprintln(w, `<?xpacket begin="" id="W5M0MpCehiHzreSzNTczkc9d"?>`)
+	fmt.Fprintln(w, `<x:xmpmeta xmlns:x="adobe:ns:meta/">`)
+	fmt.Fprintf(w, " <rdf:RDF xmlns:rdf=\"%s\">\n", nsRDF)
+	fmt.Fprintf(w, "  <rdf:Description rdf:about=\"\"\n    xmlns:xmp=\"%s\"\n    xmlns:dc=\"%s\"\n    xmlns:exif=\"%s\"\n    xmlns:tiff=\"%s\"\n",
+		nsXMP, nsDC, nsEXIF, nsTIFF)
+	fmt.Fprintf(w, "    xmp:Rating=\"%d\"", x.Rating)
+	if x.Orientation != 0 {
+		fmt.Fprintf(w, "\n    tiff:Orientation=\"%d\"", x.Orientation)
+	}
+	if !x.DateTaken.IsZero() {
+		fmt.Fprintf(w, "\n    exif:DateTimeOriginal=\"%s\"", x.DateTaken.Format(time.RFC3339))
+	}
+	if x.Location != nil {
+		fmt.Fprintf(w, "\n    exif:GPSLatitude=\"%s\"\n    exif:GPSLongitude=\"%s\"",
+			formatXMPCoordinate(x.Location.Lat, 'N', 'S'), formatXMPCoordinate(x.Location.Long, 'E', 'W'))
+	}
+	fmt.Fprintln(w, ">")
+	if len(x.Keywords) > 0 {
+		fmt.Fprintln(w, "   <dc:subject>\n    <rdf:Bag>")
+		for _, keyword := range x.Keywords {
+			fmt.Fprint(w, "     <rdf:li>")
+			if err := xml.EscapeText(w, []byte(keyword)); err != nil {
+				return err
+			}
+			fmt.Fprintln(w, "</rdf:li>")
+		}
+		fmt.Fprintln(w, "    </rdf:Bag>\n   </dc:subject>")
+	}
+	fmt.Fprintln(w, "  </rdf:Description>\n </rdf:RDF>\n</x:xmpmeta>")
+	fmt.Fprint(w, `<?xpacket end="w"?>`)
+	return w.Flush()
+}
@@ -0,0 +1,111 @@
+package formats
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"bitbucket.org/kleinnic74/photos/domain/gps"
+)
+
+const lightroomXMP = `<x:xmpmeta xmlns:x="adobe:ns:meta/" x:xmptk="Adobe XMP Core 5.6-c140">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about=""
+    xmlns:xmp="http://ns.adobe.com/xap/1.0/"
+    xmlns:exif="http://ns.adobe.com/exif/1.0/"
+    xmlns:photoshop="http://ns.adobe.com/photoshop/1.0/"
+    xmlns:dc="http://purl.org/dc/elements/1.1/"
+   xmp:Rating="4"
+   xmp:CreateDate="2018-05-01T09:00:00"
+   photoshop:DateCreated="2018-05-02T10:15:30.00+02:00"
+   exif:GPSLatitude="47,22.5N"
+   exif:GPSLongitude="8,32,24W">
+   <dc:subject>
+    <rdf:Bag>
+     <rdf:li>beach</rdf:li>
+     <rdf:li>Zürich &amp; friends</rdf:li>
+    </rdf:Bag>
+   </dc:subject>
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>`
+
+const darktableXMP = `<?xml version="1.0" encoding="UTF-8"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/" x:xmptk="XMP Core 4.4.0-Exiv2">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about=""
+    xmlns:xmp="http://ns.adobe.com/xap/1.0/"
+    xmlns:exif="http://ns.adobe.com/exif/1.0/"
+    xmlns:tiff="http://ns.adobe.com/tiff/1.0/">
+   <xmp:Rating>-1</xmp:Rating>
+   <exif:DateTimeOriginal>2019-07-14T10:30:00</exif:DateTimeOriginal>
+   <tiff:Orientation>6</tiff:Orientation>
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>`
+
+func TestReadXMP(t *testing.T) {
+	x, err := ReadXMP(strings.NewReader(lightroomXMP))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x.Rating != 4 {
+		t.Errorf("Bad rating: expected 4, got %d", x.Rating)
+	}
+	if expected := []string{"beach", "Zürich & friends"}; !reflect.DeepEqual(expected, x.Keywords) {
+		t.Errorf("Bad keywords: expected %v, got %v", expected, x.Keywords)
+	}
+	if expected := time.Date(2018, 5, 2, 8, 15, 30, 0, time.UTC); !x.DateTaken.Equal(expected) {
+		t.Errorf("Bad date: expected %s, got %s", expected, x.DateTaken)
+	}
+	if x.Location == nil || math.Abs(x.Location.Lat-47.375) > 1e-9 || math.Abs(x.Location.Long+8.54) > 1e-9 {
+		t.Errorf("Bad location: %v", x.Location)
+	}
+
+	x, err = ReadXMP(strings.NewReader(darktableXMP))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x.Rating != RatingRejected {
+		t.Errorf("Bad rating: expected rejected, got %d", x.Rating)
+	}
+	if x.Orientation != 6 {
+		t.Errorf("Bad orientation: expected 6, got %d", x.Orientation)
+	}
+	if expected := time.Date(2019, 7, 14, 10, 30, 0, 0, time.Local); !x.DateTaken.Equal(expected) {
+		t.Errorf("Bad date: expected %s, got %s", expected, x.DateTaken)
+	}
+	if x.Location != nil {
+		t.Errorf("Unexpected location %v", x.Location)
+	}
+}
+
+func TestWriteXMP(t *testing.T) {
+	x := &XMP{
+		Rating:      3,
+		Keywords:    []string{"<tag>", "Zürich"},
+		DateTaken:   time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		Location:    gps.MustNewCoordinates(-33.85, 151.2),
+		Orientation: 8,
+	}
+	var buf bytes.Buffer
+	if err := x.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadXMP(&buf)
+	if err != nil {
+		t.Fatalf("Failed to read written XMP: %s\n%s", err, buf.String())
+	}
+	if read.Rating != x.Rating || read.Orientation != x.Orientation || !read.DateTaken.Equal(x.DateTaken) {
+		t.Errorf("Bad values: expected %v, got %v", x, read)
+	}
+	if !reflect.DeepEqual(x.Keywords, read.Keywords) {
+		t.Errorf("Bad keywords: expected %v, got %v", x.Keywords, read.Keywords)
+	}
+	if read.Location == nil || math.Abs(read.Location.Lat-x.Location.Lat) > 1e-6 || math.Abs(read.Location.Long-x.Location.Long) > 1e-6 {
+		t.Errorf("Bad location: expected %v, got %v", x.Location, read.Location)
+	}
+}
@@ -55,8 +55,8 @@ func AsAddress(country, iso, city, zip string) Address {
 }
 
 func (a *Address) UnmarshalJSON(data []byte) (err error) {
-	type aliasAddress *Address
-	alias := aliasAddress(a)
+	type aliasAddress Address
+	alias := (*aliasAddress)(a)
 	if err = json.Unmarshal(data, alias); err != nil {
 		return
 	}
@@ -0,0 +1,27 @@
+package gps
+
+import (
+	"errors"
+	"time"
+	// Embedded zone data, so that time zones can be looked up on hosts without zoneinfo
+	_ "time/tzdata"
+
+	"github.com/zsefvlol/timezonemapper"
+)
+
+var (
+	UnknownTimeZone = errors.New("No time zone known at location")
+)
+
+// TimeZone returns the time zone at the given coordinates, it is looked up offline in a
+// compiled-in table of time zone boundaries
+func (c Coordinates) TimeZone() (*time.Location, error) {
+	if !c.IsValid() {
+		return nil, InvalidGPSCoordinates
+	}
+	name := timezonemapper.LatLngToTimezoneString(c.Lat, c.Long)
+	if name == "" {
+		return nil, UnknownTimeZone
+	}
+	return time.LoadLocation(name)
+}
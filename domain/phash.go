@@ -0,0 +1,49 @@
+package domain
+
+import (
+	"fmt"
+	"image"
+	"math/bits"
+
+	"github.com/disintegration/gift"
+)
+
+// PerceptualHash is a 64 bit difference hash (dHash) of an image. Visually similar images
+// have hashes with a small Hamming distance, even if they have been resized or re-encoded
+type PerceptualHash uint64
+
+// DHash computes the difference hash of the given image after applying its orientation
+func DHash(img image.Image, orientation Orientation) PerceptualHash {
+	// Downscale first so that the orientation is applied on a small image
+	small := resized(img, gift.Resize(64, 64, gift.BoxResampling))
+	small = orientation.Apply(small)
+	g := gift.New(gift.Grayscale(), gift.Resize(9, 8, gift.BoxResampling))
+	gray := image.NewGray(g.Bounds(small.Bounds()))
+	g.Draw(gray, small)
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if gray.GrayAt(x, y).Y < gray.GrayAt(x+1, y).Y {
+				hash |= 1
+			}
+		}
+	}
+	return PerceptualHash(hash)
+}
+
+func resized(img image.Image, filter gift.Filter) image.Image {
+	g := gift.New(filter)
+	dst := image.NewRGBA(g.Bounds(img.Bounds()))
+	g.Draw(dst, img)
+	return dst
+}
+
+// Distance returns the number of bits differing between both hashes
+func (h PerceptualHash) Distance(other PerceptualHash) int {
+	return bits.OnesCount64(uint64(h ^ other))
+}
+
+func (h PerceptualHash) String() string {
+	return fmt.Sprintf("%016x", uint64(h))
+}
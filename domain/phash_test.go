@@ -0,0 +1,32 @@
+package domain_test
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"bitbucket.org/kleinnic74/photos/domain"
+	"github.com/disintegration/gift"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDHashSimilarImages(t *testing.T) {
+	img := gradient(400, 300)
+	small := image.NewRGBA(image.Rect(0, 0, 200, 150))
+	gift.New(gift.Resize(200, 150, gift.LinearResampling)).Draw(small, img)
+
+	hash := domain.DHash(img, domain.NormalOrientation)
+	assert.NotEqual(t, domain.PerceptualHash(0), hash)
+	assert.True(t, hash.Distance(domain.DHash(small, domain.NormalOrientation)) <= 2, "Resized image should have a similar hash")
+	assert.True(t, hash.Distance(domain.DHash(img, domain.Rotate180Orientation)) > 16, "Rotated image should have a different hash")
+}
+
+func gradient(width, height int) image.Image {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetGray(x, y, color.Gray{Y: uint8((x*255/width + y*128/height) % 256)})
+		}
+	}
+	return img
+}
@@ -0,0 +1,135 @@
+package domain
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"bitbucket.org/kleinnic74/photos/domain/formats"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// maxPreviewAspectDiff is the maximum relative difference between the aspect ratios of a photo
+// and its preview, some cameras add black bars to fit their previews to a fixed aspect ratio
+const maxPreviewAspectDiff = 0.02
+
+const (
+	thumbFromPreview = "preview"
+	thumbFromDecode  = "decode"
+)
+
+var thumbbaseDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Subsystem: "thumber",
+	Name:      "thumbbase_duration_seconds",
+	Help:      "Time to load the image thumbs are created from, by format and by source (embedded preview or full decode)",
+	Buckets:   prometheus.ExponentialBuckets(0.001, 2, 14),
+}, []string{"format", "source"})
+
+func observeThumbbase(format, source string, start time.Time) {
+	thumbbaseDuration.WithLabelValues(format, source).Observe(time.Since(start).Seconds())
+}
+
+// decodeThumbbase creates thumbs of formats without embedded previews from the full image
+func decodeThumbbase(format string, decode photoDecoder) thumbFunc {
+	return func(in io.Reader, size ThumbSize) (image.Image, error) {
+		defer observeThumbbase(format, thumbFromDecode, time.Now())
+		return decode(in)
+	}
+}
+
+// jpegThumbbase uses the EXIF thumbnail if it is large enough for the given size, the
+// full image is decoded otherwise
+func jpegThumbbase(in io.Reader, size ThumbSize) (image.Image, error) {
+	start := time.Now()
+	// The EXIF thumbnail is stored at the start of the file, the rest of the file is only read
+	// when the full image is decoded
+	head, err := ioutil.ReadAll(io.LimitReader(in, maxMetaDataSize))
+	if err != nil {
+		return nil, err
+	}
+	if config, err := jpeg.DecodeConfig(bytes.NewReader(head)); err == nil {
+		if ex, err := exif.Decode(bytes.NewReader(head)); err == nil {
+			if thumb, err := ex.JpegThumbnail(); err == nil {
+				if preview, found := previewFor(size, config.Width, config.Height, thumb); found {
+					if img, err := jpeg.Decode(bytes.NewReader(preview)); err == nil {
+						observeThumbbase("jpg", thumbFromPreview, start)
+						return img, nil
+					}
+				}
+			}
+		}
+	}
+	defer observeThumbbase("jpg", thumbFromDecode, start)
+	return jpeg.Decode(io.MultiReader(bytes.NewReader(head), in))
+}
+
+// rawThumbbase uses the smallest embedded preview large enough for the given size, RAW files
+// cannot be decoded so the largest preview is used otherwise
+func rawThumbbase(format string, in io.Reader, size ThumbSize) (image.Image, error) {
+	start := time.Now()
+	previews, err := formats.ReadRawPreviews(in)
+	if err != nil {
+		return nil, err
+	}
+	largest := previews[len(previews)-1]
+	if config, err := jpeg.DecodeConfig(bytes.NewReader(largest)); err == nil {
+		if preview, found := previewFor(size, config.Width, config.Height, previews[:len(previews)-1]...); found {
+			if img, err := jpeg.Decode(bytes.NewReader(preview)); err == nil {
+				observeThumbbase(format, thumbFromPreview, start)
+				return img, nil
+			}
+		}
+	}
+	defer observeThumbbase(format, thumbFromDecode, start)
+	return jpeg.Decode(bytes.NewReader(largest))
+}
+
+// previewFor returns the smallest of the given JPEG previews which has the aspect ratio of the
+// photo of the given dimensions and which is large enough for thumbs of the given size
+func previewFor(size ThumbSize, width, height int, previews ...[]byte) ([]byte, bool) {
+	if width <= 0 || height <= 0 {
+		return nil, false
+	}
+	var best []byte
+	var bestPixels int
+	for _, preview := range previews {
+		config, err := jpeg.DecodeConfig(bytes.NewReader(preview))
+		if err != nil || config.Width <= 0 || config.Height <= 0 {
+			continue
+		}
+		if !sameAspect(width, height, config.Width, config.Height) || !size.fits(config.Width, config.Height) {
+			continue
+		}
+		if pixels := config.Width * config.Height; best == nil || pixels < bestPixels {
+			best, bestPixels = preview, pixels
+		}
+	}
+	return best, best != nil
+}
+
+// fits tells whether thumbs of this size can be created from an image of the given
+// dimensions without enlarging it
+func (size ThumbSize) fits(width, height int) bool {
+	short, long := width, height
+	if short > long {
+		short, long = long, short
+	}
+	if size.square {
+		return short >= size.width
+	}
+	return long >= size.width
+}
+
+func sameAspect(width, height, previewWidth, previewHeight int) bool {
+	aspect := float64(width) / float64(height)
+	diff := float64(previewWidth)/float64(previewHeight) - aspect
+	if diff < 0 {
+		diff = -diff
+	}
+	return diff <= maxPreviewAspectDiff*aspect
+}
@@ -0,0 +1,95 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJPEGThumbbase(t *testing.T) {
+	data := jpegWithExifThumbnail(t, image.Rect(0, 0, 1500, 1000), image.Rect(0, 0, 300, 200))
+
+	img, err := JPEG.Thumbbase(bytes.NewReader(data), Small)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, image.Rect(0, 0, 300, 200), img.Bounds(), "EXIF thumbnail is large enough")
+	img, err = JPEG.Thumbbase(bytes.NewReader(data), Large)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, image.Rect(0, 0, 1500, 1000), img.Bounds(), "EXIF thumbnail is too small")
+	img, err = JPEG.Thumbbase(bytes.NewReader(data), NewThumbSize("QS", 250, true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, image.Rect(0, 0, 1500, 1000), img.Bounds(), "EXIF thumbnail is too small for square thumbs")
+
+	// Thumbnail with black bars to fit a 4:3 aspect ratio
+	data = jpegWithExifThumbnail(t, image.Rect(0, 0, 1500, 1000), image.Rect(0, 0, 320, 240))
+	img, err = JPEG.Thumbbase(bytes.NewReader(data), Small)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, image.Rect(0, 0, 1500, 1000), img.Bounds(), "EXIF thumbnail has another aspect ratio")
+
+	// Data after the end of the image is not read when the EXIF thumbnail is used
+	data = jpegWithExifThumbnail(t, image.Rect(0, 0, 1500, 1000), image.Rect(0, 0, 300, 200))
+	in := bytes.NewReader(append(data, make([]byte, 2*maxMetaDataSize)...))
+	if _, err := JPEG.Thumbbase(in, Small); err != nil {
+		t.Fatal(err)
+	}
+	assert.NotZero(t, in.Len(), "Only the start of the file should be read")
+}
+
+func TestPreviewFor(t *testing.T) {
+	small, large := encodeJPEG(t, image.Rect(0, 0, 160, 120)), encodeJPEG(t, image.Rect(0, 0, 800, 600))
+	preview, found := previewFor(Small, 4000, 3000, large, small)
+	assert.True(t, found)
+	assert.Equal(t, small, preview, "Smallest preview is used")
+	preview, found = previewFor(Large, 4000, 3000, large, small)
+	assert.True(t, found)
+	assert.Equal(t, large, preview)
+	_, found = previewFor(NewThumbSize("XL", 1280, false), 4000, 3000, large, small)
+	assert.False(t, found)
+	_, found = previewFor(Small, 0, 0, large, small)
+	assert.False(t, found)
+}
+
+func encodeJPEG(t *testing.T, bounds image.Rectangle) []byte {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(bounds), nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// jpegWithExifThumbnail creates a JPEG image with an EXIF segment holding only a thumbnail
+func jpegWithExifThumbnail(t *testing.T, bounds, thumbBounds image.Rectangle) []byte {
+	thumb := encodeJPEG(t, thumbBounds)
+	var tiff bytes.Buffer
+	tiff.WriteString("MM\x00*")
+	for _, v := range []interface{}{
+		// IFD0 without entries, followed by IFD1 with the thumbnail offset and length
+		uint32(8), uint16(0), uint32(14),
+		uint16(2),
+		uint16(0x0201), uint16(4), uint32(1), uint32(44),
+		uint16(0x0202), uint16(4), uint32(1), uint32(len(thumb)),
+		uint32(0),
+	} {
+		binary.Write(&tiff, binary.BigEndian, v)
+	}
+	tiff.Write(thumb)
+
+	var out bytes.Buffer
+	out.Write([]byte{0xFF, 0xD8, 0xFF, 0xE1})
+	binary.Write(&out, binary.BigEndian, uint16(2+6+tiff.Len()))
+	out.WriteString("Exif\x00\x00")
+	out.Write(tiff.Bytes())
+	out.Write(encodeJPEG(t, bounds)[2:])
+	return out.Bytes()
+}
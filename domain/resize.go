@@ -0,0 +1,42 @@
+package domain
+
+import (
+	"image"
+	"image/jpeg"
+	"io"
+
+	"bitbucket.org/kleinnic74/photos/domain/formats"
+	"github.com/disintegration/gift"
+)
+
+// DefaultQuality is the quality used by lossy encoders when none is given
+const DefaultQuality = 80
+
+// Resize decodes an image of the given format, rotates it according to its orientation and
+// scales it down to the given width, 0 keeps the size. Images are never enlarged
+func Resize(in io.Reader, format Format, orientation Orientation, width int) (image.Image, error) {
+	img, err := format.Decode(in)
+	if err != nil {
+		return nil, err
+	}
+	img = orientation.Apply(img)
+	if width <= 0 || img.Bounds().Dx() <= width {
+		return img, nil
+	}
+	filter := gift.New(gift.Resize(width, 0, gift.LanczosResampling))
+	resized := image.NewRGBA(filter.Bounds(img.Bounds()))
+	filter.Draw(resized, img)
+	return resized, nil
+}
+
+// EncodeWithQuality encodes the image in the given format, the quality from 1 to 100 is
+// used by lossy formats and ignored by the others
+func EncodeWithQuality(format Format, img image.Image, out io.Writer, quality int) error {
+	switch format.ID() {
+	case JPEG.ID():
+		return jpeg.Encode(out, img, &jpeg.Options{Quality: quality})
+	case WEBP.ID():
+		return formats.EncodeWebP(out, img, quality)
+	}
+	return format.Encode(img, out)
+}
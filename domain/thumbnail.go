@@ -1,32 +1,119 @@
 package domain
 
 import (
+	"fmt"
 	"image"
+	"image/jpeg"
 	"io"
 	"sort"
+	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/disintegration/gift"
 )
 
+// DefaultThumbQuality is the JPEG quality of thumbs
+const DefaultThumbQuality = jpeg.DefaultQuality
+
 var (
-	Small  = ThumbSize{120, "S"}
-	Medium = ThumbSize{427, "M"}
-	Large  = ThumbSize{640, "L"}
+	Small  = ThumbSize{width: 120, Name: "S"}
+	Medium = ThumbSize{width: 427, Name: "M"}
+	Large  = ThumbSize{width: 640, Name: "L"}
+	// Square is a crop of the center of photos for grids
+	Square = ThumbSize{width: 240, Name: "Q", square: true}
 
 	ThumbSizes = map[string]ThumbSize{
 		Small.Name:  Small,
 		Medium.Name: Medium,
 		Large.Name:  Large,
+		Square.Name: Square,
 	}
 )
 
 type ThumbSize struct {
 	width int
 	Name  string
+	// square thumbs are cropped to the center of the photo
+	square bool
+}
+
+// NewThumbSize defines a thumb size whose longest side is width, square thumbs are
+// cropped to the center of the photo
+func NewThumbSize(name string, width int, square bool) ThumbSize {
+	return ThumbSize{width: width, Name: name, square: square}
+}
+
+// ParseThumbSizes parses a comma separated list of thumb sizes given as name:width, with
+// an additional :square for square thumbs, e.g. XL:1280,QL:480:square
+func ParseThumbSizes(spec string) ([]ThumbSize, error) {
+	var sizes []ThumbSize
+	for _, s := range strings.Split(spec, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		parts := strings.Split(s, ":")
+		if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || (len(parts) == 3 && parts[2] != "square") {
+			return nil, fmt.Errorf("Invalid thumb size '%s'", s)
+		}
+		width, err := strconv.Atoi(parts[1])
+		if err != nil || width <= 0 {
+			return nil, fmt.Errorf("Invalid width of thumb size '%s'", s)
+		}
+		sizes = append(sizes, NewThumbSize(parts[0], width, len(parts) == 3))
+	}
+	return sizes, nil
+}
+
+// AddThumbSizes makes additional thumb sizes available, this must be done before thumbs
+// are created
+func AddThumbSizes(sizes ...ThumbSize) {
+	for _, size := range sizes {
+		ThumbSizes[size.Name] = size
+	}
+}
+
+// AllThumbSizes returns the available thumb sizes ordered by width
+func AllThumbSizes() []ThumbSize {
+	sizes := make([]ThumbSize, 0, len(ThumbSizes))
+	for _, size := range ThumbSizes {
+		sizes = append(sizes, size)
+	}
+	sort.Slice(sizes, func(i, j int) bool {
+		if sizes[i].width == sizes[j].width {
+			return sizes[i].Name < sizes[j].Name
+		}
+		return sizes[i].width < sizes[j].width
+	})
+	return sizes
+}
+
+// MaxThumbWidth returns the width of the largest configured thumb size
+func MaxThumbWidth() int {
+	sizes := AllThumbSizes()
+	return sizes[len(sizes)-1].width
+}
+
+func (size ThumbSize) Width() int {
+	return size.width
+}
+
+func (size ThumbSize) IsSquare() bool {
+	return size.square
+}
+
+// String returns the size as parsed by ParseThumbSizes
+func (size ThumbSize) String() string {
+	if size.square {
+		return fmt.Sprintf("%s:%d:square", size.Name, size.width)
+	}
+	return fmt.Sprintf("%s:%d", size.Name, size.width)
 }
 
 func (size ThumbSize) BoundsOf(img image.Rectangle) image.Rectangle {
+	if size.square {
+		return image.Rect(0, 0, size.width, size.width)
+	}
 	if img.Dx() > img.Dy() {
 		return image.Rect(0, 0, size.width, (size.width*img.Dy())/img.Dx())
 	} else {
@@ -41,15 +128,17 @@ type Thumber interface {
 type LocalThumber struct{}
 
 func (t LocalThumber) CreateThumb(in io.Reader, format Format, orientation Orientation, size ThumbSize) (image.Image, error) {
-	img, err := format.Thumbbase(in)
+	img, err := format.Thumbbase(in, size)
 	if err != nil {
 		return nil, err
 	}
 	targetSize := size.BoundsOf(img.Bounds())
 	thumb := image.NewRGBA(targetSize)
-	filter := gift.New(
-		gift.ResizeToFit(targetSize.Dx(), targetSize.Dy(), gift.LinearResampling),
-	)
+	resize := gift.ResizeToFit(targetSize.Dx(), targetSize.Dy(), gift.LinearResampling)
+	if size.square {
+		resize = gift.ResizeToFill(targetSize.Dx(), targetSize.Dy(), gift.LinearResampling, gift.CenterAnchor)
+	}
+	filter := gift.New(resize)
 	filter.Draw(thumb, img)
 	return image.Image(orientation.Apply(thumb)), nil
 }
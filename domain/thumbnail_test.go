@@ -20,6 +20,7 @@ func TestThumbnailSize(t *testing.T) {
 		{Medium, image.Rect(0, 0, 1920, 1080), image.Rect(0, 0, Medium.width, 1080*Medium.width/1920)},
 		{Medium, image.Rect(0, 0, 1080, 1920), image.Rect(0, 0, 1080*Medium.width/1920, Medium.width)},
 		{Small, image.Rect(0, 0, 500, 1000), image.Rect(0, 0, 500*Small.width/1000, Small.width)},
+		{Square, image.Rect(0, 0, 1920, 1080), image.Rect(0, 0, Square.width, Square.width)},
 	}
 	for i, d := range data {
 		t.Run(fmt.Sprintf("#%d", i), func(t *testing.T) {
@@ -31,6 +32,20 @@ func TestThumbnailSize(t *testing.T) {
 	}
 }
 
+func TestParseThumbSizes(t *testing.T) {
+	sizes, err := ParseThumbSizes("XL:1280, QL:480:square,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []ThumbSize{NewThumbSize("XL", 1280, false), NewThumbSize("QL", 480, true)}, sizes)
+	assert.Equal(t, "QL:480:square", sizes[1].String())
+
+	for _, invalid := range []string{"XL", "XL:big", "XL:0", ":100", "XL:100:round"} {
+		_, err := ParseThumbSizes(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
 func TestCreateThumb(t *testing.T) {
 	data := []struct {
 		Src    string
@@ -49,33 +64,55 @@ func TestCreateThumb(t *testing.T) {
 		// Landscape orientation (width > height)
 		{"testdata/orientation/landscape_7.jpg", "testdata/orientation/landscape_7_thumb.jpg", image.Rect(0, 0, Medium.width, 284)},
 	}
+	squares := []struct {
+		Src    string
+		Dst    string
+		Bounds image.Rectangle
+	}{
+		{"testdata/orientation/portrait_6.jpg", "testdata/orientation/portrait_6_square.jpg", image.Rect(0, 0, Square.width, Square.width)},
+		{"testdata/orientation/landscape_7.jpg", "testdata/orientation/landscape_7_square.jpg", image.Rect(0, 0, Square.width, Square.width)},
+	}
 	base := "testdata/out"
 	if err := os.MkdirAll(base, 0777); err != nil {
 		t.Errorf("Failed to create directory %s: %s", base, err)
 	}
 	for _, d := range data {
 		t.Run(d.Src, func(t *testing.T) {
-			in, err := os.Open(d.Src)
-			if err != nil {
-				t.Fatalf("Failed to open test image: %s", err)
-			}
-			var meta MediaMetaData
-			if err := JPEG.DecodeMetaData(in, &meta); err != nil {
-				t.Fatalf("Failed to decode metadata: %s", err)
-			}
-			in.Seek(0, 0)
-			defer in.Close()
-			var thumber LocalThumber
-			result, err := thumber.CreateThumb(in, JPEG, meta.Orientation, Medium)
-			dst := filepath.Join("testdata/out", filepath.Base(d.Dst))
-			if err := saveImage(result, filepath.Join(dst)); err != nil {
-				t.Fatalf("Failed to save %s: %s", dst, err)
-			}
+			result := createThumb(t, d.Src, d.Dst, Medium)
+			assert.Equal(t, d.Bounds, result.Bounds())
+		})
+	}
+	for _, d := range squares {
+		t.Run(d.Dst, func(t *testing.T) {
+			result := createThumb(t, d.Src, d.Dst, Square)
 			assert.Equal(t, d.Bounds, result.Bounds())
 		})
 	}
 }
 
+func createThumb(t *testing.T, src, dst string, size ThumbSize) image.Image {
+	in, err := os.Open(src)
+	if err != nil {
+		t.Fatalf("Failed to open test image: %s", err)
+	}
+	defer in.Close()
+	var meta MediaMetaData
+	if err := JPEG.DecodeMetaData(in, &meta); err != nil {
+		t.Fatalf("Failed to decode metadata: %s", err)
+	}
+	in.Seek(0, 0)
+	var thumber LocalThumber
+	result, err := thumber.CreateThumb(in, JPEG, meta.Orientation, size)
+	if err != nil {
+		t.Fatalf("Failed to create thumb: %s", err)
+	}
+	out := filepath.Join("testdata/out", filepath.Base(dst))
+	if err := saveImage(result, out); err != nil {
+		t.Fatalf("Failed to save %s: %s", out, err)
+	}
+	return result
+}
+
 func saveImage(img image.Image, path string) error {
 	out, err := os.Create(path)
 	if err != nil {
@@ -0,0 +1,86 @@
+package domain
+
+import (
+	"strings"
+	"time"
+
+	"bitbucket.org/kleinnic74/photos/domain/formats"
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// maxZoneOffset is the largest offset from UTC of any time zone
+const maxZoneOffset = 14 * time.Hour
+
+// setTimeZone sets the capture time to the given time and records its UTC offset
+func (meta *MediaMetaData) setTimeZone(t time.Time) {
+	_, offset := t.Zone()
+	meta.DateTaken = t
+	meta.TimeZoneOffset = &offset
+}
+
+// inferTimeZone uses the time zone at the location of the photo if the time zone of the
+// capture time is unknown. The wall clock time is kept, as cameras are usually set to local
+// time. Nothing is changed for photos without location
+func (meta *MediaMetaData) inferTimeZone() {
+	if meta.TimeZoneOffset != nil || meta.Location == nil {
+		return
+	}
+	zone, err := meta.Location.TimeZone()
+	if err != nil {
+		return
+	}
+	meta.setTimeZone(withZone(meta.DateTaken, zone))
+}
+
+// exifTimeZone returns the time zone of the capture time found in the EXIF data: an offset
+// tag, the Canon time zone info or the difference between the local time and the UTC time
+// of the GPS timestamp
+func exifTimeZone(ex *exif.Exif, local time.Time) (*time.Location, bool) {
+	if offset, found := formats.OffsetTimeOf(ex); found {
+		return time.FixedZone("", offset), true
+	}
+	if zone, err := ex.TimeZone(); err == nil && zone != nil {
+		return zone, true
+	}
+	if utc, found := gpsTimeOf(ex); found {
+		offset := withZone(local, time.UTC).Sub(utc).Round(15 * time.Minute)
+		if offset >= -maxZoneOffset && offset <= maxZoneOffset {
+			return time.FixedZone("", int(offset.Seconds())), true
+		}
+	}
+	return nil, false
+}
+
+// gpsTimeOf returns the UTC time of the GPS fix
+func gpsTimeOf(ex *exif.Exif) (time.Time, bool) {
+	dateTag, err := ex.Get(exif.GPSDateStamp)
+	if err != nil {
+		return time.Time{}, false
+	}
+	date, err := dateTag.StringVal()
+	if err != nil {
+		return time.Time{}, false
+	}
+	day, err := time.Parse("2006:01:02", strings.TrimSpace(strings.TrimRight(date, "\x00")))
+	if err != nil {
+		return time.Time{}, false
+	}
+	timeTag, err := ex.Get(exif.GPSTimeStamp)
+	if err != nil || timeTag.Count != 3 {
+		return time.Time{}, false
+	}
+	var seconds float64
+	for i, unit := range []float64{3600, 60, 1} {
+		num, denom, err := timeTag.Rat2(i)
+		if err != nil || denom == 0 {
+			return time.Time{}, false
+		}
+		seconds += unit * float64(num) / float64(denom)
+	}
+	return day.Add(time.Duration(seconds * float64(time.Second))), true
+}
+
+// withZone returns the time with the same wall clock as t in the given zone
+func withZone(t time.Time, zone *time.Location) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), zone)
+}
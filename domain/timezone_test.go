@@ -0,0 +1,165 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+type tiffEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	data  []byte
+}
+
+func asciiEntry(tag uint16, value string) tiffEntry {
+	return tiffEntry{tag: tag, typ: 2, count: uint32(len(value) + 1), data: append([]byte(value), 0)}
+}
+
+func rationalEntry(tag uint16, values ...uint32) tiffEntry {
+	var data bytes.Buffer
+	for _, v := range values {
+		binary.Write(&data, binary.LittleEndian, []uint32{v, 1})
+	}
+	return tiffEntry{tag: tag, typ: 5, count: uint32(len(values)), data: data.Bytes()}
+}
+
+// exifWith builds little-endian TIFF data with the given entries in the EXIF and GPS IFDs
+func exifWith(t *testing.T, exifEntries, gpsEntries []tiffEntry) *exif.Exif {
+	var buf bytes.Buffer
+	buf.WriteString("II*\x00")
+	binary.Write(&buf, binary.LittleEndian, uint32(8))
+	// IFD0 only contains the pointers to the EXIF and GPS IFDs
+	const ifd0Size = 2 + 2*12 + 4
+	exifOffset := uint32(8 + ifd0Size)
+	gpsOffset := exifOffset + ifdSize(exifEntries)
+	writeIFD(&buf, 8, []tiffEntry{
+		{tag: 0x8769, typ: 4, count: 1, data: le32(exifOffset)},
+		{tag: 0x8825, typ: 4, count: 1, data: le32(gpsOffset)},
+	})
+	writeIFD(&buf, exifOffset, exifEntries)
+	writeIFD(&buf, gpsOffset, gpsEntries)
+	ex, err := exif.Decode(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("Bad test EXIF data: %s", err)
+	}
+	return ex
+}
+
+func le32(v uint32) []byte {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], v)
+	return b[:]
+}
+
+func ifdSize(entries []tiffEntry) uint32 {
+	size := uint32(2 + 12*len(entries) + 4)
+	for _, e := range entries {
+		if len(e.data) > 4 {
+			size += uint32(len(e.data))
+		}
+	}
+	return size
+}
+
+func writeIFD(buf *bytes.Buffer, offset uint32, entries []tiffEntry) {
+	binary.Write(buf, binary.LittleEndian, uint16(len(entries)))
+	data := offset + uint32(2+12*len(entries)+4)
+	var values bytes.Buffer
+	for _, e := range entries {
+		binary.Write(buf, binary.LittleEndian, []uint16{e.tag, e.typ})
+		binary.Write(buf, binary.LittleEndian, e.count)
+		if len(e.data) > 4 {
+			binary.Write(buf, binary.LittleEndian, data+uint32(values.Len()))
+			values.Write(e.data)
+		} else {
+			var inline [4]byte
+			copy(inline[:], e.data)
+			buf.Write(inline[:])
+		}
+	}
+	binary.Write(buf, binary.LittleEndian, uint32(0))
+	buf.Write(values.Bytes())
+}
+
+func TestExifTimeZone(t *testing.T) {
+	dateTaken := asciiEntry(0x9003, "2019:07:14 10:30:00")
+	zurich := []tiffEntry{
+		asciiEntry(0x0001, "N"),
+		rationalEntry(0x0002, 47, 22, 0),
+		asciiEntry(0x0003, "E"),
+		rationalEntry(0x0004, 8, 32, 0),
+	}
+	data := []struct {
+		name     string
+		exif     []tiffEntry
+		gps      []tiffEntry
+		expected time.Time
+		offset   *int
+	}{
+		{
+			name:     "offset tag",
+			exif:     []tiffEntry{dateTaken, asciiEntry(0x9011, "+09:00")},
+			expected: time.Date(2019, 7, 14, 1, 30, 0, 0, time.UTC),
+			offset:   intPtr(9 * 3600),
+		},
+		{
+			name: "GPS timestamp",
+			exif: []tiffEntry{dateTaken},
+			gps: []tiffEntry{
+				rationalEntry(0x0007, 15, 30, 4),
+				asciiEntry(0x001D, "2019:07:14"),
+			},
+			expected: time.Date(2019, 7, 14, 15, 30, 0, 0, time.UTC),
+			offset:   intPtr(-5 * 3600),
+		},
+		{
+			name:     "location",
+			exif:     []tiffEntry{dateTaken},
+			gps:      zurich,
+			expected: time.Date(2019, 7, 14, 8, 30, 0, 0, time.UTC),
+			offset:   intPtr(2 * 3600),
+		},
+		{
+			name:     "offset tag wins over location",
+			exif:     []tiffEntry{dateTaken, asciiEntry(0x9011, "-03:30")},
+			gps:      zurich,
+			expected: time.Date(2019, 7, 14, 14, 0, 0, 0, time.UTC),
+			offset:   intPtr(-3*3600 - 1800),
+		},
+		{
+			name:     "sub-seconds",
+			exif:     []tiffEntry{dateTaken, asciiEntry(0x9011, "+09:00"), asciiEntry(0x9291, "25")},
+			expected: time.Date(2019, 7, 14, 1, 30, 0, 250000000, time.UTC),
+			offset:   intPtr(9 * 3600),
+		},
+		{
+			name:     "unknown",
+			exif:     []tiffEntry{dateTaken},
+			expected: time.Date(2019, 7, 14, 10, 30, 0, 0, time.Local),
+		},
+	}
+	for _, d := range data {
+		var meta MediaMetaData
+		applyExif(exifWith(t, d.exif, d.gps), &meta)
+		if !meta.DateTaken.Equal(d.expected) {
+			t.Errorf("%s: bad date, expected %s, got %s", d.name, d.expected, meta.DateTaken)
+		}
+		switch {
+		case d.offset == nil && meta.TimeZoneOffset != nil:
+			t.Errorf("%s: unexpected offset %d", d.name, *meta.TimeZoneOffset)
+		case d.offset != nil && meta.TimeZoneOffset == nil:
+			t.Errorf("%s: missing offset", d.name)
+		case d.offset != nil && *d.offset != *meta.TimeZoneOffset:
+			t.Errorf("%s: bad offset, expected %d, got %d", d.name, *d.offset, *meta.TimeZoneOffset)
+		}
+	}
+}
+
+func intPtr(v int) *int {
+	return &v
+}
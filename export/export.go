@@ -0,0 +1,276 @@
+// Package export copies selections of photos out of the library, either to a directory
+// or to a ZIP archive, together with a JSON and an XMP sidecar per photo
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"time"
+
+	"bitbucket.org/kleinnic74/photos/domain/gps"
+	"bitbucket.org/kleinnic74/photos/library"
+	"bitbucket.org/kleinnic74/photos/logging"
+	"go.uber.org/zap"
+)
+
+// Layout defines how exported files are organized
+type Layout string
+
+const (
+	// Dated keeps the YYYY/MM/DD directories of the library
+	Dated = Layout("dated")
+	// Flat puts all files into a single directory
+	Flat = Layout("flat")
+)
+
+// batchSize is the number of photo IDs read at once from an index
+const batchSize = 100
+
+var (
+	ErrInvalidSelection = errors.New("Exactly one of date range, place, event or photos must be selected")
+	ErrNoEvents         = errors.New("Events are not enabled")
+	ErrNothingSelected  = errors.New("No photos selected")
+)
+
+// ErrInvalidLayout indicates an unknown layout
+type ErrInvalidLayout string
+
+func (e ErrInvalidLayout) Error() string {
+	return fmt.Sprintf("Invalid layout '%s', expected '%s' or '%s'", string(e), Dated, Flat)
+}
+
+// Selection describes the photos to export, only one kind of selection may be used
+type Selection struct {
+	From   time.Time         `json:"from,omitempty"`
+	To     time.Time         `json:"to,omitempty"`
+	Place  gps.PlaceID       `json:"place,omitempty"`
+	Event  string            `json:"event,omitempty"`
+	Photos []library.PhotoID `json:"photos,omitempty"`
+}
+
+// Validate checks that exactly one kind of selection is used
+func (s Selection) Validate() error {
+	var count int
+	if !s.From.IsZero() || !s.To.IsZero() {
+		count++
+	}
+	if s.Place != "" {
+		count++
+	}
+	if s.Event != "" {
+		count++
+	}
+	if len(s.Photos) > 0 {
+		count++
+	}
+	if count != 1 {
+		return ErrInvalidSelection
+	}
+	return nil
+}
+
+// ParseLayout returns the layout with the given name, the default is Dated
+func ParseLayout(name string) (Layout, error) {
+	switch Layout(name) {
+	case "", Dated:
+		return Dated, nil
+	case Flat:
+		return Flat, nil
+	}
+	return "", ErrInvalidLayout(name)
+}
+
+// Sidecar is the meta-data written next to each exported photo
+type Sidecar struct {
+	ID library.PhotoID `json:"id"`
+	library.PhotoMeta
+	Address *gps.Address `json:"address,omitempty"`
+}
+
+// EventIndex is the part of the event index needed to export the photos of an event
+type EventIndex interface {
+	FindPhotosPaged(ctx context.Context, eventID string, start, max int) ([]library.PhotoID, bool, error)
+}
+
+// TagSource provides the current tags of a photo, written as keywords to the XMP sidecars
+type TagSource interface {
+	TagsOf(ctx context.Context, id library.PhotoID) ([]string, error)
+}
+
+// Exporter writes selected photos and their sidecars to a Writer
+type Exporter struct {
+	lib    library.PhotoLibrary
+	dates  library.DateIndex
+	geo    library.GeoIndex
+	events EventIndex
+	tags   TagSource
+}
+
+func NewExporter(lib library.PhotoLibrary, dates library.DateIndex, geo library.GeoIndex) *Exporter {
+	return &Exporter{
+		lib:   lib,
+		dates: dates,
+		geo:   geo,
+	}
+}
+
+// UseEvents enables the export of events
+func (e *Exporter) UseEvents(events EventIndex) {
+	e.events = events
+}
+
+// UseTags writes the tags of photos as keywords instead of the imported keywords
+func (e *Exporter) UseTags(tags TagSource) {
+	e.tags = tags
+}
+
+// Export writes all selected photos to the given writer and returns the number of exported photos
+func (e *Exporter) Export(ctx context.Context, selection Selection, layout Layout, w Writer) (int, error) {
+	logger, ctx := logging.SubFrom(ctx, "export")
+	if err := selection.Validate(); err != nil {
+		return 0, err
+	}
+	ids, err := e.source(selection)
+	if err != nil {
+		return 0, err
+	}
+	var count int
+	for offset := 0; ; offset += batchSize {
+		batch, hasMore, err := ids(ctx, offset, batchSize)
+		if err != nil {
+			return count, err
+		}
+		for _, id := range batch {
+			photo, err := e.lib.Get(ctx, id)
+			if err != nil {
+				logger.Warn("Skipping photo", zap.String("photo", string(id)), zap.Error(err))
+				continue
+			}
+			if err := e.exportPhoto(ctx, photo, fileName(photo, layout), w); err != nil {
+				return count, err
+			}
+			count++
+		}
+		if !hasMore {
+			break
+		}
+	}
+	logger.Info("Photos exported", zap.Int("count", count))
+	return count, nil
+}
+
+// Check validates the selection and checks that it contains at least one photo of the
+// library, so that errors can be reported before starting to write an export
+func (e *Exporter) Check(ctx context.Context, selection Selection) error {
+	if err := selection.Validate(); err != nil {
+		return err
+	}
+	ids, err := e.source(selection)
+	if err != nil {
+		return err
+	}
+	for offset := 0; ; offset += batchSize {
+		batch, hasMore, err := ids(ctx, offset, batchSize)
+		if err != nil {
+			return err
+		}
+		for _, id := range batch {
+			if _, err := e.lib.Get(ctx, id); err == nil {
+				return nil
+			}
+		}
+		if !hasMore {
+			return ErrNothingSelected
+		}
+	}
+}
+
+type idSource func(ctx context.Context, start, max int) ([]library.PhotoID, bool, error)
+
+func (e *Exporter) source(selection Selection) (idSource, error) {
+	switch {
+	case len(selection.Photos) > 0:
+		return func(ctx context.Context, start, max int) ([]library.PhotoID, bool, error) {
+			if start >= len(selection.Photos) {
+				return nil, false, nil
+			}
+			end := start + max
+			if end > len(selection.Photos) {
+				end = len(selection.Photos)
+			}
+			return selection.Photos[start:end], end < len(selection.Photos), nil
+		}, nil
+	case selection.Place != "":
+		return func(ctx context.Context, start, max int) ([]library.PhotoID, bool, error) {
+			return e.geo.FindByPlacePaged(ctx, selection.Place, start, max)
+		}, nil
+	case selection.Event != "":
+		if e.events == nil {
+			return nil, ErrNoEvents
+		}
+		return func(ctx context.Context, start, max int) ([]library.PhotoID, bool, error) {
+			return e.events.FindPhotosPaged(ctx, selection.Event, start, max)
+		}, nil
+	default:
+		to := selection.To
+		if to.IsZero() {
+			to = time.Now()
+		}
+		return func(ctx context.Context, start, max int) ([]library.PhotoID, bool, error) {
+			return e.dates.FindRangePaged(ctx, selection.From, to, start, max)
+		}, nil
+	}
+}
+
+func (e *Exporter) exportPhoto(ctx context.Context, photo *library.Photo, name string, w Writer) error {
+	content, _, err := e.lib.OpenContent(ctx, photo.ID)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+	out, err := w.Create(name, photo.DateTaken)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, content); err != nil {
+		return err
+	}
+	sidecar := Sidecar{ID: photo.ID, PhotoMeta: photo.PhotoMeta}
+	if address, found, err := e.geo.Get(ctx, photo.ID); err == nil && found {
+		sidecar.Address = address
+	}
+	out, err = w.Create(name+".json", photo.DateTaken)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(&sidecar); err != nil {
+		return err
+	}
+	keywords := photo.Keywords
+	if e.tags != nil {
+		if keywords, err = e.tags.TagsOf(ctx, photo.ID); err != nil {
+			return err
+		}
+	}
+	out, err = w.Create(library.SidecarPath(name), photo.DateTaken)
+	if err != nil {
+		return err
+	}
+	return library.XMPOf(photo, keywords).Write(out)
+}
+
+// fileName returns the slash separated name of the exported photo
+func fileName(photo *library.Photo, layout Layout) string {
+	name := filepath.ToSlash(photo.Path)
+	if layout == Flat {
+		return path.Base(name)
+	}
+	return name
+}
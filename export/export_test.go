@@ -0,0 +1,105 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"bitbucket.org/kleinnic74/photos/domain/gps"
+	"bitbucket.org/kleinnic74/photos/library"
+	"bitbucket.org/kleinnic74/photos/library/boltstore"
+	"bitbucket.org/kleinnic74/photos/library/librarytest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportToZip(t *testing.T) {
+	ctx := context.Background()
+	lib, _, db := librarytest.NewLibrary(t)
+	dates, err := boltstore.NewDateIndex(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	geo, err := boltstore.NewBoltGeoIndex(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	photo := librarytest.AddFile(t, lib, "../domain/testdata/Canon_40D.jpg")
+	nice := gps.AsAddress("France", "FR", "Nice", "06000")
+	if err := geo.Update(ctx, photo.ExtendedPhotoID, &nice); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	w := NewZipWriter(&buf)
+	exporter := NewExporter(lib, dates, geo)
+	assert.NoError(t, exporter.Check(ctx, Selection{Photos: []library.PhotoID{"unknown", photo.ID}}))
+	assert.Equal(t, ErrNothingSelected, exporter.Check(ctx, Selection{Photos: []library.PhotoID{"unknown"}}))
+	assert.Equal(t, ErrNothingSelected, exporter.Check(ctx, Selection{Place: "nowhere"}))
+	assert.Equal(t, ErrNoEvents, exporter.Check(ctx, Selection{Event: "holidays"}))
+	assert.Equal(t, ErrInvalidSelection, exporter.Check(ctx, Selection{}))
+	count, err := exporter.Export(ctx, Selection{Photos: []library.PhotoID{photo.ID, "unknown"}}, Dated, w)
+	if err != nil {
+		t.Fatalf("Export failed: %s", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, count)
+
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.ToSlash(photo.Path)
+	if assert.Len(t, archive.File, 3) {
+		assert.Equal(t, name, archive.File[0].Name)
+		assert.Equal(t, uint64(fileSize(t, "../domain/testdata/Canon_40D.jpg")), archive.File[0].UncompressedSize64)
+		assert.Equal(t, name+".json", archive.File[1].Name)
+		in, err := archive.File[1].Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer in.Close()
+		var sidecar struct {
+			ID      library.PhotoID `json:"id"`
+			Format  string          `json:"format"`
+			Address *gps.Address    `json:"address"`
+		}
+		if err := json.NewDecoder(in).Decode(&sidecar); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, photo.ID, sidecar.ID)
+		assert.Equal(t, photo.Format.ID(), sidecar.Format)
+		if assert.NotNil(t, sidecar.Address, "Address of the photo") {
+			assert.Equal(t, nice.ID, sidecar.Address.ID)
+			assert.Equal(t, "Nice", sidecar.Address.City)
+		}
+		assert.Equal(t, name+".xmp", archive.File[2].Name)
+	}
+}
+
+func fileSize(t *testing.T, path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Size()
+}
+
+func TestFileName(t *testing.T) {
+	photo := &library.Photo{Path: filepath.Join("2019", "06", "14", "abcdef.jpg")}
+	assert.Equal(t, "2019/06/14/abcdef.jpg", fileName(photo, Dated))
+	assert.Equal(t, "abcdef.jpg", fileName(photo, Flat))
+}
+
+func TestSelectionValidate(t *testing.T) {
+	assert.Equal(t, ErrInvalidSelection, Selection{}.Validate())
+	assert.Equal(t, ErrInvalidSelection, Selection{Place: "1", Event: "e"}.Validate())
+	assert.NoError(t, Selection{From: time.Now()}.Validate())
+	assert.NoError(t, Selection{Photos: []library.PhotoID{"a"}}.Validate())
+}
@@ -0,0 +1,69 @@
+package export
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"bitbucket.org/kleinnic74/photos/domain/gps"
+	"bitbucket.org/kleinnic74/photos/library"
+	"bitbucket.org/kleinnic74/photos/tasks"
+)
+
+var ErrNoTarget = errors.New("No export target given")
+
+// RegisterTasks defines the user-runnable export task
+func (e *Exporter) RegisterTasks(repo *tasks.TaskRepository) {
+	repo.RegisterWithProperties("exportPhotos", func() tasks.Task {
+		return &exportTask{exporter: e}
+	}, tasks.TaskProperties{
+		UserRunnable: true,
+	})
+}
+
+// exportTask exports photos to a directory, or to a ZIP file if Target ends with .zip
+type exportTask struct {
+	exporter *Exporter
+
+	From   time.Time         `json:"from,omitempty"`
+	To     time.Time         `json:"to,omitempty"`
+	Place  gps.PlaceID       `json:"place,omitempty"`
+	Event  string            `json:"event,omitempty"`
+	Photos []library.PhotoID `json:"photos,omitempty"`
+	Layout Layout            `json:"layout,omitempty"`
+	Target string            `json:"target"`
+}
+
+func (t *exportTask) Describe() string {
+	return fmt.Sprintf("Exporting photos to %s", t.Target)
+}
+
+func (t *exportTask) Execute(ctx context.Context, executor tasks.TaskExecutor, lib library.PhotoLibrary) error {
+	if t.Target == "" {
+		return ErrNoTarget
+	}
+	layout, err := ParseLayout(string(t.Layout))
+	if err != nil {
+		return err
+	}
+	selection := Selection{From: t.From, To: t.To, Place: t.Place, Event: t.Event, Photos: t.Photos}
+	if err := selection.Validate(); err != nil {
+		return err
+	}
+	var w Writer
+	if strings.HasSuffix(strings.ToLower(t.Target), ".zip") {
+		w, err = NewZipFileWriter(t.Target)
+	} else {
+		w, err = NewDirWriter(t.Target)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := t.exporter.Export(ctx, selection, layout, w); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
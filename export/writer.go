@@ -0,0 +1,99 @@
+package export
+
+import (
+	"archive/zip"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Writer receives the exported files, names are slash separated paths relative to the
+// root of the export. The content of a file must be written before the next file is created
+type Writer interface {
+	Create(name string, modified time.Time) (io.Writer, error)
+	Close() error
+}
+
+type dirWriter struct {
+	dir     string
+	current *os.File
+}
+
+// NewDirWriter returns a Writer creating files below the given directory
+func NewDirWriter(dir string) (Writer, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &dirWriter{dir: dir}, nil
+}
+
+func (w *dirWriter) Create(name string, modified time.Time) (io.Writer, error) {
+	if err := w.closeCurrent(); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(w.dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w.current = f
+	return f, nil
+}
+
+func (w *dirWriter) closeCurrent() error {
+	if w.current == nil {
+		return nil
+	}
+	err := w.current.Close()
+	w.current = nil
+	return err
+}
+
+func (w *dirWriter) Close() error {
+	return w.closeCurrent()
+}
+
+type zipWriter struct {
+	zip    *zip.Writer
+	closer io.Closer
+}
+
+// NewZipWriter returns a Writer streaming a ZIP archive to out. Photos are already
+// compressed, so files are stored without compression
+func NewZipWriter(out io.Writer) Writer {
+	return &zipWriter{zip: zip.NewWriter(out)}
+}
+
+// NewZipFileWriter returns a Writer creating a ZIP archive at the given path
+func NewZipFileWriter(path string) (Writer, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &zipWriter{zip: zip.NewWriter(f), closer: f}, nil
+}
+
+func (w *zipWriter) Create(name string, modified time.Time) (io.Writer, error) {
+	return w.zip.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Store,
+		Modified: modified,
+	})
+}
+
+func (w *zipWriter) Close() error {
+	err := w.zip.Close()
+	if w.closer != nil {
+		if cerr := w.closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
@@ -1,6 +1,7 @@
 package geocoding
 
 import (
+	"bytes"
 	"context"
 	"errors"
 
@@ -62,6 +63,26 @@ func (g *Geocoder) LookupPhotoOnAdd(ctx context.Context, p *library.Photo) (task
 	return NewGeoLookupTaskWith(g, p.ExtendedPhotoID, *p.Location), true
 }
 
+// LookupPhotoOnUpdate removes the previous location of an updated photo from the index and
+// returns a task resolving its new location, if the location or the date of the photo has changed
+func (g *Geocoder) LookupPhotoOnUpdate(ctx context.Context, old, updated *library.Photo) (tasks.Task, bool, error) {
+	if sameLocation(old.Location, updated.Location) && bytes.Equal(old.SortID, updated.SortID) {
+		return nil, false, nil
+	}
+	if err := g.index.Remove(ctx, old.ExtendedPhotoID); err != nil {
+		return nil, false, err
+	}
+	task, ok := g.LookupPhotoOnAdd(ctx, updated)
+	return task, ok, nil
+}
+
+func sameLocation(a, b *gps.Coordinates) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
 func (g *Geocoder) ResolveAndStoreLocation(ctx context.Context, p library.ExtendedPhotoID, coords gps.Coordinates) error {
 	logger, ctx := logging.FromWithNameAndFields(ctx, "geocoder", zap.String("photo", string(p.ID)))
 	logger.Info("Reverse geocoding", zap.Stringer("location", coords))
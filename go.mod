@@ -18,10 +18,13 @@ require (
 	github.com/reusee/mmh3 v0.0.0-20140820141314-64b85163255b
 	github.com/rwcarlsen/goexif v0.0.0-20190401172101-9e8deecbddbd
 	github.com/stretchr/testify v1.8.1
+	github.com/zsefvlol/timezonemapper v1.0.0
 	go.etcd.io/bbolt v1.3.7
 	go.uber.org/atomic v1.10.0 // indirect
 	go.uber.org/multierr v1.9.0 // indirect
 	go.uber.org/zap v1.24.0
+	golang.org/x/image v0.5.0
 	golang.org/x/net v0.7.0
 	golang.org/x/tools v0.6.0 // indirect
+	modernc.org/sqlite v1.20.4
 )
@@ -59,6 +59,7 @@ func (t importDirTask) Execute(ctx context.Context, tasks tasks.TaskExecutor, li
 		return err
 	}
 	if stat.IsDir() {
+		candidates := liveCandidates{}
 		return filepath.Walk(t.Importdir, func(path string, info os.FileInfo, err error) error {
 			logger.Debug("Visiting file", zap.String("path", path),
 				zap.String("name", info.Name()))
@@ -70,15 +71,23 @@ func (t importDirTask) Execute(ctx context.Context, tasks tasks.TaskExecutor, li
 				logger.Debug("Entering dir", zap.String("dir", path))
 				return nil
 			}
-			return t.importImage(ctx, path, tasks)
+			if isSidecar(path) {
+				// Sidecars are read when importing their image
+				return nil
+			}
+			return t.importImage(ctx, path, candidates.of(path), tasks)
 		})
 	} else {
-		return t.importImage(ctx, t.Importdir, tasks)
+		return t.importImage(ctx, t.Importdir, nil, tasks)
 	}
 }
 
-func (t importDirTask) importImage(ctx context.Context, path string, tasks tasks.TaskExecutor) error {
-	task := NewImportFileTaskWithParams(t.DryRun, path, false)
+func (t importDirTask) importImage(ctx context.Context, path string, companions []string, tasks tasks.TaskExecutor) error {
+	task := &importFileTask{
+		Path:       path,
+		DryRun:     t.DryRun,
+		Companions: companions,
+	}
 	_, err := tasks.Submit(ctx, task)
 	return err
 }
@@ -8,6 +8,7 @@ import (
 	"os"
 
 	"bitbucket.org/kleinnic74/photos/domain"
+	"bitbucket.org/kleinnic74/photos/domain/formats"
 	"bitbucket.org/kleinnic74/photos/library"
 	"bitbucket.org/kleinnic74/photos/logging"
 	"bitbucket.org/kleinnic74/photos/tasks"
@@ -18,6 +19,9 @@ type importFileTask struct {
 	Path   string `json:"path,omitempty"`
 	DryRun bool   `json:"dryrun"`
 	Delete bool   `json:"delete,omitempty"`
+	// Companions are the files next to Path with the same base name, they are looked up
+	// in the directory of Path if not given
+	Companions []string `json:"companions"`
 }
 
 func NewImportFileTask() tasks.Task {
@@ -54,15 +58,44 @@ func (t importFileTask) Execute(ctx context.Context, tasks tasks.TaskExecutor, l
 	defer content.Close()
 
 	meta := library.PhotoMeta{
-		Name:        t.Path,
-		Format:      img.Format(),
-		Orientation: img.Orientation(),
-		DateTaken:   img.DateTaken(),
-		Location:    img.Location(),
+		Name:           t.Path,
+		Format:         img.Format(),
+		Orientation:    img.Orientation(),
+		DateTaken:      img.DateTaken(),
+		TimeZoneOffset: img.TimeZoneOffset(),
+		Location:       img.Location(),
+		Keywords:       img.Keywords(),
+		Rating:         img.Rating(),
+		Video:          img.Video(),
+		Camera:         img.Camera(),
+		Width:          img.Width(),
+		Height:         img.Height(),
+	}
+	var sidecar *formats.XMP
+	sidecarPath, hasSidecar := findSidecar(t.Path)
+	if hasSidecar {
+		if sidecar, err = readSidecar(sidecarPath); err != nil {
+			log.Warn("Ignoring invalid sidecar", zap.String("file", sidecarPath), zap.Error(err))
+			hasSidecar = false
+		} else {
+			mergeSidecar(&meta, sidecar)
+		}
 	}
 	if err := lib.Add(ctx, meta, content); err != nil {
 		return err
 	}
+	if hasSidecar && sidecar.Rating == formats.RatingRejected {
+		if err := markRejected(ctx, lib, img); err != nil {
+			log.Warn("Could not mark photo as rejected", zap.String("file", t.Path), zap.Error(err))
+		}
+	}
+	companions := t.Companions
+	if companions == nil {
+		companions = liveCandidates{}.of(t.Path)
+	}
+	if err := pairLive(ctx, lib, t.Path, img, companions); err != nil {
+		log.Warn("Could not pair Live Photo", zap.String("file", t.Path), zap.Error(err))
+	}
 
 	if t.Delete {
 		err = os.Remove(t.Path)
@@ -71,6 +104,11 @@ func (t importFileTask) Execute(ctx context.Context, tasks tasks.TaskExecutor, l
 			return err
 		}
 		log.Info("Deleted file", zap.String("file", t.Path))
+		if hasSidecar {
+			if err := os.Remove(sidecarPath); err != nil {
+				log.Warn("Delete failed", zap.String("file", sidecarPath), zap.Error(err))
+			}
+		}
 	}
 	return nil
 }
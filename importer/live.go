@@ -0,0 +1,114 @@
+package importer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"bitbucket.org/kleinnic74/photos/domain"
+	"bitbucket.org/kleinnic74/photos/library"
+	"bitbucket.org/kleinnic74/photos/logging"
+	"go.uber.org/zap"
+)
+
+// liveCandidates lists the files of each directory by base name, so that the Live Photo
+// companions of all files in a directory are found with a single directory listing
+type liveCandidates map[string]map[string][]string
+
+// of returns the paths of the files with the same base name as the given file
+func (c liveCandidates) of(path string) []string {
+	dir, name := filepath.Split(path)
+	dir = filepath.Clean(dir)
+	byBase, found := c[dir]
+	if !found {
+		byBase = make(map[string][]string)
+		entries, _ := os.ReadDir(dir)
+		for _, e := range entries {
+			if e.IsDir() || isSidecar(e.Name()) {
+				continue
+			}
+			key := baseKey(e.Name())
+			byBase[key] = append(byBase[key], e.Name())
+		}
+		c[dir] = byBase
+	}
+	candidates := []string{}
+	for _, other := range byBase[baseKey(name)] {
+		if other != name {
+			candidates = append(candidates, filepath.Join(dir, other))
+		}
+	}
+	return candidates
+}
+
+func baseKey(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, filepath.Ext(name)))
+}
+
+// findLiveCompanion returns the other half of a Live Photo: the video next to a still image
+// or the still image next to a video. Both have the same base name and, if known, the same
+// content identifier
+func findLiveCompanion(img domain.Photo, candidates []string) (domain.Photo, bool) {
+	if t := img.Format().Type(); t != domain.Picture && t != domain.Video {
+		return nil, false
+	}
+	for _, path := range candidates {
+		other, err := domain.NewPhoto(path)
+		if err != nil || !isLivePair(img, other) {
+			continue
+		}
+		return other, true
+	}
+	return nil, false
+}
+
+// isLivePair returns true if the given photos are a still image and a video which do not
+// have different content identifiers
+func isLivePair(a, b domain.Photo) bool {
+	if a.Format().Type() == b.Format().Type() {
+		return false
+	}
+	if t := b.Format().Type(); t != domain.Picture && t != domain.Video {
+		return false
+	}
+	idA, idB := a.ContentIdentifier(), b.ContentIdentifier()
+	return idA == "" || idB == "" || idA == idB
+}
+
+// pairLive links the imported photo with its Live Photo companion if the companion has already
+// been imported. Otherwise the pair is made when the companion is imported
+func pairLive(ctx context.Context, lib library.PhotoLibrary, path string, img domain.Photo, candidates []string) error {
+	companion, found := findLiveCompanion(img, candidates)
+	if !found {
+		return nil
+	}
+	imported, found, err := findImported(ctx, lib, img)
+	if err != nil || !found {
+		return err
+	}
+	importedCompanion, found, err := findImported(ctx, lib, companion)
+	if err != nil || !found {
+		return err
+	}
+	still, video := imported, importedCompanion
+	if still.Format.Type() == domain.Video {
+		still, video = video, still
+	}
+	logging.From(ctx).Info("Found Live Photo", zap.String("file", path), zap.String("companion", companion.Name()))
+	return lib.PairLive(ctx, still.ID, video.ID)
+}
+
+// findImported returns the photo of the library with the content of the given image
+func findImported(ctx context.Context, lib library.PhotoLibrary, img domain.Photo) (*library.Photo, bool, error) {
+	content, err := img.Content()
+	if err != nil {
+		return nil, false, err
+	}
+	defer content.Close()
+	hash, err := library.ComputeHash(content)
+	if err != nil {
+		return nil, false, err
+	}
+	return lib.FindByHash(ctx, hash)
+}
@@ -0,0 +1,82 @@
+package importer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"bitbucket.org/kleinnic74/photos/domain"
+	"bitbucket.org/kleinnic74/photos/domain/formats"
+	"bitbucket.org/kleinnic74/photos/library"
+	"bitbucket.org/kleinnic74/photos/logging"
+	"go.uber.org/zap"
+)
+
+// isSidecar returns true if the given file is an XMP sidecar
+func isSidecar(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".xmp")
+}
+
+// findSidecar returns the path of the XMP sidecar of the given image. darktable appends the
+// extension to the name of the image, Lightroom replaces the extension of the image
+func findSidecar(path string) (string, bool) {
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	for _, candidate := range []string{path + ".xmp", path + ".XMP", base + ".xmp", base + ".XMP"} {
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+func readSidecar(path string) (*formats.XMP, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	return formats.ReadXMP(in)
+}
+
+// mergeSidecar overrides the meta-data read from the image with the values of its sidecar,
+// which contains the edits made in other tools. Keywords of both are kept
+func mergeSidecar(meta *library.PhotoMeta, x *formats.XMP) {
+	if x.Rating > 0 {
+		meta.Rating = x.Rating
+	}
+	for _, k := range x.Keywords {
+		found := false
+		for _, existing := range meta.Keywords {
+			found = found || existing == k
+		}
+		if !found {
+			meta.Keywords = append(meta.Keywords, k)
+		}
+	}
+	if !x.DateTaken.IsZero() {
+		meta.DateTaken = x.DateTaken
+	}
+	if x.Location != nil && x.Location.IsValid() {
+		location := *x.Location
+		meta.Location = &location
+	}
+	if x.Orientation != 0 {
+		meta.Orientation = domain.Orientation(x.Orientation)
+	}
+}
+
+// markRejected flags the photo imported from the given image as rejected, the photo is
+// looked up by the hash of its content
+func markRejected(ctx context.Context, lib library.PhotoLibrary, img domain.Photo) error {
+	photo, found, err := findImported(ctx, lib, img)
+	if err != nil || !found {
+		return err
+	}
+	rejected := true
+	if _, err := lib.UpdateMeta(ctx, photo.ID, library.MetaUpdate{Rejected: &rejected}); err != nil {
+		return err
+	}
+	logging.From(ctx).Info("Rejected in sidecar", zap.String("photo", string(photo.ID)))
+	return nil
+}
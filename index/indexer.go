@@ -55,6 +55,11 @@ func (indexer *Indexer) Add(ctx context.Context, photo *library.Photo) error {
 	return nil
 }
 
+// Remove forgets the indexing state of the given photo
+func (indexer *Indexer) Remove(ctx context.Context, photo *library.Photo) error {
+	return indexer.tracker.Remove(photo.ID)
+}
+
 func (indexer *Indexer) RegisterDefered(name Name, version library.Version, init tasks.DeferredNewPhotoCallback) {
 	indexer.tracker.RegisterIndex(name, version)
 	indexer.indexers[name] = init
@@ -69,6 +69,7 @@ type ElementState struct {
 type Tracker interface {
 	RegisterIndex(Name, library.Version)
 	Update(Name, library.PhotoID, error) error
+	Remove(library.PhotoID) error
 	Get(library.PhotoID) (State, bool, error)
 	GetMissingIndexes(library.PhotoID) ([]Name, error)
 	GetElementStatus(context.Context) ([]ElementState, error)
@@ -0,0 +1,428 @@
+package boltstore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"bitbucket.org/kleinnic74/photos/library"
+	"bitbucket.org/kleinnic74/photos/logging"
+	"github.com/google/uuid"
+	bolt "go.etcd.io/bbolt"
+	"go.uber.org/zap"
+)
+
+var (
+	albumsBucket        = []byte("_albums")
+	photosByAlbumBucket = []byte("_photosByAlbum")
+	// trashedAlbumPhotosBucket maps trashed photos to the JSON encoded albums they were removed from
+	trashedAlbumPhotosBucket = []byte("_trashedAlbumPhotos")
+)
+
+type AlbumID string
+
+// Album is a user-curated, ordered collection of photos
+type Album struct {
+	ID      AlbumID         `json:"id"`
+	Name    string          `json:"name"`
+	Cover   library.PhotoID `json:"cover,omitempty"`
+	Count   int             `json:"count"`
+	Created time.Time       `json:"created"`
+}
+
+// albumPosition is the place of a trashed photo in an album
+type albumPosition struct {
+	Album    AlbumID `json:"album"`
+	Position int     `json:"position"`
+	Cover    bool    `json:"cover,omitempty"`
+}
+
+// ErrNoSuchAlbum indicates that an album does not exist
+type ErrNoSuchAlbum AlbumID
+
+func (e ErrNoSuchAlbum) Error() string {
+	return fmt.Sprintf("No album with id %s", string(e))
+}
+
+// ErrPhotoNotInAlbum indicates that a photo is not part of an album
+type ErrPhotoNotInAlbum library.PhotoID
+
+func (e ErrPhotoNotInAlbum) Error() string {
+	return fmt.Sprintf("Photo %s is not part of the album", string(e))
+}
+
+// AlbumIndex stores albums and the ordered list of photos they contain. Photos
+// are referenced by their ID, so albums are not affected when a photo is re-dated
+type AlbumIndex struct {
+	db *bolt.DB
+}
+
+func NewAlbumIndex(db *bolt.DB) (*AlbumIndex, error) {
+	if err := db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(albumsBucket); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(photosByAlbumBucket); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(trashedAlbumPhotosBucket); err != nil {
+			return err
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return &AlbumIndex{
+		db: db,
+	}, nil
+}
+
+// Create creates a new empty album with the given name
+func (index *AlbumIndex) Create(ctx context.Context, name string) (*Album, error) {
+	a := Album{
+		ID:      AlbumID(uuid.New().String()),
+		Name:    name,
+		Created: time.Now().UTC(),
+	}
+	return &a, index.db.Update(func(tx *bolt.Tx) error {
+		return putAlbum(tx, &a)
+	})
+}
+
+// Get returns the album with the given id
+func (index *AlbumIndex) Get(ctx context.Context, id AlbumID) (a *Album, err error) {
+	err = index.db.View(func(tx *bolt.Tx) error {
+		a, err = getAlbum(tx, id)
+		return err
+	})
+	return
+}
+
+// Update changes the name and cover of an album. The cover must be a photo of the album
+func (index *AlbumIndex) Update(ctx context.Context, id AlbumID, name string, cover library.PhotoID) (a *Album, err error) {
+	err = index.db.Update(func(tx *bolt.Tx) error {
+		if a, err = getAlbum(tx, id); err != nil {
+			return err
+		}
+		if cover != "" {
+			photos, err := getAlbumPhotos(tx, id)
+			if err != nil {
+				return err
+			}
+			if indexOf(photos, cover) == -1 {
+				return ErrPhotoNotInAlbum(cover)
+			}
+			a.Cover = cover
+		}
+		if name != "" {
+			a.Name = name
+		}
+		return putAlbum(tx, a)
+	})
+	return
+}
+
+// Delete removes the album with the given id, the photos are not affected
+func (index *AlbumIndex) Delete(ctx context.Context, id AlbumID) error {
+	return index.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(albumsBucket)
+		if b.Get([]byte(id)) == nil {
+			return ErrNoSuchAlbum(id)
+		}
+		if err := b.Delete([]byte(id)); err != nil {
+			return err
+		}
+		return tx.Bucket(photosByAlbumBucket).Delete([]byte(id))
+	})
+}
+
+// FindPaged returns the albums ordered by name
+func (index *AlbumIndex) FindPaged(ctx context.Context, start, maxCount int) (albums []Album, hasMore bool, err error) {
+	err = index.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(albumsBucket).ForEach(func(k, v []byte) error {
+			var a Album
+			if err := json.Unmarshal(v, &a); err != nil {
+				return err
+			}
+			albums = append(albums, a)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	sort.Slice(albums, func(i, j int) bool {
+		return strings.ToLower(albums[i].Name) < strings.ToLower(albums[j].Name)
+	})
+	from, to := pageBounds(len(albums), start, maxCount)
+	return albums[from:to], to < len(albums), nil
+}
+
+// AddPhotos inserts the given photos into the album at the given position, a negative
+// position appends the photos. Photos already in the album are moved to the new position
+func (index *AlbumIndex) AddPhotos(ctx context.Context, id AlbumID, position int, photos []library.PhotoID) (a *Album, err error) {
+	err = index.db.Update(func(tx *bolt.Tx) error {
+		if a, err = getAlbum(tx, id); err != nil {
+			return err
+		}
+		existing, err := getAlbumPhotos(tx, id)
+		if err != nil {
+			return err
+		}
+		existing = without(existing, photos)
+		if position < 0 || position > len(existing) {
+			position = len(existing)
+		}
+		updated := make([]library.PhotoID, 0, len(existing)+len(photos))
+		updated = append(updated, existing[:position]...)
+		updated = append(updated, unique(photos)...)
+		updated = append(updated, existing[position:]...)
+		return putAlbumPhotos(tx, a, updated)
+	})
+	return
+}
+
+// SetPhotos replaces the photos of the album, this is used to re-order an album
+func (index *AlbumIndex) SetPhotos(ctx context.Context, id AlbumID, photos []library.PhotoID) (a *Album, err error) {
+	err = index.db.Update(func(tx *bolt.Tx) error {
+		if a, err = getAlbum(tx, id); err != nil {
+			return err
+		}
+		return putAlbumPhotos(tx, a, unique(photos))
+	})
+	return
+}
+
+// RemovePhotos removes the given photos from the album
+func (index *AlbumIndex) RemovePhotos(ctx context.Context, id AlbumID, photos []library.PhotoID) (a *Album, err error) {
+	err = index.db.Update(func(tx *bolt.Tx) error {
+		if a, err = getAlbum(tx, id); err != nil {
+			return err
+		}
+		existing, err := getAlbumPhotos(tx, id)
+		if err != nil {
+			return err
+		}
+		return putAlbumPhotos(tx, a, without(existing, photos))
+	})
+	return
+}
+
+// RemovePhoto removes the given photo from all albums
+func (index *AlbumIndex) RemovePhoto(ctx context.Context, photo *library.Photo) error {
+	return index.db.Update(func(tx *bolt.Tx) error {
+		if _, err := removeFromAlbums(ctx, tx, photo.ID); err != nil {
+			return err
+		}
+		return tx.Bucket(trashedAlbumPhotosBucket).Delete([]byte(photo.ID))
+	})
+}
+
+// TrashPhoto removes a photo moved to the trash from all albums, its positions are kept
+// so that it is put back when restored
+func (index *AlbumIndex) TrashPhoto(ctx context.Context, photo *library.Photo) error {
+	return index.db.Update(func(tx *bolt.Tx) error {
+		positions, err := removeFromAlbums(ctx, tx, photo.ID)
+		if err != nil || len(positions) == 0 {
+			return err
+		}
+		v, err := json.Marshal(positions)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(trashedAlbumPhotosBucket).Put([]byte(photo.ID), v)
+	})
+}
+
+// RestorePhoto puts a photo restored from the trash back to its positions in the albums
+// which still exist
+func (index *AlbumIndex) RestorePhoto(ctx context.Context, photo *library.Photo) error {
+	return index.db.Update(func(tx *bolt.Tx) error {
+		trashed := tx.Bucket(trashedAlbumPhotosBucket)
+		v := trashed.Get([]byte(photo.ID))
+		if v == nil {
+			return nil
+		}
+		var positions []albumPosition
+		if err := json.Unmarshal(v, &positions); err != nil {
+			return err
+		}
+		for _, pos := range positions {
+			a, err := getAlbum(tx, pos.Album)
+			if _, deleted := err.(ErrNoSuchAlbum); deleted {
+				continue
+			} else if err != nil {
+				return err
+			}
+			photos, err := getAlbumPhotos(tx, pos.Album)
+			if err != nil {
+				return err
+			}
+			if indexOf(photos, photo.ID) != -1 {
+				continue
+			}
+			position := pos.Position
+			if position > len(photos) {
+				position = len(photos)
+			}
+			updated := make([]library.PhotoID, 0, len(photos)+1)
+			updated = append(updated, photos[:position]...)
+			updated = append(updated, photo.ID)
+			updated = append(updated, photos[position:]...)
+			if pos.Cover {
+				a.Cover = photo.ID
+			}
+			if err := putAlbumPhotos(tx, a, updated); err != nil {
+				return err
+			}
+		}
+		return trashed.Delete([]byte(photo.ID))
+	})
+}
+
+// FindPhotosPaged returns the photos of an album in album order
+func (index *AlbumIndex) FindPhotosPaged(ctx context.Context, id AlbumID, start, maxCount int) (photos []library.PhotoID, hasMore bool, err error) {
+	err = index.db.View(func(tx *bolt.Tx) error {
+		if _, err := getAlbum(tx, id); err != nil {
+			return err
+		}
+		photos, err = getAlbumPhotos(tx, id)
+		return err
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	from, to := pageBounds(len(photos), start, maxCount)
+	return photos[from:to], to < len(photos), nil
+}
+
+func getAlbum(tx *bolt.Tx, id AlbumID) (*Album, error) {
+	v := tx.Bucket(albumsBucket).Get([]byte(id))
+	if v == nil {
+		return nil, ErrNoSuchAlbum(id)
+	}
+	var a Album
+	if err := json.Unmarshal(v, &a); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func putAlbum(tx *bolt.Tx, a *Album) error {
+	v, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(albumsBucket).Put([]byte(a.ID), v)
+}
+
+func getAlbumPhotos(tx *bolt.Tx, id AlbumID) (photos []library.PhotoID, err error) {
+	v := tx.Bucket(photosByAlbumBucket).Get([]byte(id))
+	if v == nil {
+		return
+	}
+	err = json.Unmarshal(v, &photos)
+	return
+}
+
+// putAlbumPhotos stores the photos of the album and updates count and cover of the album
+func putAlbumPhotos(tx *bolt.Tx, a *Album, photos []library.PhotoID) error {
+	v, err := json.Marshal(photos)
+	if err != nil {
+		return err
+	}
+	if err := tx.Bucket(photosByAlbumBucket).Put([]byte(a.ID), v); err != nil {
+		return err
+	}
+	a.Count = len(photos)
+	if indexOf(photos, a.Cover) == -1 {
+		a.Cover = ""
+		if len(photos) > 0 {
+			a.Cover = photos[0]
+		}
+	}
+	return putAlbum(tx, a)
+}
+
+// removeFromAlbums removes the given photo from all albums and returns the positions
+// it had in the albums
+func removeFromAlbums(ctx context.Context, tx *bolt.Tx, id library.PhotoID) (positions []albumPosition, err error) {
+	log, ctx := logging.FromWithNameAndFields(ctx, "albumindex", zap.String("photo", string(id)))
+	if err := tx.Bucket(photosByAlbumBucket).ForEach(func(k, v []byte) error {
+		var photos []library.PhotoID
+		if err := json.Unmarshal(v, &photos); err != nil {
+			return err
+		}
+		if i := indexOf(photos, id); i != -1 {
+			positions = append(positions, albumPosition{Album: AlbumID(k), Position: i})
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	for i, pos := range positions {
+		log.Info("Removing photo from album", zap.String("album", string(pos.Album)))
+		a, err := getAlbum(tx, pos.Album)
+		if err != nil {
+			return nil, err
+		}
+		photos, err := getAlbumPhotos(tx, pos.Album)
+		if err != nil {
+			return nil, err
+		}
+		positions[i].Cover = a.Cover == id
+		if err := putAlbumPhotos(tx, a, without(photos, []library.PhotoID{id})); err != nil {
+			return nil, err
+		}
+	}
+	return positions, nil
+}
+
+func pageBounds(length, start, maxCount int) (from, to int) {
+	if start < 0 {
+		start = 0
+	}
+	if maxCount < 0 {
+		maxCount = 0
+	}
+	from, to = start, start+maxCount
+	if to > length {
+		to = length
+	}
+	if from > to {
+		from = to
+	}
+	return
+}
+
+func indexOf(photos []library.PhotoID, id library.PhotoID) int {
+	for i, p := range photos {
+		if p == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func without(photos []library.PhotoID, removed []library.PhotoID) []library.PhotoID {
+	result := make([]library.PhotoID, 0, len(photos))
+	for _, p := range photos {
+		if indexOf(removed, p) == -1 {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+func unique(photos []library.PhotoID) []library.PhotoID {
+	result := make([]library.PhotoID, 0, len(photos))
+	for _, p := range photos {
+		if indexOf(result, p) == -1 {
+			result = append(result, p)
+		}
+	}
+	return result
+}
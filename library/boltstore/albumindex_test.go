@@ -0,0 +1,115 @@
+package boltstore
+
+import (
+	"context"
+	"testing"
+
+	"bitbucket.org/kleinnic74/photos/library"
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestAlbumPhotos(t *testing.T) {
+	runTestWithBoltDB(t, func(t *testing.T, db *bolt.DB) {
+		ctx := context.Background()
+		albums, err := NewAlbumIndex(db)
+		if err != nil {
+			t.Fatalf("Failed to create AlbumIndex: %s", err)
+		}
+		album, err := albums.Create(ctx, "Holidays")
+		if err != nil {
+			t.Fatalf("Failed to create album: %s", err)
+		}
+		if _, err := albums.AddPhotos(ctx, album.ID, -1, ids("a", "b", "c")); err != nil {
+			t.Fatalf("Failed to add photos: %s", err)
+		}
+		album, err = albums.AddPhotos(ctx, album.ID, 1, ids("d", "c"))
+		if err != nil {
+			t.Fatalf("Failed to add photos: %s", err)
+		}
+		assert.Equal(t, 4, album.Count)
+		assert.Equal(t, library.PhotoID("a"), album.Cover)
+
+		photos, hasMore, err := albums.FindPhotosPaged(ctx, album.ID, 0, 3)
+		if err != nil {
+			t.Fatalf("Failed to list photos: %s", err)
+		}
+		assert.Equal(t, ids("a", "d", "c"), photos)
+		assert.True(t, hasMore)
+		photos, hasMore, err = albums.FindPhotosPaged(ctx, album.ID, -2, 3)
+		if err != nil {
+			t.Fatalf("Failed to list photos: %s", err)
+		}
+		assert.Equal(t, ids("a", "d", "c"), photos, "Negative start is the first page")
+		assert.True(t, hasMore)
+
+		if err := albums.RemovePhoto(ctx, &library.Photo{ExtendedPhotoID: library.ExtendedPhotoID{ID: "a"}}); err != nil {
+			t.Fatalf("Failed to remove photo: %s", err)
+		}
+		album, _ = albums.Get(ctx, album.ID)
+		assert.Equal(t, 3, album.Count)
+		assert.Equal(t, library.PhotoID("d"), album.Cover)
+
+		album, err = albums.SetPhotos(ctx, album.ID, ids("b", "c", "d"))
+		if err != nil {
+			t.Fatalf("Failed to re-order photos: %s", err)
+		}
+		photos, hasMore, _ = albums.FindPhotosPaged(ctx, album.ID, 0, 10)
+		assert.Equal(t, ids("b", "c", "d"), photos)
+		assert.False(t, hasMore)
+		assert.Equal(t, library.PhotoID("d"), album.Cover)
+
+		if _, err := albums.Update(ctx, album.ID, "", "a"); err == nil {
+			t.Errorf("Expected error when setting cover not in album")
+		}
+		if err := albums.Delete(ctx, album.ID); err != nil {
+			t.Fatalf("Failed to delete album: %s", err)
+		}
+		if _, err := albums.Get(ctx, album.ID); err == nil {
+			t.Errorf("Expected ErrNoSuchAlbum for deleted album")
+		}
+	})
+}
+
+func ids(values ...string) []library.PhotoID {
+	result := make([]library.PhotoID, len(values))
+	for i, v := range values {
+		result[i] = library.PhotoID(v)
+	}
+	return result
+}
+
+func TestAlbumTrashThenRestore(t *testing.T) {
+	runTestWithBoltDB(t, func(t *testing.T, db *bolt.DB) {
+		ctx := context.Background()
+		albums, err := NewAlbumIndex(db)
+		if err != nil {
+			t.Fatalf("Failed to create AlbumIndex: %s", err)
+		}
+		album, err := albums.Create(ctx, "Holidays")
+		if err != nil {
+			t.Fatalf("Failed to create album: %s", err)
+		}
+		if _, err := albums.AddPhotos(ctx, album.ID, -1, ids("a", "b", "c")); err != nil {
+			t.Fatalf("Failed to add photos: %s", err)
+		}
+		trashed := &library.Photo{ExtendedPhotoID: library.ExtendedPhotoID{ID: "a"}}
+		if err := albums.TrashPhoto(ctx, trashed); err != nil {
+			t.Fatalf("Failed to trash photo: %s", err)
+		}
+		album, _ = albums.Get(ctx, album.ID)
+		assert.Equal(t, 2, album.Count)
+		assert.Equal(t, library.PhotoID("b"), album.Cover)
+		photos, _, _ := albums.FindPhotosPaged(ctx, album.ID, 0, 10)
+		assert.Equal(t, ids("b", "c"), photos)
+
+		if err := albums.RestorePhoto(ctx, trashed); err != nil {
+			t.Fatalf("Failed to restore photo: %s", err)
+		}
+		album, _ = albums.Get(ctx, album.ID)
+		assert.Equal(t, 3, album.Count)
+		assert.Equal(t, library.PhotoID("a"), album.Cover, "Cover is restored")
+		photos, _, _ = albums.FindPhotosPaged(ctx, album.ID, 0, 10)
+		assert.Equal(t, ids("a", "b", "c"), photos, "Position is restored")
+	})
+}
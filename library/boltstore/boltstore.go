@@ -6,6 +6,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"bitbucket.org/kleinnic74/photos/consts"
 	"bitbucket.org/kleinnic74/photos/library"
@@ -17,6 +18,7 @@ var (
 	photosBucket = []byte("photos")
 	hashBucket   = []byte("photoHashes")
 	idMapBucket  = []byte("idmap")
+	trashBucket  = []byte("trash")
 )
 
 // BoltStore uses BoltDB as the storage implementation to store data about photos
@@ -40,6 +42,9 @@ func NewBoltStore(db *bolt.DB) (lib library.ClosableStore, err error) {
 		if err = createBucket(db, hashBucket); err != nil {
 			return
 		}
+		if err = createBucket(db, trashBucket); err != nil {
+			return
+		}
 	}
 	return
 }
@@ -73,7 +78,7 @@ func deleteBuckets(db *bolt.DB, names ...string) error {
 func (store *BoltStore) Close() {
 }
 
-// Exists checks if a photo with the given id on the given date exists in this store
+// Exists checks if a photo with the given hash exists in this store, trashed photos included
 func (store *BoltStore) Exists(hash library.BinaryHash) (other library.PhotoID, exists bool) {
 	store.db.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket(hashBucket)
@@ -121,6 +126,8 @@ func (store *BoltStore) Add(p *library.Photo) error {
 	})
 }
 
+// Update replaces the stored data of the given photo. If the SortID of the photo has changed,
+// the photo is re-keyed
 func (store *BoltStore) Update(p *library.Photo) error {
 	// Sanity check
 	if p.ID == "" {
@@ -140,7 +147,18 @@ func (store *BoltStore) Update(p *library.Photo) error {
 			return library.NotFound(p.ID)
 		}
 		b := tx.Bucket(photosBucket)
-		if err := b.Put(internalID, encoded); err != nil {
+		if !bytes.Equal(internalID, p.SortID) {
+			if existing := b.Get(p.SortID); existing != nil {
+				return library.PhotoAlreadyExists(p.ID)
+			}
+			if err := b.Delete(internalID); err != nil {
+				return err
+			}
+			if err := tx.Bucket(idMapBucket).Put([]byte(p.ID), p.SortID); err != nil {
+				return err
+			}
+		}
+		if err := b.Put(p.SortID, encoded); err != nil {
 			return err
 		}
 		if !p.HasHash() {
@@ -151,6 +169,146 @@ func (store *BoltStore) Update(p *library.Photo) error {
 	})
 }
 
+// Delete removes the photo with the given id from this store
+func (store *BoltStore) Delete(id library.PhotoID) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		idMap := tx.Bucket(idMapBucket)
+		internalID := idMap.Get([]byte(id))
+		if internalID == nil {
+			return deleteTrashed(tx, id)
+		}
+		b := tx.Bucket(photosBucket)
+		if data := b.Get(internalID); data != nil {
+			var photo library.Photo
+			if err := json.Unmarshal(data, &photo); err != nil {
+				return err
+			}
+			if err := deleteHash(tx, photo.Hash, id); err != nil {
+				return err
+			}
+		}
+		if err := b.Delete(internalID); err != nil {
+			return err
+		}
+		return idMap.Delete([]byte(id))
+	})
+}
+
+func deleteTrashed(tx *bolt.Tx, id library.PhotoID) error {
+	b := tx.Bucket(trashBucket)
+	data := b.Get([]byte(id))
+	if data == nil {
+		return library.NotFound(id)
+	}
+	var photo library.Photo
+	if err := json.Unmarshal(data, &photo); err != nil {
+		return err
+	}
+	if err := deleteHash(tx, photo.Hash, id); err != nil {
+		return err
+	}
+	return b.Delete([]byte(id))
+}
+
+// Trash moves the given photo to the trash, trashed photos are not returned by any
+// of the finder methods, they can be restored using Restore
+func (store *BoltStore) Trash(p *library.Photo) error {
+	encoded, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return store.db.Update(func(tx *bolt.Tx) error {
+		idMap := tx.Bucket(idMapBucket)
+		internalID := idMap.Get([]byte(p.ID))
+		if internalID == nil {
+			return library.NotFound(p.ID)
+		}
+		if err := tx.Bucket(photosBucket).Delete(internalID); err != nil {
+			return err
+		}
+		if err := idMap.Delete([]byte(p.ID)); err != nil {
+			return err
+		}
+		return tx.Bucket(trashBucket).Put([]byte(p.ID), encoded)
+	})
+}
+
+// Restore moves the photo with the given id out of the trash
+func (store *BoltStore) Restore(id library.PhotoID) (*library.Photo, error) {
+	var photo library.Photo
+	return &photo, store.db.Update(func(tx *bolt.Tx) error {
+		trash := tx.Bucket(trashBucket)
+		data := trash.Get([]byte(id))
+		if data == nil {
+			return library.NotFound(id)
+		}
+		if err := json.Unmarshal(data, &photo); err != nil {
+			return err
+		}
+		photo.TrashedAt = time.Time{}
+		encoded, err := json.Marshal(&photo)
+		if err != nil {
+			return err
+		}
+		b := tx.Bucket(photosBucket)
+		if existing := b.Get(photo.SortID); existing != nil {
+			return library.PhotoAlreadyExists(id)
+		}
+		if err := b.Put(photo.SortID, encoded); err != nil {
+			return err
+		}
+		if err := tx.Bucket(idMapBucket).Put([]byte(id), photo.SortID); err != nil {
+			return err
+		}
+		return trash.Delete([]byte(id))
+	})
+}
+
+// GetTrashed returns the trashed photo with the given id
+func (store *BoltStore) GetTrashed(id library.PhotoID) (*library.Photo, error) {
+	var found *library.Photo
+	return found, store.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(trashBucket).Get([]byte(id))
+		if data == nil {
+			return library.NotFound(id)
+		}
+		var photo library.Photo
+		if err := json.Unmarshal(data, &photo); err != nil {
+			return err
+		}
+		found = &photo
+		return nil
+	})
+}
+
+// FindTrashed returns all photos currently in the trash
+func (store *BoltStore) FindTrashed() ([]*library.Photo, error) {
+	var found = make([]*library.Photo, 0)
+	err := store.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(trashBucket).ForEach(func(k, v []byte) error {
+			var photo library.Photo
+			if err := json.Unmarshal(v, &photo); err != nil {
+				return err
+			}
+			found = append(found, &photo)
+			return nil
+		})
+	})
+	return found, err
+}
+
+// deleteHash removes the given hash from the hash bucket if it still refers to the given photo
+func deleteHash(tx *bolt.Tx, hash library.BinaryHash, id library.PhotoID) error {
+	if len(hash) == 0 {
+		return nil
+	}
+	b := tx.Bucket(hashBucket)
+	if owner := b.Get(hash.Bytes()); owner != nil && library.PhotoID(owner) == id {
+		return b.Delete(hash.Bytes())
+	}
+	return nil
+}
+
 // FindAll returns all photos in this store
 func (store *BoltStore) FindAll(order consts.SortOrder) ([]*library.Photo, error) {
 	photos, _, err := store.findRange(func(c Cursor) Cursor {
@@ -159,11 +317,52 @@ func (store *BoltStore) FindAll(order consts.SortOrder) ([]*library.Photo, error
 	return photos, err
 }
 
-//FindAllPaged returns at most max photos from the store starting at photo index start
+//FindAllPaged returns at most max photos from the store starting at photo index start,
+// companion videos of Live Photos are skipped and do not count for the start index
 func (store *BoltStore) FindAllPaged(start, max int, order consts.SortOrder) ([]*library.Photo, bool, error) {
-	return store.findRange(func(c Cursor) Cursor {
-		return c.Skip(uint(start)).Limit(uint(max))
-	}, order)
+	var found = make([]*library.Photo, 0, max)
+	var hasMore bool
+
+	err := store.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(photosBucket)
+		c := newCursor(b.Cursor(), order)
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			companion, err := isLiveCompanion(v)
+			if err != nil {
+				return err
+			}
+			if companion {
+				continue
+			}
+			if start > 0 {
+				start--
+				continue
+			}
+			if len(found) == max {
+				hasMore = true
+				return nil
+			}
+			var photo library.Photo
+			if err := json.Unmarshal(v, &photo); err != nil {
+				return err
+			}
+			found = append(found, &photo)
+		}
+		return nil
+	})
+	return found, hasMore, err
+}
+
+// isLiveCompanion checks whether the encoded photo is the companion video of a Live Photo
+// without decoding the whole photo
+func isLiveCompanion(encoded []byte) (bool, error) {
+	var photo struct {
+		LiveStill string `json:"liveStill"`
+	}
+	if err := json.Unmarshal(encoded, &photo); err != nil {
+		return false, err
+	}
+	return photo.LiveStill != "", nil
 }
 
 func (store *BoltStore) findRange(f func(Cursor) Cursor, order consts.SortOrder) ([]*library.Photo, bool, error) {
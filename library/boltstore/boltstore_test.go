@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"bitbucket.org/kleinnic74/photos/consts"
 	"bitbucket.org/kleinnic74/photos/library"
@@ -55,6 +56,97 @@ func TestAddThenGet(t *testing.T) {
 	})
 }
 
+func TestAddThenDelete(t *testing.T) {
+	runTestWithStore(t, func(t *testing.T, db *BoltStore) {
+		photo := library.RandomPhoto()
+		photo.Hash = library.BinaryHash("1234")
+		if err := db.Add(photo); err != nil {
+			t.Fatalf("Failed to add photo: %s", err)
+		}
+		if err := db.Delete(photo.ID); err != nil {
+			t.Fatalf("Failed to delete photo: %s", err)
+		}
+		if _, err := db.Get(photo.ID); err == nil {
+			t.Errorf("Expected NotFound for deleted photo %s", photo.ID)
+		}
+		if _, exists := db.Exists(photo.Hash); exists {
+			t.Errorf("Hash of deleted photo should not exist anymore")
+		}
+		found, _ := db.FindAll(consts.Ascending)
+		if len(found) != 0 {
+			t.Errorf("Bad number of photos returned, expected %d, got %d", 0, len(found))
+		}
+		if err := db.Delete(photo.ID); err == nil {
+			t.Errorf("Expected NotFound when deleting photo twice")
+		}
+	})
+}
+
+func TestUpdateWithNewSortID(t *testing.T) {
+	runTestWithStore(t, func(t *testing.T, db *BoltStore) {
+		photo := library.RandomPhoto()
+		if err := db.Add(photo); err != nil {
+			t.Fatalf("Failed to add photo: %s", err)
+		}
+		updated := *photo
+		updated.SortID = library.OrderedID("2001-01-01T00:00:00Z" + string(photo.ID))
+		if err := db.Update(&updated); err != nil {
+			t.Fatalf("Failed to update photo: %s", err)
+		}
+		found, err := db.Get(photo.ID)
+		if err != nil {
+			t.Fatalf("Updated photo not found: %s", err)
+		}
+		if string(found.SortID) != string(updated.SortID) {
+			t.Errorf("Bad SortID: expected %s, got %s", updated.SortID, found.SortID)
+		}
+		all, _ := db.FindAll(consts.Ascending)
+		if len(all) != 1 {
+			t.Errorf("Bad number of photos returned, expected %d, got %d", 1, len(all))
+		}
+	})
+}
+
+func TestTrashThenRestore(t *testing.T) {
+	runTestWithStore(t, func(t *testing.T, db *BoltStore) {
+		photo := library.RandomPhoto()
+		photo.Hash = library.BinaryHash("1234")
+		if err := db.Add(photo); err != nil {
+			t.Fatalf("Failed to add photo: %s", err)
+		}
+		photo.TrashedAt = time.Now().UTC()
+		if err := db.Trash(photo); err != nil {
+			t.Fatalf("Failed to trash photo: %s", err)
+		}
+		if _, err := db.Get(photo.ID); err == nil {
+			t.Errorf("Expected NotFound for trashed photo %s", photo.ID)
+		}
+		if _, exists := db.Exists(photo.Hash); !exists {
+			t.Errorf("Hash of trashed photo should still exist")
+		}
+		trashed, err := db.FindTrashed()
+		if err != nil {
+			t.Fatalf("Failed to list trash: %s", err)
+		}
+		if len(trashed) != 1 || !trashed[0].IsTrashed() {
+			t.Fatalf("Bad trash content: %v", trashed)
+		}
+		restored, err := db.Restore(photo.ID)
+		if err != nil {
+			t.Fatalf("Failed to restore photo: %s", err)
+		}
+		if restored.IsTrashed() {
+			t.Errorf("Restored photo is still marked as trashed")
+		}
+		if _, err := db.Get(photo.ID); err != nil {
+			t.Errorf("Restored photo not found: %s", err)
+		}
+		if trashed, _ := db.FindTrashed(); len(trashed) != 0 {
+			t.Errorf("Bad number of trashed photos, expected %d, got %d", 0, len(trashed))
+		}
+	})
+}
+
 func BenchmarkAdd(b *testing.B) {
 	// Initialize store
 	dbFile := filepath.Join(dbpath, dbfile)
@@ -0,0 +1,173 @@
+package boltstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sort"
+
+	"bitbucket.org/kleinnic74/photos/library"
+	bolt "go.etcd.io/bbolt"
+)
+
+const CameraIndexVersion = library.Version(1)
+
+var (
+	// photosByCameraBucket contains one bucket per camera mapping SortIDs to photo IDs
+	photosByCameraBucket = []byte("_photosByCamera")
+	// cameraOfPhotoBucket maps photo IDs to the JSON encoded camera entry of the photo
+	cameraOfPhotoBucket = []byte("_cameraOfPhoto")
+)
+
+// cameraEntry is the key of a photo in the bucket of its camera
+type cameraEntry struct {
+	SortID library.OrderedID `json:"sortId"`
+	Camera string            `json:"camera"`
+}
+
+// CameraCount is the number of photos taken with a camera
+type CameraCount struct {
+	Camera string `json:"camera"`
+	Count  int    `json:"count"`
+}
+
+// CameraIndex indexes photos by the name of the camera they were taken with
+type CameraIndex struct {
+	db *bolt.DB
+}
+
+func NewCameraIndex(db *bolt.DB) (*CameraIndex, error) {
+	if err := db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(photosByCameraBucket); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(cameraOfPhotoBucket); err != nil {
+			return err
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return &CameraIndex{
+		db: db,
+	}, nil
+}
+
+// Add indexes the given photo by its camera, photos without camera are ignored
+func (index *CameraIndex) Add(ctx context.Context, photo *library.Photo) error {
+	camera := cameraOf(photo)
+	if camera == "" {
+		return nil
+	}
+	if photo.SortID == nil {
+		return library.MissingSortID
+	}
+	return index.db.Update(func(tx *bolt.Tx) error {
+		if err := removeFromCamera(tx, photo.ID); err != nil {
+			return err
+		}
+		b, err := tx.Bucket(photosByCameraBucket).CreateBucketIfNotExists([]byte(camera))
+		if err != nil {
+			return err
+		}
+		if err := b.Put(photo.SortID, []byte(photo.ID)); err != nil {
+			return err
+		}
+		entry, err := json.Marshal(cameraEntry{SortID: photo.SortID, Camera: camera})
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(cameraOfPhotoBucket).Put([]byte(photo.ID), entry)
+	})
+}
+
+// RemovePhoto removes the given photo from the index
+func (index *CameraIndex) RemovePhoto(ctx context.Context, photo *library.Photo) error {
+	return index.db.Update(func(tx *bolt.Tx) error {
+		return removeFromCamera(tx, photo.ID)
+	})
+}
+
+// UpdatePhoto re-indexes a photo whose SortID or camera has changed
+func (index *CameraIndex) UpdatePhoto(ctx context.Context, old, updated *library.Photo) error {
+	if bytes.Equal(old.SortID, updated.SortID) && cameraOf(old) == cameraOf(updated) {
+		return nil
+	}
+	if cameraOf(updated) == "" {
+		return index.RemovePhoto(ctx, old)
+	}
+	return index.Add(ctx, updated)
+}
+
+// Cameras returns all cameras with the number of photos taken with each, sorted by name
+func (index *CameraIndex) Cameras(ctx context.Context) (cameras []CameraCount, err error) {
+	err = index.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(photosByCameraBucket)
+		return b.ForEach(func(k, v []byte) error {
+			if v != nil {
+				return nil
+			}
+			cameras = append(cameras, CameraCount{Camera: string(k), Count: b.Bucket(k).Stats().KeyN})
+			return nil
+		})
+	})
+	sort.Slice(cameras, func(i, j int) bool { return cameras[i].Camera < cameras[j].Camera })
+	return
+}
+
+// FindPhotosPaged returns the photos taken with the given camera ordered by date
+func (index *CameraIndex) FindPhotosPaged(ctx context.Context, camera string, start, max int) (photos []library.PhotoID, hasMore bool, err error) {
+	err = index.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(photosByCameraBucket).Bucket([]byte(camera))
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		var k, v []byte
+		var i int
+		for k, v = c.First(); k != nil && i < start+max; k, v = c.Next() {
+			if i < start {
+				i++
+				continue
+			}
+			photos = append(photos, library.PhotoID(v))
+			i++
+		}
+		hasMore = k != nil
+		return nil
+	})
+	return
+}
+
+func cameraOf(photo *library.Photo) string {
+	if photo.Camera == nil {
+		return ""
+	}
+	return photo.Camera.Name()
+}
+
+// removeFromCamera removes a photo from the bucket of its camera
+func removeFromCamera(tx *bolt.Tx, id library.PhotoID) error {
+	entries := tx.Bucket(cameraOfPhotoBucket)
+	v := entries.Get([]byte(id))
+	if v == nil {
+		return nil
+	}
+	var entry cameraEntry
+	if err := json.Unmarshal(v, &entry); err != nil {
+		return err
+	}
+	camera := []byte(entry.Camera)
+	photos := tx.Bucket(photosByCameraBucket)
+	if b := photos.Bucket(camera); b != nil {
+		if err := b.Delete(entry.SortID); err != nil {
+			return err
+		}
+		if k, _ := b.Cursor().First(); k == nil {
+			if err := photos.DeleteBucket(camera); err != nil {
+				return err
+			}
+		}
+	}
+	return entries.Delete([]byte(id))
+}
@@ -0,0 +1,51 @@
+package boltstore
+
+import (
+	"context"
+	"testing"
+
+	"bitbucket.org/kleinnic74/photos/domain"
+	"bitbucket.org/kleinnic74/photos/library"
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestCameraIndex(t *testing.T) {
+	runTestWithBoltDB(t, func(t *testing.T, db *bolt.DB) {
+		ctx := context.Background()
+		cameras, err := NewCameraIndex(db)
+		if err != nil {
+			t.Fatalf("Failed to create CameraIndex: %s", err)
+		}
+		p1 := library.RandomPhoto()
+		p1.Camera = &domain.CameraMetaData{Make: "Canon", Model: "Canon EOS 40D"}
+		p2 := library.RandomPhoto()
+		p2.SortID = library.OrderedID("2019" + string(p2.ID))
+		p2.Camera = &domain.CameraMetaData{Make: "Canon", Model: "Canon EOS 40D"}
+		p3 := library.RandomPhoto()
+		p3.Camera = &domain.CameraMetaData{Make: "NIKON CORPORATION", Model: "D750"}
+		p4 := library.RandomPhoto()
+		for _, p := range []*library.Photo{p1, p2, p3, p4} {
+			if err := cameras.Add(ctx, p); err != nil {
+				t.Fatalf("Failed to add photo: %s", err)
+			}
+		}
+		counts, _ := cameras.Cameras(ctx)
+		assert.Equal(t, []CameraCount{{"Canon EOS 40D", 2}, {"NIKON CORPORATION D750", 1}}, counts)
+
+		photos, hasMore, _ := cameras.FindPhotosPaged(ctx, "Canon EOS 40D", 0, 1)
+		assert.Equal(t, []library.PhotoID{p1.ID}, photos)
+		assert.True(t, hasMore)
+
+		updated := *p3
+		updated.Camera = &domain.CameraMetaData{Make: "Canon", Model: "Canon EOS 40D"}
+		if err := cameras.UpdatePhoto(ctx, p3, &updated); err != nil {
+			t.Fatalf("Failed to update photo: %s", err)
+		}
+		if err := cameras.RemovePhoto(ctx, p1); err != nil {
+			t.Fatalf("Failed to remove photo: %s", err)
+		}
+		counts, _ = cameras.Cameras(ctx)
+		assert.Equal(t, []CameraCount{{"Canon EOS 40D", 2}}, counts)
+	})
+}
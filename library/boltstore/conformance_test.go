@@ -0,0 +1,61 @@
+package boltstore
+
+import (
+	"path/filepath"
+	"testing"
+
+	"bitbucket.org/kleinnic74/photos/index"
+	"bitbucket.org/kleinnic74/photos/library"
+	"bitbucket.org/kleinnic74/photos/library/storetest"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestStoreConformance(t *testing.T) {
+	storetest.TestStore(t, func(t *testing.T) library.ClosableStore {
+		store, err := NewBoltStore(openTestDB(t))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return store
+	})
+}
+
+func TestDateIndexConformance(t *testing.T) {
+	storetest.TestDateIndex(t, func(t *testing.T) library.DateIndex {
+		dateindex, err := NewDateIndex(openTestDB(t))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return dateindex
+	})
+}
+
+func TestGeoIndexConformance(t *testing.T) {
+	storetest.TestGeoIndex(t, func(t *testing.T) library.GeoIndex {
+		geoindex, err := NewBoltGeoIndex(openTestDB(t))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return geoindex
+	})
+}
+
+func TestIndexTrackerConformance(t *testing.T) {
+	storetest.TestTracker(t, func(t *testing.T) index.Tracker {
+		tracker, err := NewIndexTracker(openTestDB(t))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tracker
+	})
+}
+
+// openTestDB opens an empty database which is closed at the end of the test
+func openTestDB(t *testing.T) *bolt.DB {
+	db, err := bolt.Open(filepath.Join(t.TempDir(), dbfile), 0644, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
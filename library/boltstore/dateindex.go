@@ -11,7 +11,7 @@ import (
 	"go.uber.org/zap"
 )
 
-const DateIndexVersion = library.Version(3)
+const DateIndexVersion = library.Version(4)
 
 // DateIndex indexes photos by date
 type DateIndex struct {
@@ -42,19 +42,25 @@ func NewDateIndex(db *bolt.DB) (*DateIndex, error) {
 func (d *DateIndex) MigrateStructure(ctx context.Context, from library.Version) (library.Version, bool, error) {
 	migrations := index.NewStructuralMigrations()
 	migrations.Register(3, resetBuckets(d.db, datesBucket))
+	// Days are in local capture time since version 4
+	migrations.Register(4, resetBuckets(d.db, datesBucket))
 	reindex, err := migrations.Apply(ctx, from, DateIndexVersion)
 	return DateIndexVersion, reindex, err
 }
 
-// Add will add the given photo to this date index based on its taken time
+// Add will add the given photo to this date index based on its taken time, videos of
+// Live Photos are not added as they are shown with their still image
 func (d *DateIndex) Add(ctx context.Context, photo *library.Photo) error {
 	if photo.SortID == nil {
 		return library.MissingSortID
 	}
+	if photo.IsLiveCompanion() {
+		return nil
+	}
 	return d.db.Update(func(tx *bolt.Tx) error {
 		log, _ := logging.FromWithNameAndFields(ctx, "boltdateindex")
 		b := tx.Bucket(datesBucket)
-		key := d.dayKey(photo.DateTaken)
+		key := d.dayKey(photo.LocalDateTaken())
 		dayBucket, err := b.CreateBucketIfNotExists([]byte(key))
 		if err != nil {
 			log.Warn("Failed to create sub-bucket", zap.String("bucket", key), zap.Error(err))
@@ -64,6 +70,29 @@ func (d *DateIndex) Add(ctx context.Context, photo *library.Photo) error {
 	})
 }
 
+// Remove deletes the given photo from this date index. Days without any photos
+// left are removed from the index
+func (d *DateIndex) Remove(ctx context.Context, photo *library.Photo) error {
+	if photo.SortID == nil {
+		return library.MissingSortID
+	}
+	return d.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(datesBucket)
+		key := []byte(d.dayKey(photo.LocalDateTaken()))
+		dayBucket := b.Bucket(key)
+		if dayBucket == nil {
+			return nil
+		}
+		if err := dayBucket.Delete([]byte(photo.SortID)); err != nil {
+			return err
+		}
+		if k, _ := dayBucket.Cursor().First(); k == nil {
+			return b.DeleteBucket(key)
+		}
+		return nil
+	})
+}
+
 // FindRange returns all photos in the given date range
 func (d *DateIndex) FindRangePaged(ctx context.Context, from, to time.Time, start, maxCount int) (ids []library.PhotoID, hasMore bool, err error) {
 	from, to = startOfDay(from), endOfDay(to)
@@ -54,6 +54,77 @@ func TestDateIndexFindDates(t *testing.T) {
 	}
 }
 
+func TestDateIndexRemove(t *testing.T) {
+	runTestWithBoltDB(t, func(t *testing.T, db *bolt.DB) {
+		dateindex, err := NewDateIndex(db)
+		if err != nil {
+			t.Fatalf("Failed to create DateIndex: %s", err)
+		}
+		var photos []*library.Photo
+		for i, ts := range times("2020-04-12T12:30:24Z", "2020-05-09T07:08:09Z", "2020-04-12T08:45:00Z") {
+			photo := &library.Photo{
+				ExtendedPhotoID: library.ExtendedPhotoID{
+					ID:     library.PhotoID(fmt.Sprintf("%d", i)),
+					SortID: []byte(fmt.Sprintf("%04d", i)),
+				},
+				PhotoMeta: library.PhotoMeta{
+					DateTaken: ts,
+				},
+			}
+			if err := dateindex.Add(context.Background(), photo); err != nil {
+				t.Fatalf("Failed to add photo to index: %s", err)
+			}
+			photos = append(photos, photo)
+		}
+		for _, p := range photos[:2] {
+			if err := dateindex.Remove(context.Background(), p); err != nil {
+				t.Fatalf("Failed to remove photo %s: %s", p.ID, err)
+			}
+		}
+		timeline, err := dateindex.FindDates(context.Background())
+		if err != nil {
+			t.Fatalf("Error while fetching dates: %s", err)
+		}
+		assert.Equal(t, []string{"2020-04-12"}, dates(timeline...))
+		ids, _, err := dateindex.FindRangePaged(context.Background(), photos[0].DateTaken, photos[0].DateTaken, 0, 10)
+		if err != nil {
+			t.Fatalf("Error while fetching photos: %s", err)
+		}
+		assert.Equal(t, []library.PhotoID{"2"}, ids)
+	})
+}
+
+func TestDateIndexLocalDay(t *testing.T) {
+	runTestWithBoltDB(t, func(t *testing.T, db *bolt.DB) {
+		dateindex, err := NewDateIndex(db)
+		if err != nil {
+			t.Fatalf("Failed to create DateIndex: %s", err)
+		}
+		// Taken in the evening of April 11th in New York
+		offset := -4 * 3600
+		photo := &library.Photo{
+			ExtendedPhotoID: library.ExtendedPhotoID{ID: "1", SortID: []byte("0001")},
+			PhotoMeta: library.PhotoMeta{
+				DateTaken:      times("2020-04-12T01:30:00Z")[0],
+				TimeZoneOffset: &offset,
+			},
+		}
+		if err := dateindex.Add(context.Background(), photo); err != nil {
+			t.Fatalf("Failed to add photo to index: %s", err)
+		}
+		timeline, err := dateindex.FindDates(context.Background())
+		if err != nil {
+			t.Fatalf("Error while fetching dates: %s", err)
+		}
+		assert.Equal(t, []string{"2020-04-11"}, dates(timeline...))
+		if err := dateindex.Remove(context.Background(), photo); err != nil {
+			t.Fatalf("Failed to remove photo: %s", err)
+		}
+		timeline, _ = dateindex.FindDates(context.Background())
+		assert.Empty(t, timeline)
+	})
+}
+
 func times(in ...string) (result []time.Time) {
 	result = make([]time.Time, len(in))
 	for i, s := range in {
@@ -85,6 +85,41 @@ func (index *EventIndex) AddPhotosToEvent(ctx context.Context, e Event, photos [
 	return err
 }
 
+// RemovePhoto removes the given photo from all events, events without photos are deleted
+func (index *EventIndex) RemovePhoto(ctx context.Context, photo *library.Photo) error {
+	return index.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(photosByEventBucket)
+		var emptyEvents [][]byte
+		if err := b.ForEach(func(eventID, v []byte) error {
+			photos := b.Bucket(eventID)
+			if v != nil || photos == nil {
+				return nil
+			}
+			if photos.Get([]byte(photo.SortID)) == nil {
+				return nil
+			}
+			if err := photos.Delete([]byte(photo.SortID)); err != nil {
+				return err
+			}
+			if k, _ := photos.Cursor().First(); k == nil {
+				emptyEvents = append(emptyEvents, eventID)
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		for _, eventID := range emptyEvents {
+			if err := b.DeleteBucket(eventID); err != nil {
+				return err
+			}
+			if err := tx.Bucket(eventsBucket).Delete(eventID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 func (index *EventIndex) FindPaged(ctx context.Context, start, maxCount int) (events []Event, hasMore bool, err error) {
 	err = index.db.View(func(tx *bolt.Tx) error {
 		c := tx.Bucket(eventsBucket).Cursor()
@@ -140,6 +140,27 @@ func (idx *boltGeoIndex) Update(ctx context.Context, id library.ExtendedPhotoID,
 	})
 }
 
+// Remove deletes the given photo from this geo index, known places and countries are kept
+func (idx *boltGeoIndex) Remove(ctx context.Context, id library.ExtendedPhotoID) error {
+	return idx.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(placeOfPhotos)
+		data := b.Get([]byte(id.ID))
+		if data == nil {
+			return nil
+		}
+		var address gps.Address
+		if err := json.Unmarshal(data, &address); err != nil {
+			return err
+		}
+		if photosAtPlace := tx.Bucket(photosByPlace).Bucket([]byte(address.ID)); photosAtPlace != nil {
+			if err := photosAtPlace.Delete([]byte(id.SortID)); err != nil {
+				return err
+			}
+		}
+		return b.Delete([]byte(id.ID))
+	})
+}
+
 func (idx *boltGeoIndex) Locations(ctx context.Context) (*library.Locations, error) {
 	var locations library.Locations
 	err := idx.db.View(func(tx *bolt.Tx) error {
@@ -200,7 +221,7 @@ func (idx *boltGeoIndex) FindByPlacePaged(ctx context.Context, placeID gps.Place
 func (idx *boltGeoIndex) FindByCountryPaged(ctx context.Context, country gps.CountryID, startAt int, maxCount int) (photos []library.PhotoID, hasMore bool, err error) {
 	err = idx.db.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket(photosByPlace)
-		keyPrefix := []byte(fmt.Sprintf("%s/", country))
+		keyPrefix := []byte(fmt.Sprintf("%s_", country))
 		buckets := b.Cursor()
 		var index int
 		var count int
@@ -61,6 +61,13 @@ func (tracker *indexTracker) Update(name index.Name, id library.PhotoID, err err
 	})
 }
 
+// Remove drops the indexing state of the given photo
+func (tracker *indexTracker) Remove(id library.PhotoID) error {
+	return tracker.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(indexBucket).Delete([]byte(id))
+	})
+}
+
 func (tracker *indexTracker) Get(id library.PhotoID) (index.State, bool, error) {
 	var found bool
 	state := index.NewState()
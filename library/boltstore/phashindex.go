@@ -0,0 +1,76 @@
+package boltstore
+
+import (
+	"context"
+	"encoding/binary"
+
+	"bitbucket.org/kleinnic74/photos/domain"
+	"bitbucket.org/kleinnic74/photos/library"
+	bolt "go.etcd.io/bbolt"
+)
+
+const PHashIndexVersion = library.Version(1)
+
+var (
+	phashBucket = []byte("_phashes")
+)
+
+// PHashIndex stores the perceptual hash of each photo
+type PHashIndex struct {
+	db *bolt.DB
+}
+
+func NewPHashIndex(db *bolt.DB) (*PHashIndex, error) {
+	if err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(phashBucket)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	return &PHashIndex{
+		db: db,
+	}, nil
+}
+
+// Set stores the perceptual hash of the given photo
+func (index *PHashIndex) Set(ctx context.Context, id library.PhotoID, hash domain.PerceptualHash) error {
+	return index.db.Update(func(tx *bolt.Tx) error {
+		var v [8]byte
+		binary.BigEndian.PutUint64(v[:], uint64(hash))
+		return tx.Bucket(phashBucket).Put([]byte(id), v[:])
+	})
+}
+
+// Get returns the perceptual hash of the given photo
+func (index *PHashIndex) Get(ctx context.Context, id library.PhotoID) (hash domain.PerceptualHash, found bool, err error) {
+	err = index.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(phashBucket).Get([]byte(id))
+		if len(v) != 8 {
+			return nil
+		}
+		hash, found = domain.PerceptualHash(binary.BigEndian.Uint64(v)), true
+		return nil
+	})
+	return
+}
+
+// All returns the perceptual hashes of all photos
+func (index *PHashIndex) All(ctx context.Context) (hashes map[library.PhotoID]domain.PerceptualHash, err error) {
+	hashes = make(map[library.PhotoID]domain.PerceptualHash)
+	err = index.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(phashBucket).ForEach(func(k, v []byte) error {
+			if len(v) == 8 {
+				hashes[library.PhotoID(k)] = domain.PerceptualHash(binary.BigEndian.Uint64(v))
+			}
+			return nil
+		})
+	})
+	return
+}
+
+// RemovePhoto removes the perceptual hash of the given photo
+func (index *PHashIndex) RemovePhoto(ctx context.Context, photo *library.Photo) error {
+	return index.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(phashBucket).Delete([]byte(photo.ID))
+	})
+}
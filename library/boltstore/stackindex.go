@@ -0,0 +1,477 @@
+package boltstore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"bitbucket.org/kleinnic74/photos/library"
+	"bitbucket.org/kleinnic74/photos/logging"
+	"github.com/google/uuid"
+	bolt "go.etcd.io/bbolt"
+	"go.uber.org/zap"
+)
+
+var (
+	stacksBucket       = []byte("_stacks")
+	stackByPhotoBucket = []byte("_stackByPhoto")
+	// trashedStacksBucket maps trashed photos to the JSON encoded stack they were removed from
+	trashedStacksBucket = []byte("_trashedStacks")
+)
+
+type StackID string
+
+// StackKind tells why photos have been stacked
+type StackKind string
+
+const (
+	// RawJPEGStack is a RAW file and the JPEG taken together by the camera
+	RawJPEGStack = StackKind("raw+jpeg")
+	// BurstStack is a sequence of photos taken in burst mode
+	BurstStack = StackKind("burst")
+	// EditedStack is an original with its edited exports
+	EditedStack = StackKind("edited")
+	// ManualStack is a stack created by the user
+	ManualStack = StackKind("manual")
+)
+
+// Stack is a group of photos of the same shot shown as a single photo, the representative,
+// unless the stack is expanded
+type Stack struct {
+	ID             StackID           `json:"id"`
+	Kind           StackKind         `json:"kind"`
+	Representative library.PhotoID   `json:"representative"`
+	Photos         []library.PhotoID `json:"photos"`
+	Created        time.Time         `json:"created"`
+}
+
+// StackMembership tells which stack a photo belongs to and which photo represents the stack
+type StackMembership struct {
+	Stack          StackID
+	Representative library.PhotoID
+}
+
+// ErrNoSuchStack indicates that a stack does not exist
+type ErrNoSuchStack StackID
+
+func (e ErrNoSuchStack) Error() string {
+	return fmt.Sprintf("No stack with id %s", string(e))
+}
+
+// ErrPhotoNotInStack indicates that the representative of a stack is not part of the stack
+type ErrPhotoNotInStack library.PhotoID
+
+func (e ErrPhotoNotInStack) Error() string {
+	return fmt.Sprintf("Photo %s is not part of the stack", string(e))
+}
+
+// ErrStackTooSmall indicates that a stack would contain less than two photos
+type ErrStackTooSmall int
+
+func (e ErrStackTooSmall) Error() string {
+	return fmt.Sprintf("A stack needs at least 2 photos, got %d", int(e))
+}
+
+// StackIndex stores stacks of photos. A photo is part of at most one stack, adding it
+// to a stack removes it from its previous stack
+type StackIndex struct {
+	db *bolt.DB
+}
+
+func NewStackIndex(db *bolt.DB) (*StackIndex, error) {
+	if err := db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(stacksBucket); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(stackByPhotoBucket); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(trashedStacksBucket); err != nil {
+			return err
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return &StackIndex{
+		db: db,
+	}, nil
+}
+
+// Create creates a stack of the given photos, the first photo represents the stack if
+// no representative is given
+func (index *StackIndex) Create(ctx context.Context, kind StackKind, photos []library.PhotoID, representative library.PhotoID) (*Stack, error) {
+	s := Stack{
+		ID:      StackID(uuid.New().String()),
+		Kind:    kind,
+		Created: time.Now().UTC(),
+	}
+	return &s, index.db.Update(func(tx *bolt.Tx) error {
+		return putStackPhotos(tx, &s, unique(photos), representative)
+	})
+}
+
+// Get returns the stack with the given id
+func (index *StackIndex) Get(ctx context.Context, id StackID) (s *Stack, err error) {
+	err = index.db.View(func(tx *bolt.Tx) error {
+		s, err = getStack(tx, id)
+		return err
+	})
+	return
+}
+
+// StackOf returns the stack the given photo belongs to, nil if the photo is not stacked
+func (index *StackIndex) StackOf(ctx context.Context, photo library.PhotoID) (s *Stack, err error) {
+	err = index.db.View(func(tx *bolt.Tx) error {
+		id := tx.Bucket(stackByPhotoBucket).Get([]byte(photo))
+		if id == nil {
+			return nil
+		}
+		s, err = getStack(tx, StackID(id))
+		return err
+	})
+	return
+}
+
+// Update changes the photos and/or the representative of a stack, photos are left
+// unchanged if nil
+func (index *StackIndex) Update(ctx context.Context, id StackID, photos []library.PhotoID, representative library.PhotoID) (s *Stack, err error) {
+	err = index.db.Update(func(tx *bolt.Tx) error {
+		if s, err = getStack(tx, id); err != nil {
+			return err
+		}
+		if photos == nil {
+			photos = s.Photos
+		}
+		if representative == "" {
+			representative = s.Representative
+		}
+		return putStackPhotos(tx, s, unique(photos), representative)
+	})
+	return
+}
+
+// Delete dissolves the stack with the given id, the photos are not affected
+func (index *StackIndex) Delete(ctx context.Context, id StackID) error {
+	return index.db.Update(func(tx *bolt.Tx) error {
+		s, err := getStack(tx, id)
+		if err != nil {
+			return err
+		}
+		return deleteStack(tx, s)
+	})
+}
+
+// FindPaged returns the stacks ordered by creation time
+func (index *StackIndex) FindPaged(ctx context.Context, start, maxCount int) (stacks []Stack, hasMore bool, err error) {
+	err = index.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(stacksBucket).ForEach(func(k, v []byte) error {
+			var s Stack
+			if err := json.Unmarshal(v, &s); err != nil {
+				return err
+			}
+			stacks = append(stacks, s)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	sort.Slice(stacks, func(i, j int) bool {
+		if stacks[i].Created.Equal(stacks[j].Created) {
+			return stacks[i].ID < stacks[j].ID
+		}
+		return stacks[i].Created.Before(stacks[j].Created)
+	})
+	from, to := pageBounds(len(stacks), start, maxCount)
+	return stacks[from:to], to < len(stacks), nil
+}
+
+// Memberships returns the stack and its representative of all stacked photos
+func (index *StackIndex) Memberships(ctx context.Context) (map[library.PhotoID]StackMembership, error) {
+	memberships := make(map[library.PhotoID]StackMembership)
+	err := index.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(stacksBucket).ForEach(func(k, v []byte) error {
+			var s Stack
+			if err := json.Unmarshal(v, &s); err != nil {
+				return err
+			}
+			for _, p := range s.Photos {
+				memberships[p] = StackMembership{Stack: s.ID, Representative: s.Representative}
+			}
+			return nil
+		})
+	})
+	return memberships, err
+}
+
+// MembershipsOf returns the stack and its representative of those of the given photos which
+// are stacked
+func (index *StackIndex) MembershipsOf(ctx context.Context, photos []library.PhotoID) (map[library.PhotoID]StackMembership, error) {
+	memberships := make(map[library.PhotoID]StackMembership)
+	err := index.db.View(func(tx *bolt.Tx) error {
+		byPhoto := tx.Bucket(stackByPhotoBucket)
+		for _, p := range photos {
+			id := byPhoto.Get([]byte(p))
+			if id == nil {
+				continue
+			}
+			s, err := getStack(tx, StackID(id))
+			if err != nil {
+				return err
+			}
+			memberships[p] = StackMembership{Stack: s.ID, Representative: s.Representative}
+		}
+		return nil
+	})
+	return memberships, err
+}
+
+// RemovePhoto removes the given photo from its stack, the stack is dissolved if a single
+// photo is left
+func (index *StackIndex) RemovePhoto(ctx context.Context, photo *library.Photo) error {
+	return index.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(trashedStacksBucket).Delete([]byte(photo.ID)); err != nil {
+			return err
+		}
+		if err := forgetTrashedMember(tx, photo.ID); err != nil {
+			return err
+		}
+		_, err := unstack(ctx, tx, photo.ID)
+		return err
+	})
+}
+
+// TrashPhoto removes a photo moved to the trash from its stack like RemovePhoto, the stack
+// is kept so that the photo is put back when restored
+func (index *StackIndex) TrashPhoto(ctx context.Context, photo *library.Photo) error {
+	return index.db.Update(func(tx *bolt.Tx) error {
+		s, err := unstack(ctx, tx, photo.ID)
+		if err != nil {
+			return err
+		}
+		if s == nil {
+			// The photo may be the last one of a stack dissolved when its other photos were trashed
+			if s, err = trashedStackOf(tx, photo.ID); err != nil || s == nil {
+				return err
+			}
+		}
+		v, err := json.Marshal(s)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(trashedStacksBucket).Put([]byte(photo.ID), v)
+	})
+}
+
+// RestorePhoto puts a photo restored from the trash back into its stack. A stack dissolved
+// in the meantime is created again with its photos which are neither stacked nor trashed
+func (index *StackIndex) RestorePhoto(ctx context.Context, photo *library.Photo) error {
+	return index.db.Update(func(tx *bolt.Tx) error {
+		trashed := tx.Bucket(trashedStacksBucket)
+		v := trashed.Get([]byte(photo.ID))
+		if v == nil {
+			return nil
+		}
+		if err := trashed.Delete([]byte(photo.ID)); err != nil {
+			return err
+		}
+		var before Stack
+		if err := json.Unmarshal(v, &before); err != nil {
+			return err
+		}
+		byPhoto := tx.Bucket(stackByPhotoBucket)
+		if byPhoto.Get([]byte(photo.ID)) != nil {
+			return nil
+		}
+		representative := photo.ID
+		if before.Representative != photo.ID {
+			representative = ""
+		}
+		s, err := getStack(tx, before.ID)
+		if _, dissolved := err.(ErrNoSuchStack); dissolved {
+			photos := []library.PhotoID{}
+			for _, p := range before.Photos {
+				if p == photo.ID || (byPhoto.Get([]byte(p)) == nil && trashed.Get([]byte(p)) == nil) {
+					photos = append(photos, p)
+				}
+			}
+			if len(photos) < 2 {
+				return nil
+			}
+			s = &before
+			s.Photos = nil
+			if representative == "" && indexOf(photos, before.Representative) != -1 {
+				representative = before.Representative
+			}
+			return putStackPhotos(tx, s, photos, representative)
+		} else if err != nil {
+			return err
+		}
+		if representative == "" {
+			representative = s.Representative
+		}
+		logging.From(ctx).Named("stackindex").Info("Restoring photo to stack",
+			zap.String("photo", string(photo.ID)), zap.String("stack", string(s.ID)))
+		return putStackPhotos(tx, s, append(s.Photos, photo.ID), representative)
+	})
+}
+
+// unstack removes the given photo from its stack and returns the stack as it was before
+func unstack(ctx context.Context, tx *bolt.Tx, photo library.PhotoID) (*Stack, error) {
+	id := tx.Bucket(stackByPhotoBucket).Get([]byte(photo))
+	if id == nil {
+		return nil, nil
+	}
+	logging.From(ctx).Named("stackindex").Info("Removing photo from stack",
+		zap.String("photo", string(photo)), zap.String("stack", string(id)))
+	s, err := getStack(tx, StackID(id))
+	if err != nil {
+		return nil, err
+	}
+	before := *s
+	before.Photos = append([]library.PhotoID{}, s.Photos...)
+	return &before, removeFromStack(tx, s, []library.PhotoID{photo})
+}
+
+// trashedStackOf returns the stack kept for trashed photos which contains the given photo,
+// with the photos of all such stacks if there are several
+func trashedStackOf(tx *bolt.Tx, photo library.PhotoID) (found *Stack, err error) {
+	err = tx.Bucket(trashedStacksBucket).ForEach(func(k, v []byte) error {
+		var s Stack
+		if err := json.Unmarshal(v, &s); err != nil {
+			return err
+		}
+		switch {
+		case indexOf(s.Photos, photo) == -1:
+		case found == nil:
+			found = &s
+		default:
+			found.Photos = unique(append(found.Photos, s.Photos...))
+		}
+		return nil
+	})
+	return
+}
+
+// forgetTrashedMember removes a purged photo from the stacks kept for trashed photos
+func forgetTrashedMember(tx *bolt.Tx, photo library.PhotoID) error {
+	trashed := tx.Bucket(trashedStacksBucket)
+	updated := make(map[string]Stack)
+	if err := trashed.ForEach(func(k, v []byte) error {
+		var s Stack
+		if err := json.Unmarshal(v, &s); err != nil {
+			return err
+		}
+		if indexOf(s.Photos, photo) != -1 {
+			s.Photos = without(s.Photos, []library.PhotoID{photo})
+			updated[string(k)] = s
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	for k, s := range updated {
+		v, err := json.Marshal(&s)
+		if err != nil {
+			return err
+		}
+		if err := trashed.Put([]byte(k), v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func getStack(tx *bolt.Tx, id StackID) (*Stack, error) {
+	v := tx.Bucket(stacksBucket).Get([]byte(id))
+	if v == nil {
+		return nil, ErrNoSuchStack(id)
+	}
+	var s Stack
+	if err := json.Unmarshal(v, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func putStack(tx *bolt.Tx, s *Stack) error {
+	v, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(stacksBucket).Put([]byte(s.ID), v)
+}
+
+func deleteStack(tx *bolt.Tx, s *Stack) error {
+	byPhoto := tx.Bucket(stackByPhotoBucket)
+	for _, p := range s.Photos {
+		if err := byPhoto.Delete([]byte(p)); err != nil {
+			return err
+		}
+	}
+	return tx.Bucket(stacksBucket).Delete([]byte(s.ID))
+}
+
+// removeFromStack removes the given photos from the stack, the stack is dissolved if less
+// than two photos are left and gets a new representative if its representative was removed
+func removeFromStack(tx *bolt.Tx, s *Stack, photos []library.PhotoID) error {
+	remaining := without(s.Photos, photos)
+	if len(remaining) < 2 {
+		return deleteStack(tx, s)
+	}
+	byPhoto := tx.Bucket(stackByPhotoBucket)
+	for _, p := range photos {
+		if err := byPhoto.Delete([]byte(p)); err != nil {
+			return err
+		}
+	}
+	s.Photos = remaining
+	if indexOf(remaining, s.Representative) == -1 {
+		s.Representative = remaining[0]
+	}
+	return putStack(tx, s)
+}
+
+// putStackPhotos stores the stack with the given photos, which are removed from the stacks
+// they belonged to before
+func putStackPhotos(tx *bolt.Tx, s *Stack, photos []library.PhotoID, representative library.PhotoID) error {
+	if len(photos) < 2 {
+		return ErrStackTooSmall(len(photos))
+	}
+	if representative == "" {
+		representative = photos[0]
+	}
+	if indexOf(photos, representative) == -1 {
+		return ErrPhotoNotInStack(representative)
+	}
+	byPhoto := tx.Bucket(stackByPhotoBucket)
+	for _, p := range without(s.Photos, photos) {
+		if err := byPhoto.Delete([]byte(p)); err != nil {
+			return err
+		}
+	}
+	for _, p := range photos {
+		previous := byPhoto.Get([]byte(p))
+		if previous == nil || StackID(previous) == s.ID {
+			continue
+		}
+		other, err := getStack(tx, StackID(previous))
+		if err != nil {
+			return err
+		}
+		if err := removeFromStack(tx, other, []library.PhotoID{p}); err != nil {
+			return err
+		}
+	}
+	for _, p := range photos {
+		if err := byPhoto.Put([]byte(p), []byte(s.ID)); err != nil {
+			return err
+		}
+	}
+	s.Photos = photos
+	s.Representative = representative
+	return putStack(tx, s)
+}
@@ -0,0 +1,140 @@
+package boltstore
+
+import (
+	"context"
+	"testing"
+
+	"bitbucket.org/kleinnic74/photos/library"
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestStacks(t *testing.T) {
+	runTestWithBoltDB(t, func(t *testing.T, db *bolt.DB) {
+		ctx := context.Background()
+		stacks, err := NewStackIndex(db)
+		if err != nil {
+			t.Fatalf("Failed to create StackIndex: %s", err)
+		}
+		if _, err := stacks.Create(ctx, BurstStack, ids("a"), ""); err == nil {
+			t.Errorf("Expected error for stack of a single photo")
+		}
+		if _, err := stacks.Create(ctx, BurstStack, ids("a", "b"), "c"); err == nil {
+			t.Errorf("Expected error for representative not in stack")
+		}
+		burst, err := stacks.Create(ctx, BurstStack, ids("a", "b", "c"), "")
+		if err != nil {
+			t.Fatalf("Failed to create stack: %s", err)
+		}
+		assert.Equal(t, library.PhotoID("a"), burst.Representative)
+
+		// Photos are moved from their previous stack
+		manual, err := stacks.Create(ctx, ManualStack, ids("c", "d"), "d")
+		if err != nil {
+			t.Fatalf("Failed to create stack: %s", err)
+		}
+		burst, _ = stacks.Get(ctx, burst.ID)
+		assert.Equal(t, ids("a", "b"), burst.Photos)
+		memberships, _ := stacks.Memberships(ctx)
+		assert.Equal(t, map[library.PhotoID]StackMembership{
+			"a": {burst.ID, "a"},
+			"b": {burst.ID, "a"},
+			"c": {manual.ID, "d"},
+			"d": {manual.ID, "d"},
+		}, memberships)
+		memberships, _ = stacks.MembershipsOf(ctx, ids("b", "d", "x"))
+		assert.Equal(t, map[library.PhotoID]StackMembership{
+			"b": {burst.ID, "a"},
+			"d": {manual.ID, "d"},
+		}, memberships)
+
+		if _, err := stacks.Update(ctx, manual.ID, nil, "c"); err != nil {
+			t.Fatalf("Failed to change representative: %s", err)
+		}
+		s, _ := stacks.StackOf(ctx, "c")
+		assert.Equal(t, library.PhotoID("c"), s.Representative)
+
+		// Removing the representative elects a new one, a stack of one photo is dissolved
+		if err := stacks.RemovePhoto(ctx, &library.Photo{ExtendedPhotoID: library.ExtendedPhotoID{ID: "a"}}); err != nil {
+			t.Fatalf("Failed to remove photo: %s", err)
+		}
+		if _, err := stacks.Get(ctx, burst.ID); err == nil {
+			t.Errorf("Expected stack to be dissolved")
+		}
+		s, _ = stacks.StackOf(ctx, "b")
+		assert.Nil(t, s)
+
+		all, hasMore, _ := stacks.FindPaged(ctx, 0, 10)
+		assert.Len(t, all, 1)
+		assert.False(t, hasMore)
+		if err := stacks.Delete(ctx, manual.ID); err != nil {
+			t.Fatalf("Failed to delete stack: %s", err)
+		}
+		memberships, _ = stacks.Memberships(ctx)
+		assert.Empty(t, memberships)
+	})
+}
+
+func TestStackTrashThenRestore(t *testing.T) {
+	runTestWithBoltDB(t, func(t *testing.T, db *bolt.DB) {
+		ctx := context.Background()
+		stacks, err := NewStackIndex(db)
+		if err != nil {
+			t.Fatalf("Failed to create StackIndex: %s", err)
+		}
+		photo := func(id string) *library.Photo {
+			return &library.Photo{ExtendedPhotoID: library.ExtendedPhotoID{ID: library.PhotoID(id)}}
+		}
+		burst, err := stacks.Create(ctx, BurstStack, ids("a", "b", "c"), "")
+		if err != nil {
+			t.Fatalf("Failed to create stack: %s", err)
+		}
+		if err := stacks.TrashPhoto(ctx, photo("a")); err != nil {
+			t.Fatalf("Failed to trash photo: %s", err)
+		}
+		memberships, _ := stacks.Memberships(ctx)
+		assert.Equal(t, map[library.PhotoID]StackMembership{
+			"b": {burst.ID, "b"},
+			"c": {burst.ID, "b"},
+		}, memberships, "Trashed representative does not hide the stack")
+		if err := stacks.RestorePhoto(ctx, photo("a")); err != nil {
+			t.Fatalf("Failed to restore photo: %s", err)
+		}
+		s, _ := stacks.Get(ctx, burst.ID)
+		assert.ElementsMatch(t, ids("a", "b", "c"), s.Photos)
+		assert.Equal(t, library.PhotoID("a"), s.Representative)
+
+		// Dissolved stacks are created again, but not with photos trashed meanwhile
+		raw, err := stacks.Create(ctx, RawJPEGStack, ids("d", "e", "f"), "")
+		if err != nil {
+			t.Fatalf("Failed to create stack: %s", err)
+		}
+		for _, id := range []string{"d", "e", "f"} {
+			if err := stacks.TrashPhoto(ctx, photo(id)); err != nil {
+				t.Fatalf("Failed to trash photo: %s", err)
+			}
+		}
+		if _, err := stacks.Get(ctx, raw.ID); err == nil {
+			t.Errorf("Expected stack to be dissolved")
+		}
+		for _, id := range []string{"d", "f"} {
+			if err := stacks.RestorePhoto(ctx, photo(id)); err != nil {
+				t.Fatalf("Failed to restore photo: %s", err)
+			}
+		}
+		s, err = stacks.Get(ctx, raw.ID)
+		if assert.NoError(t, err, "Stack is created again") {
+			assert.ElementsMatch(t, ids("d", "f"), s.Photos)
+			assert.Equal(t, library.PhotoID("d"), s.Representative)
+		}
+
+		if err := stacks.RemovePhoto(ctx, photo("e")); err != nil {
+			t.Fatalf("Failed to purge photo: %s", err)
+		}
+		if err := stacks.RestorePhoto(ctx, photo("e")); err != nil {
+			t.Fatalf("Failed to restore photo: %s", err)
+		}
+		s, _ = stacks.Get(ctx, raw.ID)
+		assert.ElementsMatch(t, ids("d", "f"), s.Photos, "Purged photos are not restored")
+	})
+}
@@ -0,0 +1,288 @@
+package boltstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"bitbucket.org/kleinnic74/photos/library"
+	bolt "go.etcd.io/bbolt"
+)
+
+const TagIndexVersion = library.Version(1)
+
+var (
+	// photosByTagBucket contains one bucket per tag mapping SortIDs to photo IDs
+	photosByTagBucket = []byte("_photosByTag")
+	// tagsOfPhotoBucket maps photo IDs to the JSON encoded tags of the photo
+	tagsOfPhotoBucket = []byte("_tagsOfPhoto")
+)
+
+// TagCount is the number of photos having a tag
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// TagIndex stores free-form tags attached to photos. Tags are case-insensitive and
+// stored in lower case
+type TagIndex struct {
+	db *bolt.DB
+}
+
+func NewTagIndex(db *bolt.DB) (*TagIndex, error) {
+	if err := db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(photosByTagBucket); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(tagsOfPhotoBucket); err != nil {
+			return err
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return &TagIndex{
+		db: db,
+	}, nil
+}
+
+// Add tags the given photo with the keywords found in its meta-data
+func (index *TagIndex) Add(ctx context.Context, photo *library.Photo) error {
+	return index.AddTags(ctx, photo.ExtendedPhotoID, photo.Keywords)
+}
+
+// AddTags adds the given tags to a photo
+func (index *TagIndex) AddTags(ctx context.Context, photo library.ExtendedPhotoID, tags []string) error {
+	tags = normalizeTags(tags)
+	if len(tags) == 0 {
+		return nil
+	}
+	return index.db.Update(func(tx *bolt.Tx) error {
+		existing, err := getTagsOfPhoto(tx, photo.ID)
+		if err != nil {
+			return err
+		}
+		if err := addToTags(tx, photo, tags); err != nil {
+			return err
+		}
+		return putTagsOfPhoto(tx, photo.ID, normalizeTags(append(existing, tags...)))
+	})
+}
+
+// RemoveTags removes the given tags from a photo
+func (index *TagIndex) RemoveTags(ctx context.Context, photo library.ExtendedPhotoID, tags []string) error {
+	tags = normalizeTags(tags)
+	return index.db.Update(func(tx *bolt.Tx) error {
+		existing, err := getTagsOfPhoto(tx, photo.ID)
+		if err != nil {
+			return err
+		}
+		if err := removeFromTags(tx, photo.SortID, tags); err != nil {
+			return err
+		}
+		return putTagsOfPhoto(tx, photo.ID, withoutTags(existing, tags))
+	})
+}
+
+// RemovePhoto removes all tags of the given photo
+func (index *TagIndex) RemovePhoto(ctx context.Context, photo *library.Photo) error {
+	return index.db.Update(func(tx *bolt.Tx) error {
+		existing, err := getTagsOfPhoto(tx, photo.ID)
+		if err != nil {
+			return err
+		}
+		if err := removeFromTags(tx, photo.SortID, existing); err != nil {
+			return err
+		}
+		return tx.Bucket(tagsOfPhotoBucket).Delete([]byte(photo.ID))
+	})
+}
+
+// TrashPhoto removes a photo moved to the trash from the photos of its tags, the tags
+// of the photo are kept so that it is found again when restored
+func (index *TagIndex) TrashPhoto(ctx context.Context, photo *library.Photo) error {
+	return index.db.Update(func(tx *bolt.Tx) error {
+		tags, err := getTagsOfPhoto(tx, photo.ID)
+		if err != nil {
+			return err
+		}
+		return removeFromTags(tx, photo.SortID, tags)
+	})
+}
+
+// RestorePhoto adds a photo restored from the trash to the photos of its tags
+func (index *TagIndex) RestorePhoto(ctx context.Context, photo *library.Photo) error {
+	return index.db.Update(func(tx *bolt.Tx) error {
+		tags, err := getTagsOfPhoto(tx, photo.ID)
+		if err != nil {
+			return err
+		}
+		return addToTags(tx, photo.ExtendedPhotoID, tags)
+	})
+}
+
+// UpdatePhoto re-keys the tags of a photo whose SortID has changed
+func (index *TagIndex) UpdatePhoto(ctx context.Context, old, updated *library.Photo) error {
+	if bytes.Equal(old.SortID, updated.SortID) {
+		return nil
+	}
+	return index.db.Update(func(tx *bolt.Tx) error {
+		tags, err := getTagsOfPhoto(tx, old.ID)
+		if err != nil {
+			return err
+		}
+		photos := tx.Bucket(photosByTagBucket)
+		for _, tag := range tags {
+			b := photos.Bucket([]byte(tag))
+			if b == nil {
+				continue
+			}
+			if err := b.Delete(old.SortID); err != nil {
+				return err
+			}
+			if err := b.Put(updated.SortID, []byte(updated.ID)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// TagsOf returns the tags of the photo with the given ID
+func (index *TagIndex) TagsOf(ctx context.Context, id library.PhotoID) (tags []string, err error) {
+	err = index.db.View(func(tx *bolt.Tx) error {
+		tags, err = getTagsOfPhoto(tx, id)
+		return err
+	})
+	return
+}
+
+// Tags returns all tags with the number of photos having the tag
+func (index *TagIndex) Tags(ctx context.Context) (tags []TagCount, err error) {
+	err = index.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(photosByTagBucket)
+		return b.ForEach(func(k, v []byte) error {
+			if v != nil {
+				return nil
+			}
+			tags = append(tags, TagCount{Tag: string(k), Count: b.Bucket(k).Stats().KeyN})
+			return nil
+		})
+	})
+	return
+}
+
+// FindPhotosPaged returns the photos with the given tag ordered by date
+func (index *TagIndex) FindPhotosPaged(ctx context.Context, tag string, start, max int) (photos []library.PhotoID, hasMore bool, err error) {
+	err = index.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(photosByTagBucket).Bucket([]byte(normalizeTag(tag)))
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		var k, v []byte
+		var i int
+		for k, v = c.First(); k != nil && i < start+max; k, v = c.Next() {
+			if i < start {
+				i++
+				continue
+			}
+			photos = append(photos, library.PhotoID(v))
+			i++
+		}
+		hasMore = k != nil
+		return nil
+	})
+	return
+}
+
+func addToTags(tx *bolt.Tx, photo library.ExtendedPhotoID, tags []string) error {
+	photos := tx.Bucket(photosByTagBucket)
+	for _, tag := range tags {
+		b, err := photos.CreateBucketIfNotExists([]byte(tag))
+		if err != nil {
+			return err
+		}
+		if err := b.Put(photo.SortID, []byte(photo.ID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func removeFromTags(tx *bolt.Tx, sortID library.OrderedID, tags []string) error {
+	photos := tx.Bucket(photosByTagBucket)
+	for _, tag := range tags {
+		b := photos.Bucket([]byte(tag))
+		if b == nil {
+			continue
+		}
+		if err := b.Delete(sortID); err != nil {
+			return err
+		}
+		if k, _ := b.Cursor().First(); k == nil {
+			if err := photos.DeleteBucket([]byte(tag)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func getTagsOfPhoto(tx *bolt.Tx, id library.PhotoID) (tags []string, err error) {
+	v := tx.Bucket(tagsOfPhotoBucket).Get([]byte(id))
+	if v == nil {
+		return
+	}
+	err = json.Unmarshal(v, &tags)
+	return
+}
+
+func putTagsOfPhoto(tx *bolt.Tx, id library.PhotoID, tags []string) error {
+	b := tx.Bucket(tagsOfPhotoBucket)
+	if len(tags) == 0 {
+		return b.Delete([]byte(id))
+	}
+	v, err := json.Marshal(tags)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(id), v)
+}
+
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+// normalizeTags returns the sorted, unique and normalized list of the given tags
+func normalizeTags(tags []string) []string {
+	seen := make(map[string]bool)
+	result := make([]string, 0, len(tags))
+	for _, t := range tags {
+		t = normalizeTag(t)
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		result = append(result, t)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func withoutTags(tags []string, removed []string) []string {
+	result := make([]string, 0, len(tags))
+	for _, t := range tags {
+		found := false
+		for _, r := range removed {
+			found = found || t == r
+		}
+		if !found {
+			result = append(result, t)
+		}
+	}
+	return result
+}
@@ -0,0 +1,75 @@
+package boltstore
+
+import (
+	"context"
+	"testing"
+
+	"bitbucket.org/kleinnic74/photos/library"
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestTagIndex(t *testing.T) {
+	runTestWithBoltDB(t, func(t *testing.T, db *bolt.DB) {
+		ctx := context.Background()
+		tags, err := NewTagIndex(db)
+		if err != nil {
+			t.Fatalf("Failed to create TagIndex: %s", err)
+		}
+		p1 := library.RandomPhoto()
+		p1.Keywords = []string{"Beach ", "sunset"}
+		p2 := library.RandomPhoto()
+		p2.SortID = library.OrderedID("2019" + string(p2.ID))
+		if err := tags.Add(ctx, p1); err != nil {
+			t.Fatalf("Failed to add photo: %s", err)
+		}
+		if err := tags.AddTags(ctx, p2.ExtendedPhotoID, []string{"beach"}); err != nil {
+			t.Fatalf("Failed to tag photo: %s", err)
+		}
+		counts, _ := tags.Tags(ctx)
+		assert.Equal(t, []TagCount{{"beach", 2}, {"sunset", 1}}, counts)
+
+		photos, hasMore, _ := tags.FindPhotosPaged(ctx, "BEACH", 0, 1)
+		assert.Equal(t, []library.PhotoID{p1.ID}, photos)
+		assert.True(t, hasMore)
+
+		if err := tags.RemoveTags(ctx, p1.ExtendedPhotoID, []string{"sunset"}); err != nil {
+			t.Fatalf("Failed to remove tag: %s", err)
+		}
+		of, _ := tags.TagsOf(ctx, p1.ID)
+		assert.Equal(t, []string{"beach"}, of)
+
+		if err := tags.RemovePhoto(ctx, p2); err != nil {
+			t.Fatalf("Failed to remove photo: %s", err)
+		}
+		counts, _ = tags.Tags(ctx)
+		assert.Equal(t, []TagCount{{"beach", 1}}, counts)
+	})
+}
+
+func TestTagIndexTrashThenRestore(t *testing.T) {
+	runTestWithBoltDB(t, func(t *testing.T, db *bolt.DB) {
+		ctx := context.Background()
+		tags, err := NewTagIndex(db)
+		if err != nil {
+			t.Fatalf("Failed to create TagIndex: %s", err)
+		}
+		photo := library.RandomPhoto()
+		if err := tags.AddTags(ctx, photo.ExtendedPhotoID, []string{"beach"}); err != nil {
+			t.Fatalf("Failed to tag photo: %s", err)
+		}
+		if err := tags.TrashPhoto(ctx, photo); err != nil {
+			t.Fatalf("Failed to trash photo: %s", err)
+		}
+		counts, _ := tags.Tags(ctx)
+		assert.Empty(t, counts, "Trashed photos are not counted")
+		of, _ := tags.TagsOf(ctx, photo.ID)
+		assert.Equal(t, []string{"beach"}, of, "Tags of trashed photos are kept")
+
+		if err := tags.RestorePhoto(ctx, photo); err != nil {
+			t.Fatalf("Failed to restore photo: %s", err)
+		}
+		photos, _, _ := tags.FindPhotosPaged(ctx, "beach", 0, 10)
+		assert.Equal(t, []library.PhotoID{photo.ID}, photos)
+	})
+}
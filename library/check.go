@@ -0,0 +1,191 @@
+package library
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"bitbucket.org/kleinnic74/photos/consts"
+	"bitbucket.org/kleinnic74/photos/domain"
+	"bitbucket.org/kleinnic74/photos/logging"
+	"go.uber.org/zap"
+)
+
+// IssueType is the kind of inconsistency found by an integrity check
+type IssueType string
+
+const (
+	// MissingFile is a photo record whose file does not exist
+	MissingFile = IssueType("missingFile")
+	// SizeMismatch is a photo whose file size differs from the recorded size
+	SizeMismatch = IssueType("sizeMismatch")
+	// HashMismatch is a photo whose file content does not match the recorded hash
+	HashMismatch = IssueType("hashMismatch")
+	// OrphanFile is a file in the photos directory not referenced by any photo
+	OrphanFile = IssueType("orphanFile")
+	// OrphanThumbs is a thumbnail directory of a photo which does not exist
+	OrphanThumbs = IssueType("orphanThumbs")
+	// MissingThumbs is a photo with thumbnails of some sizes missing
+	MissingThumbs = IssueType("missingThumbs")
+)
+
+// IntegrityIssue is an inconsistency between the photo records and the files of the library,
+// Path is relative to the photos directory or to the thumbnails directory for orphan thumbnails
+type IntegrityIssue struct {
+	Type    IssueType `json:"type"`
+	Photo   PhotoID   `json:"photo,omitempty"`
+	Path    string    `json:"path"`
+	Details string    `json:"details,omitempty"`
+}
+
+// IntegrityReport is the result of checking the library against its files
+type IntegrityReport struct {
+	Started  time.Time        `json:"started"`
+	Finished time.Time        `json:"finished"`
+	Checked  int              `json:"checked"`
+	Issues   []IntegrityIssue `json:"issues"`
+}
+
+// CheckIntegrity verifies that the file of each photo exists and has the recorded size and hash
+// and that its thumbnails exist, and looks for files and thumbnails which do not belong to any
+// photo. Trashed photos are not checked
+func (lib *BasicPhotoLibrary) CheckIntegrity(ctx context.Context) (*IntegrityReport, error) {
+	logger, ctx := logging.SubFrom(ctx, "checkIntegrity")
+	report := &IntegrityReport{Started: time.Now(), Issues: []IntegrityIssue{}}
+	photos, err := lib.db.FindAll(consts.Ascending)
+	if err != nil {
+		return nil, err
+	}
+	paths := make(map[string]bool, 2*len(photos))
+	ids := make(map[string]bool, len(photos))
+	for _, p := range photos {
+		paths[filepath.Clean(p.Path)] = true
+		paths[filepath.Clean(SidecarPath(p.Path))] = true
+		ids[string(p.ID)] = true
+		if issue, found := lib.checkPhoto(ctx, p); found {
+			logger.Warn("Integrity issue", zap.String("photo", string(p.ID)), zap.String("issue", string(issue.Type)))
+			report.Issues = append(report.Issues, issue)
+		} else if issue, found := lib.checkThumbs(p); found {
+			report.Issues = append(report.Issues, issue)
+		}
+		report.Checked++
+	}
+	if err := filepath.Walk(lib.photodir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(lib.photodir, path)
+		if err != nil {
+			return err
+		}
+		if !paths[rel] {
+			report.Issues = append(report.Issues, IntegrityIssue{Type: OrphanFile, Path: rel})
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	thumbs, err := os.ReadDir(lib.thumbdir)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range thumbs {
+		if t.IsDir() && !ids[t.Name()] {
+			report.Issues = append(report.Issues, IntegrityIssue{Type: OrphanThumbs, Path: t.Name()})
+		}
+	}
+	report.Finished = time.Now()
+	logger.Info("Integrity checked", zap.Int("photos", report.Checked), zap.Int("issues", len(report.Issues)),
+		zap.Duration("duration", report.Finished.Sub(report.Started)))
+	return report, nil
+}
+
+func (lib *BasicPhotoLibrary) checkPhoto(ctx context.Context, p *Photo) (IntegrityIssue, bool) {
+	issue := IntegrityIssue{Photo: p.ID, Path: p.Path}
+	info, err := os.Stat(filepath.Join(lib.photodir, p.Path))
+	if err != nil {
+		issue.Type, issue.Details = MissingFile, err.Error()
+		return issue, true
+	}
+	if p.Size != 0 && info.Size() != p.Size {
+		issue.Type, issue.Details = SizeMismatch, fmt.Sprintf("expected %d bytes, found %d", p.Size, info.Size())
+		return issue, true
+	}
+	if !p.HasHash() {
+		return issue, false
+	}
+	in, err := lib.openPhoto(p.Path)
+	if err != nil {
+		issue.Type, issue.Details = MissingFile, err.Error()
+		return issue, true
+	}
+	defer in.Close()
+	hash, err := ComputeHash(in)
+	if err != nil {
+		issue.Type, issue.Details = HashMismatch, err.Error()
+		return issue, true
+	}
+	if hash != p.Hash {
+		issue.Type, issue.Details = HashMismatch, fmt.Sprintf("expected %s, found %s", p.Hash, hash)
+		return issue, true
+	}
+	return issue, false
+}
+
+func (lib *BasicPhotoLibrary) checkThumbs(p *Photo) (IntegrityIssue, bool) {
+	var missing []string
+	for _, size := range domain.AllThumbSizes() {
+		if _, err := os.Stat(lib.thumbPath(p, size)); err != nil {
+			missing = append(missing, size.Name)
+		}
+	}
+	if len(missing) == 0 || !lib.hasThumbs(p) {
+		return IntegrityIssue{}, false
+	}
+	return IntegrityIssue{Type: MissingThumbs, Photo: p.ID, Path: p.Path, Details: "missing " + strings.Join(missing, ", ")}, true
+}
+
+// hasThumbs tells whether thumbs can be created for the given photo, there are no thumbs of
+// videos and of RAW or HEIF files without embedded preview
+func (lib *BasicPhotoLibrary) hasThumbs(p *Photo) bool {
+	in, err := lib.openPhoto(p.Path)
+	if err != nil {
+		return true
+	}
+	defer in.Close()
+	_, err = p.Format.Thumbbase(in, domain.Small)
+	_, unsupported := err.(domain.ErrThumbsNotSupported)
+	return !unsupported
+}
+
+// QuarantineFile moves a file which is not referenced by any photo out of the photos directory,
+// so that it can be imported again. It returns the new absolute path of the file
+func (lib *BasicPhotoLibrary) QuarantineFile(ctx context.Context, path string) (string, error) {
+	orphandir := filepath.Join(lib.basedir, "orphans")
+	if err := lib.moveFile(ctx, path, lib.photodir, orphandir); err != nil {
+		return "", err
+	}
+	logging.From(ctx).Info("Moved orphan file", zap.String("path", path), zap.String("to", orphandir))
+	return filepath.Join(orphandir, path), nil
+}
+
+// DeleteOrphanThumbs removes the thumbnail directory with the given name
+func (lib *BasicPhotoLibrary) DeleteOrphanThumbs(ctx context.Context, name string) error {
+	if _, err := lib.db.Get(PhotoID(name)); err == nil {
+		return fmt.Errorf("Thumbnails of photo %s are not orphaned", name)
+	}
+	return os.RemoveAll(filepath.Join(lib.thumbdir, filepath.Base(name)))
+}
+
+// RegenerateThumbs drops the thumbnails of the given photo and creates them again
+func (lib *BasicPhotoLibrary) RegenerateThumbs(ctx context.Context, id PhotoID) error {
+	photo, err := lib.db.Get(id)
+	if err != nil {
+		return err
+	}
+	lib.deleteThumbs(ctx, photo)
+	return lib.CreateThumbs(ctx, id, false)
+}
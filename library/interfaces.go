@@ -38,6 +38,13 @@ type PhotoLibrary interface {
 	FindAll(ctx context.Context, order consts.SortOrder) ([]*Photo, error)
 	FindAllPaged(ctx context.Context, start, maxCount int, order consts.SortOrder) ([]*Photo, bool, error)
 	Find(ctx context.Context, start, end time.Time, order consts.SortOrder) ([]*Photo, error)
+	Delete(ctx context.Context, id PhotoID) error
+	UpdateMeta(ctx context.Context, id PhotoID, update MetaUpdate) (*Photo, error)
+	PairLive(ctx context.Context, still, video PhotoID) error
+
+	Trash(ctx context.Context, id PhotoID) error
+	Restore(ctx context.Context, id PhotoID) (*Photo, error)
+	FindTrashed(ctx context.Context) ([]*Photo, error)
 
 	OpenContent(ctx context.Context, id PhotoID) (io.ReadCloser, *Photo, error)
 	OpenThumb(ctx context.Context, id PhotoID, size domain.ThumbSize) (io.ReadCloser, domain.Format, error)
@@ -68,6 +75,12 @@ type Store interface {
 	FindAll(order consts.SortOrder) ([]*Photo, error)
 	FindAllPaged(start, maxCount int, order consts.SortOrder) ([]*Photo, bool, error)
 	Find(start, end OrderedID, order consts.SortOrder) ([]*Photo, error)
+	Delete(id PhotoID) error
+
+	Trash(p *Photo) error
+	Restore(id PhotoID) (*Photo, error)
+	GetTrashed(id PhotoID) (*Photo, error)
+	FindTrashed() ([]*Photo, error)
 }
 
 // ClosableStore is a Store that can be closed
@@ -1,6 +1,7 @@
 package library
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
 	"fmt"
@@ -26,6 +27,25 @@ const (
 
 type NewPhotoCallback func(ctx context.Context, p *Photo) error
 
+// DeletedPhotoCallback is called after a photo has been removed from the library,
+// either permanently or by moving it to the trash
+type DeletedPhotoCallback func(ctx context.Context, p *Photo) error
+
+// PurgedPhotoCallback is called after a photo has been permanently removed from the library
+type PurgedPhotoCallback func(ctx context.Context, p *Photo) error
+
+// TrashedPhotoCallback is called after a photo has been moved to the trash, after the
+// delete callbacks. Indexes use it to keep what they need to restore the photo
+type TrashedPhotoCallback func(ctx context.Context, p *Photo) error
+
+// RestoredPhotoCallback is called after a photo has been restored from the trash, after
+// the callbacks of new photos
+type RestoredPhotoCallback func(ctx context.Context, p *Photo) error
+
+// UpdatedPhotoCallback is called after the meta-data of a photo has been changed, old
+// contains the photo as it was before the update
+type UpdatedPhotoCallback func(ctx context.Context, old, updated *Photo) error
+
 type LibraryID string
 
 // BasicPhotoLibrary is a library storing photos on the filesystem
@@ -33,17 +53,24 @@ type BasicPhotoLibrary struct {
 	ID       LibraryID
 	basedir  string
 	photodir string
+	trashdir string
 
 	dirMode os.FileMode
 	db      ClosableStore
 
 	mediaLoader Loader
 
-	thumbdir    string
-	thumber     domain.Thumber
-	thumbFormat domain.Format
-
-	callbacks []NewPhotoCallback
+	thumbdir     string
+	thumber      domain.Thumber
+	thumbFormat  domain.Format
+	thumbQuality int
+
+	callbacks        []NewPhotoCallback
+	deleteCallbacks  []DeletedPhotoCallback
+	purgeCallbacks   []PurgedPhotoCallback
+	trashCallbacks   []TrashedPhotoCallback
+	restoreCallbacks []RestoredPhotoCallback
+	updateCallbacks  []UpdatedPhotoCallback
 }
 
 // ReaderFunc is a function providing an io.ReadCloser
@@ -71,6 +98,13 @@ func PhotoAlreadyExists(id PhotoID) error {
 	return fmt.Errorf("Photo already exists: id=%s", id)
 }
 
+// ErrInTrash indicates that a photo being added is in the trash, it has to be restored instead
+type ErrInTrash PhotoID
+
+func (e ErrInTrash) Error() string {
+	return fmt.Sprintf("Photo is in the trash, restore it instead: id=%s", string(e))
+}
+
 // PhotoFileAlreadyExists indicates that a given photo file already exists in the library
 func PhotoFileAlreadyExists(path string) error {
 	return fmt.Errorf("Photo already exists at path=%s", path)
@@ -93,6 +127,10 @@ func NewBasicPhotoLibrary(basedir string, store ClosableStore, thumber domain.Th
 	if err := os.MkdirAll(thumbsDir, defaultDirMode); err != nil {
 		return nil, err
 	}
+	trashDir := filepath.Join(absdir, "trash")
+	if err := os.MkdirAll(trashDir, defaultDirMode); err != nil {
+		return nil, err
+	}
 	tmpDir := filepath.Join(absdir, "tmp", "loader")
 	if err := os.MkdirAll(tmpDir, defaultDirMode); err != nil {
 		return nil, err
@@ -106,14 +144,16 @@ func NewBasicPhotoLibrary(basedir string, store ClosableStore, thumber domain.Th
 		ID:          dbid,
 		basedir:     absdir,
 		photodir:    photosDir,
+		trashdir:    trashDir,
 		mediaLoader: NewLoader(tmpDir),
 
 		dirMode: defaultDirMode,
 		db:      store,
 
-		thumbdir:    thumbsDir,
-		thumbFormat: domain.MustFormatForExt("jpg"),
-		thumber:     thumber,
+		thumbdir:     thumbsDir,
+		thumbFormat:  domain.MustFormatForExt("jpg"),
+		thumbQuality: domain.DefaultThumbQuality,
+		thumber:      thumber,
 	}, nil
 }
 
@@ -121,8 +161,28 @@ func (lib *BasicPhotoLibrary) AddCallback(callback NewPhotoCallback) {
 	lib.callbacks = append(lib.callbacks, callback)
 }
 
+func (lib *BasicPhotoLibrary) AddDeleteCallback(callback DeletedPhotoCallback) {
+	lib.deleteCallbacks = append(lib.deleteCallbacks, callback)
+}
+
+func (lib *BasicPhotoLibrary) AddPurgeCallback(callback PurgedPhotoCallback) {
+	lib.purgeCallbacks = append(lib.purgeCallbacks, callback)
+}
+
+func (lib *BasicPhotoLibrary) AddTrashCallback(callback TrashedPhotoCallback) {
+	lib.trashCallbacks = append(lib.trashCallbacks, callback)
+}
+
+func (lib *BasicPhotoLibrary) AddRestoreCallback(callback RestoredPhotoCallback) {
+	lib.restoreCallbacks = append(lib.restoreCallbacks, callback)
+}
+
+func (lib *BasicPhotoLibrary) AddUpdateCallback(callback UpdatedPhotoCallback) {
+	lib.updateCallbacks = append(lib.updateCallbacks, callback)
+}
+
 // Add adds a photo to this library. If the given photo already exists, then
-// an error of type PhotoAlreadyExists is returned
+// an error of type PhotoAlreadyExists is returned, or ErrInTrash if it is in the trash
 func (lib *BasicPhotoLibrary) Add(ctx context.Context, photo PhotoMeta, content io.Reader) error {
 	ctx = logging.Context(ctx, logging.From(ctx).Named("library").With(zap.String("source", photo.Name)))
 	targetDir, name, id := canonicalizeFilename(photo)
@@ -133,6 +193,9 @@ func (lib *BasicPhotoLibrary) Add(ctx context.Context, photo PhotoMeta, content
 	}
 	defer media.Cleanup()
 	if dup, exists := lib.db.Exists(media.Hash()); exists {
+		if _, err := lib.db.GetTrashed(dup); err == nil {
+			return ErrInTrash(dup)
+		}
 		return PhotoAlreadyExists(dup)
 	}
 	var size int64
@@ -185,7 +248,8 @@ func (lib *BasicPhotoLibrary) FindAll(ctx context.Context, order consts.SortOrde
 }
 
 // FindAllPaged returns maximum maxCount photos from the underlying store starting
-// at start index
+// at start index. Companion videos of Live Photos are skipped and do not count for
+// the start index
 func (lib *BasicPhotoLibrary) FindAllPaged(ctx context.Context, start, maxCount int, order consts.SortOrder) ([]*Photo, bool, error) {
 	return lib.db.FindAllPaged(start, maxCount, order)
 }
@@ -197,6 +261,237 @@ func (lib *BasicPhotoLibrary) Find(ctx context.Context, start, end time.Time, or
 	return lib.db.Find(min, max, order)
 }
 
+// Delete permanently removes the photo with the given ID from this library, the photo
+// may also be in the trash. The photo file and its thumbnails are deleted and all delete
+// and purge callbacks are invoked to clean up indexes
+func (lib *BasicPhotoLibrary) Delete(ctx context.Context, id PhotoID) error {
+	logger, ctx := logging.FromWithNameAndFields(ctx, "library", zap.String("photo", string(id)))
+	photo, err := lib.db.Get(id)
+	basedir := lib.photodir
+	switch err.(type) {
+	case nil:
+	case ErrNotFound:
+		if photo, err = lib.db.GetTrashed(id); err != nil {
+			return err
+		}
+		basedir = lib.trashdir
+	default:
+		return err
+	}
+	if err := lib.db.Delete(id); err != nil {
+		return err
+	}
+	if !photo.IsTrashed() {
+		lib.notifyDeleted(ctx, photo)
+	}
+	for _, cb := range lib.purgeCallbacks {
+		if err := cb(ctx, photo); err != nil {
+			logger.Warn("Purge callback failed", zap.Error(err))
+		}
+	}
+	if err := os.Remove(filepath.Join(basedir, photo.Path)); err != nil && !os.IsNotExist(err) {
+		logger.Warn("Failed to delete photo file", zap.String("path", photo.Path), zap.Error(err))
+	}
+	lib.deleteSidecar(ctx, filepath.Join(basedir, photo.Path))
+	lib.deleteThumbs(ctx, photo)
+	logger.Info("Deleted", zap.String("path", photo.Path))
+	if photo.LiveStill != "" {
+		if err := lib.unlinkLiveStill(ctx, photo); err != nil {
+			logger.Warn("Failed to unlink Live Photo still image", zap.String("still", string(photo.LiveStill)), zap.Error(err))
+		}
+	}
+	if photo.LiveVideo != "" {
+		// The video of a Live Photo is not shown on its own
+		if err := lib.Delete(ctx, photo.LiveVideo); err != nil {
+			logger.Warn("Failed to delete Live Photo video", zap.String("video", string(photo.LiveVideo)), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+// UpdateMeta changes the meta-data of the photo with the given ID. When the date is changed,
+// the photo gets a new SortID and its file is moved to the directory of the new date, the
+// ID of the photo does not change. Thumbnails are dropped when the orientation changes
+func (lib *BasicPhotoLibrary) UpdateMeta(ctx context.Context, id PhotoID, update MetaUpdate) (*Photo, error) {
+	logger, ctx := logging.FromWithNameAndFields(ctx, "library", zap.String("photo", string(id)))
+	old, err := lib.db.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	updated := *old
+	if update.Location != nil {
+		location := *update.Location
+		updated.Location = &location
+	}
+	if update.Orientation != nil {
+		updated.Orientation = *update.Orientation
+		// Dimensions are stored as displayed
+		updated.Width, updated.Height = updated.Orientation.Dimensions(old.Orientation.Dimensions(old.Width, old.Height))
+	}
+	if update.Rating != nil {
+		updated.Rating = *update.Rating
+	}
+	if update.Favorite != nil {
+		updated.Favorite = *update.Favorite
+	}
+	if update.Rejected != nil {
+		updated.Rejected = *update.Rejected
+	}
+	if update.DateTaken != nil && !update.DateTaken.Equal(old.DateTaken) {
+		updated.DateTaken = *update.DateTaken
+		rekey(&updated)
+	}
+	if updated.Path != old.Path {
+		if err := lib.renameFile(ctx, lib.photodir, old.Path, updated.Path); err != nil {
+			return nil, err
+		}
+	}
+	if err := lib.db.Update(&updated); err != nil {
+		if updated.Path != old.Path {
+			// Try to put back file
+			lib.renameFile(ctx, lib.photodir, updated.Path, old.Path)
+		}
+		return nil, err
+	}
+	if updated.Path != old.Path {
+		lib.moveSidecar(ctx, filepath.Join(lib.photodir, old.Path), filepath.Join(lib.photodir, updated.Path))
+	}
+	if updated.Orientation != old.Orientation {
+		lib.deleteThumbs(ctx, old)
+	}
+	lib.notifyUpdated(ctx, old, &updated)
+	logger.Info("Updated", zap.String("path", updated.Path))
+	return &updated, nil
+}
+
+// Trash moves the photo with the given ID to the trash. Trashed photos are no longer
+// returned by the library but can be restored until they are deleted
+func (lib *BasicPhotoLibrary) Trash(ctx context.Context, id PhotoID) error {
+	logger, ctx := logging.FromWithNameAndFields(ctx, "library", zap.String("photo", string(id)))
+	photo, err := lib.db.Get(id)
+	if err != nil {
+		return err
+	}
+	if err := lib.moveFile(ctx, photo.Path, lib.photodir, lib.trashdir); err != nil {
+		return err
+	}
+	photo.TrashedAt = time.Now().UTC()
+	if err := lib.db.Trash(photo); err != nil {
+		// Try to put back file
+		lib.moveFile(ctx, photo.Path, lib.trashdir, lib.photodir)
+		return err
+	}
+	lib.moveSidecar(ctx, filepath.Join(lib.photodir, photo.Path), filepath.Join(lib.trashdir, photo.Path))
+	lib.notifyDeleted(ctx, photo)
+	for _, cb := range lib.trashCallbacks {
+		if err := cb(ctx, photo); err != nil {
+			logger.Warn("Trash callback failed", zap.Error(err))
+		}
+	}
+	lib.deleteThumbs(ctx, photo)
+	logger.Info("Moved to trash", zap.String("path", photo.Path))
+	if photo.LiveStill != "" {
+		if err := lib.unlinkLiveStill(ctx, photo); err != nil {
+			logger.Warn("Failed to unlink Live Photo still image", zap.String("still", string(photo.LiveStill)), zap.Error(err))
+		}
+	}
+	if photo.LiveVideo != "" {
+		if err := lib.Trash(ctx, photo.LiveVideo); err != nil {
+			logger.Warn("Failed to trash Live Photo video", zap.String("video", string(photo.LiveVideo)), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+// Restore moves the photo with the given ID out of the trash and re-adds it to all indexes.
+// The restored photo is returned together with the first error of the callbacks, if any
+func (lib *BasicPhotoLibrary) Restore(ctx context.Context, id PhotoID) (*Photo, error) {
+	logger, ctx := logging.FromWithNameAndFields(ctx, "library", zap.String("photo", string(id)))
+	trashed, err := lib.db.GetTrashed(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := lib.moveFile(ctx, trashed.Path, lib.trashdir, lib.photodir); err != nil {
+		return nil, err
+	}
+	photo, err := lib.db.Restore(id)
+	if err != nil {
+		lib.moveFile(ctx, trashed.Path, lib.photodir, lib.trashdir)
+		return nil, err
+	}
+	lib.moveSidecar(ctx, filepath.Join(lib.trashdir, trashed.Path), filepath.Join(lib.photodir, trashed.Path))
+	var callbackErr error
+	for _, cb := range lib.callbacks {
+		if err := cb(ctx, photo); err != nil && callbackErr == nil {
+			callbackErr = err
+		}
+	}
+	for _, cb := range lib.restoreCallbacks {
+		if err := cb(ctx, photo); err != nil && callbackErr == nil {
+			callbackErr = err
+		}
+	}
+	if callbackErr != nil {
+		logger.Warn("Restore callback failed", zap.Error(callbackErr))
+	}
+	logger.Info("Restored from trash", zap.String("path", photo.Path))
+	if photo.LiveStill != "" {
+		if err := lib.relinkLiveStill(ctx, photo); err != nil {
+			logger.Warn("Failed to link Live Photo still image", zap.String("still", string(photo.LiveStill)), zap.Error(err))
+		}
+	}
+	if photo.LiveVideo != "" {
+		if err := lib.restoreLiveVideo(ctx, photo); err != nil {
+			logger.Warn("Failed to restore Live Photo video", zap.String("video", string(photo.LiveVideo)), zap.Error(err))
+		}
+	}
+	return photo, callbackErr
+}
+
+// FindTrashed returns all photos currently in the trash
+func (lib *BasicPhotoLibrary) FindTrashed(ctx context.Context) ([]*Photo, error) {
+	return lib.db.FindTrashed()
+}
+
+func (lib *BasicPhotoLibrary) notifyDeleted(ctx context.Context, photo *Photo) {
+	for _, cb := range lib.deleteCallbacks {
+		if err := cb(ctx, photo); err != nil {
+			logging.From(ctx).Warn("Delete callback failed", zap.Error(err))
+		}
+	}
+}
+
+func (lib *BasicPhotoLibrary) notifyUpdated(ctx context.Context, old, updated *Photo) {
+	for _, cb := range lib.updateCallbacks {
+		if err := cb(ctx, old, updated); err != nil {
+			logging.From(ctx).Warn("Update callback failed", zap.Error(err))
+		}
+	}
+}
+
+func (lib *BasicPhotoLibrary) deleteThumbs(ctx context.Context, photo *Photo) {
+	if err := os.RemoveAll(filepath.Join(lib.thumbdir, string(photo.ID))); err != nil {
+		logging.From(ctx).Warn("Failed to delete thumbs", zap.Error(err))
+	}
+}
+
+func (lib *BasicPhotoLibrary) moveFile(ctx context.Context, path, from, to string) error {
+	if err := lib.createDirectory(ctx, to, filepath.Dir(path)); err != nil {
+		return err
+	}
+	return os.Rename(filepath.Join(from, path), filepath.Join(to, path))
+}
+
+func (lib *BasicPhotoLibrary) renameFile(ctx context.Context, basedir, from, to string) error {
+	if _, err := os.Stat(filepath.Join(basedir, to)); err == nil {
+		return PhotoFileAlreadyExists(to)
+	}
+	if err := lib.createDirectory(ctx, basedir, filepath.Dir(to)); err != nil {
+		return err
+	}
+	return os.Rename(filepath.Join(basedir, from), filepath.Join(basedir, to))
+}
+
 // OpenContent returns an io.ReadCloser on the content of the photo with the given ID.
 // The caller is responsible to close the reader
 func (lib *BasicPhotoLibrary) OpenContent(ctx context.Context, id PhotoID) (io.ReadCloser, *Photo, error) {
@@ -260,46 +555,20 @@ func (lib *BasicPhotoLibrary) fileSizeOf(path string) int64 {
 	return info.Size()
 }
 
+// OpenThumb returns the thumb of the given size of a photo, the thumb is created if it
+// does not exist yet
 func (lib *BasicPhotoLibrary) OpenThumb(ctx context.Context, id PhotoID, size domain.ThumbSize) (io.ReadCloser, domain.Format, error) {
-	logger, ctx := logging.FromWithNameAndFields(ctx, "library", zap.String("photo", string(id)))
-
 	photo, err := lib.Get(ctx, id)
 	if err != nil {
 		// Photo does not exist
 		return nil, nil, err
 	}
-	dir := filepath.Join(lib.thumbdir, string(photo.ID))
-	path := filepath.Join(dir, size.Name+".jpg")
+	path := lib.thumbPath(photo, size)
 	if _, err := os.Stat(path); err != nil {
 		// Thumb does not exist yet
-		logger = logger.With(zap.String("thumb", path))
-		start := time.Now()
-		logger.Debug("Creating thumbnail")
-		if _, err := os.Stat(dir); err != nil {
-			if err = os.MkdirAll(dir, defaultDirMode); err != nil {
-				return nil, nil, err
-			}
-		}
-
-		baseImage, err := lib.openPhoto(photo.Path)
-		if err != nil {
-			logger.Error("Failed to open image content", zap.Error(err))
-			return nil, nil, err
-		}
-		defer baseImage.Close()
-		thumb, err := lib.thumber.CreateThumb(baseImage, photo.Format, photo.Orientation, domain.Small)
-		if err != nil {
-			logger.Error("Failed to created thumb", zap.Error(err))
-			return nil, nil, err
-		}
-		out, err := os.Create(path)
-		if err != nil {
-			logger.Error("Failed to save thumb", zap.Error(err))
+		if err := lib.createThumb(ctx, photo, size); err != nil {
 			return nil, nil, err
 		}
-		defer out.Close()
-		lib.thumbFormat.Encode(thumb, out)
-		logger.Info("Created thumb", zap.Duration("duration", time.Since(start)))
 	}
 	// Thumb exists
 	f, err := os.Open(path)
@@ -312,7 +581,7 @@ func (lib *BasicPhotoLibrary) OpenThumb(ctx context.Context, id PhotoID, size do
 var unknownIDs uint32
 
 func canonicalizeFilename(photo PhotoMeta) (dir, filename string, id PhotoID) {
-	dir = photo.DateTaken.Format("2006/01/02")
+	dir = photo.LocalDateTaken().Format("2006/01/02")
 	name := photo.Name
 	if name == "" {
 		id := atomic.AddUint32(&unknownIDs, 1)
@@ -362,7 +631,10 @@ func (lib *BasicPhotoLibrary) MigrateInstances(ctx context.Context, progress fun
 				zap.Int("pre_schema", int(p.schema)),
 				zap.Int("new_schema", int(updated.schema)),
 				zap.Any("content", updated))
-			lib.db.Update(&updated)
+			if err := lib.updateMigrated(ctx, p, &updated); err != nil {
+				logger.Warn("Failed to update migrated photo", zap.String("photo", string(p.ID)), zap.Error(err))
+				continue
+			}
 			count++
 		}
 		progress(i, len(photos))
@@ -373,6 +645,43 @@ func (lib *BasicPhotoLibrary) MigrateInstances(ctx context.Context, progress fun
 	return nil
 }
 
+// updateMigrated stores a migrated photo. Photos which got another path or sort ID are moved
+// and the indexes are notified as for any other update
+func (lib *BasicPhotoLibrary) updateMigrated(ctx context.Context, old, updated *Photo) error {
+	// The file is already at the converted path if only the separators changed
+	from := old.Path
+	if isPathConversionNeeded(from) {
+		from = convertPath(from)
+	}
+	moved := updated.Path != from
+	if moved {
+		if err := lib.renameFile(ctx, lib.photodir, from, updated.Path); err != nil {
+			return err
+		}
+	}
+	if err := lib.db.Update(updated); err != nil {
+		if moved {
+			// Try to put back file
+			lib.renameFile(ctx, lib.photodir, updated.Path, from)
+		}
+		return err
+	}
+	if moved {
+		lib.moveSidecar(ctx, filepath.Join(lib.photodir, from), filepath.Join(lib.photodir, updated.Path))
+	}
+	if moved || !bytes.Equal(old.SortID, updated.SortID) {
+		lib.notifyUpdated(ctx, old, updated)
+	}
+	return nil
+}
+
+// rekey sets the sort ID and the path which the photo gets when imported with its capture time
+func rekey(p *Photo) {
+	p.SortID = orderedIDOf(p.DateTaken.UTC(), p.ID)
+	targetDir, _, _ := canonicalizeFilename(p.PhotoMeta)
+	p.Path = filepath.Join(targetDir, filepath.Base(p.Path))
+}
+
 func migratePath(ctx context.Context, p Photo, _ ReaderFunc) (Photo, error) {
 	logger, ctx := logging.SubFrom(ctx, "migratePath")
 	if !isPathConversionNeeded(p.Path) {
@@ -416,6 +725,110 @@ func addOrientation(ctx context.Context, p Photo, in ReaderFunc) (Photo, error)
 	return p, nil
 }
 
+func addRating(ctx context.Context, p Photo, in ReaderFunc) (Photo, error) {
+	if p.Rating != 0 || p.Format.Type() != domain.Picture {
+		return p, nil
+	}
+	content, err := in()
+	if err != nil {
+		return p, err
+	}
+	defer content.Close()
+	var meta domain.MediaMetaData
+	if err := p.Format.DecodeMetaData(content, &meta); err != nil {
+		// Photos without EXIF data are simply not rated
+		logging.From(ctx).Debug("No meta-data for rating", zap.String("photo", string(p.ID)), zap.Error(err))
+		return p, nil
+	}
+	p.Rating = meta.Rating
+	return p, nil
+}
+
+func addVideoMeta(ctx context.Context, p Photo, in ReaderFunc) (Photo, error) {
+	if p.Video != nil || p.Format.Type() != domain.Video {
+		return p, nil
+	}
+	content, err := in()
+	if err != nil {
+		return p, err
+	}
+	defer content.Close()
+	var meta domain.MediaMetaData
+	if err := p.Format.DecodeMetaData(content, &meta); err != nil {
+		logging.From(ctx).Debug("No video meta-data", zap.String("photo", string(p.ID)), zap.Error(err))
+		return p, nil
+	}
+	p.Video = meta.Video
+	return p, nil
+}
+
+func addCameraMeta(ctx context.Context, p Photo, in ReaderFunc) (Photo, error) {
+	if p.Camera != nil || p.Format.Type() != domain.Picture {
+		return p, nil
+	}
+	content, err := in()
+	if err != nil {
+		return p, err
+	}
+	defer content.Close()
+	var meta domain.MediaMetaData
+	if err := p.Format.DecodeMetaData(content, &meta); err != nil {
+		// Photos without EXIF data have no camera
+		logging.From(ctx).Debug("No camera meta-data", zap.String("photo", string(p.ID)), zap.Error(err))
+		return p, nil
+	}
+	p.Camera = meta.Camera
+	return p, nil
+}
+
+// addTimeZone sets the time zone of photos imported before time zones were known. The capture
+// time of pictures was read as local time of the server, it is corrected unless the date has
+// been changed since the import. SortID and path are set as for photos imported with a time zone
+func addTimeZone(ctx context.Context, p Photo, in ReaderFunc) (Photo, error) {
+	if p.TimeZoneOffset != nil {
+		return p, nil
+	}
+	content, err := in()
+	if err != nil {
+		return p, err
+	}
+	defer content.Close()
+	var meta domain.MediaMetaData
+	if err := p.Format.DecodeMetaData(content, &meta); err != nil || meta.TimeZoneOffset == nil {
+		return p, nil
+	}
+	local := meta.DateTaken
+	asServerTime := time.Date(local.Year(), local.Month(), local.Day(), local.Hour(), local.Minute(), local.Second(), local.Nanosecond(), time.Local)
+	if asServerTime.Equal(p.DateTaken) {
+		p.DateTaken = meta.DateTaken
+	}
+	p.TimeZoneOffset = meta.TimeZoneOffset
+	p.DateTaken = p.LocalDateTaken()
+	rekey(&p)
+	logging.From(ctx).Debug("Added time zone", zap.String("photo", string(p.ID)), zap.Int("offset", *p.TimeZoneOffset))
+	return p, nil
+}
+
+// addDimensions reads the dimensions of photos imported before they were known, the
+// orientation found in the file is replaced by the one of the photo which may have been changed
+func addDimensions(ctx context.Context, p Photo, in ReaderFunc) (Photo, error) {
+	if p.Width != 0 && p.Height != 0 {
+		return p, nil
+	}
+	content, err := in()
+	if err != nil {
+		return p, err
+	}
+	defer content.Close()
+	var meta domain.MediaMetaData
+	if err := p.Format.DecodeMetaData(content, &meta); err != nil && (meta.Width == 0 || meta.Height == 0) {
+		logging.From(ctx).Debug("No dimensions", zap.String("photo", string(p.ID)), zap.Error(err))
+		return p, nil
+	}
+	p.Width, p.Height = p.Orientation.Dimensions(meta.Orientation.Dimensions(meta.Width, meta.Height))
+	return p, nil
+}
+
 func addSortID(ctx context.Context, p Photo, in ReaderFunc) (Photo, error) {
 	log, ctx := logging.SubFrom(ctx, "addSortID")
 	if len(p.SortID) == 0 {
@@ -464,5 +877,10 @@ func instanceMigrations(libraryID LibraryID) InstanceMigrations {
 	migrations.Register(Version(3), InstanceFunc(migrateHash))
 	migrations.Register(Version(6), InstanceFunc(addSortID))
 	migrations.Register(Version(7), addStoreID(libraryID))
+	migrations.Register(Version(8), InstanceFunc(addRating))
+	migrations.Register(Version(9), InstanceFunc(addVideoMeta))
+	migrations.Register(Version(10), InstanceFunc(addCameraMeta))
+	migrations.Register(Version(11), InstanceFunc(addTimeZone))
+	migrations.Register(Version(12), InstanceFunc(addDimensions))
 	return migrations
 }
@@ -55,7 +55,7 @@ func TestMarshallJSON(t *testing.T) {
 			},
 			JSON: `{
   "id": "id",
-  "schema": 7,
+  "schema": 12,
   "path": "to/file",
   "format": "jpg",
   "dateUN": %d,
@@ -174,6 +174,18 @@ func TestCanonicalizePhoto(t *testing.T) {
 	}
 }
 
+func TestCanonicalizeLocalDate(t *testing.T) {
+	offset := -10 * 3600
+	photo := PhotoMeta{
+		Name:           "/some/path/myfile.jpg",
+		DateTaken:      at("2015", "02", "24"),
+		TimeZoneOffset: &offset,
+		Format:         domain.MustFormatForExt("jpg"),
+	}
+	dir, _, _ := canonicalizeFilename(photo)
+	assertEquals(t, "path", "2015/02/23", dir)
+}
+
 func assertEquals(t *testing.T, name, expected, actual string) {
 	if expected != actual {
 		t.Errorf("Bad value for '%s': expected '%s', got '%s'", name, expected, actual)
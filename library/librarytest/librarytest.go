@@ -0,0 +1,68 @@
+// Package librarytest provides a photo library in a temporary directory for the tests of
+// the library and of the packages built on it
+package librarytest
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"bitbucket.org/kleinnic74/photos/domain"
+	"bitbucket.org/kleinnic74/photos/library"
+	"bitbucket.org/kleinnic74/photos/library/boltstore"
+	bolt "go.etcd.io/bbolt"
+)
+
+// NewLibrary returns an empty library stored in a temporary directory, the directory and
+// the database are returned for tests creating indexes or checking files. The database is
+// closed when the test ends
+func NewLibrary(t *testing.T) (*library.BasicPhotoLibrary, string, *bolt.DB) {
+	dir := t.TempDir()
+	db, err := bolt.Open(filepath.Join(dir, "photos.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	store, err := boltstore.NewBoltStore(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lib, err := library.NewBasicPhotoLibrary(dir, store, domain.LocalThumber{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return lib, dir, db
+}
+
+// AddFile adds the photo at the given path with the meta-data read from the file
+func AddFile(t *testing.T, lib *library.BasicPhotoLibrary, path string) *library.Photo {
+	img, err := domain.NewPhoto(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta := library.PhotoMeta{Name: filepath.Base(path), Format: img.Format(), DateTaken: img.DateTaken()}
+	return AddContent(t, lib, meta, content)
+}
+
+// AddContent adds a photo with the given meta-data and content
+func AddContent(t *testing.T, lib *library.BasicPhotoLibrary, meta library.PhotoMeta, content []byte) *library.Photo {
+	ctx := context.Background()
+	if err := lib.Add(ctx, meta, bytes.NewReader(content)); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := library.ComputeHash(bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	photo, found, err := lib.FindByHash(ctx, hash)
+	if err != nil || !found {
+		t.Fatalf("Photo %s not added: %v", meta.Name, err)
+	}
+	return photo
+}
@@ -0,0 +1,109 @@
+package library
+
+import (
+	"context"
+	"fmt"
+
+	"bitbucket.org/kleinnic74/photos/domain"
+	"bitbucket.org/kleinnic74/photos/logging"
+	"go.uber.org/zap"
+)
+
+// PairLive links the still image and the companion video of a Live Photo, the update
+// callbacks are invoked for both photos so that indexes can hide the video
+func (lib *BasicPhotoLibrary) PairLive(ctx context.Context, still, video PhotoID) error {
+	logger, ctx := logging.FromWithNameAndFields(ctx, "library", zap.String("photo", string(still)), zap.String("video", string(video)))
+	oldStill, err := lib.db.Get(still)
+	if err != nil {
+		return err
+	}
+	oldVideo, err := lib.db.Get(video)
+	if err != nil {
+		return err
+	}
+	if oldStill.Format.Type() != domain.Picture || oldVideo.Format.Type() != domain.Video {
+		return fmt.Errorf("Photos %s and %s are not a still image and a video", still, video)
+	}
+	if oldStill.LiveVideo == video && oldVideo.LiveStill == still {
+		return nil
+	}
+	updatedStill, updatedVideo := *oldStill, *oldVideo
+	updatedStill.LiveVideo = video
+	updatedVideo.LiveStill = still
+	if err := lib.db.Update(&updatedVideo); err != nil {
+		return err
+	}
+	if err := lib.db.Update(&updatedStill); err != nil {
+		return err
+	}
+	lib.notifyUpdated(ctx, oldVideo, &updatedVideo)
+	lib.notifyUpdated(ctx, oldStill, &updatedStill)
+	logger.Info("Paired Live Photo")
+	return nil
+}
+
+// unlinkLiveStill removes the link of the still image to its companion video when the video
+// is deleted or trashed on its own
+func (lib *BasicPhotoLibrary) unlinkLiveStill(ctx context.Context, video *Photo) error {
+	still, err := lib.db.Get(video.LiveStill)
+	if _, gone := err.(ErrNotFound); gone {
+		// The still image was deleted or trashed together with its video
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if still.LiveVideo != video.ID {
+		return nil
+	}
+	return lib.updateLiveLink(ctx, still, func(p *Photo) {
+		p.LiveVideo = ""
+	})
+}
+
+// relinkLiveStill pairs a companion video restored on its own with its still image again. The
+// video is shown on its own if its still image is not in the library
+func (lib *BasicPhotoLibrary) relinkLiveStill(ctx context.Context, video *Photo) error {
+	still, err := lib.db.Get(video.LiveStill)
+	switch err.(type) {
+	case nil:
+		return lib.PairLive(ctx, still.ID, video.ID)
+	case ErrNotFound:
+		return lib.updateLiveLink(ctx, video, func(p *Photo) {
+			p.LiveStill = ""
+		})
+	default:
+		return err
+	}
+}
+
+// restoreLiveVideo restores the companion video of a restored still image. A video restored
+// on its own before is paired again and the link to a deleted video is removed
+func (lib *BasicPhotoLibrary) restoreLiveVideo(ctx context.Context, still *Photo) error {
+	_, err := lib.Restore(ctx, still.LiveVideo)
+	if _, notTrashed := err.(ErrNotFound); !notTrashed {
+		return err
+	}
+	_, err = lib.db.Get(still.LiveVideo)
+	switch err.(type) {
+	case nil:
+		return lib.PairLive(ctx, still.ID, still.LiveVideo)
+	case ErrNotFound:
+		return lib.updateLiveLink(ctx, still, func(p *Photo) {
+			p.LiveVideo = ""
+		})
+	default:
+		return err
+	}
+}
+
+// updateLiveLink stores the photo after changing its Live Photo link with the given function
+func (lib *BasicPhotoLibrary) updateLiveLink(ctx context.Context, photo *Photo, change func(*Photo)) error {
+	old := *photo
+	change(photo)
+	if err := lib.db.Update(photo); err != nil {
+		*photo = old
+		return err
+	}
+	lib.notifyUpdated(ctx, &old, photo)
+	return nil
+}
@@ -0,0 +1,81 @@
+package library_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"bitbucket.org/kleinnic74/photos/consts"
+	"bitbucket.org/kleinnic74/photos/domain"
+	"bitbucket.org/kleinnic74/photos/library"
+	"bitbucket.org/kleinnic74/photos/library/librarytest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPairLive(t *testing.T) {
+	ctx := context.Background()
+	lib, _, _ := librarytest.NewLibrary(t)
+	var updates int
+	lib.AddUpdateCallback(func(ctx context.Context, old, updated *library.Photo) error {
+		updates++
+		return nil
+	})
+	taken := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	content, err := os.ReadFile("../domain/testdata/Canon_40D.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	still := librarytest.AddContent(t, lib, library.PhotoMeta{Name: "IMG_0001.JPG", Format: domain.MustFormatForExt("jpg"), DateTaken: taken}, content)
+	video := librarytest.AddContent(t, lib, library.PhotoMeta{Name: "IMG_0001.MOV", Format: domain.MustFormatForExt("mov"), DateTaken: taken}, []byte("not really a video"))
+
+	assert.Error(t, lib.PairLive(ctx, video.ID, still.ID), "Video cannot be the still image")
+	if err := lib.PairLive(ctx, still.ID, video.ID); err != nil {
+		t.Fatalf("Pairing failed: %s", err)
+	}
+	assert.Equal(t, 2, updates)
+	still, _ = lib.Get(ctx, still.ID)
+	video, _ = lib.Get(ctx, video.ID)
+	assert.Equal(t, video.ID, still.LiveVideo)
+	assert.Equal(t, still.ID, video.LiveStill)
+	assert.True(t, video.IsLiveCompanion())
+	assert.False(t, still.IsLiveCompanion())
+
+	if err := lib.Trash(ctx, still.ID); err != nil {
+		t.Fatal(err)
+	}
+	trashed, _ := lib.FindTrashed(ctx)
+	assert.Len(t, trashed, 2, "Video should be trashed with its still image")
+	if _, err := lib.Restore(ctx, still.ID); err != nil {
+		t.Fatal(err)
+	}
+	_, err = lib.Get(ctx, video.ID)
+	assert.NoError(t, err, "Video should be restored with its still image")
+
+	photos, hasMore, err := lib.FindAllPaged(ctx, 0, 10, consts.Ascending)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, hasMore)
+	if assert.Len(t, photos, 1, "Companion video should not be listed") {
+		assert.Equal(t, still.ID, photos[0].ID)
+	}
+
+	if err := lib.Trash(ctx, video.ID); err != nil {
+		t.Fatal(err)
+	}
+	still, _ = lib.Get(ctx, still.ID)
+	assert.Empty(t, still.LiveVideo, "Still image should be unlinked from trashed video")
+	video, err = lib.Restore(ctx, video.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	still, _ = lib.Get(ctx, still.ID)
+	assert.Equal(t, video.ID, still.LiveVideo, "Restored video should be paired again")
+
+	if err := lib.Delete(ctx, video.ID); err != nil {
+		t.Fatal(err)
+	}
+	still, _ = lib.Get(ctx, still.ID)
+	assert.Empty(t, still.LiveVideo, "Still image should be unlinked from deleted video")
+}
@@ -1,11 +1,16 @@
 package library
 
 import (
+	"bytes"
 	"context"
+	"encoding/binary"
 	"io"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"bitbucket.org/kleinnic74/photos/domain"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -55,3 +60,95 @@ func TestMigrations(t *testing.T) {
 		assert.Equal(t, d.dst, result, "Photo #%d", i)
 	}
 }
+
+func TestAddDimensions(t *testing.T) {
+	content := func() (io.ReadCloser, error) {
+		return os.Open("../domain/testdata/orientation/portrait_3.jpg")
+	}
+	photo := Photo{PhotoMeta: PhotoMeta{Format: domain.MustFormatForExt("jpg"), Orientation: domain.Orientation(3)}}
+	result, err := addDimensions(context.Background(), photo, content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 450, result.Width)
+	assert.Equal(t, 600, result.Height)
+	assert.Equal(t, 0.75, result.AspectRatio())
+
+	// The orientation was changed in the library
+	photo.Orientation = domain.Orientation(6)
+	result, err = addDimensions(context.Background(), photo, content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 600, result.Width)
+	assert.Equal(t, 450, result.Height)
+}
+
+func TestAddTimeZoneSortsLikeImport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "photo.jpg")
+	if err := os.WriteFile(path, jpegWithCaptureTime(t, "2019:07:14 08:30:00", "+09:00"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	content := func() (io.ReadCloser, error) {
+		return os.Open(path)
+	}
+	// Imported before time zones were known, the capture time was read as local time of the server
+	taken := time.Date(2019, 7, 14, 8, 30, 0, 0, time.Local)
+	photo := Photo{
+		ExtendedPhotoID: ExtendedPhotoID{ID: "1234", SortID: orderedIDOf(taken.UTC(), "1234")},
+		Path:            filepath.Join(taken.Format("2006/01/02"), "1234.jpg"),
+		PhotoMeta:       PhotoMeta{Format: domain.MustFormatForExt("jpg"), DateTaken: taken},
+	}
+	result, err := addTimeZone(context.Background(), photo, content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.NotNil(t, result.TimeZoneOffset) {
+		assert.Equal(t, 9*3600, *result.TimeZoneOffset)
+	}
+	assert.True(t, result.DateTaken.Equal(time.Date(2019, 7, 13, 23, 30, 0, 0, time.UTC)))
+
+	imported := PhotoMeta{Name: "photo.jpg", Format: photo.Format, DateTaken: result.DateTaken, TimeZoneOffset: result.TimeZoneOffset}
+	targetDir, _, _ := canonicalizeFilename(imported)
+	assert.Equal(t, orderedIDOf(imported.DateTaken.UTC(), photo.ID), result.SortID)
+	assert.Equal(t, filepath.Join(targetDir, "1234.jpg"), result.Path)
+}
+
+// jpegWithCaptureTime returns a JPEG whose EXIF data only contains the given capture time and UTC offset
+func jpegWithCaptureTime(t *testing.T, taken, offset string) []byte {
+	image, err := os.ReadFile("../domain/testdata/orientation/portrait_1.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := [][]byte{[]byte(taken + "\x00"), []byte(offset + "\x00")}
+	var tiff bytes.Buffer
+	write := func(values ...interface{}) {
+		for _, v := range values {
+			binary.Write(&tiff, binary.LittleEndian, v)
+		}
+	}
+	tiff.WriteString("II*\x00")
+	write(uint32(8))
+	// IFD0 only points to the EXIF IFD which follows it
+	const exifOffset = 8 + 2 + 12 + 4
+	write(uint16(1), uint16(0x8769), uint16(4), uint32(1), uint32(exifOffset), uint32(0))
+	dataOffset := uint32(exifOffset + 2 + 12*len(values) + 4)
+	write(uint16(len(values)))
+	for i, tag := range []uint16{0x9003, 0x9011} {
+		write(tag, uint16(2), uint32(len(values[i])), dataOffset)
+		dataOffset += uint32(len(values[i]))
+	}
+	write(uint32(0))
+	tiff.Write(bytes.Join(values, nil))
+
+	var out bytes.Buffer
+	out.Write([]byte{0xFF, 0xD8, 0xFF, 0xE1})
+	binary.Write(&out, binary.BigEndian, uint16(2+6+tiff.Len()))
+	out.WriteString("Exif\x00\x00")
+	out.Write(tiff.Bytes())
+	if !bytes.HasPrefix(image, []byte{0xFF, 0xD8}) {
+		t.Fatal("Test image is not a JPEG")
+	}
+	out.Write(image[2:])
+	return out.Bytes()
+}
@@ -12,7 +12,7 @@ import (
 	"github.com/reusee/mmh3"
 )
 
-const currentSchema = 7
+const currentSchema = 12
 
 type PhotoMeta struct {
 	Name        string             `json:"name,omitempty"`
@@ -20,6 +20,33 @@ type PhotoMeta struct {
 	Format      domain.FormatSpec  `json:"format"`
 	DateTaken   time.Time          `json:"dateUN,omitempty"`
 	Location    *gps.Coordinates   `json:"gps,omitempty"`
+	Keywords    []string           `json:"keywords,omitempty"`
+	Rating      int                `json:"rating,omitempty"`
+	// Video is the technical meta-data of videos, nil for pictures
+	Video *domain.VideoMetaData `json:"video,omitempty"`
+	// Camera is the camera and settings used to take a picture, nil if unknown
+	Camera *domain.CameraMetaData `json:"camera,omitempty"`
+	// TimeZoneOffset is the UTC offset in seconds of the capture time, nil if unknown
+	TimeZoneOffset *int `json:"tzOffset,omitempty"`
+	// Width and Height are the pixel dimensions as displayed, with the orientation applied
+	Width  int `json:"width,omitempty"`
+	Height int `json:"height,omitempty"`
+}
+
+// MetaUpdate describes changes to the meta-data of a photo, nil fields are left unchanged
+type MetaUpdate struct {
+	DateTaken   *time.Time
+	Location    *gps.Coordinates
+	Orientation *domain.Orientation
+	Rating      *int
+	Favorite    *bool
+	Rejected    *bool
+}
+
+// IsEmpty returns true if this update does not change anything
+func (u MetaUpdate) IsEmpty() bool {
+	return u.DateTaken == nil && u.Location == nil && u.Orientation == nil &&
+		u.Rating == nil && u.Favorite == nil && u.Rejected == nil
 }
 
 type Photo struct {
@@ -30,6 +57,34 @@ type Photo struct {
 	Path   string     `json:"path,omitempty"`
 	Size   int64      `json:"size,omitempty"`
 	Hash   BinaryHash `json:"hash,omitempty"`
+
+	Favorite bool `json:"favorite,omitempty"`
+	Rejected bool `json:"rejected,omitempty"`
+
+	// LiveVideo is the companion video of a Live Photo still image
+	LiveVideo PhotoID `json:"liveVideo,omitempty"`
+	// LiveStill is the still image of a Live Photo companion video
+	LiveStill PhotoID `json:"liveStill,omitempty"`
+
+	TrashedAt time.Time `json:"trashed,omitempty"`
+}
+
+// LocalDateTaken returns the capture time in the time zone of the place where the photo was
+// taken, the capture time is returned unchanged if the time zone of the photo is unknown
+func (p PhotoMeta) LocalDateTaken() time.Time {
+	if p.TimeZoneOffset == nil {
+		return p.DateTaken
+	}
+	return p.DateTaken.In(time.FixedZone("", *p.TimeZoneOffset))
+}
+
+// AspectRatio returns the ratio of the width to the height of the photo as displayed, 0 if
+// the dimensions are unknown
+func (p PhotoMeta) AspectRatio() float64 {
+	if p.Width == 0 || p.Height == 0 {
+		return 0
+	}
+	return float64(p.Width) / float64(p.Height)
 }
 
 func (p *Photo) Name() string {
@@ -40,28 +95,67 @@ func (p *Photo) HasHash() bool {
 	return len(p.Hash) > 0
 }
 
+// IsLiveCompanion returns true if this is the video of a Live Photo, which is only shown
+// together with its still image
+func (p *Photo) IsLiveCompanion() bool {
+	return p.LiveStill != ""
+}
+
+// IsTrashed returns true if this photo has been moved to the trash
+func (p *Photo) IsTrashed() bool {
+	return !p.TrashedAt.IsZero()
+}
+
 func (p *Photo) MarshalJSON() ([]byte, error) {
 	out := struct {
 		ExtendedPhotoID
-		Schema      Version            `json:"schema"`
-		Store       LibraryID          `json:"store,omitempty"`
-		Path        string             `json:"path,omitempty"`
-		Format      string             `json:"format"`
-		Size        int                `json:"size,omitempty"`
-		DateTaken   int64              `json:"dateUN"`
-		Location    *gps.Coordinates   `json:"gps,omitempty"`
-		Orientation domain.Orientation `json:"or,omitempty"`
-		Hash        BinaryHash         `json:"hash,omitempty"`
+		Schema      Version                `json:"schema"`
+		Store       LibraryID              `json:"store,omitempty"`
+		Path        string                 `json:"path,omitempty"`
+		Name        string                 `json:"name,omitempty"`
+		Format      string                 `json:"format"`
+		Size        int                    `json:"size,omitempty"`
+		DateTaken   int64                  `json:"dateUN"`
+		TZOffset    *int                   `json:"tzOffset,omitempty"`
+		Location    *gps.Coordinates       `json:"gps,omitempty"`
+		Orientation domain.Orientation     `json:"or,omitempty"`
+		Hash        BinaryHash             `json:"hash,omitempty"`
+		Keywords    []string               `json:"keywords,omitempty"`
+		Rating      int                    `json:"rating,omitempty"`
+		Video       *domain.VideoMetaData  `json:"video,omitempty"`
+		Camera      *domain.CameraMetaData `json:"camera,omitempty"`
+		Width       int                    `json:"width,omitempty"`
+		Height      int                    `json:"height,omitempty"`
+		Favorite    bool                   `json:"favorite,omitempty"`
+		Rejected    bool                   `json:"rejected,omitempty"`
+		LiveVideo   PhotoID                `json:"liveVideo,omitempty"`
+		LiveStill   PhotoID                `json:"liveStill,omitempty"`
+		Trashed     int64                  `json:"trashed,omitempty"`
 	}{
 		Schema:          currentSchema,
 		ExtendedPhotoID: p.ExtendedPhotoID,
 		Store:           p.Store,
 		Path:            p.Path,
+		Name:            p.PhotoMeta.Name,
 		Format:          p.Format.ID(),
 		DateTaken:       p.DateTaken.UnixNano(),
+		TZOffset:        p.TimeZoneOffset,
 		Location:        p.Location,
 		Orientation:     p.Orientation,
 		Hash:            p.Hash,
+		Keywords:        p.Keywords,
+		Rating:          p.Rating,
+		Video:           p.Video,
+		Camera:          p.Camera,
+		Width:           p.Width,
+		Height:          p.Height,
+		Favorite:        p.Favorite,
+		Rejected:        p.Rejected,
+		LiveVideo:       p.LiveVideo,
+		LiveStill:       p.LiveStill,
+	}
+	if p.IsTrashed() {
+		out.Trashed = p.TrashedAt.UnixNano()
 	}
 	return json.Marshal(&out)
 }
@@ -70,15 +164,28 @@ func (p *Photo) UnmarshalJSON(buf []byte) error {
 	// TODO get rid of this, format should be marshallabled to string
 	var data struct {
 		ExtendedPhotoID
-		Schema      Version            `json:"schema"`
-		Store       LibraryID          `json:"store,omitempty"`
-		Path        string             `json:"path"`
-		Format      domain.FormatSpec  `json:"format"`
-		Size        int                `json:"size"`
-		DateTaken   int64              `json:"dateUN"`
-		Location    *gps.Coordinates   `json:"gps"`
-		Orientation domain.Orientation `json:"or,omitempty"`
-		Hash        BinaryHash         `json:"hash,omitempty"`
+		Schema      Version                `json:"schema"`
+		Store       LibraryID              `json:"store,omitempty"`
+		Path        string                 `json:"path"`
+		Name        string                 `json:"name,omitempty"`
+		Format      domain.FormatSpec      `json:"format"`
+		Size        int                    `json:"size"`
+		DateTaken   int64                  `json:"dateUN"`
+		TZOffset    *int                   `json:"tzOffset,omitempty"`
+		Location    *gps.Coordinates       `json:"gps"`
+		Orientation domain.Orientation     `json:"or,omitempty"`
+		Hash        BinaryHash             `json:"hash,omitempty"`
+		Keywords    []string               `json:"keywords,omitempty"`
+		Rating      int                    `json:"rating,omitempty"`
+		Video       *domain.VideoMetaData  `json:"video,omitempty"`
+		Camera      *domain.CameraMetaData `json:"camera,omitempty"`
+		Width       int                    `json:"width,omitempty"`
+		Height      int                    `json:"height,omitempty"`
+		Favorite    bool                   `json:"favorite,omitempty"`
+		Rejected    bool                   `json:"rejected,omitempty"`
+		LiveVideo   PhotoID                `json:"liveVideo,omitempty"`
+		LiveStill   PhotoID                `json:"liveStill,omitempty"`
+		Trashed     int64                  `json:"trashed,omitempty"`
 	}
 	err := json.Unmarshal(buf, &data)
 	if err != nil {
@@ -88,12 +195,29 @@ func (p *Photo) UnmarshalJSON(buf []byte) error {
 	p.Store = data.Store
 	p.Format = data.Format
 	p.Path = data.Path
+	p.PhotoMeta.Name = data.Name
 	if data.DateTaken != 0 {
 		p.DateTaken = time.Unix(data.DateTaken/1e9, data.DateTaken%1e9).In(time.UTC)
 	}
+	p.TimeZoneOffset = data.TZOffset
+	if p.TimeZoneOffset != nil {
+		p.DateTaken = p.LocalDateTaken()
+	}
 	p.Location = data.Location
 	p.Orientation = data.Orientation
 	p.Hash = data.Hash
+	p.Keywords = data.Keywords
+	p.Rating = data.Rating
+	p.Video = data.Video
+	p.Camera = data.Camera
+	p.Width, p.Height = data.Width, data.Height
+	p.Favorite = data.Favorite
+	p.Rejected = data.Rejected
+	p.LiveVideo = data.LiveVideo
+	p.LiveStill = data.LiveStill
+	if data.Trashed != 0 {
+		p.TrashedAt = time.Unix(data.Trashed/1e9, data.Trashed%1e9).In(time.UTC)
+	}
 	p.schema = data.Schema
 	return nil
 }
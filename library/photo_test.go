@@ -15,15 +15,44 @@ var photoData = []struct {
 	json  string
 	photo Photo
 }{
-	{fmt.Sprintf(`{"id":"123","sortId":"AQIDBA==","schema":%d,"format":"jpg","dateUN":1573148532000000000,"or":4}`, currentSchema),
+	{fmt.Sprintf(`{"id":"123","sortId":"AQIDBA==","schema":%d,"name":"IMG_0001.JPG","format":"jpg","dateUN":1573148532000000000,"or":4}`, currentSchema),
 		Photo{schema: currentSchema,
 			ExtendedPhotoID: ExtendedPhotoID{ID: "123", SortID: []byte{1, 2, 3, 4}},
 			PhotoMeta: PhotoMeta{
+				Name:        "IMG_0001.JPG",
 				Orientation: 4,
 				Format:      domain.MustFormatForExt("jpg"),
 				DateTaken:   time.Date(2019, 11, 07, 17, 42, 12, 0, time.UTC),
 			},
 		}},
+	{fmt.Sprintf(`{"id":"456","schema":%d,"format":"mp4","dateUN":1573148532000000000,"video":{"duration":12500000000,"width":1920,"height":1080,"codec":"avc1","rotation":90}}`, currentSchema),
+		Photo{schema: currentSchema,
+			ExtendedPhotoID: ExtendedPhotoID{ID: "456"},
+			PhotoMeta: PhotoMeta{
+				Format:    domain.MustFormatForExt("mp4"),
+				DateTaken: time.Date(2019, 11, 07, 17, 42, 12, 0, time.UTC),
+				Video: &domain.VideoMetaData{
+					Duration: 12500 * time.Millisecond,
+					Width:    1920,
+					Height:   1080,
+					Codec:    "avc1",
+					Rotation: 90,
+				},
+			},
+		}},
+	{fmt.Sprintf(`{"id":"789","schema":%d,"format":"jpg","dateUN":1573148532000000000,"tzOffset":-18000}`, currentSchema),
+		Photo{schema: currentSchema,
+			ExtendedPhotoID: ExtendedPhotoID{ID: "789"},
+			PhotoMeta: PhotoMeta{
+				Format:         domain.MustFormatForExt("jpg"),
+				DateTaken:      time.Date(2019, 11, 07, 12, 42, 12, 0, time.FixedZone("", -18000)),
+				TimeZoneOffset: intPtr(-18000),
+			},
+		}},
+}
+
+func intPtr(v int) *int {
+	return &v
 }
 
 func TestPhotoJSONUnmarshal(t *testing.T) {
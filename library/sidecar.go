@@ -0,0 +1,81 @@
+package library
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"bitbucket.org/kleinnic74/photos/domain/formats"
+	"bitbucket.org/kleinnic74/photos/logging"
+	"go.uber.org/zap"
+)
+
+// sidecarExt is the extension of XMP sidecar files
+const sidecarExt = ".xmp"
+
+// SidecarPath returns the path of the XMP sidecar of the photo file with the given path. The
+// sidecar keeps the extension of the photo like darktable does, so that the sidecars of a
+// photo and a video with the same base name do not collide
+func SidecarPath(path string) string {
+	return path + sidecarExt
+}
+
+// XMPOf returns the meta-data of the given photo to be written to an XMP sidecar, keywords
+// are the current tags of the photo
+func XMPOf(photo *Photo, keywords []string) *formats.XMP {
+	x := &formats.XMP{
+		Rating:      photo.Rating,
+		Keywords:    keywords,
+		DateTaken:   photo.DateTaken,
+		Location:    photo.Location,
+		Orientation: int(photo.Orientation),
+	}
+	if photo.Rejected {
+		x.Rating = formats.RatingRejected
+	}
+	return x
+}
+
+// WriteSidecar writes an XMP sidecar with the meta-data of the given photo next to its file
+// in the library, an existing sidecar is replaced
+func (lib *BasicPhotoLibrary) WriteSidecar(ctx context.Context, id PhotoID, keywords []string) error {
+	photo, err := lib.db.Get(id)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(lib.photodir, SidecarPath(photo.Path))
+	tmp := path + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := XMPOf(photo, keywords).Write(out); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	logging.From(ctx).Debug("Wrote sidecar", zap.String("photo", string(id)), zap.String("path", path))
+	return nil
+}
+
+// moveSidecar moves the sidecar of a photo file along with the file, photos without sidecar
+// are ignored
+func (lib *BasicPhotoLibrary) moveSidecar(ctx context.Context, from, to string) {
+	if err := os.Rename(SidecarPath(from), SidecarPath(to)); err != nil && !os.IsNotExist(err) {
+		logging.From(ctx).Warn("Failed to move sidecar", zap.String("from", from), zap.String("to", to), zap.Error(err))
+	}
+}
+
+// deleteSidecar removes the sidecar of the given photo file if it exists
+func (lib *BasicPhotoLibrary) deleteSidecar(ctx context.Context, path string) {
+	if err := os.Remove(SidecarPath(path)); err != nil && !os.IsNotExist(err) {
+		logging.From(ctx).Warn("Failed to delete sidecar", zap.String("path", path), zap.Error(err))
+	}
+}
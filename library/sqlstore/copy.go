@@ -0,0 +1,153 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"bitbucket.org/kleinnic74/photos/consts"
+	"bitbucket.org/kleinnic74/photos/index"
+	"bitbucket.org/kleinnic74/photos/library"
+	"bitbucket.org/kleinnic74/photos/logging"
+	"bitbucket.org/kleinnic74/photos/tasks"
+	"go.uber.org/zap"
+)
+
+// Source is the meta-data of a library stored by another backend, dates are not needed as
+// the date index is rebuilt from the photos
+type Source struct {
+	Store   library.Store
+	Geo     library.GeoIndex
+	Tracker index.Tracker
+}
+
+// Copier copies the meta-data of a library into a SQL database, so that an existing
+// library can switch backends without indexing all photos again
+type Copier struct {
+	from Source
+	db   *sql.DB
+}
+
+func NewCopier(from Source, db *sql.DB) *Copier {
+	return &Copier{from: from, db: db}
+}
+
+// RegisterTasks defines the user-runnable task copying the library
+func (c *Copier) RegisterTasks(repo *tasks.TaskRepository) {
+	repo.RegisterWithProperties("copyToSQL", func() tasks.Task {
+		return &copyTask{copier: c}
+	}, tasks.TaskProperties{
+		UserRunnable: true,
+	})
+}
+
+// Copy copies all photos, trashed ones included, with their place and indexing state. Photos
+// already in the database are overwritten so that copying can be repeated
+func (c *Copier) Copy(ctx context.Context, progress func(done, total int)) error {
+	logger, ctx := logging.SubFrom(ctx, "copyToSQL")
+	photos, err := c.from.Store.FindAll(consts.Ascending)
+	if err != nil {
+		return err
+	}
+	trashed, err := c.from.Store.FindTrashed()
+	if err != nil {
+		return err
+	}
+	dates, err := NewDateIndex(c.db)
+	if err != nil {
+		return err
+	}
+	geo, err := NewSQLGeoIndex(c.db)
+	if err != nil {
+		return err
+	}
+	if _, err := NewSQLStore(c.db); err != nil {
+		return err
+	}
+	if _, err := NewIndexTracker(c.db); err != nil {
+		return err
+	}
+	total := len(photos) + len(trashed)
+	for i, p := range append(photos, trashed...) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := c.copyPhoto(ctx, p, dates, geo); err != nil {
+			logger.Error("Failed to copy photo", zap.String("photo", string(p.ID)), zap.Error(err))
+			return err
+		}
+		progress(i+1, total)
+	}
+	logger.Info("Library copied", zap.Int("photos", len(photos)), zap.Int("trashed", len(trashed)))
+	return nil
+}
+
+func (c *Copier) copyPhoto(ctx context.Context, p *library.Photo, dates *DateIndex, geo library.GeoIndex) error {
+	state, indexed, err := c.from.Tracker.Get(p.ID)
+	if err != nil {
+		return err
+	}
+	if err := inTx(c.db, func(tx *sql.Tx) error {
+		if err := putPhoto(tx, p); err != nil {
+			return err
+		}
+		if !indexed {
+			return nil
+		}
+		return putState(tx, p.ID, state)
+	}); err != nil {
+		return err
+	}
+	if !p.IsTrashed() {
+		if err := dates.Add(ctx, p); err != nil {
+			return err
+		}
+	}
+	address, found, err := c.from.Geo.Get(ctx, p.ID)
+	if err != nil || !found {
+		return err
+	}
+	return geo.Update(ctx, p.ExtendedPhotoID, address)
+}
+
+// putPhoto stores the given photo in the photos or in the trash table depending on whether
+// it is trashed, replacing it in both tables
+func putPhoto(tx *sql.Tx, p *library.Photo) error {
+	encoded, err := p.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	for _, table := range []string{"photos", "trash"} {
+		if _, err := tx.Exec(`DELETE FROM `+table+` WHERE id = ?`, string(p.ID)); err != nil {
+			return err
+		}
+	}
+	table := "photos"
+	if p.IsTrashed() {
+		table = "trash"
+	}
+	if _, err := tx.Exec(`INSERT INTO `+table+` (id, sort_id, data) VALUES (?, ?, ?)`, string(p.ID), []byte(p.SortID), string(encoded)); err != nil {
+		return err
+	}
+	return putHash(tx, p)
+}
+
+type copyTask struct {
+	copier *Copier
+
+	done, count int
+}
+
+func (t *copyTask) Describe() string {
+	if t.count == 0 {
+		return "Copying library into SQL database"
+	}
+	return fmt.Sprintf("Copying library into SQL database (%d of %d done)", t.done, t.count)
+}
+
+func (t *copyTask) Execute(ctx context.Context, executor tasks.TaskExecutor, lib library.PhotoLibrary) error {
+	return t.copier.Copy(ctx, func(done, total int) {
+		t.done = done
+		t.count = total
+	})
+}
@@ -0,0 +1,104 @@
+package sqlstore
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"bitbucket.org/kleinnic74/photos/consts"
+	"bitbucket.org/kleinnic74/photos/domain/gps"
+	"bitbucket.org/kleinnic74/photos/index"
+	"bitbucket.org/kleinnic74/photos/library"
+	"bitbucket.org/kleinnic74/photos/library/boltstore"
+	"bitbucket.org/kleinnic74/photos/library/storetest"
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestCopy(t *testing.T) {
+	ctx := context.Background()
+	boltDB, err := bolt.Open(filepath.Join(t.TempDir(), "photos.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer boltDB.Close()
+	from := boltSource(t, boltDB)
+	photos := []*library.Photo{storetest.PhotoTakenAt("2020-04-12T12:00:00Z"), storetest.PhotoTakenAt("2020-04-13T12:00:00Z")}
+	photos[1].Hash = library.BinaryHash("1234")
+	for _, p := range photos {
+		if err := from.Store.Add(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	photos[1].TrashedAt = time.Now().UTC()
+	if err := from.Store.Trash(photos[1]); err != nil {
+		t.Fatal(err)
+	}
+	berlin := gps.AsAddress("Deutschland", "DE", "Berlin", "10115")
+	if err := from.Geo.Update(ctx, photos[0].ExtendedPhotoID, &berlin); err != nil {
+		t.Fatal(err)
+	}
+	from.Tracker.RegisterIndex("geo", GeoIndexVersion)
+	if err := from.Tracker.Update("geo", photos[0].ID, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	db := openTestDB(t)
+	var done, total int
+	copier := NewCopier(from, db)
+	for i := 0; i < 2; i++ {
+		if err := copier.Copy(ctx, func(d, t int) { done, total = d, t }); err != nil {
+			t.Fatalf("#%d: failed to copy library: %s", i, err)
+		}
+	}
+	assert.Equal(t, 2, done)
+	assert.Equal(t, 2, total)
+
+	store, _ := NewSQLStore(db)
+	all, err := store.FindAll(consts.Ascending)
+	assert.NoError(t, err)
+	if assert.Len(t, all, 1, "Copying twice does not duplicate photos") {
+		assert.Equal(t, photos[0].ID, all[0].ID)
+	}
+	trashed, err := store.FindTrashed()
+	assert.NoError(t, err)
+	if assert.Len(t, trashed, 1) {
+		assert.Equal(t, photos[1].ID, trashed[0].ID)
+	}
+	owner, _ := store.Exists(photos[1].Hash)
+	assert.Equal(t, photos[1].ID, owner, "Hashes are copied")
+
+	dates, _ := NewDateIndex(db)
+	ids, _, err := dates.FindRangePaged(ctx, photos[0].DateTaken, photos[1].DateTaken, 0, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []library.PhotoID{photos[0].ID}, ids, "Date index is rebuilt without trashed photos")
+
+	geo, _ := NewSQLGeoIndex(db)
+	address, found, err := geo.Get(ctx, photos[0].ID)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, &berlin, address)
+
+	tracker, _ := NewIndexTracker(db)
+	state, found, err := tracker.Get(photos[0].ID)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, index.IndexStatus{Status: index.Indexed, Version: GeoIndexVersion}, state.StatusFor("geo"))
+}
+
+func boltSource(t *testing.T, db *bolt.DB) Source {
+	store, err := boltstore.NewBoltStore(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	geo, err := boltstore.NewBoltGeoIndex(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracker, err := boltstore.NewIndexTracker(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Source{Store: store, Geo: geo, Tracker: tracker}
+}
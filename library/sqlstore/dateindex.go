@@ -0,0 +1,124 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"bitbucket.org/kleinnic74/photos/library"
+	"bitbucket.org/kleinnic74/photos/logging"
+	"go.uber.org/zap"
+)
+
+// DateIndexVersion is the same as the one of the bolt date index, so that the indexing
+// state of photos stays valid when a library is copied from bolt
+const DateIndexVersion = library.Version(4)
+
+const dateFormat = "2006-01-02"
+
+// DateIndex indexes photos by date
+type DateIndex struct {
+	db *sql.DB
+}
+
+// NewDateIndex returns a DateIndex stored in the given database. If the needed tables
+// do not exist, they will be created
+func NewDateIndex(db *sql.DB) (*DateIndex, error) {
+	if err := createTables(db,
+		`CREATE TABLE IF NOT EXISTS photo_days (
+			day TEXT NOT NULL,
+			sort_id BLOB NOT NULL,
+			photo TEXT NOT NULL,
+			PRIMARY KEY (day, sort_id)
+		)`,
+	); err != nil {
+		return nil, err
+	}
+	return &DateIndex{db: db}, nil
+}
+
+// MigrateStructure has nothing to migrate yet, the table was created in its current form
+func (d *DateIndex) MigrateStructure(ctx context.Context, from library.Version) (library.Version, bool, error) {
+	return DateIndexVersion, false, nil
+}
+
+// Add will add the given photo to this date index based on its taken time, videos of
+// Live Photos are not added as they are shown with their still image
+func (d *DateIndex) Add(ctx context.Context, photo *library.Photo) error {
+	if photo.SortID == nil {
+		return library.MissingSortID
+	}
+	if photo.IsLiveCompanion() {
+		return nil
+	}
+	key := d.dayKey(photo.LocalDateTaken())
+	_, err := d.db.Exec(`INSERT OR REPLACE INTO photo_days (day, sort_id, photo) VALUES (?, ?, ?)`, key, []byte(photo.SortID), string(photo.ID))
+	if err != nil {
+		log, _ := logging.FromWithNameAndFields(ctx, "sqldateindex")
+		log.Warn("Failed to add photo", zap.String("day", key), zap.Error(err))
+	}
+	return err
+}
+
+// Remove deletes the given photo from this date index
+func (d *DateIndex) Remove(ctx context.Context, photo *library.Photo) error {
+	if photo.SortID == nil {
+		return library.MissingSortID
+	}
+	_, err := d.db.Exec(`DELETE FROM photo_days WHERE day = ? AND sort_id = ?`, d.dayKey(photo.LocalDateTaken()), []byte(photo.SortID))
+	return err
+}
+
+// FindRangePaged returns the photos taken on the days of the given date range
+func (d *DateIndex) FindRangePaged(ctx context.Context, from, to time.Time, start, maxCount int) ([]library.PhotoID, bool, error) {
+	return findPhotoIDs(d.db, maxCount, `SELECT photo FROM photo_days WHERE day >= ? AND day <= ? ORDER BY day, sort_id LIMIT ? OFFSET ?`,
+		d.dayKey(from), d.dayKey(to), maxCount+1, start)
+}
+
+// Keys returns the timeline of indexed photos
+func (d *DateIndex) Keys(ctx context.Context) (timeline library.Timeline, err error) {
+	days, err := d.days()
+	for _, day := range days {
+		t, err := time.Parse(dateFormat, day)
+		if err != nil {
+			return timeline, err
+		}
+		timeline.Add(t, day)
+	}
+	return
+}
+
+// FindDates returns the days for which photos have been indexed
+func (d *DateIndex) FindDates(ctx context.Context) (dates []time.Time, err error) {
+	log := logging.From(ctx)
+	days, err := d.days()
+	for _, day := range days {
+		t, err := time.Parse(dateFormat, day)
+		if err != nil {
+			log.Warn("Bad date in index", zap.String("key", day), zap.Error(err))
+			continue
+		}
+		dates = append(dates, t)
+	}
+	return
+}
+
+func (d *DateIndex) days() (days []string, err error) {
+	rows, err := d.db.Query(`SELECT DISTINCT day FROM photo_days ORDER BY day`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var day string
+		if err := rows.Scan(&day); err != nil {
+			return nil, err
+		}
+		days = append(days, day)
+	}
+	return days, rows.Err()
+}
+
+func (d *DateIndex) dayKey(t time.Time) string {
+	return t.Format(dateFormat)
+}
@@ -0,0 +1,188 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"bitbucket.org/kleinnic74/photos/domain/gps"
+	"bitbucket.org/kleinnic74/photos/library"
+	"bitbucket.org/kleinnic74/photos/logging"
+	"go.uber.org/zap"
+)
+
+// GeoIndexVersion is the same as the one of the bolt geo index, so that the indexing
+// state of photos stays valid when a library is copied from bolt
+const GeoIndexVersion = library.Version(11)
+
+type sqlGeoIndex struct {
+	db *sql.DB
+}
+
+// NewSQLGeoIndex returns a geo index stored in the given database, the needed tables are
+// created if they do not exist yet
+func NewSQLGeoIndex(db *sql.DB) (library.GeoIndex, error) {
+	if err := createTables(db,
+		`CREATE TABLE IF NOT EXISTS countries (
+			id TEXT PRIMARY KEY,
+			data TEXT NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS places (
+			id TEXT PRIMARY KEY,
+			country TEXT NOT NULL,
+			data TEXT NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS photo_places (
+			photo TEXT PRIMARY KEY,
+			sort_id BLOB NOT NULL,
+			place TEXT NOT NULL,
+			data TEXT NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS photo_places_by_place ON photo_places (place, sort_id)`,
+	); err != nil {
+		return nil, err
+	}
+	return &sqlGeoIndex{db: db}, nil
+}
+
+// MigrateStructure has nothing to migrate yet, the tables were created in their current form
+func (idx *sqlGeoIndex) MigrateStructure(ctx context.Context, from library.Version) (library.Version, bool, error) {
+	return GeoIndexVersion, false, nil
+}
+
+func (idx *sqlGeoIndex) Has(ctx context.Context, id library.PhotoID) bool {
+	var count int
+	if err := idx.db.QueryRow(`SELECT count(*) FROM photo_places WHERE photo = ?`, string(id)).Scan(&count); err != nil {
+		logger, _ := logging.FromWithNameAndFields(ctx, "geoStore")
+		logger.Warn("SQL error", zap.String("photo", string(id)), zap.Error(err))
+	}
+	return count > 0
+}
+
+func (idx *sqlGeoIndex) Get(ctx context.Context, id library.PhotoID) (*gps.Address, bool, error) {
+	var data string
+	err := idx.db.QueryRow(`SELECT data FROM photo_places WHERE photo = ?`, string(id)).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	} else if err != nil {
+		logger, _ := logging.FromWithNameAndFields(ctx, "geoStore")
+		logger.Warn("SQL error", zap.String("photo", string(id)), zap.Error(err))
+		return nil, false, err
+	}
+	address := new(gps.Address)
+	if err := json.Unmarshal([]byte(data), address); err != nil {
+		return nil, false, err
+	}
+	return address, true, nil
+}
+
+func (idx *sqlGeoIndex) Update(ctx context.Context, id library.ExtendedPhotoID, address *gps.Address) error {
+	if address == nil {
+		return nil
+	}
+	encodedAddress, err := json.Marshal(address)
+	if err != nil {
+		return err
+	}
+	encodedCountry, err := json.Marshal(&address.Country)
+	if err != nil {
+		return err
+	}
+	return inTx(idx.db, func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`INSERT OR REPLACE INTO countries (id, data) VALUES (?, ?)`, string(address.Country.ID), string(encodedCountry)); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`INSERT OR REPLACE INTO places (id, country, data) VALUES (?, ?, ?)`, string(address.ID), string(address.Country.ID), string(encodedAddress)); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`INSERT OR REPLACE INTO photo_places (photo, sort_id, place, data) VALUES (?, ?, ?, ?)`,
+			string(id.ID), []byte(id.SortID), string(address.ID), string(encodedAddress))
+		return err
+	})
+}
+
+// Remove deletes the given photo from this geo index, known places and countries are kept
+func (idx *sqlGeoIndex) Remove(ctx context.Context, id library.ExtendedPhotoID) error {
+	_, err := idx.db.Exec(`DELETE FROM photo_places WHERE photo = ?`, string(id.ID))
+	return err
+}
+
+func (idx *sqlGeoIndex) Locations(ctx context.Context) (*library.Locations, error) {
+	var locations library.Locations
+	byCountry := make(map[gps.CountryID]*library.CountryAndPlaces)
+	rows, err := idx.db.Query(`SELECT data FROM countries ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var countryAndPlaces library.CountryAndPlaces
+		if err := json.Unmarshal([]byte(data), &countryAndPlaces.Country); err != nil {
+			return nil, err
+		}
+		byCountry[countryAndPlaces.ID] = &countryAndPlaces
+		locations.Countries = append(locations.Countries, &countryAndPlaces)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	places, err := idx.db.Query(`SELECT data FROM places ORDER BY country, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer places.Close()
+	for places.Next() {
+		var data string
+		if err := places.Scan(&data); err != nil {
+			return nil, err
+		}
+		var address gps.Address
+		if err := json.Unmarshal([]byte(data), &address); err != nil {
+			return nil, err
+		}
+		if country, found := byCountry[address.Country.ID]; found {
+			country.Places = append(country.Places, &address)
+		}
+	}
+	return &locations, places.Err()
+}
+
+func (idx *sqlGeoIndex) FindByPlacePaged(ctx context.Context, placeID gps.PlaceID, startAt int, maxCount int) ([]library.PhotoID, bool, error) {
+	return findPhotoIDs(idx.db, maxCount, `SELECT photo FROM photo_places WHERE place = ? ORDER BY sort_id LIMIT ? OFFSET ?`,
+		string(placeID), maxCount+1, startAt)
+}
+
+func (idx *sqlGeoIndex) FindByCountryPaged(ctx context.Context, country gps.CountryID, startAt int, maxCount int) ([]library.PhotoID, bool, error) {
+	// Place IDs start with the country code followed by an underscore
+	prefix := fmt.Sprintf("%s_", country)
+	return findPhotoIDs(idx.db, maxCount, `SELECT photo FROM photo_places WHERE substr(place, 1, ?) = ? ORDER BY place, sort_id LIMIT ? OFFSET ?`,
+		len(prefix), prefix, maxCount+1, startAt)
+}
+
+// findPhotoIDs returns the IDs selected by the given query which must fetch one more row than
+// maxCount to tell whether there are more
+func findPhotoIDs(db *sql.DB, maxCount int, query string, args ...interface{}) (ids []library.PhotoID, hasMore bool, err error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id library.PhotoID
+		if err := rows.Scan(&id); err != nil {
+			return nil, false, err
+		}
+		if len(ids) == maxCount {
+			hasMore = true
+			break
+		}
+		ids = append(ids, id)
+	}
+	return ids, hasMore, rows.Err()
+}
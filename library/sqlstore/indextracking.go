@@ -0,0 +1,122 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"bitbucket.org/kleinnic74/photos/index"
+	"bitbucket.org/kleinnic74/photos/library"
+	"bitbucket.org/kleinnic74/photos/logging"
+	"go.uber.org/zap"
+)
+
+type indexTracker struct {
+	db      *sql.DB
+	indexes map[index.Name]library.Version
+}
+
+// NewIndexTracker returns a new index tracker using the given database. The needed
+// tables are created if not yet available.
+func NewIndexTracker(db *sql.DB) (index.Tracker, error) {
+	if err := createTables(db,
+		`CREATE TABLE IF NOT EXISTS index_states (
+			photo TEXT PRIMARY KEY,
+			state TEXT NOT NULL
+		)`,
+	); err != nil {
+		return nil, err
+	}
+	return &indexTracker{db: db, indexes: make(map[index.Name]library.Version)}, nil
+}
+
+func (tracker *indexTracker) RegisterIndex(index index.Name, version library.Version) {
+	tracker.indexes[index] = version
+}
+
+func (tracker *indexTracker) Update(name index.Name, id library.PhotoID, err error) error {
+	var status index.Status
+	if err != nil {
+		status = index.ErrorOnIndex
+	} else {
+		status = index.Indexed
+	}
+	version := tracker.indexes[name]
+	return inTx(tracker.db, func(tx *sql.Tx) error {
+		state, _, err := getState(tx, id)
+		if err != nil {
+			return err
+		}
+		state.Set(name, status, version)
+		return putState(tx, id, state)
+	})
+}
+
+// Remove drops the indexing state of the given photo
+func (tracker *indexTracker) Remove(id library.PhotoID) error {
+	_, err := tracker.db.Exec(`DELETE FROM index_states WHERE photo = ?`, string(id))
+	return err
+}
+
+func (tracker *indexTracker) Get(id library.PhotoID) (index.State, bool, error) {
+	return getState(tracker.db, id)
+}
+
+func (tracker *indexTracker) GetMissingIndexes(id library.PhotoID) (missing []index.Name, err error) {
+	state, _, err := getState(tracker.db, id)
+	if err != nil {
+		return nil, err
+	}
+	for k, version := range tracker.indexes {
+		notIndexed := state.StatusFor(k).Status == index.NotIndexed
+		outdated := state.StatusFor(k).Version < version
+		if notIndexed || outdated {
+			missing = append(missing, k)
+		}
+	}
+	return
+}
+
+func (tracker *indexTracker) GetElementStatus(ctx context.Context) (state []index.ElementState, err error) {
+	log, ctx := logging.SubFrom(ctx, "indexTracker")
+	rows, err := tracker.db.Query(`SELECT photo, state FROM index_states ORDER BY photo`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id library.PhotoID
+		var data string
+		if err := rows.Scan(&id, &data); err != nil {
+			return nil, err
+		}
+		indexingStatus := index.NewState()
+		if err := json.Unmarshal([]byte(data), &indexingStatus); err != nil {
+			log.Warn("Failed to JSON decode index status", zap.String("photo", string(id)), zap.Error(err))
+			continue
+		}
+		state = append(state, index.ElementState{ID: id, State: indexingStatus})
+	}
+	return state, rows.Err()
+}
+
+func getState(q queryer, id library.PhotoID) (index.State, bool, error) {
+	state := index.NewState()
+	var data string
+	err := q.QueryRow(`SELECT state FROM index_states WHERE photo = ?`, string(id)).Scan(&data)
+	if err == sql.ErrNoRows {
+		return state, false, nil
+	} else if err != nil {
+		return state, false, err
+	}
+	return state, true, json.Unmarshal([]byte(data), &state)
+}
+
+func putState(tx *sql.Tx, id library.PhotoID, state index.State) error {
+	encoded, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT OR REPLACE INTO index_states (photo, state) VALUES (?, ?)`, string(id), string(encoded))
+	return err
+}
@@ -0,0 +1,330 @@
+// Package sqlstore is an implementation of a library meta-data index
+// using an embedded SQLite database for storing data persistently
+package sqlstore
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"bitbucket.org/kleinnic74/photos/consts"
+	"bitbucket.org/kleinnic74/photos/library"
+
+	// Registers the pure-Go SQLite driver
+	_ "modernc.org/sqlite"
+)
+
+// Open opens the SQLite database at the given path, the file is created if it does not
+// exist yet. Transactions lock the database immediately so that concurrent writers wait
+// for each other instead of failing
+func Open(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(10000)&_pragma=journal_mode(WAL)&_txlock=immediate")
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// SQLStore uses a SQL database as the storage implementation to store data about photos
+type SQLStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore creates a new SQLStore in the given database, the needed tables are
+// created if they do not exist yet
+func NewSQLStore(db *sql.DB) (library.ClosableStore, error) {
+	if err := createTables(db,
+		`CREATE TABLE IF NOT EXISTS photos (
+			id TEXT PRIMARY KEY,
+			sort_id BLOB NOT NULL UNIQUE,
+			data TEXT NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS trash (
+			id TEXT PRIMARY KEY,
+			sort_id BLOB NOT NULL,
+			data TEXT NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS photo_hashes (
+			hash TEXT PRIMARY KEY,
+			photo TEXT NOT NULL
+		)`,
+	); err != nil {
+		return nil, err
+	}
+	return &SQLStore{db: db}, nil
+}
+
+func createTables(db *sql.DB, statements ...string) error {
+	return inTx(db, func(tx *sql.Tx) error {
+		for _, stmt := range statements {
+			if _, err := tx.Exec(stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// inTx runs f in a transaction which is committed if f does not return an error
+func inTx(db *sql.DB, f func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := f(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Close closes this store, the database is left open as it is shared with the indexes
+func (store *SQLStore) Close() {
+}
+
+// Exists checks if a photo with the given hash exists in this store, trashed photos included
+func (store *SQLStore) Exists(hash library.BinaryHash) (other library.PhotoID, exists bool) {
+	err := store.db.QueryRow(`SELECT photo FROM photo_hashes WHERE hash = ?`, hash.String()).Scan(&other)
+	return other, err == nil
+}
+
+// Add adds the given photo to this store
+func (store *SQLStore) Add(p *library.Photo) error {
+	// Sanity check
+	if p.ID == "" {
+		panic(fmt.Errorf("Photo %v has no ID", p))
+	}
+	if len(p.SortID) == 0 {
+		panic(fmt.Errorf("Photo %s has no SortID", p.ID))
+	}
+
+	encoded, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return inTx(store.db, func(tx *sql.Tx) error {
+		var existing int
+		err := tx.QueryRow(`SELECT count(*) FROM photos WHERE id = ? OR sort_id = ?`, string(p.ID), []byte(p.SortID)).Scan(&existing)
+		if err != nil {
+			return err
+		}
+		if existing > 0 {
+			return library.PhotoAlreadyExists(p.ID)
+		}
+		if _, err := tx.Exec(`INSERT INTO photos (id, sort_id, data) VALUES (?, ?, ?)`, string(p.ID), []byte(p.SortID), string(encoded)); err != nil {
+			return err
+		}
+		return putHash(tx, p)
+	})
+}
+
+// Update replaces the stored data of the given photo, including its SortID
+func (store *SQLStore) Update(p *library.Photo) error {
+	// Sanity check
+	if p.ID == "" {
+		panic(fmt.Errorf("Photo %v has no ID", p))
+	}
+	if len(p.SortID) == 0 {
+		panic(fmt.Errorf("Photo %s has no SortID", p.ID))
+	}
+
+	encoded, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return inTx(store.db, func(tx *sql.Tx) error {
+		var existing int
+		err := tx.QueryRow(`SELECT count(*) FROM photos WHERE sort_id = ? AND id != ?`, []byte(p.SortID), string(p.ID)).Scan(&existing)
+		if err != nil {
+			return err
+		}
+		if existing > 0 {
+			return library.PhotoAlreadyExists(p.ID)
+		}
+		result, err := tx.Exec(`UPDATE photos SET sort_id = ?, data = ? WHERE id = ?`, []byte(p.SortID), string(encoded), string(p.ID))
+		if err != nil {
+			return err
+		}
+		if updated, err := result.RowsAffected(); err != nil {
+			return err
+		} else if updated == 0 {
+			return library.NotFound(p.ID)
+		}
+		return putHash(tx, p)
+	})
+}
+
+func putHash(tx *sql.Tx, p *library.Photo) error {
+	if !p.HasHash() {
+		return nil
+	}
+	_, err := tx.Exec(`INSERT OR REPLACE INTO photo_hashes (hash, photo) VALUES (?, ?)`, p.Hash.String(), string(p.ID))
+	return err
+}
+
+// Delete removes the photo with the given id from this store, the photo may also be in
+// the trash
+func (store *SQLStore) Delete(id library.PhotoID) error {
+	return inTx(store.db, func(tx *sql.Tx) error {
+		photo, err := getPhoto(tx, `SELECT data FROM photos WHERE id = ?`, id)
+		table := "photos"
+		if _, notFound := err.(library.ErrNotFound); notFound {
+			photo, err = getPhoto(tx, `SELECT data FROM trash WHERE id = ?`, id)
+			table = "trash"
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM `+table+` WHERE id = ?`, string(id)); err != nil {
+			return err
+		}
+		// The hash may belong to a newer photo with the same content
+		_, err = tx.Exec(`DELETE FROM photo_hashes WHERE hash = ? AND photo = ?`, photo.Hash.String(), string(id))
+		return err
+	})
+}
+
+// Trash moves the given photo to the trash, trashed photos are not returned by any
+// of the finder methods, they can be restored using Restore
+func (store *SQLStore) Trash(p *library.Photo) error {
+	encoded, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return inTx(store.db, func(tx *sql.Tx) error {
+		result, err := tx.Exec(`DELETE FROM photos WHERE id = ?`, string(p.ID))
+		if err != nil {
+			return err
+		}
+		if deleted, err := result.RowsAffected(); err != nil {
+			return err
+		} else if deleted == 0 {
+			return library.NotFound(p.ID)
+		}
+		_, err = tx.Exec(`INSERT OR REPLACE INTO trash (id, sort_id, data) VALUES (?, ?, ?)`, string(p.ID), []byte(p.SortID), string(encoded))
+		return err
+	})
+}
+
+// Restore moves the photo with the given id out of the trash
+func (store *SQLStore) Restore(id library.PhotoID) (*library.Photo, error) {
+	var photo *library.Photo
+	err := inTx(store.db, func(tx *sql.Tx) (err error) {
+		photo, err = getPhoto(tx, `SELECT data FROM trash WHERE id = ?`, id)
+		if err != nil {
+			return err
+		}
+		photo.TrashedAt = time.Time{}
+		encoded, err := json.Marshal(photo)
+		if err != nil {
+			return err
+		}
+		var existing int
+		if err := tx.QueryRow(`SELECT count(*) FROM photos WHERE id = ? OR sort_id = ?`, string(id), []byte(photo.SortID)).Scan(&existing); err != nil {
+			return err
+		}
+		if existing > 0 {
+			return library.PhotoAlreadyExists(id)
+		}
+		if _, err := tx.Exec(`INSERT INTO photos (id, sort_id, data) VALUES (?, ?, ?)`, string(id), []byte(photo.SortID), string(encoded)); err != nil {
+			return err
+		}
+		_, err = tx.Exec(`DELETE FROM trash WHERE id = ?`, string(id))
+		return err
+	})
+	return photo, err
+}
+
+// GetTrashed returns the trashed photo with the given id
+func (store *SQLStore) GetTrashed(id library.PhotoID) (*library.Photo, error) {
+	return getPhoto(store.db, `SELECT data FROM trash WHERE id = ?`, id)
+}
+
+// FindTrashed returns all photos currently in the trash
+func (store *SQLStore) FindTrashed() ([]*library.Photo, error) {
+	return findPhotos(store.db, `SELECT data FROM trash ORDER BY id`)
+}
+
+// FindAll returns all photos in this store
+func (store *SQLStore) FindAll(order consts.SortOrder) ([]*library.Photo, error) {
+	return findPhotos(store.db, `SELECT data FROM photos ORDER BY sort_id `+direction(order))
+}
+
+// FindAllPaged returns at most max photos from the store starting at photo index start,
+// companion videos of Live Photos are skipped and do not count for the start index
+func (store *SQLStore) FindAllPaged(start, max int, order consts.SortOrder) ([]*library.Photo, bool, error) {
+	// One more photo is fetched to know whether there are more
+	found, err := findPhotos(store.db, `SELECT data FROM photos WHERE json_extract(data, '$.liveStill') IS NULL
+		ORDER BY sort_id `+direction(order)+` LIMIT ? OFFSET ?`, max+1, start)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(found) > max {
+		return found[:max], true, nil
+	}
+	return found, false, nil
+}
+
+// Find returns all photos in this library with a SortID between the given ones
+func (store *SQLStore) Find(start, end library.OrderedID, order consts.SortOrder) ([]*library.Photo, error) {
+	return findPhotos(store.db, `SELECT data FROM photos WHERE sort_id >= ? AND sort_id <= ? ORDER BY sort_id `+direction(order), []byte(start), []byte(end))
+}
+
+// Get returns the photo with the given id
+func (store *SQLStore) Get(id library.PhotoID) (*library.Photo, error) {
+	return getPhoto(store.db, `SELECT data FROM photos WHERE id = ?`, id)
+}
+
+// queryer is implemented by both sql.DB and sql.Tx
+type queryer interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func getPhoto(q queryer, query string, id library.PhotoID) (*library.Photo, error) {
+	var data string
+	err := q.QueryRow(query, string(id)).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, library.NotFound(id)
+	} else if err != nil {
+		return nil, err
+	}
+	var photo library.Photo
+	if err := json.Unmarshal([]byte(data), &photo); err != nil {
+		return nil, err
+	}
+	return &photo, nil
+}
+
+func findPhotos(q queryer, query string, args ...interface{}) ([]*library.Photo, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var found = make([]*library.Photo, 0)
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var photo library.Photo
+		if err := json.Unmarshal([]byte(data), &photo); err != nil {
+			return nil, err
+		}
+		found = append(found, &photo)
+	}
+	return found, rows.Err()
+}
+
+func direction(order consts.SortOrder) string {
+	if order == consts.Descending {
+		return "DESC"
+	}
+	return "ASC"
+}
@@ -0,0 +1,327 @@
+package storetest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"bitbucket.org/kleinnic74/photos/domain/gps"
+	"bitbucket.org/kleinnic74/photos/index"
+	"bitbucket.org/kleinnic74/photos/library"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestDateIndex runs the conformance tests of library.DateIndex, newIndex must return an
+// empty index on each call
+func TestDateIndex(t *testing.T, newIndex func(t *testing.T) library.DateIndex) {
+	tests := map[string]func(*testing.T, library.DateIndex){
+		"Keys":           testDateIndexKeys,
+		"Remove":         testDateIndexRemove,
+		"LocalDay":       testDateIndexLocalDay,
+		"FindRangePaged": testDateIndexFindRangePaged,
+		"LiveCompanion":  testDateIndexLiveCompanion,
+	}
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			test(t, newIndex(t))
+		})
+	}
+}
+
+func testDateIndexKeys(t *testing.T, dateindex library.DateIndex) {
+	addToDateIndex(t, dateindex, "2020-04-12T12:30:24Z", "2019-05-09T07:08:09Z", "2020-04-12T08:45:00Z", "2020-05-01T10:00:00Z")
+	assert.Equal(t, []string{"2019-05-09", "2020-04-12", "2020-05-01"}, days(t, dateindex))
+}
+
+func testDateIndexRemove(t *testing.T, dateindex library.DateIndex) {
+	ctx := context.Background()
+	photos := addToDateIndex(t, dateindex, "2020-04-12T12:30:24Z", "2020-05-09T07:08:09Z", "2020-04-12T08:45:00Z")
+	for _, p := range photos[:2] {
+		if err := dateindex.Remove(ctx, p); err != nil {
+			t.Fatalf("Failed to remove photo %s: %s", p.ID, err)
+		}
+	}
+	assert.Equal(t, []string{"2020-04-12"}, days(t, dateindex), "Days without photos are removed")
+	found, _, err := dateindex.FindRangePaged(ctx, photos[0].DateTaken, photos[0].DateTaken, 0, 10)
+	if err != nil {
+		t.Fatalf("Error while fetching photos: %s", err)
+	}
+	assert.Equal(t, ids(photos[2]), found)
+	assert.Equal(t, library.MissingSortID, dateindex.Remove(ctx, &library.Photo{}))
+}
+
+func testDateIndexLocalDay(t *testing.T, dateindex library.DateIndex) {
+	// Taken in the evening of April 11th in New York
+	offset := -4 * 3600
+	photo := PhotoTakenAt("2020-04-12T01:30:00Z")
+	photo.TimeZoneOffset = &offset
+	if err := dateindex.Add(context.Background(), photo); err != nil {
+		t.Fatalf("Failed to add photo to index: %s", err)
+	}
+	assert.Equal(t, []string{"2020-04-11"}, days(t, dateindex))
+	if err := dateindex.Remove(context.Background(), photo); err != nil {
+		t.Fatalf("Failed to remove photo: %s", err)
+	}
+	assert.Empty(t, days(t, dateindex))
+}
+
+func testDateIndexFindRangePaged(t *testing.T, dateindex library.DateIndex) {
+	ctx := context.Background()
+	photos := addToDateIndex(t, dateindex, "2020-04-13T08:00:00Z", "2020-04-12T10:00:00Z", "2020-04-12T09:00:00Z",
+		"2020-04-15T08:00:00Z", "2020-04-11T08:00:00Z")
+	from, to := photos[2].DateTaken, photos[0].DateTaken
+	found, hasMore, err := dateindex.FindRangePaged(ctx, from, to, 0, 2)
+	if err != nil {
+		t.Fatalf("Error while fetching photos: %s", err)
+	}
+	assert.Equal(t, ids(photos[2], photos[1]), found, "Photos of the first day of the range, whatever their time")
+	assert.True(t, hasMore)
+	found, hasMore, err = dateindex.FindRangePaged(ctx, from, to, 2, 2)
+	if err != nil {
+		t.Fatalf("Error while fetching photos: %s", err)
+	}
+	assert.Equal(t, ids(photos[0]), found, "Photos of the last day of the range, whatever their time")
+	assert.False(t, hasMore)
+}
+
+func testDateIndexLiveCompanion(t *testing.T, dateindex library.DateIndex) {
+	photo := PhotoTakenAt("2020-04-12T12:30:24Z")
+	photo.LiveStill = "still"
+	if err := dateindex.Add(context.Background(), photo); err != nil {
+		t.Fatalf("Failed to add photo to index: %s", err)
+	}
+	assert.Empty(t, days(t, dateindex), "Videos of Live Photos are not indexed")
+	assert.Equal(t, library.MissingSortID, dateindex.Add(context.Background(), &library.Photo{}))
+}
+
+func addToDateIndex(t *testing.T, dateindex library.DateIndex, taken ...string) []*library.Photo {
+	photos := make([]*library.Photo, len(taken))
+	for i, ts := range taken {
+		photos[i] = PhotoTakenAt(ts)
+		if err := dateindex.Add(context.Background(), photos[i]); err != nil {
+			t.Fatalf("Failed to add photo to index: %s", err)
+		}
+	}
+	return photos
+}
+
+func days(t *testing.T, dateindex library.DateIndex) (days []string) {
+	timeline, err := dateindex.Keys(context.Background())
+	if err != nil {
+		t.Fatalf("Error while fetching dates: %s", err)
+	}
+	for _, y := range timeline.Years {
+		for _, m := range y.Months {
+			for _, d := range m.Days {
+				days = append(days, d.Date)
+			}
+		}
+	}
+	return
+}
+
+// TestGeoIndex runs the conformance tests of library.GeoIndex, newIndex must return an
+// empty index on each call
+func TestGeoIndex(t *testing.T, newIndex func(t *testing.T) library.GeoIndex) {
+	tests := map[string]func(*testing.T, library.GeoIndex){
+		"UpdateThenGet": testGeoIndexUpdateThenGet,
+		"Remove":        testGeoIndexRemove,
+		"Locations":     testGeoIndexLocations,
+		"FindPaged":     testGeoIndexFindPaged,
+	}
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			test(t, newIndex(t))
+		})
+	}
+}
+
+var (
+	berlin  = gps.AsAddress("Deutschland", "DE", "Berlin", "10115")
+	hamburg = gps.AsAddress("Deutschland", "DE", "Hamburg", "20095")
+	paris   = gps.AsAddress("France", "FR", "Paris", "75001")
+)
+
+func testGeoIndexUpdateThenGet(t *testing.T, geoindex library.GeoIndex) {
+	ctx := context.Background()
+	photos := addToGeoIndex(t, geoindex, berlin)
+	assert.True(t, geoindex.Has(ctx, photos[0].ID))
+	address, found, err := geoindex.Get(ctx, photos[0].ID)
+	if err != nil {
+		t.Fatalf("Failed to get address: %s", err)
+	}
+	assert.True(t, found)
+	assert.Equal(t, &berlin, address)
+
+	assert.False(t, geoindex.Has(ctx, "unknown"))
+	_, found, err = geoindex.Get(ctx, "unknown")
+	assert.NoError(t, err)
+	assert.False(t, found)
+	assert.NoError(t, geoindex.Update(ctx, photos[0].ExtendedPhotoID, nil), "Photos without address are ignored")
+}
+
+func testGeoIndexRemove(t *testing.T, geoindex library.GeoIndex) {
+	ctx := context.Background()
+	photos := addToGeoIndex(t, geoindex, berlin, berlin)
+	if err := geoindex.Remove(ctx, photos[0].ExtendedPhotoID); err != nil {
+		t.Fatalf("Failed to remove photo: %s", err)
+	}
+	assert.False(t, geoindex.Has(ctx, photos[0].ID))
+	found, _, err := geoindex.FindByPlacePaged(ctx, berlin.ID, 0, 10)
+	if err != nil {
+		t.Fatalf("Failed to find photos: %s", err)
+	}
+	assert.Equal(t, ids(photos[1]), found)
+	assert.NoError(t, geoindex.Remove(ctx, photos[0].ExtendedPhotoID), "Photo removed twice")
+}
+
+func testGeoIndexLocations(t *testing.T, geoindex library.GeoIndex) {
+	photos := addToGeoIndex(t, geoindex, paris, hamburg, berlin)
+	if err := geoindex.Remove(context.Background(), photos[0].ExtendedPhotoID); err != nil {
+		t.Fatalf("Failed to remove photo: %s", err)
+	}
+	locations, err := geoindex.Locations(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to get locations: %s", err)
+	}
+	if assert.Len(t, locations.Countries, 2, "Countries are kept when their photos are removed") {
+		assert.Equal(t, berlin.Country, locations.Countries[0].Country)
+		assert.Equal(t, []*gps.Address{&berlin, &hamburg}, locations.Countries[0].Places)
+		assert.Equal(t, paris.Country, locations.Countries[1].Country)
+		assert.Equal(t, []*gps.Address{&paris}, locations.Countries[1].Places)
+	}
+}
+
+func testGeoIndexFindPaged(t *testing.T, geoindex library.GeoIndex) {
+	ctx := context.Background()
+	photos := addToGeoIndex(t, geoindex, hamburg, berlin, paris, berlin)
+	found, hasMore, err := geoindex.FindByPlacePaged(ctx, berlin.ID, 0, 10)
+	if err != nil {
+		t.Fatalf("Failed to find photos: %s", err)
+	}
+	assert.Equal(t, ids(photos[1], photos[3]), found)
+	assert.False(t, hasMore)
+	found, hasMore, err = geoindex.FindByCountryPaged(ctx, berlin.Country.ID, 0, 2)
+	if err != nil {
+		t.Fatalf("Failed to find photos: %s", err)
+	}
+	assert.Equal(t, ids(photos[1], photos[3]), found, "Photos ordered by place")
+	assert.True(t, hasMore)
+	found, hasMore, err = geoindex.FindByCountryPaged(ctx, berlin.Country.ID, 2, 2)
+	if err != nil {
+		t.Fatalf("Failed to find photos: %s", err)
+	}
+	assert.Equal(t, ids(photos[0]), found)
+	assert.False(t, hasMore)
+	found, _, err = geoindex.FindByPlacePaged(ctx, "unknown", 0, 10)
+	assert.NoError(t, err)
+	assert.Empty(t, found)
+}
+
+// addToGeoIndex adds one photo per address, taken one day after the other
+func addToGeoIndex(t *testing.T, geoindex library.GeoIndex, addresses ...gps.Address) []*library.Photo {
+	photos := make([]*library.Photo, len(addresses))
+	for i := range addresses {
+		photos[i] = PhotoTakenAt(time.Date(2020, 4, 12+i, 12, 0, 0, 0, time.UTC).Format(time.RFC3339))
+		if err := geoindex.Update(context.Background(), photos[i].ExtendedPhotoID, &addresses[i]); err != nil {
+			t.Fatalf("Failed to add photo to index: %s", err)
+		}
+	}
+	return photos
+}
+
+// TestTracker runs the conformance tests of index.Tracker, newTracker must return an
+// empty tracker on each call
+func TestTracker(t *testing.T, newTracker func(t *testing.T) index.Tracker) {
+	tests := map[string]func(*testing.T, index.Tracker){
+		"Update":          testTrackerUpdate,
+		"MissingIndexes":  testTrackerMissingIndexes,
+		"Remove":          testTrackerRemove,
+		"GetElementState": testTrackerElementStatus,
+	}
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			test(t, newTracker(t))
+		})
+	}
+}
+
+func testTrackerUpdate(t *testing.T, tracker index.Tracker) {
+	tracker.RegisterIndex("geo", library.Version(2))
+	_, found, err := tracker.Get("1234")
+	assert.NoError(t, err)
+	assert.False(t, found)
+	for i, err := range []error{nil, errors.New("some error")} {
+		expected := index.IndexStatus{Status: index.Indexed, Version: 2}
+		if err != nil {
+			expected.Status = index.ErrorOnIndex
+		}
+		if err := tracker.Update("geo", "1234", err); err != nil {
+			t.Fatalf("#%d: failed to update index: %s", i, err)
+		}
+		state, found, err := tracker.Get("1234")
+		if err != nil {
+			t.Fatalf("#%d: failed to retrieve state: %s", i, err)
+		}
+		assert.True(t, found)
+		assert.Equal(t, expected, state.StatusFor("geo"), "#%d", i)
+	}
+}
+
+func testTrackerMissingIndexes(t *testing.T, tracker index.Tracker) {
+	tracker.RegisterIndex("geo", library.Version(1))
+	tracker.RegisterIndex("date", library.Version(1))
+	if err := tracker.Update("geo", "1234", nil); err != nil {
+		t.Fatalf("Failed to update index: %s", err)
+	}
+	missing, err := tracker.GetMissingIndexes("1234")
+	assert.NoError(t, err)
+	assert.Equal(t, []index.Name{"date"}, missing)
+	tracker.RegisterIndex("geo", library.Version(2))
+	missing, err = tracker.GetMissingIndexes("1234")
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []index.Name{"date", "geo"}, missing, "Outdated index")
+	missing, err = tracker.GetMissingIndexes("unknown")
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []index.Name{"date", "geo"}, missing)
+}
+
+func testTrackerRemove(t *testing.T, tracker index.Tracker) {
+	tracker.RegisterIndex("geo", library.Version(1))
+	if err := tracker.Update("geo", "1234", nil); err != nil {
+		t.Fatalf("Failed to update index: %s", err)
+	}
+	if err := tracker.Remove("1234"); err != nil {
+		t.Fatalf("Failed to remove photo: %s", err)
+	}
+	_, found, err := tracker.Get("1234")
+	assert.NoError(t, err)
+	assert.False(t, found)
+}
+
+func testTrackerElementStatus(t *testing.T, tracker index.Tracker) {
+	tracker.RegisterIndex("geo", library.Version(1))
+	tracker.RegisterIndex("date", library.Version(1))
+	for _, id := range []library.PhotoID{"1", "2"} {
+		if err := tracker.Update("geo", id, nil); err != nil {
+			t.Fatalf("Failed to update index: %s", err)
+		}
+	}
+	if err := tracker.Update("date", "2", nil); err != nil {
+		t.Fatalf("Failed to update index: %s", err)
+	}
+	states, err := tracker.GetElementStatus(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to get states: %s", err)
+	}
+	if assert.Len(t, states, 2) {
+		assert.Equal(t, library.PhotoID("1"), states[0].ID)
+		assert.Len(t, states[0].State, 1)
+		assert.Equal(t, library.PhotoID("2"), states[1].ID)
+		assert.Len(t, states[1].State, 2)
+	}
+}
@@ -0,0 +1,294 @@
+// Package storetest contains the tests every implementation of the library meta-data
+// store and of its indexes must pass, so that the implementations can be used in place
+// of each other
+package storetest
+
+import (
+	"testing"
+	"time"
+
+	"bitbucket.org/kleinnic74/photos/consts"
+	"bitbucket.org/kleinnic74/photos/library"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestStore runs the conformance tests of library.Store, newStore must return an empty
+// store on each call
+func TestStore(t *testing.T, newStore func(t *testing.T) library.ClosableStore) {
+	tests := map[string]func(*testing.T, library.Store){
+		"AddThenGet":           testAddThenGet,
+		"AddTwice":             testAddTwice,
+		"FindAll":              testFindAll,
+		"FindAllPaged":         testFindAllPaged,
+		"FindAllPagedLive":     testFindAllPagedLive,
+		"Find":                 testFind,
+		"UpdateWithNewSortID":  testUpdateWithNewSortID,
+		"UpdateUnknown":        testUpdateUnknown,
+		"Delete":               testDelete,
+		"DeleteKeepsOtherHash": testDeleteKeepsOtherHash,
+		"TrashThenRestore":     testTrashThenRestore,
+		"DeleteTrashed":        testDeleteTrashed,
+	}
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+			defer store.Close()
+			test(t, store)
+		})
+	}
+}
+
+func testAddThenGet(t *testing.T, store library.Store) {
+	photo := PhotoTakenAt("2018-02-23T13:43:12Z")
+	photo.Hash = library.BinaryHash("1234")
+	mustAdd(t, store, photo)
+	found, err := store.Get(photo.ID)
+	if err != nil {
+		t.Fatalf("Added photo not found: %s", err)
+	}
+	assert.Equal(t, photo.ID, found.ID)
+	assert.Equal(t, photo.SortID, found.SortID)
+	assert.Equal(t, photo.Path, found.Path)
+	assert.True(t, photo.DateTaken.Equal(found.DateTaken))
+	other, exists := store.Exists(photo.Hash)
+	assert.True(t, exists, "Hash of added photo exists")
+	assert.Equal(t, photo.ID, other)
+
+	_, err = store.Get("unknown")
+	assert.IsType(t, library.ErrNotFound(""), err, "Unknown photo")
+	_, exists = store.Exists(library.BinaryHash("unknown"))
+	assert.False(t, exists)
+}
+
+func testAddTwice(t *testing.T, store library.Store) {
+	photo := PhotoTakenAt("2018-02-23T13:43:12Z")
+	mustAdd(t, store, photo)
+	assert.Error(t, store.Add(photo), "Photo added twice")
+}
+
+func testFindAll(t *testing.T, store library.Store) {
+	photos := addPhotosTakenAt(t, store, "2019-01-01T00:00:00Z", "2018-01-01T00:00:00Z", "2020-01-01T00:00:00Z")
+	found, err := store.FindAll(consts.Ascending)
+	if err != nil {
+		t.Fatalf("Failed to find photos: %s", err)
+	}
+	assert.Equal(t, ids(photos[1], photos[0], photos[2]), ids(found...))
+	found, err = store.FindAll(consts.Descending)
+	if err != nil {
+		t.Fatalf("Failed to find photos: %s", err)
+	}
+	assert.Equal(t, ids(photos[2], photos[0], photos[1]), ids(found...))
+}
+
+func testFindAllPaged(t *testing.T, store library.Store) {
+	photos := addPhotosTakenAt(t, store, "2018-01-01T00:00:00Z", "2018-01-02T00:00:00Z", "2018-01-03T00:00:00Z",
+		"2018-01-04T00:00:00Z", "2018-01-05T00:00:00Z")
+	found, hasMore, err := store.FindAllPaged(0, 2, consts.Ascending)
+	if err != nil {
+		t.Fatalf("Failed to find photos: %s", err)
+	}
+	assert.Equal(t, ids(photos[:2]...), ids(found...))
+	assert.True(t, hasMore)
+	found, hasMore, err = store.FindAllPaged(4, 2, consts.Ascending)
+	if err != nil {
+		t.Fatalf("Failed to find photos: %s", err)
+	}
+	assert.Equal(t, ids(photos[4]), ids(found...))
+	assert.False(t, hasMore, "Last page")
+	found, _, err = store.FindAllPaged(1, 2, consts.Descending)
+	if err != nil {
+		t.Fatalf("Failed to find photos: %s", err)
+	}
+	assert.Equal(t, ids(photos[3], photos[2]), ids(found...))
+}
+
+func testFindAllPagedLive(t *testing.T, store library.Store) {
+	still := PhotoTakenAt("2018-01-01T00:00:00Z")
+	still.LiveVideo = "video"
+	video := PhotoTakenAt("2018-01-01T00:00:01Z")
+	video.LiveStill = still.ID
+	mustAdd(t, store, still)
+	mustAdd(t, store, video)
+	photos := addPhotosTakenAt(t, store, "2018-01-02T00:00:00Z", "2018-01-03T00:00:00Z")
+	found, hasMore, err := store.FindAllPaged(1, 1, consts.Ascending)
+	if err != nil {
+		t.Fatalf("Failed to find photos: %s", err)
+	}
+	assert.Equal(t, ids(photos[0]), ids(found...), "Companion video is not counted")
+	assert.True(t, hasMore)
+	found, hasMore, err = store.FindAllPaged(1, 2, consts.Ascending)
+	if err != nil {
+		t.Fatalf("Failed to find photos: %s", err)
+	}
+	assert.Equal(t, ids(photos...), ids(found...))
+	assert.False(t, hasMore, "Last page")
+	found, _, err = store.FindAllPaged(1, 2, consts.Descending)
+	if err != nil {
+		t.Fatalf("Failed to find photos: %s", err)
+	}
+	assert.Equal(t, ids(photos[0], still), ids(found...))
+}
+
+func testFind(t *testing.T, store library.Store) {
+	photos := addPhotosTakenAt(t, store, "2018-01-01T00:00:00Z", "2019-01-01T00:00:00Z", "2019-06-01T00:00:00Z", "2020-01-01T00:00:00Z")
+	found, err := store.Find(library.OrderedID("2018-06-01T00:00:00Z"), library.OrderedID("2019-12-31T23:59:59Z"), consts.Ascending)
+	if err != nil {
+		t.Fatalf("Failed to find photos: %s", err)
+	}
+	assert.Equal(t, ids(photos[1:3]...), ids(found...))
+}
+
+func testUpdateWithNewSortID(t *testing.T, store library.Store) {
+	photo := PhotoTakenAt("2018-02-23T13:43:12Z")
+	mustAdd(t, store, photo)
+	updated := *photo
+	updated.SortID = library.OrderedID("2001-01-01T00:00:00Z" + string(photo.ID))
+	updated.Path = "2001/01/01"
+	if err := store.Update(&updated); err != nil {
+		t.Fatalf("Failed to update photo: %s", err)
+	}
+	found, err := store.Get(photo.ID)
+	if err != nil {
+		t.Fatalf("Updated photo not found: %s", err)
+	}
+	assert.Equal(t, updated.SortID, found.SortID)
+	assert.Equal(t, updated.Path, found.Path)
+	all, _ := store.FindAll(consts.Ascending)
+	assert.Equal(t, ids(photo), ids(all...), "Photo is not duplicated")
+}
+
+func testUpdateUnknown(t *testing.T, store library.Store) {
+	photo := PhotoTakenAt("2018-02-23T13:43:12Z")
+	assert.IsType(t, library.ErrNotFound(""), store.Update(photo))
+}
+
+func testDelete(t *testing.T, store library.Store) {
+	photo := PhotoTakenAt("2018-02-23T13:43:12Z")
+	photo.Hash = library.BinaryHash("1234")
+	mustAdd(t, store, photo)
+	if err := store.Delete(photo.ID); err != nil {
+		t.Fatalf("Failed to delete photo: %s", err)
+	}
+	_, err := store.Get(photo.ID)
+	assert.IsType(t, library.ErrNotFound(""), err, "Deleted photo")
+	_, exists := store.Exists(photo.Hash)
+	assert.False(t, exists, "Hash of deleted photo")
+	all, _ := store.FindAll(consts.Ascending)
+	assert.Empty(t, all)
+	assert.Error(t, store.Delete(photo.ID), "Photo deleted twice")
+}
+
+func testDeleteKeepsOtherHash(t *testing.T, store library.Store) {
+	photos := addPhotosTakenAt(t, store, "2018-01-01T00:00:00Z")
+	duplicate := PhotoTakenAt("2018-01-01T00:00:00Z")
+	photos[0].Hash = library.BinaryHash("1234")
+	duplicate.Hash = photos[0].Hash
+	if err := store.Update(photos[0]); err != nil {
+		t.Fatalf("Failed to update photo: %s", err)
+	}
+	mustAdd(t, store, duplicate)
+	if err := store.Delete(photos[0].ID); err != nil {
+		t.Fatalf("Failed to delete photo: %s", err)
+	}
+	other, exists := store.Exists(duplicate.Hash)
+	assert.True(t, exists, "Hash is owned by the other photo")
+	assert.Equal(t, duplicate.ID, other)
+}
+
+func testTrashThenRestore(t *testing.T, store library.Store) {
+	photo := PhotoTakenAt("2018-02-23T13:43:12Z")
+	photo.Hash = library.BinaryHash("1234")
+	mustAdd(t, store, photo)
+	photo.TrashedAt = time.Now().UTC()
+	if err := store.Trash(photo); err != nil {
+		t.Fatalf("Failed to trash photo: %s", err)
+	}
+	_, err := store.Get(photo.ID)
+	assert.IsType(t, library.ErrNotFound(""), err, "Trashed photo")
+	all, _ := store.FindAll(consts.Ascending)
+	assert.Empty(t, all, "Trashed photos are not found")
+	_, exists := store.Exists(photo.Hash)
+	assert.True(t, exists, "Hash of trashed photo")
+	trashed, err := store.FindTrashed()
+	if err != nil {
+		t.Fatalf("Failed to list trash: %s", err)
+	}
+	if assert.Len(t, trashed, 1) {
+		assert.True(t, trashed[0].IsTrashed())
+	}
+	found, err := store.GetTrashed(photo.ID)
+	if err != nil {
+		t.Fatalf("Trashed photo not found: %s", err)
+	}
+	assert.Equal(t, photo.ID, found.ID)
+
+	restored, err := store.Restore(photo.ID)
+	if err != nil {
+		t.Fatalf("Failed to restore photo: %s", err)
+	}
+	assert.Equal(t, photo.ID, restored.ID)
+	assert.False(t, restored.IsTrashed(), "Restored photo")
+	found, err = store.Get(photo.ID)
+	if err != nil {
+		t.Fatalf("Restored photo not found: %s", err)
+	}
+	assert.False(t, found.IsTrashed(), "Restored photo")
+	trashed, _ = store.FindTrashed()
+	assert.Empty(t, trashed)
+	_, err = store.Restore(photo.ID)
+	assert.IsType(t, library.ErrNotFound(""), err, "Photo restored twice")
+}
+
+func testDeleteTrashed(t *testing.T, store library.Store) {
+	photo := PhotoTakenAt("2018-02-23T13:43:12Z")
+	photo.Hash = library.BinaryHash("1234")
+	mustAdd(t, store, photo)
+	photo.TrashedAt = time.Now().UTC()
+	if err := store.Trash(photo); err != nil {
+		t.Fatalf("Failed to trash photo: %s", err)
+	}
+	if err := store.Delete(photo.ID); err != nil {
+		t.Fatalf("Failed to delete trashed photo: %s", err)
+	}
+	_, err := store.GetTrashed(photo.ID)
+	assert.IsType(t, library.ErrNotFound(""), err, "Deleted photo")
+	_, exists := store.Exists(photo.Hash)
+	assert.False(t, exists, "Hash of deleted photo")
+}
+
+// PhotoTakenAt returns a random photo taken at the given RFC3339 time
+func PhotoTakenAt(taken string) *library.Photo {
+	photo := library.RandomPhoto()
+	dateTaken, err := time.Parse(time.RFC3339, taken)
+	if err != nil {
+		panic(err)
+	}
+	photo.DateTaken = dateTaken
+	photo.Path = dateTaken.Format("2006/01/02")
+	photo.SortID = library.OrderedID(dateTaken.UTC().Format(time.RFC3339) + string(photo.ID))
+	return photo
+}
+
+func addPhotosTakenAt(t *testing.T, store library.Store, taken ...string) []*library.Photo {
+	photos := make([]*library.Photo, len(taken))
+	for i, ts := range taken {
+		photos[i] = PhotoTakenAt(ts)
+		mustAdd(t, store, photos[i])
+	}
+	return photos
+}
+
+func mustAdd(t *testing.T, store library.Store, photo *library.Photo) {
+	if err := store.Add(photo); err != nil {
+		t.Fatalf("Failed to add photo: %s", err)
+	}
+}
+
+func ids(photos ...*library.Photo) []library.PhotoID {
+	ids := make([]library.PhotoID, len(photos))
+	for i, p := range photos {
+		ids[i] = p.ID
+	}
+	return ids
+}
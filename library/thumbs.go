@@ -0,0 +1,138 @@
+package library
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"bitbucket.org/kleinnic74/photos/domain"
+	"bitbucket.org/kleinnic74/photos/logging"
+	"go.uber.org/zap"
+)
+
+// thumbSettingsFile stores the sizes and quality the existing thumbs were created with
+const thumbSettingsFile = "settings"
+
+// SetThumbQuality sets the JPEG quality of new thumbs
+func (lib *BasicPhotoLibrary) SetThumbQuality(quality int) {
+	lib.thumbQuality = quality
+}
+
+// CreateThumbs creates the thumbs of all sizes of the given photo. Existing thumbs are kept
+// unless overwrite is set, in which case thumbs of sizes which are not used anymore are removed
+func (lib *BasicPhotoLibrary) CreateThumbs(ctx context.Context, id PhotoID, overwrite bool) error {
+	photo, err := lib.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	sizes := domain.AllThumbSizes()
+	if overwrite {
+		lib.deleteUnusedThumbs(ctx, photo, sizes)
+	}
+	for _, size := range sizes {
+		if !overwrite {
+			if _, err := os.Stat(lib.thumbPath(photo, size)); err == nil {
+				continue
+			}
+		}
+		if err := lib.createThumb(ctx, photo, size); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ThumbsOutdated tells whether the sizes or quality of thumbs changed since ThumbsUpdated was
+// last called. Thumbs are not outdated before ThumbsUpdated was called for the first time
+func (lib *BasicPhotoLibrary) ThumbsOutdated() (bool, error) {
+	settings, err := os.ReadFile(filepath.Join(lib.thumbdir, thumbSettingsFile))
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return string(settings) != lib.thumbSettings(), nil
+}
+
+// ThumbsUpdated records that the thumbs of all photos use the current sizes and quality
+func (lib *BasicPhotoLibrary) ThumbsUpdated() error {
+	return os.WriteFile(filepath.Join(lib.thumbdir, thumbSettingsFile), []byte(lib.thumbSettings()), 0644)
+}
+
+func (lib *BasicPhotoLibrary) thumbSettings() string {
+	sizes := domain.AllThumbSizes()
+	settings := make([]string, len(sizes))
+	for i, size := range sizes {
+		settings[i] = size.String()
+	}
+	return strings.Join(settings, ",") + ";q=" + strconv.Itoa(lib.thumbQuality)
+}
+
+func (lib *BasicPhotoLibrary) thumbPath(photo *Photo, size domain.ThumbSize) string {
+	return filepath.Join(lib.thumbdir, string(photo.ID), size.Name+".jpg")
+}
+
+// createThumb creates the thumb of the given size, replacing an existing one
+func (lib *BasicPhotoLibrary) createThumb(ctx context.Context, photo *Photo, size domain.ThumbSize) error {
+	path := lib.thumbPath(photo, size)
+	logger := logging.From(ctx).Named("library").With(zap.String("photo", string(photo.ID)), zap.String("thumb", path))
+	start := time.Now()
+	logger.Debug("Creating thumbnail")
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, defaultDirMode); err != nil {
+		return err
+	}
+	baseImage, err := lib.openPhoto(photo.Path)
+	if err != nil {
+		logger.Error("Failed to open image content", zap.Error(err))
+		return err
+	}
+	defer baseImage.Close()
+	thumb, err := lib.thumber.CreateThumb(baseImage, photo.Format, photo.Orientation, size)
+	if err != nil {
+		logger.Error("Failed to created thumb", zap.Error(err))
+		return err
+	}
+	// Written to a temporary file first so that concurrent readers never see a partial thumb
+	out, err := os.CreateTemp(dir, size.Name+".*.tmp")
+	if err != nil {
+		logger.Error("Failed to save thumb", zap.Error(err))
+		return err
+	}
+	defer os.Remove(out.Name())
+	err = domain.EncodeWithQuality(lib.thumbFormat, thumb, out, lib.thumbQuality)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		logger.Error("Failed to save thumb", zap.Error(err))
+		return err
+	}
+	if err := os.Rename(out.Name(), path); err != nil {
+		return err
+	}
+	logger.Info("Created thumb", zap.Duration("duration", time.Since(start)))
+	return nil
+}
+
+func (lib *BasicPhotoLibrary) deleteUnusedThumbs(ctx context.Context, photo *Photo, sizes []domain.ThumbSize) {
+	used := make(map[string]bool, len(sizes))
+	for _, size := range sizes {
+		used[filepath.Base(lib.thumbPath(photo, size))] = true
+	}
+	files, err := os.ReadDir(filepath.Join(lib.thumbdir, string(photo.ID)))
+	if err != nil {
+		return
+	}
+	for _, f := range files {
+		// Temporary files belong to thumbs being created
+		if !used[f.Name()] && !strings.HasSuffix(f.Name(), ".tmp") {
+			if err := os.Remove(filepath.Join(lib.thumbdir, string(photo.ID), f.Name())); err != nil {
+				logging.From(ctx).Warn("Failed to delete thumb", zap.String("thumb", f.Name()), zap.Error(err))
+			}
+		}
+	}
+}
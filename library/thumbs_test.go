@@ -0,0 +1,63 @@
+package library_test
+
+import (
+	"context"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"bitbucket.org/kleinnic74/photos/domain"
+	"bitbucket.org/kleinnic74/photos/library"
+	"bitbucket.org/kleinnic74/photos/library/librarytest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateThumbs(t *testing.T) {
+	ctx := context.Background()
+	lib, dir, _ := librarytest.NewLibrary(t)
+	content, err := os.ReadFile("../domain/testdata/orientation/landscape_7.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	photo := librarytest.AddContent(t, lib, library.PhotoMeta{Name: "IMG_0001.JPG", Format: domain.MustFormatForExt("jpg"), DateTaken: time.Now()}, content)
+
+	thumb, _, err := lib.OpenThumb(ctx, photo.ID, domain.Large)
+	if err != nil {
+		t.Fatalf("Failed to open thumb: %s", err)
+	}
+	img, err := jpeg.Decode(thumb)
+	thumb.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, domain.Large.Width(), img.Bounds().Dy(), "Thumb has the requested size")
+
+	thumbdir := filepath.Join(dir, "thumbs", string(photo.ID))
+	unused := filepath.Join(thumbdir, "X.jpg")
+	if err := os.WriteFile(unused, []byte("old size"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := lib.CreateThumbs(ctx, photo.ID, false); err != nil {
+		t.Fatalf("Failed to create thumbs: %s", err)
+	}
+	for _, size := range domain.AllThumbSizes() {
+		assert.FileExists(t, filepath.Join(thumbdir, size.Name+".jpg"))
+	}
+	assert.FileExists(t, unused, "Thumbs are only added")
+	if err := lib.CreateThumbs(ctx, photo.ID, true); err != nil {
+		t.Fatalf("Failed to rebuild thumbs: %s", err)
+	}
+	assert.NoFileExists(t, unused, "Thumbs of unused sizes are removed on rebuild")
+
+	outdated, err := lib.ThumbsOutdated()
+	assert.NoError(t, err)
+	assert.False(t, outdated, "Thumbs never updated")
+	assert.NoError(t, lib.ThumbsUpdated())
+	outdated, _ = lib.ThumbsOutdated()
+	assert.False(t, outdated)
+	lib.SetThumbQuality(50)
+	outdated, _ = lib.ThumbsOutdated()
+	assert.True(t, outdated, "Quality changed")
+}
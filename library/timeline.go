@@ -63,5 +63,6 @@ func (m *Month) Add(t time.Time, key string) {
 type DateIndex interface {
 	Keys(context.Context) (Timeline, error)
 	Add(context.Context, *Photo) error
+	Remove(context.Context, *Photo) error
 	FindRangePaged(context.Context, time.Time, time.Time, int, int) ([]PhotoID, bool, error)
 }
@@ -0,0 +1,52 @@
+package library_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"bitbucket.org/kleinnic74/photos/domain"
+	"bitbucket.org/kleinnic74/photos/library"
+	"bitbucket.org/kleinnic74/photos/library/librarytest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrashThenRestore(t *testing.T) {
+	ctx := context.Background()
+	lib, _, _ := librarytest.NewLibrary(t)
+	var trashed, restored []library.PhotoID
+	failure := errors.New("index failed")
+	lib.AddTrashCallback(func(ctx context.Context, p *library.Photo) error {
+		trashed = append(trashed, p.ID)
+		return nil
+	})
+	lib.AddRestoreCallback(func(ctx context.Context, p *library.Photo) error {
+		restored = append(restored, p.ID)
+		return failure
+	})
+	content, err := os.ReadFile("../domain/testdata/Canon_40D.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	photo := librarytest.AddContent(t, lib, library.PhotoMeta{Name: "IMG_0001.JPG", Format: domain.MustFormatForExt("jpg"), DateTaken: time.Now()}, content)
+
+	if err := lib.Trash(ctx, photo.ID); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []library.PhotoID{photo.ID}, trashed)
+	assert.Empty(t, restored)
+	err = lib.Add(ctx, library.PhotoMeta{Name: "IMG_0001.JPG", Format: domain.MustFormatForExt("jpg"), DateTaken: time.Now()}, bytes.NewReader(content))
+	assert.Equal(t, library.ErrInTrash(photo.ID), err, "Trashed photos are restored, not added again")
+
+	found, err := lib.Restore(ctx, photo.ID)
+	assert.Equal(t, failure, err, "Errors of callbacks are returned")
+	if assert.NotNil(t, found) {
+		assert.Equal(t, photo.ID, found.ID)
+	}
+	assert.Equal(t, []library.PhotoID{photo.ID}, restored)
+	_, err = lib.Get(ctx, photo.ID)
+	assert.NoError(t, err, "Photo is restored despite failed callback")
+}
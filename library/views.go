@@ -0,0 +1,206 @@
+package library
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"bitbucket.org/kleinnic74/photos/domain"
+	"bitbucket.org/kleinnic74/photos/logging"
+	"go.uber.org/zap"
+)
+
+// DefaultViewCacheSize is the default maximum size in bytes of the cached views
+const DefaultViewCacheSize = 512 * 1024 * 1024
+
+// ViewOptions tell how a photo is converted for viewing
+type ViewOptions struct {
+	// Width is the maximum width of the view, 0 keeps the width of the photo
+	Width int
+	// Format is the format of the view
+	Format domain.Format
+	// Quality is the quality of lossy formats, from 1 to 100
+	Quality int
+}
+
+// ViewCache stores resized and converted photos on disk, the least recently used
+// views are removed when the cache grows beyond its maximum size
+type ViewCache struct {
+	dir     string
+	maxSize int64
+
+	mutex   sync.Mutex
+	size    int64
+	lru     *list.List
+	entries map[string]*list.Element
+}
+
+type cachedView struct {
+	name string
+	size int64
+}
+
+// NewViewCache creates a cache in the given directory, views already stored there
+// are kept if the cache is not full
+func NewViewCache(dir string, maxSize int64) (*ViewCache, error) {
+	if err := os.MkdirAll(dir, defaultDirMode); err != nil {
+		return nil, err
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	c := &ViewCache{
+		dir:     dir,
+		maxSize: maxSize,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+	}
+	infos := make([]os.FileInfo, 0, len(files))
+	for _, f := range files {
+		info, err := f.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		if strings.HasSuffix(f.Name(), ".tmp") {
+			// Left over by an interrupted conversion
+			os.Remove(filepath.Join(dir, f.Name()))
+			continue
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ModTime().Before(infos[j].ModTime()) })
+	for _, info := range infos {
+		c.entries[info.Name()] = c.lru.PushFront(cachedView{name: info.Name(), size: info.Size()})
+		c.size += info.Size()
+	}
+	c.evict()
+	return c, nil
+}
+
+// Open returns the view of the given photo and its size, the view is created from
+// the content of the photo if it is not cached yet
+func (c *ViewCache) Open(ctx context.Context, photo *Photo, content ReaderFunc, opts ViewOptions) (io.ReadCloser, int64, error) {
+	name := viewName(photo, opts)
+	if f, size, found := c.open(name); found {
+		return f, size, nil
+	}
+	logger := logging.From(ctx).Named("views").With(zap.String("photo", string(photo.ID)), zap.String("view", name))
+	start := time.Now()
+	in, err := content()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer in.Close()
+	img, err := domain.Resize(in, photo.Format, photo.Orientation, opts.Width)
+	if err != nil {
+		return nil, 0, err
+	}
+	tmp, err := os.CreateTemp(c.dir, name+".*.tmp")
+	if err != nil {
+		return nil, 0, err
+	}
+	defer os.Remove(tmp.Name())
+	err = domain.EncodeWithQuality(opts.Format, img, tmp, opts.Quality)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	path := filepath.Join(c.dir, name)
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return nil, 0, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	c.add(name, info.Size())
+	logger.Info("Created view", zap.Int64("size", info.Size()), zap.Duration("duration", time.Since(start)))
+	return f, info.Size(), nil
+}
+
+// RemovePhoto removes all views of the given photo
+func (c *ViewCache) RemovePhoto(ctx context.Context, photo *Photo) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	prefix := string(photo.ID) + "_"
+	for name, e := range c.entries {
+		if strings.HasPrefix(name, prefix) {
+			c.remove(e)
+		}
+	}
+	return nil
+}
+
+// open opens a cached view and marks it as the most recently used one
+func (c *ViewCache) open(name string) (*os.File, int64, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	e, found := c.entries[name]
+	if !found {
+		return nil, 0, false
+	}
+	path := filepath.Join(c.dir, name)
+	f, err := os.Open(path)
+	if err != nil {
+		c.remove(e)
+		return nil, 0, false
+	}
+	c.lru.MoveToFront(e)
+	// The modification time keeps the order of use across restarts
+	now := time.Now()
+	os.Chtimes(path, now, now)
+	return f, e.Value.(cachedView).size, true
+}
+
+func (c *ViewCache) add(name string, size int64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if e, found := c.entries[name]; found {
+		// Created concurrently by another request
+		c.size -= e.Value.(cachedView).size
+		c.lru.Remove(e)
+	}
+	c.entries[name] = c.lru.PushFront(cachedView{name: name, size: size})
+	c.size += size
+	c.evict()
+}
+
+// evict removes the least recently used views until the cache fits its maximum size,
+// the most recently used view is always kept
+func (c *ViewCache) evict() {
+	for c.size > c.maxSize && c.lru.Len() > 1 {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *ViewCache) remove(e *list.Element) {
+	v := c.lru.Remove(e).(cachedView)
+	delete(c.entries, v.name)
+	c.size -= v.size
+	os.Remove(filepath.Join(c.dir, v.name))
+}
+
+// viewName is the file name of a view, it changes with the orientation of the photo. Widths
+// from the width of the photo on share the view of the full size as photos are never enlarged
+func viewName(photo *Photo, opts ViewOptions) string {
+	width := opts.Width
+	if photo.Width > 0 && width >= photo.Width {
+		width = 0
+	}
+	return fmt.Sprintf("%s_%d_%d_%d.%s", photo.ID, photo.Orientation, width, opts.Quality, opts.Format.ID())
+}
@@ -0,0 +1,87 @@
+package library_test
+
+import (
+	"context"
+	"image"
+	"io"
+	"os"
+	"testing"
+
+	"bitbucket.org/kleinnic74/photos/domain"
+	"bitbucket.org/kleinnic74/photos/library"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestViewCache(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	content := func() (io.ReadCloser, error) {
+		return os.Open("../domain/testdata/Canon_40D.jpg")
+	}
+	photo := func(id string) *library.Photo {
+		return &library.Photo{
+			ExtendedPhotoID: library.ExtendedPhotoID{ID: library.PhotoID(id)},
+			PhotoMeta: library.PhotoMeta{Format: domain.MustFormatForExt("jpg"), Orientation: domain.Rotate90Orientation,
+				Width: 68, Height: 100},
+		}
+	}
+	open := func(t *testing.T, cache *library.ViewCache, p *library.Photo, opts library.ViewOptions) image.Image {
+		view, size, err := cache.Open(ctx, p, content, opts)
+		if err != nil {
+			t.Fatalf("Failed to open view: %s", err)
+		}
+		defer view.Close()
+		assert.True(t, size > 0)
+		img, err := opts.Format.Decode(view)
+		if err != nil {
+			t.Fatalf("Failed to decode view: %s", err)
+		}
+		return img
+	}
+	small := library.ViewOptions{Width: 40, Format: domain.WEBP, Quality: 80}
+	full := library.ViewOptions{Format: domain.JPEG, Quality: 90}
+
+	cache, err := library.NewViewCache(dir, library.DefaultViewCacheSize)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %s", err)
+	}
+	// The photo is rotated before it is resized
+	img := open(t, cache, photo("a"), small)
+	assert.Equal(t, 40, img.Bounds().Dx())
+	assert.True(t, img.Bounds().Dy() > 40)
+	img = open(t, cache, photo("a"), full)
+	assert.Equal(t, 68, img.Bounds().Dx())
+	assert.Len(t, viewFiles(t, dir), 2)
+	// Photos are not enlarged, larger widths share the view of the full size
+	for _, width := range []int{68, 100, 4000} {
+		img = open(t, cache, photo("a"), library.ViewOptions{Width: width, Format: full.Format, Quality: full.Quality})
+		assert.Equal(t, 68, img.Bounds().Dx())
+	}
+	assert.Len(t, viewFiles(t, dir), 2)
+
+	// Views are found again after a restart, the least recently used ones are evicted
+	cache, err = library.NewViewCache(dir, 1)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %s", err)
+	}
+	assert.Len(t, viewFiles(t, dir), 1)
+	open(t, cache, photo("b"), small)
+	assert.Len(t, viewFiles(t, dir), 1)
+
+	if err := cache.RemovePhoto(ctx, photo("b")); err != nil {
+		t.Fatalf("Failed to remove photo: %s", err)
+	}
+	assert.Empty(t, viewFiles(t, dir))
+}
+
+func viewFiles(t *testing.T, dir string) []string {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, len(files))
+	for i, f := range files {
+		names[i] = f.Name()
+	}
+	return names
+}
@@ -0,0 +1,142 @@
+package maintenance
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"bitbucket.org/kleinnic74/photos/importer"
+	"bitbucket.org/kleinnic74/photos/library"
+	"bitbucket.org/kleinnic74/photos/logging"
+	"bitbucket.org/kleinnic74/photos/tasks"
+	"go.uber.org/zap"
+)
+
+// Checker verifies the consistency of the library with its files and repairs it
+type Checker interface {
+	CheckIntegrity(ctx context.Context) (*library.IntegrityReport, error)
+	QuarantineFile(ctx context.Context, path string) (string, error)
+	DeleteOrphanThumbs(ctx context.Context, name string) error
+	RegenerateThumbs(ctx context.Context, id library.PhotoID) error
+}
+
+// Repair is an action taken to fix an integrity issue
+type Repair struct {
+	Issue  library.IntegrityIssue `json:"issue"`
+	Action string                 `json:"action"`
+	Error  string                 `json:"error,omitempty"`
+}
+
+// IntegrityReport is the result of a library check with the repairs made
+type IntegrityReport struct {
+	library.IntegrityReport
+	Repairs []Repair `json:"repairs,omitempty"`
+}
+
+// IntegrityChecker runs library checks and keeps the report of the last check
+type IntegrityChecker struct {
+	checker Checker
+
+	mutex sync.RWMutex
+	last  *IntegrityReport
+}
+
+func NewIntegrityChecker(checker Checker) *IntegrityChecker {
+	return &IntegrityChecker{checker: checker}
+}
+
+// RegisterTasks defines the user-runnable task checking the library
+func (c *IntegrityChecker) RegisterTasks(repo *tasks.TaskRepository) {
+	repo.RegisterWithProperties("checkLibrary", func() tasks.Task {
+		return &checkLibraryTask{checker: c}
+	}, tasks.TaskProperties{
+		UserRunnable: true,
+	})
+}
+
+// LastReport returns the report of the last completed check
+func (c *IntegrityChecker) LastReport() (IntegrityReport, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	if c.last == nil {
+		return IntegrityReport{}, false
+	}
+	return *c.last, true
+}
+
+type checkLibraryTask struct {
+	checker *IntegrityChecker
+
+	ReimportOrphans    bool `json:"reimportOrphans"`
+	DropDangling       bool `json:"dropDangling"`
+	DeleteOrphanThumbs bool `json:"deleteOrphanThumbs"`
+	RegenerateThumbs   bool `json:"regenerateThumbs"`
+}
+
+func (t *checkLibraryTask) Describe() string {
+	var repairs []string
+	if t.ReimportOrphans {
+		repairs = append(repairs, "re-import orphans")
+	}
+	if t.DropDangling {
+		repairs = append(repairs, "drop dangling records")
+	}
+	if t.DeleteOrphanThumbs {
+		repairs = append(repairs, "delete orphan thumbnails")
+	}
+	if t.RegenerateThumbs {
+		repairs = append(repairs, "regenerate missing thumbnails")
+	}
+	if len(repairs) == 0 {
+		return "Checking library integrity"
+	}
+	return fmt.Sprintf("Checking library integrity (%s)", strings.Join(repairs, ", "))
+}
+
+func (t *checkLibraryTask) Execute(ctx context.Context, executor tasks.TaskExecutor, lib library.PhotoLibrary) error {
+	logger, ctx := logging.SubFrom(ctx, "checkLibrary")
+	checked, err := t.checker.checker.CheckIntegrity(ctx)
+	if err != nil {
+		return err
+	}
+	report := &IntegrityReport{IntegrityReport: *checked}
+	for _, issue := range checked.Issues {
+		action, err := t.repair(ctx, issue, executor, lib)
+		if action == "" {
+			continue
+		}
+		repair := Repair{Issue: issue, Action: action}
+		if err != nil {
+			logger.Warn("Repair failed", zap.String("action", action), zap.String("path", issue.Path), zap.Error(err))
+			repair.Error = err.Error()
+		}
+		report.Repairs = append(report.Repairs, repair)
+	}
+	t.checker.mutex.Lock()
+	defer t.checker.mutex.Unlock()
+	t.checker.last = report
+	return nil
+}
+
+// repair fixes the given issue if the corresponding repair has been requested, it
+// returns the action taken or an empty string if the issue was left as is. Originals whose
+// size or hash do not match are only reported, they cannot be repaired
+func (t *checkLibraryTask) repair(ctx context.Context, issue library.IntegrityIssue, executor tasks.TaskExecutor, lib library.PhotoLibrary) (string, error) {
+	switch {
+	case issue.Type == library.OrphanFile && t.ReimportOrphans:
+		path, err := t.checker.checker.QuarantineFile(ctx, issue.Path)
+		if err != nil {
+			return "reimport", err
+		}
+		_, err = executor.Submit(ctx, importer.NewImportFileTaskWithParams(false, path, true))
+		return "reimport", err
+	case issue.Type == library.MissingFile && t.DropDangling:
+		return "drop", lib.Delete(ctx, issue.Photo)
+	case issue.Type == library.OrphanThumbs && t.DeleteOrphanThumbs:
+		return "deleteThumbs", t.checker.checker.DeleteOrphanThumbs(ctx, issue.Path)
+	case issue.Type == library.MissingThumbs && t.RegenerateThumbs:
+		return "regenerateThumbs", t.checker.checker.RegenerateThumbs(ctx, issue.Photo)
+	}
+	return "", nil
+}
@@ -0,0 +1,100 @@
+package maintenance
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"bitbucket.org/kleinnic74/photos/domain"
+	"bitbucket.org/kleinnic74/photos/library"
+	"bitbucket.org/kleinnic74/photos/library/librarytest"
+	"bitbucket.org/kleinnic74/photos/tasks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckLibrary(t *testing.T) {
+	ctx := context.Background()
+	lib, dir, _ := librarytest.NewLibrary(t)
+	photo := librarytest.AddFile(t, lib, "../domain/testdata/Canon_40D.jpg")
+	// Videos have no thumbs
+	librarytest.AddContent(t, lib, library.PhotoMeta{Name: "MOV_0001.MOV", Format: domain.MustFormatForExt("mov"), DateTaken: time.Now()}, []byte("not really a video"))
+	writeFile(t, filepath.Join(dir, "photos", "2001", "02", "03", "orphan.jpg"))
+	if err := os.MkdirAll(filepath.Join(dir, "thumbs", "unknown"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	checker := NewIntegrityChecker(lib)
+	executor := tasks.NewDummyTaskExecutor()
+
+	if _, found := checker.LastReport(); found {
+		t.Errorf("Unexpected report before first check")
+	}
+	task := &checkLibraryTask{checker: checker}
+	if err := task.Execute(ctx, executor, lib); err != nil {
+		t.Fatalf("Check failed: %s", err)
+	}
+	report, found := checker.LastReport()
+	assert.True(t, found)
+	assert.Equal(t, 2, report.Checked)
+	assert.Equal(t, []library.IntegrityIssue{
+		{Type: library.MissingThumbs, Photo: photo.ID, Path: photo.Path, Details: "missing " + thumbNames()},
+		{Type: library.OrphanFile, Path: filepath.Join("2001", "02", "03", "orphan.jpg")},
+		{Type: library.OrphanThumbs, Path: "unknown"},
+	}, report.Issues)
+	assert.Empty(t, report.Repairs)
+
+	task = &checkLibraryTask{checker: checker, RegenerateThumbs: true}
+	if err := task.Execute(ctx, executor, lib); err != nil {
+		t.Fatalf("Check failed: %s", err)
+	}
+	report, _ = checker.LastReport()
+	if assert.Len(t, report.Repairs, 1) {
+		assert.Equal(t, "regenerateThumbs", report.Repairs[0].Action)
+		assert.Empty(t, report.Repairs[0].Error)
+	}
+	for _, size := range domain.AllThumbSizes() {
+		assert.FileExists(t, filepath.Join(dir, "thumbs", string(photo.ID), size.Name+".jpg"))
+	}
+	assert.DirExists(t, filepath.Join(dir, "thumbs", "unknown"), "Orphan thumbs are kept")
+
+	if err := os.Remove(filepath.Join(dir, "photos", photo.Path)); err != nil {
+		t.Fatal(err)
+	}
+	task = &checkLibraryTask{checker: checker, ReimportOrphans: true, DropDangling: true, DeleteOrphanThumbs: true}
+	if err := task.Execute(ctx, executor, lib); err != nil {
+		t.Fatalf("Check failed: %s", err)
+	}
+	report, _ = checker.LastReport()
+	if assert.Len(t, report.Repairs, 3) {
+		assert.Equal(t, "drop", report.Repairs[0].Action)
+		assert.Equal(t, "reimport", report.Repairs[1].Action)
+		assert.Equal(t, "deleteThumbs", report.Repairs[2].Action)
+		for _, r := range report.Repairs {
+			assert.Empty(t, r.Error)
+		}
+	}
+	_, err := lib.Get(ctx, photo.ID)
+	assert.IsType(t, library.ErrNotFound(""), err, "Dangling photo should be dropped")
+	assert.FileExists(t, filepath.Join(dir, "orphans", "2001", "02", "03", "orphan.jpg"))
+	assert.NoDirExists(t, filepath.Join(dir, "thumbs", "unknown"))
+	assert.Len(t, executor.ListTasks(ctx), 1, "Orphan should be re-imported")
+}
+
+func thumbNames() string {
+	var names []string
+	for _, size := range domain.AllThumbSizes() {
+		names = append(names, size.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+func writeFile(t *testing.T, path string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("not a photo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
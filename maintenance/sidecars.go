@@ -0,0 +1,106 @@
+package maintenance
+
+import (
+	"context"
+	"fmt"
+
+	"bitbucket.org/kleinnic74/photos/consts"
+	"bitbucket.org/kleinnic74/photos/library"
+	"bitbucket.org/kleinnic74/photos/logging"
+	"bitbucket.org/kleinnic74/photos/tasks"
+	"go.uber.org/zap"
+)
+
+// SidecarLibrary writes XMP sidecars next to the files of the library
+type SidecarLibrary interface {
+	WriteSidecar(ctx context.Context, id library.PhotoID, keywords []string) error
+}
+
+// TagSource provides the current tags of a photo
+type TagSource interface {
+	TagsOf(ctx context.Context, id library.PhotoID) ([]string, error)
+}
+
+// SidecarWriter writes XMP sidecars for the photos of the library, so that other tools
+// can see the edits made in the library without changing the original files
+type SidecarWriter struct {
+	lib  SidecarLibrary
+	tags TagSource
+}
+
+func NewSidecarWriter(lib SidecarLibrary) *SidecarWriter {
+	return &SidecarWriter{lib: lib}
+}
+
+// UseTags writes the tags of the given source as keywords instead of the imported keywords
+func (w *SidecarWriter) UseTags(tags TagSource) {
+	w.tags = tags
+}
+
+// RegisterTasks defines the user-runnable task writing sidecars
+func (w *SidecarWriter) RegisterTasks(repo *tasks.TaskRepository) {
+	repo.RegisterWithProperties("writeSidecars", func() tasks.Task {
+		return &writeSidecarsTask{writer: w}
+	}, tasks.TaskProperties{
+		UserRunnable: true,
+	})
+}
+
+// Write writes the sidecar of the given photo
+func (w *SidecarWriter) Write(ctx context.Context, photo *library.Photo) error {
+	keywords := photo.Keywords
+	if w.tags != nil {
+		tags, err := w.tags.TagsOf(ctx, photo.ID)
+		if err != nil {
+			return err
+		}
+		keywords = tags
+	}
+	return w.lib.WriteSidecar(ctx, photo.ID, keywords)
+}
+
+type writeSidecarsTask struct {
+	writer *SidecarWriter
+
+	Photos []library.PhotoID `json:"photos,omitempty"`
+}
+
+func (t *writeSidecarsTask) Describe() string {
+	if len(t.Photos) == 0 {
+		return "Writing XMP sidecars of all photos"
+	}
+	return fmt.Sprintf("Writing XMP sidecars of %d photos", len(t.Photos))
+}
+
+func (t *writeSidecarsTask) Execute(ctx context.Context, executor tasks.TaskExecutor, lib library.PhotoLibrary) error {
+	logger, ctx := logging.SubFrom(ctx, "writeSidecars")
+	photos, err := t.photos(ctx, lib)
+	if err != nil {
+		return err
+	}
+	var count int
+	for _, p := range photos {
+		if err := t.writer.Write(ctx, p); err != nil {
+			logger.Warn("Failed to write sidecar", zap.String("photo", string(p.ID)), zap.Error(err))
+			continue
+		}
+		count++
+	}
+	logger.Info("Sidecars written", zap.Int("count", count))
+	return nil
+}
+
+func (t *writeSidecarsTask) photos(ctx context.Context, lib library.PhotoLibrary) ([]*library.Photo, error) {
+	if len(t.Photos) == 0 {
+		return lib.FindAll(ctx, consts.Ascending)
+	}
+	photos := make([]*library.Photo, 0, len(t.Photos))
+	for _, id := range t.Photos {
+		p, err := lib.Get(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		photos = append(photos, p)
+	}
+	return photos, nil
+}
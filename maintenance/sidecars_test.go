@@ -0,0 +1,65 @@
+package maintenance
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"bitbucket.org/kleinnic74/photos/domain/formats"
+	"bitbucket.org/kleinnic74/photos/library"
+	"bitbucket.org/kleinnic74/photos/library/librarytest"
+	"bitbucket.org/kleinnic74/photos/tasks"
+	"github.com/stretchr/testify/assert"
+)
+
+type fixedTags []string
+
+func (tags fixedTags) TagsOf(ctx context.Context, id library.PhotoID) ([]string, error) {
+	return tags, nil
+}
+
+func TestWriteSidecars(t *testing.T) {
+	ctx := context.Background()
+	lib, dir, _ := librarytest.NewLibrary(t)
+	photo := librarytest.AddFile(t, lib, "../domain/testdata/Canon_40D.jpg")
+	rating := 4
+	if _, err := lib.UpdateMeta(ctx, photo.ID, library.MetaUpdate{Rating: &rating}); err != nil {
+		t.Fatal(err)
+	}
+
+	writer := NewSidecarWriter(lib)
+	writer.UseTags(fixedTags{"beach", "sunset"})
+	task := &writeSidecarsTask{writer: writer}
+	if err := task.Execute(ctx, tasks.NewDummyTaskExecutor(), lib); err != nil {
+		t.Fatalf("Writing sidecars failed: %s", err)
+	}
+	path := filepath.Join(dir, "photos", library.SidecarPath(photo.Path))
+	in, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Sidecar not written: %s", err)
+	}
+	x, err := formats.ReadXMP(in)
+	in.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 4, x.Rating)
+	assert.Equal(t, []string{"beach", "sunset"}, x.Keywords)
+	assert.True(t, photo.DateTaken.Equal(x.DateTaken))
+
+	if err := lib.CreateThumbs(ctx, photo.ID, false); err != nil {
+		t.Fatal(err)
+	}
+	report, err := lib.CheckIntegrity(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, report.Issues, "Sidecars are not orphans")
+
+	if err := lib.Trash(ctx, photo.ID); err != nil {
+		t.Fatal(err)
+	}
+	assert.NoFileExists(t, path)
+	assert.FileExists(t, filepath.Join(dir, "trash", library.SidecarPath(photo.Path)))
+}
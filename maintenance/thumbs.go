@@ -0,0 +1,123 @@
+package maintenance
+
+import (
+	"context"
+	"fmt"
+
+	"bitbucket.org/kleinnic74/photos/consts"
+	"bitbucket.org/kleinnic74/photos/domain"
+	"bitbucket.org/kleinnic74/photos/library"
+	"bitbucket.org/kleinnic74/photos/logging"
+	"bitbucket.org/kleinnic74/photos/tasks"
+	"go.uber.org/zap"
+)
+
+// ThumbIndexVersion is the version of the thumbs index, photos indexed with an older version
+// get their thumbs created again
+const ThumbIndexVersion = library.Version(1)
+
+// ThumbLibrary creates the thumbs of the photos of the library
+type ThumbLibrary interface {
+	CreateThumbs(ctx context.Context, id library.PhotoID, overwrite bool) error
+	ThumbsOutdated() (bool, error)
+	ThumbsUpdated() error
+}
+
+// ThumbGenerator pregenerates the thumbs of all sizes so that browsing the library does not
+// wait for thumbs to be created
+type ThumbGenerator struct {
+	lib ThumbLibrary
+}
+
+func NewThumbGenerator(lib ThumbLibrary) *ThumbGenerator {
+	return &ThumbGenerator{lib: lib}
+}
+
+// RegisterTasks defines the task creating the thumbs of a photo, the user-runnable task
+// rebuilding all thumbs and the task rebuilding them on start when their sizes or quality changed
+func (g *ThumbGenerator) RegisterTasks(repo *tasks.TaskRepository) {
+	repo.Register("createThumbs", func() tasks.Task {
+		return &createThumbsTask{generator: g}
+	})
+	repo.RegisterWithProperties("rebuildThumbs", func() tasks.Task {
+		return &rebuildThumbsTask{generator: g, Force: true}
+	}, tasks.TaskProperties{
+		UserRunnable: true,
+	})
+	repo.RegisterWithProperties("updateThumbs", func() tasks.Task {
+		return &rebuildThumbsTask{generator: g}
+	}, tasks.TaskProperties{
+		RunOnStart: true,
+	})
+}
+
+// CreateThumbsOnAdd returns the task creating the thumbs of a new photo
+func (g *ThumbGenerator) CreateThumbsOnAdd(ctx context.Context, p *library.Photo) (tasks.Task, bool) {
+	return &createThumbsTask{generator: g, PhotoID: p.ID}, true
+}
+
+// create creates the thumbs of a photo, photos of formats without thumbs are skipped
+func (g *ThumbGenerator) create(ctx context.Context, id library.PhotoID, overwrite bool) error {
+	err := g.lib.CreateThumbs(ctx, id, overwrite)
+	if _, unsupported := err.(domain.ErrThumbsNotSupported); unsupported {
+		return nil
+	}
+	return err
+}
+
+type createThumbsTask struct {
+	generator *ThumbGenerator
+	PhotoID   library.PhotoID `json:"photoID"`
+}
+
+func (t *createThumbsTask) Describe() string {
+	return fmt.Sprintf("Creating thumbs of photo %s", t.PhotoID)
+}
+
+func (t *createThumbsTask) Execute(ctx context.Context, executor tasks.TaskExecutor, lib library.PhotoLibrary) error {
+	return t.generator.create(ctx, t.PhotoID, false)
+}
+
+type rebuildThumbsTask struct {
+	generator *ThumbGenerator
+
+	// Force rebuilds the thumbs even if their sizes and quality did not change
+	Force bool `json:"force"`
+}
+
+func (t *rebuildThumbsTask) Describe() string {
+	if t.Force {
+		return "Rebuilding thumbs of all photos"
+	}
+	return "Rebuilding thumbs of all photos if their sizes or quality changed"
+}
+
+func (t *rebuildThumbsTask) Execute(ctx context.Context, executor tasks.TaskExecutor, lib library.PhotoLibrary) error {
+	logger, ctx := logging.SubFrom(ctx, "rebuildThumbs")
+	if !t.Force {
+		// On first start the thumbs index creates the thumbs of all photos, only the settings
+		// are recorded so that later changes are detected
+		outdated, err := t.generator.lib.ThumbsOutdated()
+		if err != nil {
+			return err
+		}
+		if !outdated {
+			return t.generator.lib.ThumbsUpdated()
+		}
+	}
+	photos, err := lib.FindAll(ctx, consts.Ascending)
+	if err != nil {
+		return err
+	}
+	var count, failed int
+	for _, p := range photos {
+		if err := t.generator.create(ctx, p.ID, true); err != nil {
+			logger.Warn("Failed to rebuild thumbs", zap.String("photo", string(p.ID)), zap.Error(err))
+			failed++
+			continue
+		}
+		count++
+	}
+	logger.Info("Thumbs rebuilt", zap.Int("count", count), zap.Int("failed", failed))
+	return t.generator.lib.ThumbsUpdated()
+}
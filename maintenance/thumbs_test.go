@@ -0,0 +1,41 @@
+package maintenance
+
+import (
+	"context"
+	"testing"
+
+	"bitbucket.org/kleinnic74/photos/library"
+	"bitbucket.org/kleinnic74/photos/tasks"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingThumbLibrary struct {
+	outdated bool
+	created  []library.PhotoID
+	updated  int
+}
+
+func (lib *recordingThumbLibrary) CreateThumbs(ctx context.Context, id library.PhotoID, overwrite bool) error {
+	lib.created = append(lib.created, id)
+	return nil
+}
+
+func (lib *recordingThumbLibrary) ThumbsOutdated() (bool, error) {
+	return lib.outdated, nil
+}
+
+func (lib *recordingThumbLibrary) ThumbsUpdated() error {
+	lib.updated++
+	return nil
+}
+
+func TestUpdateThumbsOnlyRecordsSettingsIfNotOutdated(t *testing.T) {
+	lib := &recordingThumbLibrary{}
+	task := &rebuildThumbsTask{generator: NewThumbGenerator(lib)}
+	// The photo library is not needed when thumbs are not rebuilt
+	if err := task.Execute(context.Background(), tasks.NewDummyTaskExecutor(), nil); err != nil {
+		t.Fatalf("Failed to update thumbs: %s", err)
+	}
+	assert.Empty(t, lib.created, "Thumbs of new libraries are created by the thumbs index")
+	assert.Equal(t, 1, lib.updated, "Settings are recorded")
+}
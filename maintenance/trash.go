@@ -0,0 +1,58 @@
+// Package maintenance contains tasks keeping the photo library in good shape
+package maintenance
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"bitbucket.org/kleinnic74/photos/library"
+	"bitbucket.org/kleinnic74/photos/logging"
+	"bitbucket.org/kleinnic74/photos/tasks"
+	"go.uber.org/zap"
+)
+
+// DefaultTrashRetention is the time photos are kept in the trash before being purged
+const DefaultTrashRetention = 30 * 24 * time.Hour
+
+// RegisterTasks defines the maintenance tasks, trashed photos are kept for the given
+// retention period before being purged
+func RegisterTasks(repo *tasks.TaskRepository, retention time.Duration) {
+	repo.RegisterWithProperties("purgeTrash", func() tasks.Task {
+		return &purgeTrashTask{Retention: retention}
+	}, tasks.TaskProperties{
+		RunOnStart:   true,
+		UserRunnable: true,
+		RunEvery:     24 * time.Hour,
+	})
+}
+
+type purgeTrashTask struct {
+	Retention time.Duration `json:"retention"`
+}
+
+func (t *purgeTrashTask) Describe() string {
+	return fmt.Sprintf("Purging photos trashed more than %s ago", t.Retention)
+}
+
+func (t *purgeTrashTask) Execute(ctx context.Context, executor tasks.TaskExecutor, lib library.PhotoLibrary) error {
+	logger, ctx := logging.SubFrom(ctx, "purgeTrash")
+	trashed, err := lib.FindTrashed(ctx)
+	if err != nil {
+		return err
+	}
+	limit := time.Now().Add(-t.Retention)
+	var count int
+	for _, p := range trashed {
+		if p.TrashedAt.After(limit) {
+			continue
+		}
+		if err := lib.Delete(ctx, p.ID); err != nil {
+			logger.Warn("Failed to purge photo", zap.String("photo", string(p.ID)), zap.Error(err))
+			continue
+		}
+		count++
+	}
+	logger.Info("Trash purged", zap.Int("purged", count), zap.Int("trashed", len(trashed)))
+	return nil
+}
@@ -0,0 +1,192 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"bitbucket.org/kleinnic74/photos/library"
+	"bitbucket.org/kleinnic74/photos/library/boltstore"
+	"bitbucket.org/kleinnic74/photos/rest/cursor"
+	"bitbucket.org/kleinnic74/photos/rest/views"
+	"github.com/gorilla/mux"
+)
+
+var (
+	errorNoName = errors.New("Missing 'name'")
+)
+
+type AlbumsHandler struct {
+	albums *boltstore.AlbumIndex
+	lib    library.PhotoLibrary
+}
+
+type albumRequest struct {
+	Name  string          `json:"name"`
+	Cover library.PhotoID `json:"cover,omitempty"`
+}
+
+type albumPhotosRequest struct {
+	Photos   []library.PhotoID `json:"photos"`
+	Position *int              `json:"position,omitempty"`
+}
+
+func NewAlbumsHandler(albums *boltstore.AlbumIndex, lib library.PhotoLibrary) *AlbumsHandler {
+	return &AlbumsHandler{albums, lib}
+}
+
+func (h *AlbumsHandler) InitRoutes(r *mux.Router) {
+	r.HandleFunc("/albums", h.listAlbums).Methods(http.MethodGet)
+	r.HandleFunc("/albums", h.createAlbum).Methods(http.MethodPost)
+	r.HandleFunc("/albums/{id}", h.getAlbum).Methods(http.MethodGet)
+	r.HandleFunc("/albums/{id}", h.updateAlbum).Methods(http.MethodPatch)
+	r.HandleFunc("/albums/{id}", h.deleteAlbum).Methods(http.MethodDelete)
+	r.HandleFunc("/albums/{id}/photos", h.photosForAlbum).Methods(http.MethodGet)
+	r.HandleFunc("/albums/{id}/photos", h.addPhotos).Methods(http.MethodPost)
+	r.HandleFunc("/albums/{id}/photos", h.setPhotos).Methods(http.MethodPut)
+	r.HandleFunc("/albums/{id}/photos/{photo}", h.removePhoto).Methods(http.MethodDelete)
+}
+
+func (h *AlbumsHandler) listAlbums(w http.ResponseWriter, r *http.Request) {
+	page := cursor.DecodeFromRequest(r)
+	responder := Respond(r)
+	albums, hasMore, err := h.albums.FindPaged(r.Context(), page.Start, page.PageSize)
+	if err != nil {
+		responder.WithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	v := make([]views.Album, len(albums))
+	for i := range albums {
+		v[i] = views.AlbumFrom(&albums[i])
+	}
+	responder.WithJSON(w, http.StatusOK, cursor.PageFor(v, page, hasMore))
+}
+
+func (h *AlbumsHandler) createAlbum(w http.ResponseWriter, r *http.Request) {
+	responder := Respond(r)
+	var req albumRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		responder.WithError(w, http.StatusBadRequest, err)
+		return
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		responder.WithError(w, http.StatusBadRequest, errorNoName)
+		return
+	}
+	album, err := h.albums.Create(r.Context(), strings.TrimSpace(req.Name))
+	if err != nil {
+		responder.WithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	responder.WithJSON(w, http.StatusCreated, views.AlbumFrom(album))
+}
+
+func (h *AlbumsHandler) getAlbum(w http.ResponseWriter, r *http.Request) {
+	album, err := h.albums.Get(r.Context(), albumID(r))
+	h.respondWithAlbum(w, r, album, err)
+}
+
+func (h *AlbumsHandler) updateAlbum(w http.ResponseWriter, r *http.Request) {
+	var req albumRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		Respond(r).WithError(w, http.StatusBadRequest, err)
+		return
+	}
+	album, err := h.albums.Update(r.Context(), albumID(r), strings.TrimSpace(req.Name), req.Cover)
+	h.respondWithAlbum(w, r, album, err)
+}
+
+func (h *AlbumsHandler) deleteAlbum(w http.ResponseWriter, r *http.Request) {
+	if err := h.albums.Delete(r.Context(), albumID(r)); err != nil {
+		respondWithAlbumError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AlbumsHandler) photosForAlbum(w http.ResponseWriter, r *http.Request) {
+	responder := Respond(r)
+	page := cursor.DecodeFromRequest(r)
+	// Photos in the trash are not shown
+	photos, hasMore, next, err := existingPage(r.Context(), h.lib, func(start, max int) ([]library.PhotoID, bool, error) {
+		return h.albums.FindPhotosPaged(r.Context(), albumID(r), start, max)
+	}, page)
+	if err != nil {
+		respondWithAlbumError(w, r, err)
+		return
+	}
+	v := make([]views.Photo, len(photos))
+	for i, p := range photos {
+		v[i] = views.PhotoFrom(p)
+	}
+	responder.WithJSON(w, http.StatusOK, cursor.PageFor(v, page.ContinueAt(next), hasMore))
+}
+
+func (h *AlbumsHandler) addPhotos(w http.ResponseWriter, r *http.Request) {
+	req, ok := h.decodePhotos(w, r)
+	if !ok {
+		return
+	}
+	position := -1
+	if req.Position != nil {
+		position = *req.Position
+	}
+	album, err := h.albums.AddPhotos(r.Context(), albumID(r), position, req.Photos)
+	h.respondWithAlbum(w, r, album, err)
+}
+
+func (h *AlbumsHandler) setPhotos(w http.ResponseWriter, r *http.Request) {
+	req, ok := h.decodePhotos(w, r)
+	if !ok {
+		return
+	}
+	album, err := h.albums.SetPhotos(r.Context(), albumID(r), req.Photos)
+	h.respondWithAlbum(w, r, album, err)
+}
+
+func (h *AlbumsHandler) removePhoto(w http.ResponseWriter, r *http.Request) {
+	photo := library.PhotoID(mux.Vars(r)["photo"])
+	album, err := h.albums.RemovePhotos(r.Context(), albumID(r), []library.PhotoID{photo})
+	h.respondWithAlbum(w, r, album, err)
+}
+
+// decodePhotos reads the list of photos from the request and checks that all photos exist
+func (h *AlbumsHandler) decodePhotos(w http.ResponseWriter, r *http.Request) (req albumPhotosRequest, ok bool) {
+	responder := Respond(r)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		responder.WithError(w, http.StatusBadRequest, err)
+		return
+	}
+	for _, id := range req.Photos {
+		if _, err := h.lib.Get(r.Context(), id); err != nil {
+			responder.WithError(w, http.StatusBadRequest, fmt.Errorf("No photo with id %s", id))
+			return
+		}
+	}
+	return req, true
+}
+
+func (h *AlbumsHandler) respondWithAlbum(w http.ResponseWriter, r *http.Request, album *boltstore.Album, err error) {
+	if err != nil {
+		respondWithAlbumError(w, r, err)
+		return
+	}
+	Respond(r).WithJSON(w, http.StatusOK, views.AlbumFrom(album))
+}
+
+func respondWithAlbumError(w http.ResponseWriter, r *http.Request, err error) {
+	switch err.(type) {
+	case boltstore.ErrNoSuchAlbum:
+		Respond(r).WithError(w, http.StatusNotFound, err)
+	case boltstore.ErrPhotoNotInAlbum:
+		Respond(r).WithError(w, http.StatusBadRequest, err)
+	default:
+		respondWithLibraryError(w, r, err)
+	}
+}
+
+func albumID(r *http.Request) boltstore.AlbumID {
+	return boltstore.AlbumID(mux.Vars(r)["id"])
+}
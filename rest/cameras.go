@@ -0,0 +1,40 @@
+package rest
+
+import (
+	"net/http"
+
+	"bitbucket.org/kleinnic74/photos/library/boltstore"
+	"bitbucket.org/kleinnic74/photos/rest/cursor"
+	"github.com/gorilla/mux"
+)
+
+type CamerasHandler struct {
+	cameras *boltstore.CameraIndex
+}
+
+func NewCamerasHandler(cameras *boltstore.CameraIndex) *CamerasHandler {
+	return &CamerasHandler{cameras}
+}
+
+func (h *CamerasHandler) InitRoutes(r *mux.Router) {
+	r.HandleFunc("/cameras", h.listCameras).Methods(http.MethodGet)
+}
+
+func (h *CamerasHandler) listCameras(w http.ResponseWriter, r *http.Request) {
+	page := cursor.DecodeFromRequest(r)
+	responder := Respond(r)
+	cameras, err := h.cameras.Cameras(r.Context())
+	if err != nil {
+		responder.WithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	end := page.Start + page.PageSize
+	if end > len(cameras) {
+		end = len(cameras)
+	}
+	result := []boltstore.CameraCount{}
+	if page.Start < end {
+		result = cameras[page.Start:end]
+	}
+	responder.WithJSON(w, http.StatusOK, cursor.PageFor(result, page, end < len(cameras)))
+}
@@ -15,6 +15,10 @@ type Cursor struct {
 	Start    int
 	PageSize int
 	Order    consts.SortOrder `json:"order,omitempty"`
+	// Offset is the position of the first photo of the page in the unfiltered source of a
+	// filtered listing, 0 if unknown
+	Offset int `json:"offset,omitempty"`
+	next   int
 }
 
 var (
@@ -44,6 +48,13 @@ func DecodeFromRequest(r *http.Request) Cursor {
 		cursor.Order = consts.Descending
 	default:
 	}
+	// Cursors are decoded from the client, handlers can rely on valid bounds
+	if cursor.Start < 0 {
+		cursor.Start = 0
+	}
+	if cursor.PageSize < 0 {
+		cursor.PageSize = defaultPageSize
+	}
 	return cursor
 }
 
@@ -68,11 +79,23 @@ func (c Cursor) Encode() string {
 
 func (c Cursor) Previous() (Cursor, bool) {
 	if c.Start > 0 {
-		return Cursor{Start: c.Start - c.PageSize, PageSize: c.PageSize, Order: c.Order}, true
+		start := c.Start - c.PageSize
+		if start < 0 {
+			start = 0
+		}
+		return Cursor{Start: start, PageSize: c.PageSize, Order: c.Order}, true
 	}
 	return Cursor{}, false
 }
 
 func (c Cursor) Next() (Cursor, bool) {
-	return Cursor{Start: c.Start + c.PageSize, PageSize: c.PageSize, Order: c.Order}, true
+	return Cursor{Start: c.Start + c.PageSize, PageSize: c.PageSize, Order: c.Order, Offset: c.next}, true
+}
+
+// ContinueAt returns this cursor with the position in the unfiltered source where the
+// next page starts, so that filtered listings do not need to scan the source from the
+// beginning for each page
+func (c Cursor) ContinueAt(offset int) Cursor {
+	c.next = offset
+	return c
 }
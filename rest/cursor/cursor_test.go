@@ -1,6 +1,8 @@
 package cursor_test
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"bitbucket.org/kleinnic74/photos/rest/cursor"
@@ -84,3 +86,13 @@ func TestDecodeCursor(t *testing.T) {
 		assert.Equal(t, d.Next, next, "%d: bad NEXT cursor", i)
 	}
 }
+
+func TestDecodeFromRequestClampsBounds(t *testing.T) {
+	encoded := cursor.Cursor{Start: -5, PageSize: -1}.Encode()
+	c := cursor.DecodeFromRequest(httptest.NewRequest(http.MethodGet, "/tags?c="+encoded, nil))
+	assert.Equal(t, 0, c.Start)
+	assert.Equal(t, 20, c.PageSize)
+	previous, hasPrevious := cursor.Cursor{Start: 5, PageSize: 20}.Previous()
+	assert.True(t, hasPrevious)
+	assert.Equal(t, 0, previous.Start)
+}
@@ -0,0 +1,79 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"bitbucket.org/kleinnic74/photos/classification"
+	"bitbucket.org/kleinnic74/photos/library"
+	"bitbucket.org/kleinnic74/photos/rest/cursor"
+	"bitbucket.org/kleinnic74/photos/rest/views"
+	"github.com/gorilla/mux"
+)
+
+// maxHashDistance is the number of bits of a perceptual hash
+const maxHashDistance = 64
+
+type DuplicatesHandler struct {
+	hasher *classification.PerceptualHasher
+	lib    library.PhotoLibrary
+}
+
+// duplicates is a group of visually similar photos
+type duplicates struct {
+	Photos []views.Photo `json:"photos"`
+}
+
+func NewDuplicatesHandler(hasher *classification.PerceptualHasher, lib library.PhotoLibrary) *DuplicatesHandler {
+	return &DuplicatesHandler{hasher, lib}
+}
+
+func (h *DuplicatesHandler) InitRoutes(r *mux.Router) {
+	r.HandleFunc("/duplicates", h.listDuplicates).Methods(http.MethodGet).Name("/duplicates")
+}
+
+// listDuplicates returns groups of similar photos, the query parameter 'threshold' is the
+// maximum Hamming distance between the perceptual hashes of similar photos
+func (h *DuplicatesHandler) listDuplicates(w http.ResponseWriter, r *http.Request) {
+	responder := Respond(r)
+	page := cursor.DecodeFromRequest(r)
+	threshold := classification.DefaultDuplicateThreshold
+	if v := r.FormValue("threshold"); v != "" {
+		var err error
+		if threshold, err = strconv.Atoi(v); err != nil || threshold < 0 || threshold > maxHashDistance {
+			responder.WithError(w, http.StatusBadRequest, fmt.Errorf("Invalid threshold '%s'", v))
+			return
+		}
+	}
+	clusters, err := h.hasher.FindDuplicates(r.Context(), threshold)
+	if err != nil {
+		responder.WithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	// Groups left with less than 2 photos after their photos were deleted or trashed are
+	// skipped, start and page size are relative to the remaining groups
+	result := make([]duplicates, 0, page.PageSize)
+	hasMore, skipped := false, 0
+	for _, cluster := range clusters {
+		var group duplicates
+		for _, id := range cluster {
+			if p, err := h.lib.Get(r.Context(), id); err == nil {
+				group.Photos = append(group.Photos, views.PhotoFrom(p))
+			}
+		}
+		if len(group.Photos) < 2 {
+			continue
+		}
+		if skipped < page.Start {
+			skipped++
+			continue
+		}
+		if len(result) == page.PageSize {
+			hasMore = true
+			break
+		}
+		result = append(result, group)
+	}
+	responder.WithJSON(w, http.StatusOK, cursor.PageFor(result, page, hasMore))
+}
@@ -0,0 +1,85 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"bitbucket.org/kleinnic74/photos/domain/gps"
+	"bitbucket.org/kleinnic74/photos/export"
+	"bitbucket.org/kleinnic74/photos/library"
+	"bitbucket.org/kleinnic74/photos/logging"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+type ExportHandler struct {
+	exporter *export.Exporter
+}
+
+func NewExportHandler(exporter *export.Exporter) *ExportHandler {
+	return &ExportHandler{exporter}
+}
+
+func (h *ExportHandler) InitRoutes(r *mux.Router) {
+	r.HandleFunc("/export", h.exportZip).Methods(http.MethodGet).Name("/export")
+}
+
+// exportZip streams a ZIP archive of the photos selected by the query parameters 'from' and 'to',
+// 'place', 'event' or 'ids' (comma separated). The parameter 'layout' is either 'dated' or 'flat'
+func (h *ExportHandler) exportZip(w http.ResponseWriter, r *http.Request) {
+	responder := Respond(r)
+	selection, err := selectionFromRequest(r)
+	if err != nil {
+		responder.WithError(w, http.StatusBadRequest, err)
+		return
+	}
+	layout, err := export.ParseLayout(r.FormValue("layout"))
+	if err != nil {
+		responder.WithError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := h.exporter.Check(r.Context(), selection); err != nil {
+		switch err {
+		case export.ErrNothingSelected:
+			responder.WithError(w, http.StatusNotFound, err)
+		case export.ErrInvalidSelection, export.ErrNoEvents:
+			responder.WithError(w, http.StatusBadRequest, err)
+		default:
+			responder.WithError(w, http.StatusInternalServerError, err)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"photos-%s.zip\"", time.Now().Format("20060102-150405")))
+	out := export.NewZipWriter(w)
+	// The response has already started, errors can only be logged from now on
+	if _, err := h.exporter.Export(r.Context(), selection, layout, out); err != nil {
+		logging.From(r.Context()).Error("Export failed", zap.Error(err))
+	}
+	if err := out.Close(); err != nil {
+		logging.From(r.Context()).Error("Failed to complete archive", zap.Error(err))
+	}
+}
+
+func selectionFromRequest(r *http.Request) (s export.Selection, err error) {
+	for _, p := range []struct {
+		name  string
+		value *time.Time
+	}{{"from", &s.From}, {"to", &s.To}} {
+		if v := r.FormValue(p.name); v != "" {
+			if *p.value, err = time.Parse("2006-01-02", v); err != nil {
+				return s, fmt.Errorf("Invalid date '%s' for '%s', expected YYYY-MM-DD", v, p.name)
+			}
+		}
+	}
+	s.Place = gps.PlaceID(r.FormValue("place"))
+	s.Event = r.FormValue("event")
+	if ids := r.FormValue("ids"); ids != "" {
+		for _, id := range strings.Split(ids, ",") {
+			s.Photos = append(s.Photos, library.PhotoID(strings.TrimSpace(id)))
+		}
+	}
+	return s, s.Validate()
+}
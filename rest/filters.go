@@ -0,0 +1,205 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"bitbucket.org/kleinnic74/photos/library"
+	"bitbucket.org/kleinnic74/photos/library/boltstore"
+	"bitbucket.org/kleinnic74/photos/logging"
+	"bitbucket.org/kleinnic74/photos/rest/cursor"
+	"go.uber.org/zap"
+)
+
+// filterBatchSize is the number of photos fetched at once from the source when filtering
+const filterBatchSize = 100
+
+// pageSource returns at most max photos starting at index start and whether more photos exist,
+// photos which are missing in the library are nil
+type pageSource func(start, max int) ([]*library.Photo, bool, error)
+
+// photoFilter restricts the photos returned by paged queries based on the
+// query parameters 'minRating', 'favorite', 'minDuration' and 'maxDuration'.
+// Durations only apply to videos, pictures are excluded when a duration is given.
+// Stacks are collapsed to their representative unless 'expanded' is true
+type photoFilter struct {
+	minRating    int
+	favoriteOnly bool
+	minDuration  time.Duration
+	maxDuration  time.Duration
+	expanded     bool
+	// hidden returns the photos of a batch hidden in their stack, nil if stacks are expanded
+	hidden func([]*library.Photo) (map[library.PhotoID]bool, error)
+}
+
+func filterFromRequest(r *http.Request) (f photoFilter, err error) {
+	if v := r.FormValue("minRating"); v != "" {
+		if f.minRating, err = strconv.Atoi(v); err != nil || f.minRating < 0 || f.minRating > 5 {
+			return f, fmt.Errorf("Invalid minRating '%s'", v)
+		}
+	}
+	if v := r.FormValue("favorite"); v != "" {
+		if f.favoriteOnly, err = strconv.ParseBool(v); err != nil {
+			return f, fmt.Errorf("Invalid value for favorite '%s'", v)
+		}
+	}
+	if v := r.FormValue("minDuration"); v != "" {
+		if f.minDuration, err = time.ParseDuration(v); err != nil || f.minDuration < 0 {
+			return f, fmt.Errorf("Invalid minDuration '%s'", v)
+		}
+	}
+	if v := r.FormValue("maxDuration"); v != "" {
+		if f.maxDuration, err = time.ParseDuration(v); err != nil || f.maxDuration <= 0 {
+			return f, fmt.Errorf("Invalid maxDuration '%s'", v)
+		}
+	}
+	if v := r.FormValue("expanded"); v != "" {
+		if f.expanded, err = strconv.ParseBool(v); err != nil {
+			return f, fmt.Errorf("Invalid value for expanded '%s'", v)
+		}
+	}
+	return
+}
+
+// collapseStacks hides the photos of stacks other than their representative, unless the stacks
+// are expanded. Photos in the trash are not part of any stack
+func (f *photoFilter) collapseStacks(ctx context.Context, stacks *boltstore.StackIndex) {
+	if stacks == nil || f.expanded {
+		return
+	}
+	f.hidden = func(batch []*library.Photo) (map[library.PhotoID]bool, error) {
+		memberships, err := stackMemberships(ctx, stacks, batch)
+		if err != nil {
+			return nil, err
+		}
+		hidden := make(map[library.PhotoID]bool)
+		for id, m := range memberships {
+			hidden[id] = m.Representative != id
+		}
+		return hidden, nil
+	}
+}
+
+// stackMemberships returns the stacks of the given photos, nil if there is no stack index
+func stackMemberships(ctx context.Context, stacks *boltstore.StackIndex, photos []*library.Photo) (map[library.PhotoID]boltstore.StackMembership, error) {
+	if stacks == nil {
+		return nil, nil
+	}
+	ids := make([]library.PhotoID, len(photos))
+	for i, p := range photos {
+		ids[i] = p.ID
+	}
+	return stacks.MembershipsOf(ctx, ids)
+}
+
+func (f photoFilter) isEmpty() bool {
+	return f.minRating == 0 && !f.favoriteOnly && !f.filtersDuration() && f.hidden == nil
+}
+
+func (f photoFilter) filtersDuration() bool {
+	return f.minDuration != 0 || f.maxDuration != 0
+}
+
+func (f photoFilter) matches(p *library.Photo) bool {
+	if p.Rating < f.minRating {
+		return false
+	}
+	if f.favoriteOnly && !p.Favorite {
+		return false
+	}
+	if !f.filtersDuration() {
+		return true
+	}
+	if p.Video == nil {
+		return false
+	}
+	return p.Video.Duration >= f.minDuration && (f.maxDuration == 0 || p.Video.Duration <= f.maxDuration)
+}
+
+// page returns the page of photos matching this filter at the position of the cursor, start and
+// page size are relative to the filtered result. The position of the next page in the source
+// is returned for the cursor of the next page
+func (f photoFilter) page(source pageSource, c cursor.Cursor) (photos []*library.Photo, hasMore bool, next int, err error) {
+	if f.isEmpty() {
+		photos, hasMore, err = source(c.Start, c.PageSize)
+		return existing(photos), hasMore, 0, err
+	}
+	return f.scan(source, c)
+}
+
+// existingPage returns the page of the photos with the given IDs which are in the library,
+// start and page size of the cursor are relative to the photos found
+func existingPage(ctx context.Context, lib library.PhotoLibrary, ids func(start, max int) ([]library.PhotoID, bool, error), c cursor.Cursor) ([]*library.Photo, bool, int, error) {
+	return photoFilter{}.scan(idSource(ctx, lib, ids), c)
+}
+
+// scan returns the page of photos matching this filter by scanning the source from the offset
+// of the cursor, or from the beginning if the offset is unknown
+func (f photoFilter) scan(source pageSource, c cursor.Cursor) (photos []*library.Photo, hasMore bool, next int, err error) {
+	offset, skip := c.Offset, 0
+	if offset == 0 {
+		skip = c.Start
+	}
+	for ; ; offset += filterBatchSize {
+		batch, more, err := source(offset, filterBatchSize)
+		if err != nil {
+			return nil, false, 0, err
+		}
+		var hidden map[library.PhotoID]bool
+		if f.hidden != nil {
+			if hidden, err = f.hidden(existing(batch)); err != nil {
+				return nil, false, 0, err
+			}
+		}
+		for i, p := range batch {
+			if p == nil || hidden[p.ID] || !f.matches(p) {
+				continue
+			}
+			if skip > 0 {
+				skip--
+				continue
+			}
+			if len(photos) == c.PageSize {
+				return photos, true, offset + i, nil
+			}
+			photos = append(photos, p)
+		}
+		if !more {
+			return photos, false, 0, nil
+		}
+	}
+}
+
+// existing returns the photos of a batch without the ones missing in the library
+func existing(batch []*library.Photo) []*library.Photo {
+	photos := make([]*library.Photo, 0, len(batch))
+	for _, p := range batch {
+		if p != nil {
+			photos = append(photos, p)
+		}
+	}
+	return photos
+}
+
+// idSource adapts a paged source of photo IDs, IDs of photos which cannot be found
+// in the library are logged and returned as nil to keep the positions of the others
+func idSource(ctx context.Context, lib library.PhotoLibrary, ids func(start, max int) ([]library.PhotoID, bool, error)) pageSource {
+	return func(start, max int) ([]*library.Photo, bool, error) {
+		page, hasMore, err := ids(start, max)
+		if err != nil {
+			return nil, false, err
+		}
+		photos := make([]*library.Photo, len(page))
+		for i, id := range page {
+			if p, err := lib.Get(ctx, id); err == nil {
+				photos[i] = p
+			} else {
+				logging.From(ctx).Warn("Unknown photo referenced in index", zap.String("id", string(id)))
+			}
+		}
+		return photos, hasMore, nil
+	}
+}
@@ -0,0 +1,191 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"bitbucket.org/kleinnic74/photos/domain"
+	"bitbucket.org/kleinnic74/photos/library"
+	"bitbucket.org/kleinnic74/photos/rest/cursor"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilteredPage(t *testing.T) {
+	all := make([]*library.Photo, 250)
+	for i := range all {
+		all[i] = &library.Photo{
+			ExtendedPhotoID: library.ExtendedPhotoID{ID: library.PhotoID(fmt.Sprintf("%03d", i))},
+			PhotoMeta:       library.PhotoMeta{Rating: i % 6},
+			Favorite:        i%10 == 0,
+		}
+		if i%5 == 0 {
+			all[i].Video = &domain.VideoMetaData{Duration: time.Duration(i) * time.Second}
+		}
+	}
+	source := func(start, max int) ([]*library.Photo, bool, error) {
+		if start >= len(all) {
+			return nil, false, nil
+		}
+		end := start + max
+		if end > len(all) {
+			end = len(all)
+		}
+		return all[start:end], end < len(all), nil
+	}
+	data := []struct {
+		URL      string
+		start    int
+		pageSize int
+		expected []string
+		hasMore  bool
+	}{
+		{"/photos", 3, 2, []string{"003", "004"}, true},
+		{"/photos?minRating=5", 0, 3, []string{"005", "011", "017"}, true},
+		{"/photos?minRating=5", 40, 3, []string{"245"}, false},
+		{"/photos?favorite=true&minRating=4", 0, 3, []string{"010", "040", "070"}, true},
+		{"/photos?maxDuration=30s", 0, 3, []string{"000", "005", "010"}, true},
+		{"/photos?minDuration=2m&maxDuration=2m10s", 0, 5, []string{"120", "125", "130"}, false},
+	}
+	for _, d := range data {
+		t.Run(d.URL, func(t *testing.T) {
+			f, err := filterFromRequest(httptest.NewRequest(http.MethodGet, d.URL, nil))
+			if err != nil {
+				t.Fatalf("Failed to parse filter: %s", err)
+			}
+			photos, hasMore, _, err := f.page(source, cursor.Cursor{Start: d.start, PageSize: d.pageSize})
+			if err != nil {
+				t.Fatalf("Paging failed: %s", err)
+			}
+			ids := make([]string, len(photos))
+			for i, p := range photos {
+				ids[i] = string(p.ID)
+			}
+			assert.Equal(t, d.expected, ids)
+			assert.Equal(t, d.hasMore, hasMore)
+		})
+	}
+	t.Run("collapsed stacks", func(t *testing.T) {
+		var batches int
+		f := photoFilter{hidden: func(batch []*library.Photo) (map[library.PhotoID]bool, error) {
+			batches++
+			hidden := make(map[library.PhotoID]bool)
+			for _, p := range batch {
+				// Stacks of 3 photos represented by their first photo
+				hidden[p.ID] = p.ID[2]%3 != 0
+			}
+			return hidden, nil
+		}}
+		photos, hasMore, _, err := f.page(source, cursor.Cursor{Start: 40, PageSize: 3})
+		if err != nil {
+			t.Fatalf("Paging failed: %s", err)
+		}
+		ids := make([]string, len(photos))
+		for i, p := range photos {
+			ids[i] = string(p.ID)
+		}
+		assert.Equal(t, []string{"100", "103", "106"}, ids)
+		assert.True(t, hasMore)
+		assert.Equal(t, 2, batches, "Stacks should be looked up per batch")
+	})
+	t.Run("next pages", func(t *testing.T) {
+		f := photoFilter{minRating: 5}
+		c := cursor.Cursor{PageSize: 3}
+		var ids []string
+		for {
+			var first = -1
+			photos, hasMore, next, err := f.page(func(start, max int) ([]*library.Photo, bool, error) {
+				if first < 0 {
+					first = start
+				}
+				return source(start, max)
+			}, c)
+			if err != nil {
+				t.Fatalf("Paging failed: %s", err)
+			}
+			if c.Start > 0 {
+				assert.True(t, first > 0, "Page at %d should not be scanned from the beginning", c.Start)
+			}
+			for _, p := range photos {
+				ids = append(ids, string(p.ID))
+			}
+			if !hasMore {
+				break
+			}
+			c, _ = c.ContinueAt(next).Next()
+		}
+		assert.Len(t, ids, 41)
+		assert.Equal(t, []string{"005", "011", "017"}, ids[:3])
+		assert.Equal(t, "245", ids[40])
+	})
+}
+
+func TestInvalidFilter(t *testing.T) {
+	for _, url := range []string{"/photos?minRating=6", "/photos?minRating=x", "/photos?favorite=maybe",
+		"/photos?minDuration=long", "/photos?maxDuration=-1s", "/photos?expanded=maybe"} {
+		if _, err := filterFromRequest(httptest.NewRequest(http.MethodGet, url, nil)); err == nil {
+			t.Errorf("Expected error for %s", url)
+		}
+	}
+}
+
+func TestExistingPage(t *testing.T) {
+	ctx := context.Background()
+	lib := newPhotoLib()
+	var ids []library.PhotoID
+	for i := 0; i < 10; i++ {
+		id := fmt.Sprintf("%02d", i)
+		ids = append(ids, library.PhotoID(id))
+		lib.Add(ctx, library.PhotoMeta{Name: id}, nil)
+	}
+	for _, id := range []library.PhotoID{"01", "02", "05"} {
+		lib.Trash(ctx, id)
+	}
+	source := func(start, max int) ([]library.PhotoID, bool, error) {
+		if start >= len(ids) {
+			return nil, false, nil
+		}
+		end := start + max
+		if end > len(ids) {
+			end = len(ids)
+		}
+		return ids[start:end], end < len(ids), nil
+	}
+	data := []struct {
+		start    int
+		expected []string
+		hasMore  bool
+	}{
+		{0, []string{"00", "03", "04"}, true},
+		{3, []string{"06", "07", "08"}, true},
+		{6, []string{"09"}, false},
+	}
+	for _, d := range data {
+		photos, hasMore, _, err := existingPage(ctx, lib, source, cursor.Cursor{Start: d.start, PageSize: 3})
+		if err != nil {
+			t.Fatalf("Paging failed: %s", err)
+		}
+		ids := make([]string, len(photos))
+		for i, p := range photos {
+			ids[i] = string(p.ID)
+		}
+		assert.Equal(t, d.expected, ids, "Page at %d", d.start)
+		assert.Equal(t, d.hasMore, hasMore, "Page at %d", d.start)
+	}
+	c := cursor.Cursor{PageSize: 3}
+	for _, d := range data {
+		photos, _, next, err := existingPage(ctx, lib, source, c)
+		if err != nil {
+			t.Fatalf("Paging failed: %s", err)
+		}
+		ids := make([]string, len(photos))
+		for i, p := range photos {
+			ids[i] = string(p.ID)
+		}
+		assert.Equal(t, d.expected, ids, "Page at %d continued from offset %d", d.start, c.Offset)
+		c, _ = c.ContinueAt(next).Next()
+	}
+}
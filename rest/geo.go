@@ -10,7 +10,6 @@ import (
 	"bitbucket.org/kleinnic74/photos/rest/cursor"
 	"bitbucket.org/kleinnic74/photos/rest/views"
 	"github.com/gorilla/mux"
-	"go.uber.org/zap"
 )
 
 type GeoHandler struct {
@@ -42,47 +41,53 @@ func (g *GeoHandler) getGeoIndex(w http.ResponseWriter, r *http.Request) {
 }
 
 func (g *GeoHandler) getPhotosByPlace(w http.ResponseWriter, r *http.Request) {
-	log, ctx := logging.SubFrom(r.Context(), "geo")
+	_, ctx := logging.SubFrom(r.Context(), "geo")
 	c := cursor.DecodeFromRequest(r)
 	vars := mux.Vars(r)
 	placeID := gps.PlaceID(vars["placeID"])
 	responder := Respond(r)
-	photos, hasMore, err := g.index.FindByPlacePaged(ctx, placeID, c.Start, c.PageSize)
+	filter, err := filterFromRequest(r)
+	if err != nil {
+		responder.WithError(w, http.StatusBadRequest, err)
+		return
+	}
+	photos, hasMore, next, err := filter.page(idSource(ctx, g.photos, func(start, max int) ([]library.PhotoID, bool, error) {
+		return g.index.FindByPlacePaged(ctx, placeID, start, max)
+	}), c)
 	if err != nil {
 		responder.WithError(w, http.StatusInternalServerError, err)
 		return
 	}
 	var v []views.Photo
-	for _, p := range photos {
-		if photo, err := g.photos.Get(ctx, p); err == nil {
-			v = append(v, views.PhotoFrom(photo))
-		} else {
-			log.Warn("Unknown photo referenced in geoindex", zap.String("id", string(p)))
-		}
+	for _, photo := range photos {
+		v = append(v, views.PhotoFrom(photo))
 	}
-	responder.WithJSON(w, http.StatusOK, cursor.PageFor(v, c, hasMore))
+	responder.WithJSON(w, http.StatusOK, cursor.PageFor(v, c.ContinueAt(next), hasMore))
 }
 
 func (g *GeoHandler) getPhotosByCountry(w http.ResponseWriter, r *http.Request) {
-	log, ctx := logging.SubFrom(r.Context(), "geo")
+	_, ctx := logging.SubFrom(r.Context(), "geo")
 	c := cursor.DecodeFromRequest(r)
 	vars := mux.Vars(r)
 	responder := Respond(r)
 	countryID := gps.CountryID(vars["countryID"])
-	photos, hasMore, err := g.index.FindByCountryPaged(ctx, countryID, c.Start, c.PageSize)
+	filter, err := filterFromRequest(r)
+	if err != nil {
+		responder.WithError(w, http.StatusBadRequest, err)
+		return
+	}
+	photos, hasMore, next, err := filter.page(idSource(ctx, g.photos, func(start, max int) ([]library.PhotoID, bool, error) {
+		return g.index.FindByCountryPaged(ctx, countryID, start, max)
+	}), c)
 	if err != nil {
 		responder.WithError(w, http.StatusInternalServerError, err)
 		return
 	}
 	var v []views.Photo
-	for _, p := range photos {
-		if photo, err := g.photos.Get(ctx, p); err == nil {
-			v = append(v, views.PhotoFrom(photo))
-		} else {
-			log.Warn("Unknown photo referenced in geoindex", zap.String("id", string(p)))
-		}
+	for _, photo := range photos {
+		v = append(v, views.PhotoFrom(photo))
 	}
-	responder.WithJSON(w, http.StatusOK, cursor.PageFor(v, c, hasMore))
+	responder.WithJSON(w, http.StatusOK, cursor.PageFor(v, c.ContinueAt(next), hasMore))
 }
 
 type GeoCacheHandler struct {
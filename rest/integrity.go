@@ -0,0 +1,35 @@
+package rest
+
+import (
+	"errors"
+	"net/http"
+
+	"bitbucket.org/kleinnic74/photos/maintenance"
+	"github.com/gorilla/mux"
+)
+
+var (
+	errorNoIntegrityReport = errors.New("No library check has been run yet, launch task 'checkLibrary'")
+)
+
+type IntegrityHandler struct {
+	checker *maintenance.IntegrityChecker
+}
+
+func NewIntegrityHandler(checker *maintenance.IntegrityChecker) *IntegrityHandler {
+	return &IntegrityHandler{checker}
+}
+
+func (h *IntegrityHandler) InitRoutes(r *mux.Router) {
+	r.HandleFunc("/integrity", h.getReport).Methods(http.MethodGet).Name("/integrity")
+}
+
+// getReport returns the report of the last library check
+func (h *IntegrityHandler) getReport(w http.ResponseWriter, r *http.Request) {
+	report, found := h.checker.LastReport()
+	if !found {
+		Respond(r).WithError(w, http.StatusNotFound, errorNoIntegrityReport)
+		return
+	}
+	Respond(r).WithJSON(w, http.StatusOK, report)
+}
@@ -1,11 +1,22 @@
 package rest
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"sort"
+	"strconv"
+	"time"
 
+	"bitbucket.org/kleinnic74/photos/consts"
 	"bitbucket.org/kleinnic74/photos/domain"
+	"bitbucket.org/kleinnic74/photos/domain/formats"
+	"bitbucket.org/kleinnic74/photos/domain/gps"
 	"bitbucket.org/kleinnic74/photos/library"
+	"bitbucket.org/kleinnic74/photos/library/boltstore"
 	"bitbucket.org/kleinnic74/photos/logging"
 	"bitbucket.org/kleinnic74/photos/rest/cursor"
 	"bitbucket.org/kleinnic74/photos/rest/views"
@@ -15,12 +26,25 @@ import (
 
 var (
 	jpg = domain.MustFormatForExt("jpg")
+
+	errorNoCameraIndex = errors.New("Filtering by camera is not available")
+	errorNoViewCache   = errors.New("Resized views are not available")
+
+	// viewFormats are the formats photos can be converted to by /photos/{id}/view
+	viewFormats = map[string]domain.Format{
+		"jpg":  domain.JPEG,
+		"jpeg": domain.JPEG,
+		"webp": domain.WEBP,
+	}
 )
 
 // App is the REST API that can be used as an http.HandlerFunc
 type App struct {
-	router *mux.Router
-	lib    library.PhotoLibrary
+	router  *mux.Router
+	lib     library.PhotoLibrary
+	cameras *boltstore.CameraIndex
+	stacks  *boltstore.StackIndex
+	views   *library.ViewCache
 }
 
 // NewApp creates a new instance of the REST application
@@ -30,11 +54,31 @@ func NewApp(lib library.PhotoLibrary) (a *App) {
 
 }
 
+// UseCameraIndex enables the 'camera' query parameter of /photos
+func (a *App) UseCameraIndex(cameras *boltstore.CameraIndex) {
+	a.cameras = cameras
+}
+
+// UseStacks collapses stacks to their representative in /photos unless 'expanded' is true
+func (a *App) UseStacks(stacks *boltstore.StackIndex) {
+	a.stacks = stacks
+}
+
+// UseViewCache enables the 'w', 'format' and 'q' query parameters of /photos/{id}/view
+func (a *App) UseViewCache(views *library.ViewCache) {
+	a.views = views
+}
+
 func (a *App) InitRoutes(r *mux.Router) {
 	r.HandleFunc("/photos/{id}/view", a.getPhotoImage).Methods("GET").Name("/photos/{id}/view")
 	r.HandleFunc("/photos/{id}/thumb", a.getThumb).Methods("GET").Name("/photos/{id}/thumb")
 	r.HandleFunc("/photos/{id}", a.getPhoto).Methods("GET").Name("/photos/{id}")
+	r.HandleFunc("/photos/{id}", a.deletePhoto).Methods("DELETE").Name("/photos/{id}")
+	r.HandleFunc("/photos/{id}", a.patchPhoto).Methods("PATCH").Name("/photos/{id}")
 	r.HandleFunc("/photos", a.getPhotos).Methods("GET").Name("/photos")
+	r.HandleFunc("/trash/{id}/restore", a.restorePhoto).Methods("POST").Name("/trash/{id}/restore")
+	r.HandleFunc("/trash/{id}", a.purgePhoto).Methods("DELETE").Name("/trash/{id}")
+	r.HandleFunc("/trash", a.getTrash).Methods("GET").Name("/trash")
 }
 
 func (a *App) route(path string, f http.HandlerFunc) *mux.Route {
@@ -48,7 +92,30 @@ func (a *App) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 func (a *App) getPhotos(w http.ResponseWriter, r *http.Request) {
 	c := cursor.DecodeFromRequest(r)
 	responder := Respond(r)
-	photos, hasMore, err := a.lib.FindAllPaged(r.Context(), c.Start, c.PageSize, c.Order)
+	filter, err := filterFromRequest(r)
+	if err != nil {
+		responder.WithError(w, http.StatusBadRequest, err)
+		return
+	}
+	source := func(start, max int) ([]*library.Photo, bool, error) {
+		return a.lib.FindAllPaged(r.Context(), start, max, c.Order)
+	}
+	if camera := r.FormValue("camera"); camera != "" {
+		if a.cameras == nil {
+			responder.WithError(w, http.StatusBadRequest, errorNoCameraIndex)
+			return
+		}
+		source = idSource(r.Context(), a.lib, func(start, max int) ([]library.PhotoID, bool, error) {
+			return a.cameras.FindPhotosPaged(r.Context(), camera, start, max)
+		})
+	}
+	filter.collapseStacks(r.Context(), a.stacks)
+	photos, hasMore, next, err := filter.page(source, c)
+	if err != nil {
+		responder.WithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	memberships, err := stackMemberships(r.Context(), a.stacks, photos)
 	if err != nil {
 		responder.WithError(w, http.StatusInternalServerError, err)
 		return
@@ -57,9 +124,9 @@ func (a *App) getPhotos(w http.ResponseWriter, r *http.Request) {
 		zap.Bool("hasMore", hasMore), zap.Int("start", c.Start), zap.Int("page", c.PageSize))
 	photoViews := make([]views.Photo, len(photos))
 	for i, p := range photos {
-		photoViews[i] = views.PhotoFrom(p)
+		photoViews[i] = photoViewIn(p, memberships)
 	}
-	responder.WithJSON(w, http.StatusOK, cursor.PageFor(photoViews, c, hasMore))
+	responder.WithJSON(w, http.StatusOK, cursor.PageFor(photoViews, c.ContinueAt(next), hasMore))
 }
 
 func (a *App) getPhoto(w http.ResponseWriter, r *http.Request) {
@@ -78,10 +145,145 @@ func (a *App) getPhoto(w http.ResponseWriter, r *http.Request) {
 	responder.WithJSON(w, http.StatusOK, photo)
 }
 
+type photoPatch struct {
+	DateTaken   *time.Time          `json:"dateTaken,omitempty"`
+	Location    *gps.Coordinates    `json:"location,omitempty"`
+	Orientation *domain.Orientation `json:"orientation,omitempty"`
+	Rating      *int                `json:"rating,omitempty"`
+	Favorite    *bool               `json:"favorite,omitempty"`
+	Rejected    *bool               `json:"rejected,omitempty"`
+}
+
+func (p photoPatch) update() library.MetaUpdate {
+	return library.MetaUpdate{
+		DateTaken:   p.DateTaken,
+		Location:    p.Location,
+		Orientation: p.Orientation,
+		Rating:      p.Rating,
+		Favorite:    p.Favorite,
+		Rejected:    p.Rejected,
+	}
+}
+
+func (p photoPatch) validate() error {
+	if p.update().IsEmpty() {
+		return errors.New("Nothing to update")
+	}
+	if p.Rating != nil && (*p.Rating < 0 || *p.Rating > 5) {
+		return fmt.Errorf("Invalid rating %d", *p.Rating)
+	}
+	if p.Location != nil && !p.Location.IsValid() {
+		return fmt.Errorf("Invalid location %s", p.Location)
+	}
+	if p.Orientation != nil && (*p.Orientation < domain.NormalOrientation || *p.Orientation > domain.Rotate90Orientation) {
+		return fmt.Errorf("Invalid orientation %d", *p.Orientation)
+	}
+	return nil
+}
+
+// patchPhoto changes the date, location, orientation, rating and/or flags of a photo
+func (a *App) patchPhoto(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := library.PhotoID(vars["id"])
+	responder := Respond(r)
+	var patch photoPatch
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		responder.WithError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := patch.validate(); err != nil {
+		responder.WithError(w, http.StatusBadRequest, err)
+		return
+	}
+	photo, err := a.lib.UpdateMeta(r.Context(), id, patch.update())
+	if err != nil {
+		respondWithLibraryError(w, r, err)
+		return
+	}
+	responder.WithJSON(w, http.StatusOK, views.PhotoFrom(photo))
+}
+
+// deletePhoto moves the photo to the trash, unless the query parameter 'permanent' is true
+func (a *App) deletePhoto(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := library.PhotoID(vars["id"])
+	deleteFunc := a.lib.Trash
+	if r.URL.Query().Get("permanent") == "true" {
+		deleteFunc = a.lib.Delete
+	}
+	if err := deleteFunc(r.Context(), id); err != nil {
+		respondWithLibraryError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *App) getTrash(w http.ResponseWriter, r *http.Request) {
+	c := cursor.DecodeFromRequest(r)
+	responder := Respond(r)
+	photos, err := a.lib.FindTrashed(r.Context())
+	if err != nil {
+		responder.WithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	sort.Slice(photos, func(i, j int) bool {
+		if c.Order == consts.Descending {
+			return photos[i].TrashedAt.After(photos[j].TrashedAt)
+		}
+		return photos[i].TrashedAt.Before(photos[j].TrashedAt)
+	})
+	photoViews := make([]views.Photo, 0, c.PageSize)
+	for i := c.Start; i < len(photos) && i < c.Start+c.PageSize; i++ {
+		photoViews = append(photoViews, views.TrashedPhotoFrom(photos[i]))
+	}
+	responder.WithJSON(w, http.StatusOK, cursor.PageFor(photoViews, c, c.Start+c.PageSize < len(photos)))
+}
+
+func (a *App) restorePhoto(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := library.PhotoID(vars["id"])
+	photo, err := a.lib.Restore(r.Context(), id)
+	if err != nil {
+		respondWithLibraryError(w, r, err)
+		return
+	}
+	Respond(r).WithJSON(w, http.StatusOK, views.PhotoFrom(photo))
+}
+
+func (a *App) purgePhoto(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := library.PhotoID(vars["id"])
+	if err := a.lib.Delete(r.Context(), id); err != nil {
+		respondWithLibraryError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func respondWithLibraryError(w http.ResponseWriter, r *http.Request, err error) {
+	responder := Respond(r)
+	switch err.(type) {
+	case library.ErrNotFound:
+		responder.WithError(w, http.StatusNotFound, err)
+	default:
+		logging.From(r.Context()).Error("Internal error", zap.Error(err))
+		responder.WithError(w, http.StatusInternalServerError, err)
+	}
+}
+
 func (a *App) getPhotoImage(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := library.PhotoID(vars["id"])
 	responder := Respond(r)
+	opts, resized, err := viewOptionsFromRequest(r)
+	if err != nil {
+		responder.WithError(w, http.StatusBadRequest, err)
+		return
+	}
+	if resized {
+		a.getPhotoView(w, r, id, opts)
+		return
+	}
 	binary, photo, err := a.lib.OpenContent(r.Context(), id)
 	if binary == nil && err == nil {
 		responder.WithError(w, http.StatusNotFound, fmt.Errorf("No photo with id %s", id))
@@ -92,14 +294,95 @@ func (a *App) getPhotoImage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	defer binary.Close()
+	if photo.Format.HasPreview() {
+		// Browsers cannot display RAW files, their embedded JPEG preview is sent instead
+		preview, err := photo.Format.Preview(binary)
+		if err == formats.ErrNoPreview {
+			responder.WithError(w, http.StatusNotImplemented, err)
+			return
+		} else if err != nil {
+			responder.WithError(w, http.StatusInternalServerError, err)
+			return
+		}
+		respondWithBinary(w, domain.JPEG.Mime(), int64(len(preview)), bytes.NewReader(preview))
+		return
+	}
 	respondWithBinary(w, photo.Format.Mime(), photo.Size, binary)
 }
 
+// getPhotoView sends the photo resized and converted as requested, views are cached
+// so that they are only converted once
+func (a *App) getPhotoView(w http.ResponseWriter, r *http.Request, id library.PhotoID, opts library.ViewOptions) {
+	responder := Respond(r)
+	if a.views == nil {
+		responder.WithError(w, http.StatusNotImplemented, errorNoViewCache)
+		return
+	}
+	photo, err := a.lib.Get(r.Context(), id)
+	if err != nil {
+		respondWithLibraryError(w, r, err)
+		return
+	}
+	view, size, err := a.views.Open(r.Context(), photo, func() (io.ReadCloser, error) {
+		content, _, err := a.lib.OpenContent(r.Context(), id)
+		if content == nil && err == nil {
+			err = library.NotFound(id)
+		}
+		return content, err
+	}, opts)
+	switch {
+	case err == domain.ErrNoDecoderAvailable || err == formats.ErrNoPreview:
+		// Videos and RAW or HEIF files without a JPEG preview
+		responder.WithError(w, http.StatusNotImplemented, err)
+		return
+	case err != nil:
+		respondWithLibraryError(w, r, err)
+		return
+	}
+	defer view.Close()
+	respondWithBinary(w, opts.Format.Mime(), size, view)
+}
+
+// viewOptionsFromRequest returns the width, format and quality of the view requested by the
+// query parameters 'w', 'format' and 'q', resized is false if none of them is given
+func viewOptionsFromRequest(r *http.Request) (opts library.ViewOptions, resized bool, err error) {
+	opts = library.ViewOptions{Format: domain.JPEG, Quality: domain.DefaultQuality}
+	if v := r.FormValue("w"); v != "" {
+		if opts.Width, err = strconv.Atoi(v); err != nil || opts.Width <= 0 {
+			return opts, false, fmt.Errorf("Invalid width '%s'", v)
+		}
+		resized = true
+	}
+	if v := r.FormValue("format"); v != "" {
+		format, found := viewFormats[v]
+		if !found {
+			return opts, false, fmt.Errorf("Unsupported format '%s'", v)
+		}
+		opts.Format = format
+		resized = true
+	}
+	if v := r.FormValue("q"); v != "" {
+		if opts.Quality, err = strconv.Atoi(v); err != nil || opts.Quality < 1 || opts.Quality > 100 {
+			return opts, false, fmt.Errorf("Invalid quality '%s'", v)
+		}
+		resized = true
+	}
+	return opts, resized, nil
+}
+
 func (a *App) getThumb(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := library.PhotoID(vars["id"])
 	responder := Respond(r)
-	thumb, format, err := a.lib.OpenThumb(r.Context(), id, domain.Small)
+	size := domain.Small
+	if name := r.FormValue("size"); name != "" {
+		var found bool
+		if size, found = domain.ThumbSizes[name]; !found {
+			responder.WithError(w, http.StatusBadRequest, fmt.Errorf("Unknown thumb size '%s'", name))
+			return
+		}
+	}
+	thumb, format, err := a.lib.OpenThumb(r.Context(), id, size)
 	if err != nil {
 		switch err.(type) {
 		case library.ErrNotFound:
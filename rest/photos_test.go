@@ -6,6 +6,7 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -35,14 +36,101 @@ func TestGetAll(t *testing.T) {
 	checkResponseCode(t, http.StatusOK, response)
 }
 
+func TestDeletePhoto(t *testing.T) {
+	lib = newPhotoLib()
+	lib.Add(context.Background(), library.PhotoMeta{Name: "1234"}, nil)
+	a = NewApp(lib)
+
+	router := mux.NewRouter()
+	a.InitRoutes(router)
+
+	data := []struct {
+		id       string
+		expected int
+	}{
+		{"1234", http.StatusNoContent},
+		{"1234", http.StatusNotFound},
+	}
+	for _, d := range data {
+		req, _ := http.NewRequest("DELETE", "/photos/"+d.id, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		checkResponseCode(t, d.expected, rr.Result())
+	}
+}
+
 func checkResponseCode(t *testing.T, expected int, response *http.Response) {
 	if expected != response.StatusCode {
 		t.Fatalf("Bad response code: expected %d, got %d (%s)", expected, response.StatusCode, response.Status)
 	}
 }
 
+func TestTrashAndRestorePhoto(t *testing.T) {
+	lib = newPhotoLib()
+	lib.Add(context.Background(), library.PhotoMeta{Name: "1234"}, nil)
+	a = NewApp(lib)
+
+	router := mux.NewRouter()
+	a.InitRoutes(router)
+
+	data := []struct {
+		method   string
+		path     string
+		expected int
+	}{
+		{"DELETE", "/photos/1234", http.StatusNoContent},
+		{"GET", "/trash", http.StatusOK},
+		{"POST", "/trash/1234/restore", http.StatusOK},
+		{"POST", "/trash/1234/restore", http.StatusNotFound},
+		{"DELETE", "/photos/1234?permanent=true", http.StatusNoContent},
+		{"DELETE", "/trash/1234", http.StatusNotFound},
+	}
+	for _, d := range data {
+		req, _ := http.NewRequest(d.method, d.path, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		checkResponseCode(t, d.expected, rr.Result())
+	}
+}
+
+func TestPatchPhoto(t *testing.T) {
+	lib = newPhotoLib()
+	lib.Add(context.Background(), library.PhotoMeta{Name: "1234"}, nil)
+	a = NewApp(lib)
+
+	router := mux.NewRouter()
+	a.InitRoutes(router)
+
+	data := []struct {
+		id       string
+		body     string
+		expected int
+	}{
+		{"1234", `{"dateTaken":"2019-05-17T10:00:00Z","location":{"lat":46.5,"long":6.6},"orientation":6}`, http.StatusOK},
+		{"1234", `{"orientation":12}`, http.StatusBadRequest},
+		{"1234", `{"location":{"lat":100,"long":6.6}}`, http.StatusBadRequest},
+		{"1234", `{}`, http.StatusBadRequest},
+		{"1234", `not json`, http.StatusBadRequest},
+		{"5678", `{"orientation":1}`, http.StatusNotFound},
+	}
+	for _, d := range data {
+		req, _ := http.NewRequest("PATCH", "/photos/"+d.id, strings.NewReader(d.body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		checkResponseCode(t, d.expected, rr.Result())
+	}
+	p, _ := lib.Get(context.Background(), "1234")
+	if p.Orientation != domain.Rotate270Orientation {
+		t.Errorf("Bad orientation: expected %d, got %d", domain.Rotate270Orientation, p.Orientation)
+	}
+	if p.Location == nil || p.Location.Lat != 46.5 {
+		t.Errorf("Bad location: %v", p.Location)
+	}
+}
+
 type testLib struct {
-	photos []*library.Photo
+	photos  []*library.Photo
+	trashed []*library.Photo
 }
 
 func (lib *testLib) Add(ctx context.Context, p library.PhotoMeta, content io.Reader) error {
@@ -77,6 +165,65 @@ func (lib *testLib) Get(ctx context.Context, id library.PhotoID) (*library.Photo
 	return nil, library.NotFound(id)
 }
 
+func (lib *testLib) Delete(ctx context.Context, id library.PhotoID) error {
+	for i, p := range lib.photos {
+		if p.ID == id {
+			lib.photos = append(lib.photos[:i], lib.photos[i+1:]...)
+			return nil
+		}
+	}
+	return library.NotFound(id)
+}
+
+func (lib *testLib) UpdateMeta(ctx context.Context, id library.PhotoID, update library.MetaUpdate) (*library.Photo, error) {
+	p, err := lib.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if update.DateTaken != nil {
+		p.DateTaken = *update.DateTaken
+	}
+	if update.Location != nil {
+		p.Location = update.Location
+	}
+	if update.Orientation != nil {
+		p.Orientation = *update.Orientation
+	}
+	return p, nil
+}
+
+func (lib *testLib) PairLive(ctx context.Context, still, video library.PhotoID) error {
+	return errors.New("Not implemented")
+}
+
+func (lib *testLib) Trash(ctx context.Context, id library.PhotoID) error {
+	for i, p := range lib.photos {
+		if p.ID == id {
+			p.TrashedAt = time.Now()
+			lib.photos = append(lib.photos[:i], lib.photos[i+1:]...)
+			lib.trashed = append(lib.trashed, p)
+			return nil
+		}
+	}
+	return library.NotFound(id)
+}
+
+func (lib *testLib) Restore(ctx context.Context, id library.PhotoID) (*library.Photo, error) {
+	for i, p := range lib.trashed {
+		if p.ID == id {
+			p.TrashedAt = time.Time{}
+			lib.trashed = append(lib.trashed[:i], lib.trashed[i+1:]...)
+			lib.photos = append(lib.photos, p)
+			return p, nil
+		}
+	}
+	return nil, library.NotFound(id)
+}
+
+func (lib *testLib) FindTrashed(ctx context.Context) ([]*library.Photo, error) {
+	return lib.trashed, nil
+}
+
 func (lib *testLib) OpenContent(ctx context.Context, id library.PhotoID) (io.ReadCloser, *library.Photo, error) {
 	return nil, nil, errors.New("Not implemented")
 }
@@ -92,3 +239,22 @@ func (lib *testLib) FindByHash(ctx context.Context, hash library.BinaryHash) (*l
 func newPhotoLib() library.PhotoLibrary {
 	return &testLib{photos: make([]*library.Photo, 0)}
 }
+
+func TestViewOptionsFromRequest(t *testing.T) {
+	opts, resized, err := viewOptionsFromRequest(httptest.NewRequest(http.MethodGet, "/photos/1234/view?w=1920&format=webp&q=60", nil))
+	if err != nil {
+		t.Fatalf("Failed to parse view options: %s", err)
+	}
+	if !resized || opts.Width != 1920 || opts.Format.ID() != domain.WEBP.ID() || opts.Quality != 60 {
+		t.Errorf("Bad view options: %v", opts)
+	}
+	if _, resized, _ := viewOptionsFromRequest(httptest.NewRequest(http.MethodGet, "/photos/1234/view", nil)); resized {
+		t.Errorf("Expected original without view options")
+	}
+	for _, url := range []string{"/photos/1234/view?w=0", "/photos/1234/view?w=x", "/photos/1234/view?format=tiff",
+		"/photos/1234/view?q=0", "/photos/1234/view?q=101"} {
+		if _, _, err := viewOptionsFromRequest(httptest.NewRequest(http.MethodGet, url, nil)); err == nil {
+			t.Errorf("Expected error for %s", url)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package rest
+
+import (
+	"net/http"
+
+	"bitbucket.org/kleinnic74/photos/rest/cursor"
+	"bitbucket.org/kleinnic74/photos/rest/views"
+	"bitbucket.org/kleinnic74/photos/search"
+	"github.com/gorilla/mux"
+)
+
+type SearchHandler struct {
+	searcher *search.Searcher
+}
+
+// searchResult is a page of photos together with the plan used to find them
+type searchResult struct {
+	Plan search.Plan `json:"plan"`
+	cursor.Page
+}
+
+func NewSearchHandler(searcher *search.Searcher) *SearchHandler {
+	return &SearchHandler{searcher}
+}
+
+func (h *SearchHandler) InitRoutes(r *mux.Router) {
+	r.HandleFunc("/search", h.search).Methods(http.MethodGet).Name("/search")
+}
+
+func (h *SearchHandler) search(w http.ResponseWriter, r *http.Request) {
+	responder := Respond(r)
+	c := cursor.DecodeFromRequest(r)
+	q, err := search.Parse(r.FormValue("q"))
+	if err != nil {
+		responder.WithError(w, http.StatusBadRequest, err)
+		return
+	}
+	plan, photos, hasMore, err := h.searcher.Search(r.Context(), q, c.Start, c.PageSize)
+	if err != nil {
+		responder.WithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	v := make([]views.Photo, len(photos))
+	for i, p := range photos {
+		v[i] = views.PhotoFrom(p)
+	}
+	responder.WithJSON(w, http.StatusOK, searchResult{
+		Plan: plan,
+		Page: cursor.PageFor(v, c, hasMore),
+	})
+}
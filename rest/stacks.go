@@ -0,0 +1,153 @@
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"bitbucket.org/kleinnic74/photos/library"
+	"bitbucket.org/kleinnic74/photos/library/boltstore"
+	"bitbucket.org/kleinnic74/photos/rest/cursor"
+	"bitbucket.org/kleinnic74/photos/rest/views"
+	"github.com/gorilla/mux"
+)
+
+type StacksHandler struct {
+	stacks *boltstore.StackIndex
+	lib    library.PhotoLibrary
+}
+
+type stackRequest struct {
+	Photos         []library.PhotoID `json:"photos,omitempty"`
+	Representative library.PhotoID   `json:"representative,omitempty"`
+}
+
+func NewStacksHandler(stacks *boltstore.StackIndex, lib library.PhotoLibrary) *StacksHandler {
+	return &StacksHandler{stacks, lib}
+}
+
+func (h *StacksHandler) InitRoutes(r *mux.Router) {
+	r.HandleFunc("/stacks", h.listStacks).Methods(http.MethodGet)
+	r.HandleFunc("/stacks", h.createStack).Methods(http.MethodPost)
+	r.HandleFunc("/stacks/{id}", h.getStack).Methods(http.MethodGet)
+	r.HandleFunc("/stacks/{id}", h.updateStack).Methods(http.MethodPatch)
+	r.HandleFunc("/stacks/{id}", h.deleteStack).Methods(http.MethodDelete)
+	r.HandleFunc("/stacks/{id}/photos", h.photosForStack).Methods(http.MethodGet)
+}
+
+func (h *StacksHandler) listStacks(w http.ResponseWriter, r *http.Request) {
+	page := cursor.DecodeFromRequest(r)
+	responder := Respond(r)
+	stacks, hasMore, err := h.stacks.FindPaged(r.Context(), page.Start, page.PageSize)
+	if err != nil {
+		responder.WithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	v := make([]views.Stack, len(stacks))
+	for i := range stacks {
+		v[i] = views.StackFrom(&stacks[i])
+	}
+	responder.WithJSON(w, http.StatusOK, cursor.PageFor(v, page, hasMore))
+}
+
+// createStack stacks the given photos manually, photos are removed from their previous stack
+func (h *StacksHandler) createStack(w http.ResponseWriter, r *http.Request) {
+	req, ok := h.decodeStack(w, r)
+	if !ok {
+		return
+	}
+	stack, err := h.stacks.Create(r.Context(), boltstore.ManualStack, req.Photos, req.Representative)
+	if err != nil {
+		respondWithStackError(w, r, err)
+		return
+	}
+	Respond(r).WithJSON(w, http.StatusCreated, views.StackFrom(stack))
+}
+
+func (h *StacksHandler) getStack(w http.ResponseWriter, r *http.Request) {
+	stack, err := h.stacks.Get(r.Context(), stackID(r))
+	h.respondWithStack(w, r, stack, err)
+}
+
+// updateStack changes the photos and/or the representative of a stack
+func (h *StacksHandler) updateStack(w http.ResponseWriter, r *http.Request) {
+	req, ok := h.decodeStack(w, r)
+	if !ok {
+		return
+	}
+	stack, err := h.stacks.Update(r.Context(), stackID(r), req.Photos, req.Representative)
+	h.respondWithStack(w, r, stack, err)
+}
+
+// deleteStack dissolves a stack, the photos are kept
+func (h *StacksHandler) deleteStack(w http.ResponseWriter, r *http.Request) {
+	if err := h.stacks.Delete(r.Context(), stackID(r)); err != nil {
+		respondWithStackError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *StacksHandler) photosForStack(w http.ResponseWriter, r *http.Request) {
+	stack, err := h.stacks.Get(r.Context(), stackID(r))
+	if err != nil {
+		respondWithStackError(w, r, err)
+		return
+	}
+	v := make([]views.Photo, 0, len(stack.Photos))
+	for _, p := range stack.Photos {
+		// Photos in the trash are not shown
+		if photo, err := h.lib.Get(r.Context(), p); err == nil {
+			v = append(v, views.PhotoFrom(photo).InStack(stack.ID))
+		}
+	}
+	Respond(r).WithJSON(w, http.StatusOK, v)
+}
+
+// decodeStack reads the photos and representative from the request and checks that all photos exist
+func (h *StacksHandler) decodeStack(w http.ResponseWriter, r *http.Request) (req stackRequest, ok bool) {
+	responder := Respond(r)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		responder.WithError(w, http.StatusBadRequest, err)
+		return
+	}
+	for _, id := range req.Photos {
+		if _, err := h.lib.Get(r.Context(), id); err != nil {
+			responder.WithError(w, http.StatusBadRequest, fmt.Errorf("No photo with id %s", id))
+			return
+		}
+	}
+	return req, true
+}
+
+func (h *StacksHandler) respondWithStack(w http.ResponseWriter, r *http.Request, stack *boltstore.Stack, err error) {
+	if err != nil {
+		respondWithStackError(w, r, err)
+		return
+	}
+	Respond(r).WithJSON(w, http.StatusOK, views.StackFrom(stack))
+}
+
+func respondWithStackError(w http.ResponseWriter, r *http.Request, err error) {
+	switch err.(type) {
+	case boltstore.ErrNoSuchStack:
+		Respond(r).WithError(w, http.StatusNotFound, err)
+	case boltstore.ErrPhotoNotInStack, boltstore.ErrStackTooSmall:
+		Respond(r).WithError(w, http.StatusBadRequest, err)
+	default:
+		respondWithLibraryError(w, r, err)
+	}
+}
+
+func stackID(r *http.Request) boltstore.StackID {
+	return boltstore.StackID(mux.Vars(r)["id"])
+}
+
+// photoViewIn returns the view of a photo with a link to the stack it belongs to, if any
+func photoViewIn(p *library.Photo, memberships map[library.PhotoID]boltstore.StackMembership) views.Photo {
+	v := views.PhotoFrom(p)
+	if m, found := memberships[p.ID]; found {
+		v = v.InStack(m.Stack)
+	}
+	return v
+}
@@ -0,0 +1,146 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"bitbucket.org/kleinnic74/photos/library"
+	"bitbucket.org/kleinnic74/photos/library/boltstore"
+	"bitbucket.org/kleinnic74/photos/rest/cursor"
+	"bitbucket.org/kleinnic74/photos/rest/views"
+	"github.com/gorilla/mux"
+)
+
+var (
+	errorNoTags = errors.New("No tags to add or remove")
+)
+
+type TagsHandler struct {
+	tags *boltstore.TagIndex
+	lib  library.PhotoLibrary
+}
+
+// tagsRequest adds and removes tags on photos, Photos is ignored when the
+// photo is given in the path
+type tagsRequest struct {
+	Photos []library.PhotoID `json:"photos,omitempty"`
+	Add    []string          `json:"add,omitempty"`
+	Remove []string          `json:"remove,omitempty"`
+}
+
+func NewTagsHandler(tags *boltstore.TagIndex, lib library.PhotoLibrary) *TagsHandler {
+	return &TagsHandler{tags, lib}
+}
+
+func (h *TagsHandler) InitRoutes(r *mux.Router) {
+	r.HandleFunc("/tags", h.listTags).Methods(http.MethodGet)
+	r.HandleFunc("/tags", h.updateTags).Methods(http.MethodPost)
+	r.HandleFunc("/tags/{tag}", h.photosForTag).Methods(http.MethodGet)
+	r.HandleFunc("/photos/{id}/tags", h.tagsOfPhoto).Methods(http.MethodGet)
+	r.HandleFunc("/photos/{id}/tags", h.updateTagsOfPhoto).Methods(http.MethodPost)
+}
+
+func (h *TagsHandler) listTags(w http.ResponseWriter, r *http.Request) {
+	page := cursor.DecodeFromRequest(r)
+	responder := Respond(r)
+	tags, err := h.tags.Tags(r.Context())
+	if err != nil {
+		responder.WithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	end := page.Start + page.PageSize
+	if end > len(tags) {
+		end = len(tags)
+	}
+	result := []boltstore.TagCount{}
+	if page.Start < end {
+		result = tags[page.Start:end]
+	}
+	responder.WithJSON(w, http.StatusOK, cursor.PageFor(result, page, end < len(tags)))
+}
+
+func (h *TagsHandler) photosForTag(w http.ResponseWriter, r *http.Request) {
+	responder := Respond(r)
+	page := cursor.DecodeFromRequest(r)
+	// Photos in the trash are not shown
+	photos, hasMore, next, err := existingPage(r.Context(), h.lib, func(start, max int) ([]library.PhotoID, bool, error) {
+		return h.tags.FindPhotosPaged(r.Context(), mux.Vars(r)["tag"], start, max)
+	}, page)
+	if err != nil {
+		responder.WithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	v := make([]views.Photo, len(photos))
+	for i, p := range photos {
+		v[i] = views.PhotoFrom(p)
+	}
+	responder.WithJSON(w, http.StatusOK, cursor.PageFor(v, page.ContinueAt(next), hasMore))
+}
+
+func (h *TagsHandler) tagsOfPhoto(w http.ResponseWriter, r *http.Request) {
+	responder := Respond(r)
+	id := library.PhotoID(mux.Vars(r)["id"])
+	if _, err := h.lib.Get(r.Context(), id); err != nil {
+		respondWithLibraryError(w, r, err)
+		return
+	}
+	tags, err := h.tags.TagsOf(r.Context(), id)
+	if err != nil {
+		responder.WithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if tags == nil {
+		tags = []string{}
+	}
+	responder.WithJSON(w, http.StatusOK, tags)
+}
+
+func (h *TagsHandler) updateTags(w http.ResponseWriter, r *http.Request) {
+	var req tagsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		Respond(r).WithError(w, http.StatusBadRequest, err)
+		return
+	}
+	h.applyTags(w, r, req.Photos, req)
+}
+
+func (h *TagsHandler) updateTagsOfPhoto(w http.ResponseWriter, r *http.Request) {
+	var req tagsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		Respond(r).WithError(w, http.StatusBadRequest, err)
+		return
+	}
+	id := library.PhotoID(mux.Vars(r)["id"])
+	h.applyTags(w, r, []library.PhotoID{id}, req)
+}
+
+// applyTags adds and removes the tags of the request on all given photos. All photos are
+// checked to exist before any change is made
+func (h *TagsHandler) applyTags(w http.ResponseWriter, r *http.Request, ids []library.PhotoID, req tagsRequest) {
+	responder := Respond(r)
+	if len(req.Add) == 0 && len(req.Remove) == 0 {
+		responder.WithError(w, http.StatusBadRequest, errorNoTags)
+		return
+	}
+	photos := make([]*library.Photo, len(ids))
+	for i, id := range ids {
+		photo, err := h.lib.Get(r.Context(), id)
+		if err != nil {
+			respondWithLibraryError(w, r, err)
+			return
+		}
+		photos[i] = photo
+	}
+	for _, p := range photos {
+		if err := h.tags.RemoveTags(r.Context(), p.ExtendedPhotoID, req.Remove); err != nil {
+			responder.WithError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if err := h.tags.AddTags(r.Context(), p.ExtendedPhotoID, req.Add); err != nil {
+			responder.WithError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -3,6 +3,7 @@ package rest
 import (
 	"fmt"
 	"net/http"
+	"strconv"
 
 	"bitbucket.org/kleinnic74/photos/domain"
 	"bitbucket.org/kleinnic74/photos/logging"
@@ -33,6 +34,16 @@ func (t *ThumberAPI) createThumb(w http.ResponseWriter, r *http.Request) {
 	}
 	s := mux.Vars(r)["size"]
 	size, found := domain.ThumbSizes[s]
+	if width, err := strconv.Atoi(r.FormValue("width")); err == nil && width > 0 {
+		// Sizes configured on the requesting instance only, but not larger than the sizes
+		// configured here so that the thumb fits in memory
+		if width > domain.MaxThumbWidth() {
+			log.Warn("Thumb too large", zap.Int("width", width))
+			Respond(r).WithError(w, http.StatusBadRequest, fmt.Errorf("Thumb width %d larger than %d", width, domain.MaxThumbWidth()))
+			return
+		}
+		size, found = domain.NewThumbSize(s, width, r.FormValue("square") == "true"), true
+	}
 	if !found {
 		log.Warn("Invalid thumb size", zap.String("size", s))
 		Respond(r).WithError(w, http.StatusBadRequest, fmt.Errorf("Invalid thumb size '%s'", s))
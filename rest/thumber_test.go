@@ -0,0 +1,39 @@
+package rest
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"bitbucket.org/kleinnic74/photos/domain"
+	"github.com/gorilla/mux"
+)
+
+func TestCreateThumbWithWidth(t *testing.T) {
+	router := mux.NewRouter()
+	NewThumberAPI(domain.LocalThumber{}).InitRoutes(router)
+	var img bytes.Buffer
+	if err := jpeg.Encode(&img, image.NewGray(image.Rect(0, 0, 400, 300)), nil); err != nil {
+		t.Fatal(err)
+	}
+	data := []struct {
+		width    int
+		expected int
+	}{
+		{200, http.StatusOK},
+		{domain.MaxThumbWidth(), http.StatusOK},
+		{domain.MaxThumbWidth() + 1, http.StatusBadRequest},
+		{100000000, http.StatusBadRequest},
+	}
+	for _, d := range data {
+		req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("/thumb/jpg/XS?width=%d", d.width), bytes.NewReader(img.Bytes()))
+		req.Header.Set("Content-Type", "image/jpeg")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		checkResponseCode(t, d.expected, rr.Result())
+	}
+}
@@ -5,14 +5,16 @@ import (
 	"time"
 
 	"bitbucket.org/kleinnic74/photos/library"
+	"bitbucket.org/kleinnic74/photos/library/boltstore"
 	"bitbucket.org/kleinnic74/photos/rest/cursor"
 	"bitbucket.org/kleinnic74/photos/rest/views"
 	"github.com/gorilla/mux"
 )
 
 type TimelineHandler struct {
-	index library.DateIndex
-	lib   library.PhotoLibrary
+	index  library.DateIndex
+	lib    library.PhotoLibrary
+	stacks *boltstore.StackIndex
 }
 
 func NewTimelineHandler(index library.DateIndex, lib library.PhotoLibrary) *TimelineHandler {
@@ -22,6 +24,11 @@ func NewTimelineHandler(index library.DateIndex, lib library.PhotoLibrary) *Time
 	}
 }
 
+// UseStacks collapses stacks to their representative in the timeline unless 'expanded' is true
+func (dates *TimelineHandler) UseStacks(stacks *boltstore.StackIndex) {
+	dates.stacks = stacks
+}
+
 func (dates *TimelineHandler) InitRoutes(r *mux.Router) {
 	r.HandleFunc("/timeline/photos", dates.getTimelineForward).Methods("GET").Name("/timeline/photos")
 	r.HandleFunc("/timeline/index", dates.getTimelineIndex).Methods("GET").Name("/timeline/index")
@@ -35,18 +42,29 @@ func (dates *TimelineHandler) getTimelineForward(w http.ResponseWriter, r *http.
 	c := cursor.DecodeFromRequest(r)
 	from := parseDateOrDefault(r.FormValue("from"), time.Time{})
 	to := parseDateOrDefault(r.FormValue("to"), time.Now())
-	ids, hasMore, err := dates.index.FindRangePaged(ctx, from, to, c.Start, c.PageSize)
+	filter, err := filterFromRequest(r)
+	if err != nil {
+		responder.WithError(w, http.StatusBadRequest, err)
+		return
+	}
+	filter.collapseStacks(ctx, dates.stacks)
+	photos, hasMore, next, err := filter.page(idSource(ctx, dates.lib, func(start, max int) ([]library.PhotoID, bool, error) {
+		return dates.index.FindRangePaged(ctx, from, to, start, max)
+	}), c)
+	if err != nil {
+		responder.WithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	memberships, err := stackMemberships(ctx, dates.stacks, photos)
 	if err != nil {
 		responder.WithError(w, http.StatusInternalServerError, err)
 		return
 	}
 	var photoViews []views.Photo
-	for _, id := range ids {
-		if p, err := dates.lib.Get(ctx, id); err == nil {
-			photoViews = append(photoViews, views.PhotoFrom(p))
-		}
+	for _, p := range photos {
+		photoViews = append(photoViews, photoViewIn(p, memberships))
 	}
-	responder.WithJSON(w, http.StatusOK, cursor.PageFor(photoViews, c, hasMore))
+	responder.WithJSON(w, http.StatusOK, cursor.PageFor(photoViews, c.ContinueAt(next), hasMore))
 }
 
 func (dates *TimelineHandler) getTimelineIndex(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,34 @@
+package views
+
+import (
+	"fmt"
+	"time"
+
+	"bitbucket.org/kleinnic74/photos/library/boltstore"
+)
+
+type Album struct {
+	ID      boltstore.AlbumID `json:"id"`
+	Links   Links             `json:"links"`
+	Name    string            `json:"name"`
+	Count   int               `json:"count"`
+	Created time.Time         `json:"created"`
+}
+
+// AlbumFrom returns the view of the given album, the cover is linked to the thumb of the cover photo
+func AlbumFrom(a *boltstore.Album) Album {
+	links := Links{
+		"self":   fmt.Sprintf("/albums/%s", a.ID),
+		"photos": fmt.Sprintf("/albums/%s/photos", a.ID),
+	}
+	if a.Cover != "" {
+		links.Add("cover", PhotoLinksFor(a.Cover)["thumb"])
+	}
+	return Album{
+		ID:      a.ID,
+		Links:   links,
+		Name:    a.Name,
+		Count:   a.Count,
+		Created: a.Created,
+	}
+}
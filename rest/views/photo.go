@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"time"
 
+	"bitbucket.org/kleinnic74/photos/domain"
 	"bitbucket.org/kleinnic74/photos/domain/gps"
 	"bitbucket.org/kleinnic74/photos/library"
 )
@@ -29,6 +30,55 @@ type Photo struct {
 	Hash      string           `json:"hash,omitempty"`
 	DateTaken time.Time        `json:"dateTaken,omitempty"`
 	Location  *gps.Coordinates `json:"location,omitempty"`
+	Rating    int              `json:"rating,omitempty"`
+	Favorite  bool             `json:"favorite,omitempty"`
+	Rejected  bool             `json:"rejected,omitempty"`
+	Trashed   *time.Time       `json:"trashed,omitempty"`
+	Video     *Video           `json:"video,omitempty"`
+	Camera    *Camera          `json:"camera,omitempty"`
+
+	// Width and Height are the pixel dimensions as displayed, omitted if unknown
+	Width       int     `json:"width,omitempty"`
+	Height      int     `json:"height,omitempty"`
+	AspectRatio float64 `json:"aspectRatio,omitempty"`
+
+	// TimeZoneOffset is the UTC offset in seconds of DateTaken, omitted if unknown
+	TimeZoneOffset *int `json:"tzOffset,omitempty"`
+}
+
+// Camera contains the camera meta-data of a photo with the name of the camera as used by /cameras
+type Camera struct {
+	Name string `json:"name,omitempty"`
+	domain.CameraMetaData
+}
+
+func cameraFrom(p *library.Photo) *Camera {
+	if p.Camera == nil {
+		return nil
+	}
+	return &Camera{Name: p.Camera.Name(), CameraMetaData: *p.Camera}
+}
+
+// Video contains the technical meta-data of a video, the duration is in seconds
+type Video struct {
+	Duration float64 `json:"duration"`
+	Width    int     `json:"width,omitempty"`
+	Height   int     `json:"height,omitempty"`
+	Codec    string  `json:"codec,omitempty"`
+	Rotation int     `json:"rotation,omitempty"`
+}
+
+func videoFrom(p *library.Photo) *Video {
+	if p.Video == nil {
+		return nil
+	}
+	return &Video{
+		Duration: p.Video.Duration.Seconds(),
+		Width:    p.Video.Width,
+		Height:   p.Video.Height,
+		Codec:    p.Video.Codec,
+		Rotation: p.Video.Rotation,
+	}
 }
 
 type LinkProvider struct {
@@ -43,17 +93,62 @@ func (p LinkProvider) LinksFor(photo library.PhotoID) Links {
 	return links
 }
 
+// PhotoFrom returns the view of a photo, Live Photos have a 'live' link to their video
 func PhotoFrom(p *library.Photo) Photo {
+	links := PhotoLinksFor(p.ID)
+	if p.LiveVideo != "" {
+		links.Add("live", PhotoLinksFor(p.LiveVideo)["view"])
+	}
 	return Photo{
 		ID:        p.ID,
-		Links:     PhotoLinksFor(p.ID),
+		Links:     links,
 		Name:      p.Name(),
 		Hash:      p.Hash.String(),
 		DateTaken: p.DateTaken,
 		Location:  p.Location,
+		Rating:    p.Rating,
+		Favorite:  p.Favorite,
+		Rejected:  p.Rejected,
+		Video:     videoFrom(p),
+		Camera:    cameraFrom(p),
+
+		Width:       p.Width,
+		Height:      p.Height,
+		AspectRatio: p.AspectRatio(),
+
+		TimeZoneOffset: p.TimeZoneOffset,
 	}
 }
 
+// TrashedPhotoFrom returns the view of a photo that is in the trash
+func TrashedPhotoFrom(p *library.Photo) Photo {
+	trashed := p.TrashedAt
+	return Photo{
+		ID:        p.ID,
+		Links:     trashLinks.LinksFor(p.ID),
+		Name:      p.Name(),
+		Hash:      p.Hash.String(),
+		DateTaken: p.DateTaken,
+		Location:  p.Location,
+		Trashed:   &trashed,
+		Video:     videoFrom(p),
+		Camera:    cameraFrom(p),
+
+		Width:       p.Width,
+		Height:      p.Height,
+		AspectRatio: p.AspectRatio(),
+
+		TimeZoneOffset: p.TimeZoneOffset,
+	}
+}
+
+var trashLinks = LinkProvider{
+	patterns: map[string]string{
+		"restore": "/trash/%s/restore",
+		"delete":  "/trash/%s",
+	},
+}
+
 var photoLinks = LinkProvider{
 	patterns: map[string]string{
 		"self":  "/photos/%s",
@@ -0,0 +1,46 @@
+package views
+
+import (
+	"fmt"
+	"time"
+
+	"bitbucket.org/kleinnic74/photos/library"
+	"bitbucket.org/kleinnic74/photos/library/boltstore"
+)
+
+type Stack struct {
+	ID             boltstore.StackID   `json:"id"`
+	Links          Links               `json:"links"`
+	Kind           boltstore.StackKind `json:"kind"`
+	Representative library.PhotoID     `json:"representative"`
+	Photos         []library.PhotoID   `json:"photos"`
+	Created        time.Time           `json:"created"`
+}
+
+// StackFrom returns the view of the given stack, the cover is linked to the thumb of the representative
+func StackFrom(s *boltstore.Stack) Stack {
+	links := Links{
+		"self":   StackLinkFor(s.ID),
+		"photos": fmt.Sprintf("/stacks/%s/photos", s.ID),
+		"cover":  PhotoLinksFor(s.Representative)["thumb"],
+	}
+	return Stack{
+		ID:             s.ID,
+		Links:          links,
+		Kind:           s.Kind,
+		Representative: s.Representative,
+		Photos:         s.Photos,
+		Created:        s.Created,
+	}
+}
+
+// StackLinkFor returns the link to the stack with the given id
+func StackLinkFor(id boltstore.StackID) string {
+	return fmt.Sprintf("/stacks/%s", id)
+}
+
+// InStack returns this view with a link to the stack the photo belongs to
+func (p Photo) InStack(id boltstore.StackID) Photo {
+	p.Links.Add("stack", StackLinkFor(id))
+	return p
+}
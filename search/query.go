@@ -0,0 +1,211 @@
+// Package search implements a small query language to find photos by combining
+// the date, geo and tag indexes with the attributes of the photos
+package search
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"bitbucket.org/kleinnic74/photos/domain"
+	"bitbucket.org/kleinnic74/photos/domain/gps"
+)
+
+// Query is a parsed search query. A query is a list of space separated terms of the
+// form key:value, values containing spaces can be quoted. Terms without key are matched
+// against the name and the keywords of the photos. Dates are calendar days where the photos
+// were taken. Supported keys are:
+//
+//	country:CH           photos taken in the country with the given ISO code
+//	place:<id>           photos taken at the place with the given ID
+//	after:2019-06        photos taken on or after the start of the given year, month or day
+//	before:2020          photos taken before the start of the given year, month or day
+//	date:2019-06-14      photos taken during the given year, month or day
+//	format:mov           photos with the given file format
+//	type:video           photos of the given media type, either photo or video
+//	tag:beach            photos with the given tag
+//	rating:3             photos with at least the given rating
+//	favorite:true        favorite photos only
+type Query struct {
+	Country   gps.CountryID
+	Place     gps.PlaceID
+	After     time.Time
+	Before    time.Time
+	Formats   []string
+	Type      *domain.MediaType
+	Tags      []string
+	MinRating int
+	Favorite  bool
+	Text      []string
+}
+
+// ErrInvalidQuery indicates a syntax error in a query
+type ErrInvalidQuery string
+
+func (e ErrInvalidQuery) Error() string {
+	return string(e)
+}
+
+func invalidQuery(format string, args ...interface{}) error {
+	return ErrInvalidQuery(fmt.Sprintf(format, args...))
+}
+
+// Parse parses the given query string
+func Parse(query string) (q Query, err error) {
+	terms, err := tokenize(query)
+	if err != nil {
+		return
+	}
+	for _, term := range terms {
+		if term.key == "" {
+			q.Text = append(q.Text, strings.ToLower(term.value))
+			continue
+		}
+		if term.value == "" {
+			return q, invalidQuery("Missing value for '%s'", term.key)
+		}
+		if err = q.set(term.key, term.value); err != nil {
+			return
+		}
+	}
+	if !q.After.IsZero() && !q.Before.IsZero() && !q.After.Before(q.Before) {
+		return q, invalidQuery("Empty date range: %s - %s", q.After.Format("2006-01-02"), q.Before.Format("2006-01-02"))
+	}
+	return
+}
+
+func (q *Query) set(key, value string) error {
+	switch strings.ToLower(key) {
+	case "country":
+		q.Country = gps.CountryIDFromString(value)
+	case "place":
+		q.Place = gps.PlaceID(value)
+	case "after":
+		from, _, err := parsePeriod(value)
+		if err != nil {
+			return err
+		}
+		q.After = latest(q.After, from)
+	case "before":
+		to, _, err := parsePeriod(value)
+		if err != nil {
+			return err
+		}
+		q.Before = earliest(q.Before, to)
+	case "date":
+		from, to, err := parsePeriod(value)
+		if err != nil {
+			return err
+		}
+		q.After, q.Before = latest(q.After, from), earliest(q.Before, to)
+	case "format":
+		f, found := domain.FormatForExt(strings.ToLower(value))
+		if !found {
+			return invalidQuery("Unknown format '%s'", value)
+		}
+		q.Formats = append(q.Formats, f.ID())
+	case "type":
+		var t domain.MediaType
+		switch strings.ToLower(value) {
+		case "photo", "picture":
+			t = domain.Picture
+		case "video":
+			t = domain.Video
+		default:
+			return invalidQuery("Unknown type '%s'", value)
+		}
+		q.Type = &t
+	case "tag":
+		q.Tags = append(q.Tags, value)
+	case "rating":
+		rating, err := strconv.Atoi(value)
+		if err != nil || rating < 0 || rating > 5 {
+			return invalidQuery("Invalid rating '%s'", value)
+		}
+		q.MinRating = rating
+	case "favorite":
+		favorite, err := strconv.ParseBool(value)
+		if err != nil {
+			return invalidQuery("Invalid value for favorite '%s'", value)
+		}
+		q.Favorite = favorite
+	default:
+		return invalidQuery("Unknown search key '%s'", key)
+	}
+	return nil
+}
+
+// parsePeriod parses a year, month or day and returns the start of the period and the start
+// of the following period
+func parsePeriod(value string) (from, to time.Time, err error) {
+	layouts := []struct {
+		layout string
+		next   func(time.Time) time.Time
+	}{
+		{"2006-01-02", func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }},
+		{"2006-01", func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }},
+		{"2006", func(t time.Time) time.Time { return t.AddDate(1, 0, 0) }},
+	}
+	for _, l := range layouts {
+		if from, err = time.Parse(l.layout, value); err == nil {
+			return from, l.next(from), nil
+		}
+	}
+	return from, to, invalidQuery("Invalid date '%s', expected YYYY, YYYY-MM or YYYY-MM-DD", value)
+}
+
+func latest(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+func earliest(a, b time.Time) time.Time {
+	if a.IsZero() || b.Before(a) {
+		return b
+	}
+	return a
+}
+
+type term struct {
+	key, value string
+}
+
+// tokenize splits the query into terms, double quotes can be used around values
+func tokenize(query string) (terms []term, err error) {
+	runes := []rune(query)
+	for i := 0; i < len(runes); {
+		if unicode.IsSpace(runes[i]) {
+			i++
+			continue
+		}
+		var t term
+		var current strings.Builder
+		quoted := false
+		for ; i < len(runes); i++ {
+			r := runes[i]
+			if r == '"' {
+				quoted = !quoted
+				continue
+			}
+			if !quoted && unicode.IsSpace(r) {
+				break
+			}
+			if !quoted && r == ':' && t.key == "" {
+				t.key = current.String()
+				current.Reset()
+				continue
+			}
+			current.WriteRune(r)
+		}
+		if quoted {
+			return nil, invalidQuery("Unterminated quote in '%s'", query)
+		}
+		t.value = current.String()
+		terms = append(terms, t)
+	}
+	return
+}
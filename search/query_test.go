@@ -0,0 +1,99 @@
+package search
+
+import (
+	"testing"
+	"time"
+
+	"bitbucket.org/kleinnic74/photos/domain"
+	"bitbucket.org/kleinnic74/photos/domain/gps"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	video := domain.Video
+	data := []struct {
+		query    string
+		expected Query
+	}{
+		{"", Query{}},
+		{"country:CH after:2019-06 format:mov", Query{
+			Country: gps.CountryID("ch"),
+			After:   date("2019-06-01"),
+			Formats: []string{"mov"},
+		}},
+		{"date:2019 before:2019-03-15", Query{
+			After:  date("2019-01-01"),
+			Before: date("2019-03-15"),
+		}},
+		{`tag:"new york" tag:beach rating:3 favorite:true`, Query{
+			Tags:      []string{"new york", "beach"},
+			MinRating: 3,
+			Favorite:  true,
+		}},
+		{"type:video  IMG_12", Query{
+			Type: &video,
+			Text: []string{"img_12"},
+		}},
+		{"place:ch/8000", Query{Place: gps.PlaceID("ch/8000")}},
+	}
+	for _, d := range data {
+		t.Run(d.query, func(t *testing.T) {
+			q, err := Parse(d.query)
+			if err != nil {
+				t.Fatalf("Failed to parse: %s", err)
+			}
+			assert.Equal(t, d.expected, q)
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	queries := []string{
+		"unknown:value",
+		"after:June",
+		"format:xyz",
+		"rating:7",
+		`tag:"unterminated`,
+		"after:2020 before:2019",
+		"country:",
+	}
+	for _, query := range queries {
+		if _, err := Parse(query); err == nil {
+			t.Errorf("Expected error for '%s'", query)
+		}
+	}
+}
+
+func TestPlanSource(t *testing.T) {
+	s := NewSearcher(nil, nil, nil, nil)
+	data := []struct {
+		query   string
+		source  string
+		filters []string
+	}{
+		{"", "library", nil},
+		{"country:CH after:2019-06 format:mov", "geo.country(ch)", []string{"date>=2019-06-01T00:00:00Z", "format in (mov)"}},
+		{"after:2019-06-01 before:2019-06-03", "dates(2019-06-01..2019-06-02)", []string{"date>=2019-06-01T00:00:00Z,date<2019-06-03T00:00:00Z"}},
+		{"tag:beach tag:sunset", "tags(beach)", []string{"tag=sunset"}},
+		{"place:ch/8000 country:ch rating:2", "geo.place(ch/8000)", []string{"country=ch", "rating>=2"}},
+	}
+	for _, d := range data {
+		t.Run(d.query, func(t *testing.T) {
+			q, err := Parse(d.query)
+			if err != nil {
+				t.Fatalf("Failed to parse: %s", err)
+			}
+			plan := s.Plan(q)
+			assert.Equal(t, d.source, plan.Source)
+			assert.Equal(t, d.filters, plan.Filters)
+		})
+	}
+}
+
+func date(s string) time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
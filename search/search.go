@@ -0,0 +1,295 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"bitbucket.org/kleinnic74/photos/consts"
+	"bitbucket.org/kleinnic74/photos/library"
+	"bitbucket.org/kleinnic74/photos/logging"
+	"go.uber.org/zap"
+)
+
+// batchSize is the number of photo IDs fetched at once from the source of a plan
+const batchSize = 100
+
+// TagIndex is the part of the tag index used for searching
+type TagIndex interface {
+	FindPhotosPaged(ctx context.Context, tag string, start, max int) ([]library.PhotoID, bool, error)
+	TagsOf(ctx context.Context, id library.PhotoID) ([]string, error)
+}
+
+// Plan describes how a query is executed: photos are read from one source, usually the most
+// selective index, and all other constraints of the query are checked on each photo
+type Plan struct {
+	Source  string   `json:"source"`
+	Filters []string `json:"filters,omitempty"`
+
+	source  pageSource
+	filters []filter
+}
+
+type pageSource func(ctx context.Context, start, max int) ([]*library.Photo, bool, error)
+
+type filter struct {
+	description string
+	matches     func(ctx context.Context, p *library.Photo) (bool, error)
+}
+
+// Searcher executes queries against the library and its indexes
+type Searcher struct {
+	lib   library.PhotoLibrary
+	dates library.DateIndex
+	geo   library.GeoIndex
+	tags  TagIndex
+}
+
+func NewSearcher(lib library.PhotoLibrary, dates library.DateIndex, geo library.GeoIndex, tags TagIndex) *Searcher {
+	return &Searcher{
+		lib:   lib,
+		dates: dates,
+		geo:   geo,
+		tags:  tags,
+	}
+}
+
+// Search executes the given query and returns the page of matching photos with the plan used
+func (s *Searcher) Search(ctx context.Context, q Query, start, pageSize int) (Plan, []*library.Photo, bool, error) {
+	plan := s.Plan(q)
+	logging.From(ctx).Debug("Search", zap.String("source", plan.Source), zap.Strings("filters", plan.Filters))
+	photos, hasMore, err := plan.execute(ctx, start, pageSize)
+	return plan, photos, hasMore, err
+}
+
+// Plan selects the source of photos for the query. Sources are preferred in this order: place,
+// country, tag, date range and finally a scan of the whole library
+func (s *Searcher) Plan(q Query) (plan Plan) {
+	tags := q.Tags
+	switch {
+	case q.Place != "":
+		plan.Source = fmt.Sprintf("geo.place(%s)", q.Place)
+		plan.source = s.idSource(func(ctx context.Context, start, max int) ([]library.PhotoID, bool, error) {
+			return s.geo.FindByPlacePaged(ctx, q.Place, start, max)
+		})
+		if q.Country != "" {
+			plan.addFilter(s.countryFilter(q))
+		}
+	case q.Country != "":
+		plan.Source = fmt.Sprintf("geo.country(%s)", q.Country)
+		plan.source = s.idSource(func(ctx context.Context, start, max int) ([]library.PhotoID, bool, error) {
+			return s.geo.FindByCountryPaged(ctx, q.Country, start, max)
+		})
+	case len(tags) > 0:
+		tag := tags[0]
+		tags = tags[1:]
+		plan.Source = fmt.Sprintf("tags(%s)", tag)
+		plan.source = s.idSource(func(ctx context.Context, start, max int) ([]library.PhotoID, bool, error) {
+			return s.tags.FindPhotosPaged(ctx, tag, start, max)
+		})
+	case !q.After.IsZero():
+		to := q.Before
+		if to.IsZero() {
+			to = time.Now()
+		}
+		// The date index includes the whole last day
+		to = to.Add(-time.Nanosecond)
+		plan.Source = fmt.Sprintf("dates(%s..%s)", q.After.Format("2006-01-02"), to.Format("2006-01-02"))
+		plan.source = s.idSource(func(ctx context.Context, start, max int) ([]library.PhotoID, bool, error) {
+			return s.dates.FindRangePaged(ctx, q.After, to, start, max)
+		})
+	default:
+		plan.Source = "library"
+		plan.source = func(ctx context.Context, start, max int) ([]*library.Photo, bool, error) {
+			return s.lib.FindAllPaged(ctx, start, max, consts.Ascending)
+		}
+	}
+	if !q.After.IsZero() || !q.Before.IsZero() {
+		plan.addFilter(dateFilter(q))
+	}
+	for _, tag := range tags {
+		plan.addFilter(s.tagFilter(tag))
+	}
+	if len(q.Formats) > 0 {
+		plan.addFilter(formatFilter(q.Formats))
+	}
+	if q.Type != nil {
+		t := *q.Type
+		plan.addFilter(filter{
+			description: fmt.Sprintf("type=%d", t),
+			matches: func(ctx context.Context, p *library.Photo) (bool, error) {
+				return p.Format.Type() == t, nil
+			},
+		})
+	}
+	if q.MinRating > 0 {
+		plan.addFilter(filter{
+			description: fmt.Sprintf("rating>=%d", q.MinRating),
+			matches: func(ctx context.Context, p *library.Photo) (bool, error) {
+				return p.Rating >= q.MinRating, nil
+			},
+		})
+	}
+	if q.Favorite {
+		plan.addFilter(filter{
+			description: "favorite",
+			matches: func(ctx context.Context, p *library.Photo) (bool, error) {
+				return p.Favorite, nil
+			},
+		})
+	}
+	for _, text := range q.Text {
+		plan.addFilter(textFilter(text))
+	}
+	return
+}
+
+func (plan *Plan) addFilter(f filter) {
+	plan.filters = append(plan.filters, f)
+	plan.Filters = append(plan.Filters, f.description)
+}
+
+// execute reads photos from the source of the plan and returns the page of photos matching
+// all filters, start and pageSize are relative to the matching photos
+func (plan Plan) execute(ctx context.Context, start, pageSize int) (photos []*library.Photo, hasMore bool, err error) {
+	skipped := 0
+	for offset := 0; ; offset += batchSize {
+		batch, more, err := plan.source(ctx, offset, batchSize)
+		if err != nil {
+			return nil, false, err
+		}
+		for _, p := range batch {
+			matches, err := plan.matches(ctx, p)
+			if err != nil {
+				return nil, false, err
+			}
+			if !matches {
+				continue
+			}
+			if skipped < start {
+				skipped++
+				continue
+			}
+			if len(photos) == pageSize {
+				return photos, true, nil
+			}
+			photos = append(photos, p)
+		}
+		if !more {
+			return photos, false, nil
+		}
+	}
+}
+
+func (plan Plan) matches(ctx context.Context, p *library.Photo) (bool, error) {
+	for _, f := range plan.filters {
+		if ok, err := f.matches(ctx, p); err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// idSource resolves the photo IDs returned by an index, photos no longer in the library are skipped
+func (s *Searcher) idSource(ids func(ctx context.Context, start, max int) ([]library.PhotoID, bool, error)) pageSource {
+	return func(ctx context.Context, start, max int) ([]*library.Photo, bool, error) {
+		page, hasMore, err := ids(ctx, start, max)
+		if err != nil {
+			return nil, false, err
+		}
+		photos := make([]*library.Photo, 0, len(page))
+		for _, id := range page {
+			if p, err := s.lib.Get(ctx, id); err == nil {
+				photos = append(photos, p)
+			}
+		}
+		return photos, hasMore, nil
+	}
+}
+
+func (s *Searcher) countryFilter(q Query) filter {
+	return filter{
+		description: fmt.Sprintf("country=%s", q.Country),
+		matches: func(ctx context.Context, p *library.Photo) (bool, error) {
+			address, found, err := s.geo.Get(ctx, p.ID)
+			if err != nil || !found {
+				return false, err
+			}
+			return address.Country.ID == q.Country, nil
+		},
+	}
+}
+
+func (s *Searcher) tagFilter(tag string) filter {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	return filter{
+		description: fmt.Sprintf("tag=%s", tag),
+		matches: func(ctx context.Context, p *library.Photo) (bool, error) {
+			tags, err := s.tags.TagsOf(ctx, p.ID)
+			if err != nil {
+				return false, err
+			}
+			for _, t := range tags {
+				if t == tag {
+					return true, nil
+				}
+			}
+			return false, nil
+		},
+	}
+}
+
+func dateFilter(q Query) filter {
+	var conditions []string
+	if !q.After.IsZero() {
+		conditions = append(conditions, fmt.Sprintf("date>=%s", q.After.Format(time.RFC3339)))
+	}
+	if !q.Before.IsZero() {
+		conditions = append(conditions, fmt.Sprintf("date<%s", q.Before.Format(time.RFC3339)))
+	}
+	return filter{
+		description: strings.Join(conditions, ","),
+		matches: func(ctx context.Context, p *library.Photo) (bool, error) {
+			// Photos are dated by their local calendar day like in the date index
+			local := p.LocalDateTaken()
+			day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.UTC)
+			if !q.After.IsZero() && day.Before(q.After) {
+				return false, nil
+			}
+			return q.Before.IsZero() || day.Before(q.Before), nil
+		},
+	}
+}
+
+// textFilter matches photos with the given text in their name or in one of their keywords
+func textFilter(text string) filter {
+	return filter{
+		description: fmt.Sprintf("text~%s", text),
+		matches: func(ctx context.Context, p *library.Photo) (bool, error) {
+			if strings.Contains(strings.ToLower(p.Name()), text) {
+				return true, nil
+			}
+			for _, keyword := range p.Keywords {
+				if strings.Contains(strings.ToLower(keyword), text) {
+					return true, nil
+				}
+			}
+			return false, nil
+		},
+	}
+}
+
+func formatFilter(formats []string) filter {
+	return filter{
+		description: fmt.Sprintf("format in (%s)", strings.Join(formats, ",")),
+		matches: func(ctx context.Context, p *library.Photo) (bool, error) {
+			for _, f := range formats {
+				if p.Format.ID() == f {
+					return true, nil
+				}
+			}
+			return false, nil
+		},
+	}
+}
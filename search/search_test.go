@@ -0,0 +1,84 @@
+package search
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"bitbucket.org/kleinnic74/photos/domain"
+	"bitbucket.org/kleinnic74/photos/domain/gps"
+	"bitbucket.org/kleinnic74/photos/library"
+	"bitbucket.org/kleinnic74/photos/library/boltstore"
+	"bitbucket.org/kleinnic74/photos/library/librarytest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearch(t *testing.T) {
+	ctx := context.Background()
+	lib, _, db := librarytest.NewLibrary(t)
+	dates, err := boltstore.NewDateIndex(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lib.AddCallback(dates.Add)
+	geo, err := boltstore.NewBoltGeoIndex(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile("../domain/testdata/Canon_40D.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Taken on July 15th in Tokyo, which is still July 14th in UTC
+	tokyo := 9 * 3600
+	taken := time.Date(2024, 7, 15, 1, 30, 0, 0, time.FixedZone("", tokyo))
+	photo := librarytest.AddContent(t, lib, library.PhotoMeta{
+		Name:           "IMG_0001.JPG",
+		Format:         domain.MustFormatForExt("jpg"),
+		DateTaken:      taken,
+		TimeZoneOffset: &tokyo,
+		Keywords:       []string{"Sunset"},
+	}, content)
+	tokyoAddress := gps.AsAddress("Japan", "JP", "Tokyo", "100-0001")
+	if err := geo.Update(ctx, photo.ExtendedPhotoID, &tokyoAddress); err != nil {
+		t.Fatal(err)
+	}
+
+	searcher := NewSearcher(lib, dates, geo, nil)
+	data := []struct {
+		query string
+		found bool
+	}{
+		{"img_0001", true},
+		{"sunset", true},
+		{"beach", false},
+		{"date:2024-07-15", true},
+		{"date:2024-07-14", false},
+		{"after:2024-07-15 img", true},
+		{"before:2024-07-15 img", false},
+		{"country:jp", true},
+		{"country:fr", false},
+		{"place:jp_100-0001_tokyo country:jp", true},
+		{"place:jp_100-0001_tokyo country:fr", false},
+	}
+	for _, d := range data {
+		t.Run(d.query, func(t *testing.T) {
+			q, err := Parse(d.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, photos, _, err := searcher.Search(ctx, q, 0, 10)
+			if err != nil {
+				t.Fatalf("Search failed: %s", err)
+			}
+			if d.found {
+				if assert.Len(t, photos, 1) {
+					assert.Equal(t, photo.ID, photos[0].ID)
+				}
+			} else {
+				assert.Empty(t, photos)
+			}
+		})
+	}
+}
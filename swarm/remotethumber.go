@@ -55,7 +55,7 @@ func (t *remoteThumber) CreateThumb(in io.Reader, f domain.Format, o domain.Orie
 		}
 	}()
 
-	endpoint := fmt.Sprintf("%s/%s/%s", t.baseURL.String(), t.thumbFormat.ID(), size.Name)
+	endpoint := fmt.Sprintf("%s/%s/%s?width=%d&square=%t", t.baseURL.String(), t.thumbFormat.ID(), size.Name, size.Width(), size.IsSquare())
 	var r *http.Request
 	if r, err = http.NewRequest(http.MethodPost, endpoint, in); err != nil {
 		return
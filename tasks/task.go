@@ -22,6 +22,8 @@ type TaskInitFunc func() Task
 type TaskProperties struct {
 	RunOnStart   bool
 	UserRunnable bool
+	// RunEvery is the interval at which the task is launched periodically, zero disables periodic execution
+	RunEvery time.Duration `json:",omitempty"`
 }
 type TaskDefinition struct {
 	TaskProperties